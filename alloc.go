@@ -0,0 +1,97 @@
+package beatnik
+
+// Allocation of parsed hits in blocks.
+
+import (
+	"sync"
+)
+
+// Sizes of the blocks that hits are allocated in. Blocks start small, so that
+// short tracks stay small, and grow up to the largest size.
+const (
+	minHitBlock = 16
+	maxHitBlock = 256
+)
+
+// A HitBuffer holds parsed hits by value, in blocks of []Hit, for reuse by
+// programs that parse many tracks, like servers. Parsing with a buffer, see
+// ParseOptions.Hits, takes the track's hits from the buffer rather than
+// allocating each hit and its note map.
+//
+// After Reset, the buffer's hits are given to the following parses, so the
+// tracks that were parsed before must no longer be used. A buffer may be used
+// by one parse at a time.
+type HitBuffer struct {
+	mu     sync.Mutex
+	blocks [][]Hit
+	used   int // Number of blocks given since the last reset.
+}
+
+// Reset makes all the buffer's hits available to the following parses.
+func (b *HitBuffer) Reset() {
+	b.mu.Lock()
+	b.used = 0
+	b.mu.Unlock()
+}
+
+// Len returns the number of hits that the buffer holds.
+func (b *HitBuffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := 0
+	for _, block := range b.blocks {
+		n += len(block)
+	}
+	return n
+}
+
+// block returns a block of at least n hits that are not in use, reusing one
+// from before the last reset if there is one.
+func (b *HitBuffer) block(n int) []Hit {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.used == len(b.blocks) {
+		b.blocks = append(b.blocks, make([]Hit, n))
+	}
+	b.used++
+	return b.blocks[b.used-1]
+}
+
+// A hitSlab gives out the hits of one parser, a block at a time. Not safe for
+// concurrent use.
+type hitSlab struct {
+	buf   *HitBuffer // Where blocks come from, nil for new ones.
+	block []Hit      // Rest of the current block.
+	size  int        // Size of the last new block.
+}
+
+// new returns a hit whose fields are all empty, except for an empty Notes.
+func (s *hitSlab) new() *Hit {
+	if len(s.block) == 0 {
+		s.size *= 2
+		if s.size < minHitBlock {
+			s.size = minHitBlock
+		}
+		if s.size > maxHitBlock {
+			s.size = maxHitBlock
+		}
+		if s.buf != nil {
+			s.block = s.buf.block(maxHitBlock)
+		} else {
+			s.block = make([]Hit, s.size)
+		}
+	}
+	h := &s.block[0]
+	s.block = s.block[1:]
+
+	notes := h.Notes
+	if notes == nil {
+		notes = map[byte]Velocity{}
+	} else {
+		for k := range notes {
+			delete(notes, k)
+		}
+	}
+	*h = Hit{Notes: notes}
+	return h
+}
@@ -0,0 +1,81 @@
+package beatnik
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHitBuffer(t *testing.T) {
+	srcs := []string{
+		"K,HC. S-@3?50.. HC{a=1}. alias:x=T1 x,K+ (S..) S",
+		strings.Repeat("HC,K+. HC--.. HC.. HC,S.> ", 200),
+		"remap:K=S K,HC,S. [ HC K ]rev T1,T2?20",
+	}
+	buf := &HitBuffer{}
+	for _, src := range srcs {
+		want := mustParse(t, src)
+		for i := 0; i < 2; i++ {
+			buf.Reset()
+			got, err := ParseTrackWithOptions(src, ParseOptions{Hits: buf})
+			if err != nil {
+				t.Fatalf("ParseTrackWithOptions(%q) failed: %v", src, err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("ParseTrackWithOptions(%q)=%v, want %v", src, got, want)
+			}
+		}
+	}
+	if n := buf.Len(); n != 4*maxHitBlock {
+		t.Errorf("Len()=%v, want %v", n, 4*maxHitBlock)
+	}
+}
+
+func TestHitBuffer_keepsHits(t *testing.T) {
+	buf := &HitBuffer{}
+	opts := ParseOptions{Hits: buf}
+	a, err := ParseTrackWithOptions("K. S.", opts)
+	if err != nil {
+		t.Fatalf("ParseTrackWithOptions() failed: %v", err)
+	}
+	if _, err := ParseTrackWithOptions("HC. HC.", opts); err != nil {
+		t.Fatalf("ParseTrackWithOptions() failed: %v", err)
+	}
+	if want := mustParse(t, "K. S."); !reflect.DeepEqual(a, want) {
+		t.Errorf("track without reset=%v, want %v", a, want)
+	}
+}
+
+func TestHitSlab(t *testing.T) {
+	s := &hitSlab{}
+	var hits []*Hit
+	for i := 0; i < 1000; i++ {
+		h := s.new()
+		if !reflect.DeepEqual(h, &Hit{Notes: map[byte]Velocity{}}) {
+			t.Fatalf("new()=%v, want empty hit", h)
+		}
+		h.Notes[byte(i)] = F
+		h.T = uint(i)
+		hits = append(hits, h)
+	}
+	for i, h := range hits {
+		if h.T != uint(i) || len(h.Notes) != 1 {
+			t.Fatalf("hit #%v=%v, want T=%v with one note", i, h, i)
+		}
+	}
+	if s.size != maxHitBlock {
+		t.Errorf("size=%v, want %v", s.size, maxHitBlock)
+	}
+}
+
+func BenchmarkParseTrack_hitBuffer(b *testing.B) {
+	src := strings.Repeat("HC,K+. HC--.. HC.. HC,S.> HC~ (S--...) K.... ~ .\n", 1000)
+	buf := &HitBuffer{}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		if _, err := ParseTrackWithOptions(src, ParseOptions{Hits: buf}); err != nil {
+			b.Fatalf("ParseTrackWithOptions() failed: %v", err)
+		}
+	}
+}
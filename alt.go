@@ -0,0 +1,56 @@
+package beatnik
+
+// Notes that alternate between repetitions.
+
+import (
+	"strings"
+)
+
+// alts maps the notes of a hit that have alternatives, as in "alt(S|SR)", to
+// their alternatives. Each note is its first alternative.
+type alts map[byte][]byte
+
+// altNames returns the names in a note name with alternatives, like
+// "alt(S|SR)", or the name itself if it has none.
+func altNames(name string) []string {
+	if !strings.HasPrefix(name, "alt(") {
+		return []string{name}
+	}
+	return strings.Split(name[4:len(name)-1], "|")
+}
+
+// remap returns the alternatives with their notes rewritten according to m.
+func (a alts) remap(m map[byte]byte) alts {
+	if a == nil {
+		return nil
+	}
+	result := alts{}
+	for _, options := range a {
+		var mapped []byte
+		for _, o := range options {
+			if to, ok := m[o]; ok {
+				o = to
+			}
+			mapped = append(mapped, o)
+		}
+		result[mapped[0]] = mapped
+	}
+	return result
+}
+
+// alternate plays the k'th alternative of the notes of the hits in from,
+// in the hits of to, which are their copies. Alternatives are counted from 0
+// and repeat in cycles.
+func (p *parser) alternate(from, to []*Hit, k int) {
+	for i, h := range from {
+		a := p.alts[h]
+		if a == nil {
+			continue
+		}
+		m := map[byte]byte{}
+		for n, options := range a {
+			m[n] = options[k%len(options)]
+		}
+		to[i].remap(m)
+	}
+}
@@ -0,0 +1,70 @@
+package beatnik
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAlt(t *testing.T) {
+	tr := mustParse(t, "section:a K,alt(S|SR|SS)+@2. HC play:a*3 play:a")
+	var got []byte
+	var vels []Velocity
+	for _, h := range tr.Hits {
+		if len(h.Notes) == 2 {
+			for n, v := range h.Notes {
+				if n != 36 {
+					got = append(got, n)
+					vels = append(vels, v)
+					if h.Offsets[n] != 2 {
+						t.Errorf("note %v offsets=%v, want 2", n, h.Offsets)
+					}
+				}
+			}
+		}
+	}
+	s, sr, ss := ezDrummer["S"], ezDrummer["SR"], ezDrummer["SS"]
+	if want := []byte{s, sr, ss, s, sr}; !reflect.DeepEqual(got, want) {
+		t.Errorf("alternatives=%v, want %v", got, want)
+	}
+	for _, v := range vels {
+		if v != FF {
+			t.Errorf("velocities=%v, want all %v", vels, FF)
+			break
+		}
+	}
+}
+
+func TestAlt_remap(t *testing.T) {
+	tr := mustParse(t, "remap:S=T1 section:a alt(S|K) play:a")
+	want := []byte{ezDrummer["T1"], ezDrummer["K"]}
+	for i, h := range tr.Hits {
+		if _, ok := h.Notes[want[i]]; !ok || len(h.Notes) != 1 {
+			t.Errorf("hit %v=%v, want note %v", i+1, h, want[i])
+		}
+	}
+}
+
+func TestAlt_bad(t *testing.T) {
+	tests := []struct {
+		src  string
+		code Code
+	}{
+		{"alt(S|X)", CodeBadDrum},
+		{"alt(S)", CodeUnrecognizedToken},
+		{"(alt(S|K)", CodeHalfParenthesis},
+		{"alt(S|K))", CodeHalfParenthesis},
+	}
+	for _, test := range tests {
+		_, err := ParseTrack(test.src)
+		if e, ok := err.(*Error); !ok || e.Code != test.code {
+			t.Errorf("ParseTrack(%q)=%v, want %v", test.src, err, test.code)
+		}
+	}
+}
+
+func TestAlt_grace(t *testing.T) {
+	tr := mustParse(t, "section:a K (alt(S|SR)..) play:a")
+	if _, ok := tr.Hits[3].Notes[ezDrummer["SR"]]; !ok || tr.Hits[3].T != 24 {
+		t.Errorf("repeated grace note=%v, want a rimshot", tr.Hits[3])
+	}
+}
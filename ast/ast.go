@@ -0,0 +1,170 @@
+// Package ast represents beatnik source as a tree that keeps its structure:
+// sections and the plays that repeat them, variable and alias definitions,
+// groups, bar lines and comments. It is meant for tools that work on the
+// source, like formatters, linters and refactoring tools.
+//
+// A tree is lowered to a flat track with its Track method, which prints the
+// tree and parses the result with beatnik's parser. Printing a parsed tree
+// keeps the positions of its tokens, so errors point at the original source.
+package ast
+
+import (
+	"strconv"
+	"strings"
+)
+
+// A Position is the location of a node in the source.
+type Position struct {
+	Line int // 1-based line number, 0 for nodes that were not parsed.
+	Col  int // 1-based column, in runes (not bytes).
+}
+
+// Pos returns the position.
+func (p Position) Pos() Position {
+	return p
+}
+
+// A Node is an element of the tree.
+type Node interface {
+	// Pos returns the position of the node's first token.
+	Pos() Position
+}
+
+// A File is a parsed source file.
+type File struct {
+	Nodes []Node
+}
+
+// A Hit is a set of drums played together, as in "K,S+{stick=rim}.".
+type Hit struct {
+	Position
+	Notes       []Note
+	Annotations string // Annotations with their braces, or empty.
+	Duration    string // Duration marks, as in "." or ".>".
+	Grace       bool   // The hit is parenthesized.
+}
+
+// A Note is a single drum of a hit.
+type Note struct {
+	Name     string // Drum name, number or alias.
+	Velocity string // Velocity marks, as in "+" or "--".
+	Offset   string // Timing offset without its "@", as in "-3", or empty.
+	Chance   string // Chance without its "?", as in "75", or empty.
+}
+
+// A Wait is a duration that extends the previous hit, as in "..".
+type Wait struct {
+	Position
+	Duration string
+}
+
+// A BarLine is a "|" that marks the end of a bar.
+type BarLine struct {
+	Position
+}
+
+// A Comment is a comment until the end of its line.
+type Comment struct {
+	Position
+	Text string // Comment text, including its "#".
+}
+
+// A Directive is a directive that has no node of its own, as in "bpm:120".
+type Directive struct {
+	Position
+	Name  string
+	Value string
+}
+
+// A Set defines a variable, as in "set:base=90".
+type Set struct {
+	Position
+	Name string
+	Expr string
+}
+
+// An Alias defines a drum name, as in "alias:Бочка=K".
+type Alias struct {
+	Position
+	Name string
+	Drum string // Drum name, number or alias.
+}
+
+// A Section is a named part of the track that can be played again, as in
+// "section:verse". Its body lasts until the next section or play directive,
+// a "section:" directive with no name, or the end of its enclosing group.
+type Section struct {
+	Position
+	Name string
+	Body []Node
+}
+
+// A Play plays earlier sections again, as in "play:verse*2,chorus".
+type Play struct {
+	Position
+	Items []PlayItem
+}
+
+// A PlayItem is a section of a play directive, with its number of repeats.
+type PlayItem struct {
+	Name  string
+	Times int // Number of repeats, 0 if not written (plays once).
+}
+
+// A Group is a bracketed sequence of nodes with an operator, as in
+// "[ S.. T1. ]rev".
+type Group struct {
+	Position
+	Body  []Node
+	Op    string   // Operator after the closing bracket, or empty.
+	Close Position // Position of the closing bracket.
+}
+
+// Inspect traverses the given nodes in source order, calling f for each node.
+// If f returns false, the body of that node is skipped.
+func Inspect(nodes []Node, f func(Node) bool) {
+	for _, n := range nodes {
+		if !f(n) {
+			continue
+		}
+		switch n := n.(type) {
+		case *Section:
+			Inspect(n.Body, f)
+		case *Group:
+			Inspect(n.Body, f)
+		}
+	}
+}
+
+// String returns the hit as a token.
+func (h *Hit) String() string {
+	var notes []string
+	for _, n := range h.Notes {
+		s := n.Name + n.Velocity
+		if n.Offset != "" {
+			s += "@" + n.Offset
+		}
+		if n.Chance != "" {
+			s += "?" + n.Chance
+		}
+		notes = append(notes, s)
+	}
+	s := strings.Join(notes, ",") + h.Annotations + h.Duration
+	if h.Grace {
+		s = "(" + s + ")"
+	}
+	return s
+}
+
+// String returns the play directive as a token.
+func (p *Play) String() string {
+	var items []string
+	for _, it := range p.Items {
+		s := it.Name
+		if it.Times != 0 {
+			s += "*" + strconv.Itoa(it.Times)
+		}
+		items = append(items, s)
+	}
+	return "play:" + strings.Join(items, ",")
+}
@@ -0,0 +1,111 @@
+package ast
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fluhus/beatnik"
+)
+
+const src = `bpm:90 # Slow.
+set:base=100 alias:Бочка=K
+
+section:verse
+Бочка,HC. HC. S+@-3,HC{stick=rim}. (S..) HC | .. [ T1. T2. ]rev
+section:chorus
+C1,K~ S~
+section:
+play:verse*2,chorus
+`
+
+func TestParse(t *testing.T) {
+	f, err := Parse(src)
+	if err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+	if got := f.String(); got != src {
+		t.Errorf("String()=%q, want %q", got, src)
+	}
+
+	var kinds []string
+	Inspect(f.Nodes, func(n Node) bool {
+		kinds = append(kinds, reflect.TypeOf(n).Elem().Name())
+		return true
+	})
+	want := []string{"Directive", "Comment", "Set", "Alias", "Section", "Hit",
+		"Hit", "Hit", "Hit", "Hit", "BarLine", "Wait", "Group", "Hit", "Hit",
+		"Section", "Hit", "Hit", "Directive", "Play"}
+	if !reflect.DeepEqual(kinds, want) {
+		t.Errorf("Inspect()=%v, want %v", kinds, want)
+	}
+
+	verse := f.Nodes[4].(*Section)
+	if verse.Name != "verse" || len(verse.Body) != 8 {
+		t.Errorf("section=%+v, want verse with 8 nodes", verse)
+	}
+	hit := verse.Body[2].(*Hit)
+	wantHit := &Hit{Position{5, 15}, []Note{{"S", "+", "-3", ""}, {"HC", "", "", ""}},
+		"{stick=rim}", ".", false}
+	if !reflect.DeepEqual(hit, wantHit) {
+		t.Errorf("hit=%+v, want %+v", hit, wantHit)
+	}
+	play := f.Nodes[len(f.Nodes)-1].(*Play)
+	if !reflect.DeepEqual(play.Items, []PlayItem{{"verse", 2}, {"chorus", 0}}) {
+		t.Errorf("play=%+v, want verse*2,chorus", play.Items)
+	}
+
+	got, err := f.Track()
+	if err != nil {
+		t.Fatalf("Track() failed: %v", err)
+	}
+	wantTrack, _ := beatnik.ParseTrack(src)
+	if !reflect.DeepEqual(got, wantTrack) {
+		t.Errorf("Track()=%v, want %v", got, wantTrack)
+	}
+}
+
+func TestParse_errors(t *testing.T) {
+	tests := []struct {
+		src string
+		err string
+	}{
+		{"K S ??", "1:5:"},
+		{"K\n  [ S", "2:3: opening bracket"},
+		{"K ]", "1:3: closing bracket"},
+	}
+	for _, test := range tests {
+		_, err := Parse(test.src)
+		if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+			t.Errorf("Parse(%q)=%v, want %q", test.src, err, test.err)
+		}
+	}
+}
+
+func TestTrack_positions(t *testing.T) {
+	f, err := Parse("K S\n  # Comment\n   X")
+	if err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+	if _, err := f.Track(); err == nil ||
+		!strings.HasPrefix(err.Error(), "3:4:") {
+		t.Errorf("Track()=%v, want error at 3:4", err)
+	}
+}
+
+func TestFprint(t *testing.T) {
+	f := &File{[]Node{
+		&Comment{Text: "# Made up."},
+		&Directive{Name: "bpm", Value: "120"},
+		&Section{Name: "a", Body: []Node{
+			&Hit{Notes: []Note{{Name: "K"}, {Name: "HC", Velocity: "-"}},
+				Duration: "."},
+			&Group{Body: []Node{&Hit{Notes: []Note{{Name: "S"}}}}, Op: "rev"},
+		}},
+		&Play{Items: []PlayItem{{"a", 3}}},
+	}}
+	want := "# Made up.\nbpm:120 section:a K,HC-. [ S ]rev play:a*3\n"
+	if got := f.String(); got != want {
+		t.Errorf("String()=%q, want %q", got, want)
+	}
+}
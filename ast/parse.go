@@ -0,0 +1,154 @@
+package ast
+
+// Parsing of source text into a tree.
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/fluhus/beatnik"
+)
+
+var (
+	hitParts  = regexp.MustCompile("^([^{]*?)(\\{[^{}]*\\})?([.~]*(?:>[0-9]*)?)$")
+	noteParts = regexp.MustCompile("^(.*?)(\\+*|-*)(?:@([+-]?[0-9]+))?(?:\\?([0-9]+))?$")
+	defParts  = regexp.MustCompile("^([^=]+)=(.+)$")
+	playItem  = regexp.MustCompile("^([\\pL\\pN_-]+)(?:\\*([0-9]+))?$")
+)
+
+// A scope is a node list that the parser appends to.
+type scope struct {
+	body    *[]Node
+	group   *Group // The scope's group, nil for sections and the file.
+	section bool   // The scope is a section's body.
+}
+
+// Parse parses source text into a tree. Returns the first lexical or
+// structural error, such as an unclosed group. The meaning of the tree, like
+// drum names and directive values, is only checked when it is lowered.
+func Parse(src string) (*File, error) {
+	f := &File{}
+	scopes := []*scope{{body: &f.Nodes}}
+	top := func() *scope { return scopes[len(scopes)-1] }
+	endSection := func() {
+		if top().section {
+			scopes = scopes[:len(scopes)-1]
+		}
+	}
+	add := func(n Node) { *top().body = append(*top().body, n) }
+
+	l := beatnik.NewLexer(strings.NewReader(src))
+	for {
+		tok, err := l.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		pos := Position{tok.Line, tok.Col}
+		switch tok.Kind {
+		case beatnik.TokenHit:
+			add(parseHit(tok.Text, pos))
+		case beatnik.TokenWait:
+			add(&Wait{pos, tok.Text})
+		case beatnik.TokenBarLine:
+			add(&BarLine{pos})
+		case beatnik.TokenComment:
+			add(&Comment{pos, tok.Text})
+		case beatnik.TokenGroupOpen:
+			g := &Group{Position: pos}
+			add(g)
+			scopes = append(scopes, &scope{body: &g.Body, group: g})
+		case beatnik.TokenGroupClose:
+			endSection()
+			g := top().group
+			if g == nil {
+				return nil, fmt.Errorf("%v:%v: closing bracket was never opened",
+					pos.Line, pos.Col)
+			}
+			g.Op, g.Close = tok.Text[1:], pos
+			scopes = scopes[:len(scopes)-1]
+		case beatnik.TokenDirective:
+			n := parseDirective(tok.Text, pos)
+			switch n := n.(type) {
+			case *Section:
+				endSection()
+				add(n)
+				scopes = append(scopes, &scope{body: &n.Body, section: true})
+			case *Play:
+				endSection()
+				add(n)
+			case *Directive:
+				if n.Name == "section" {
+					endSection()
+				}
+				add(n)
+			default:
+				add(n)
+			}
+		}
+	}
+	endSection()
+	if g := top().group; g != nil {
+		return nil, fmt.Errorf("%v:%v: opening bracket is never closed",
+			g.Line, g.Col)
+	}
+	return f, nil
+}
+
+// parseHit returns the node of a hit token.
+func parseHit(s string, pos Position) *Hit {
+	h := &Hit{Position: pos}
+	if strings.HasPrefix(s, "(") {
+		h.Grace = true
+		s = s[1 : len(s)-1]
+	}
+	m := hitParts.FindStringSubmatch(s)
+	h.Annotations, h.Duration = m[2], m[3]
+	for _, part := range strings.Split(m[1], ",") {
+		nm := noteParts.FindStringSubmatch(part)
+		h.Notes = append(h.Notes, Note{nm[1], nm[2], nm[3], nm[4]})
+	}
+	return h
+}
+
+// parseDirective returns the node of a directive token. Directives that do
+// not have a node of their own, or that are malformed, are returned as
+// Directive nodes.
+func parseDirective(s string, pos Position) Node {
+	i := strings.IndexByte(s, ':')
+	d := &Directive{pos, s[:i], s[i+1:]}
+	switch d.Name {
+	case "set":
+		if m := defParts.FindStringSubmatch(d.Value); m != nil {
+			return &Set{pos, m[1], m[2]}
+		}
+	case "alias":
+		if m := defParts.FindStringSubmatch(d.Value); m != nil {
+			return &Alias{pos, m[1], m[2]}
+		}
+	case "section":
+		if d.Value != "" {
+			return &Section{Position: pos, Name: d.Value}
+		}
+	case "play":
+		p := &Play{Position: pos}
+		for _, part := range strings.Split(d.Value, ",") {
+			m := playItem.FindStringSubmatch(part)
+			if m == nil {
+				return d
+			}
+			n, _ := strconv.Atoi(m[2])
+			if m[2] != "" && n == 0 {
+				return d
+			}
+			p.Items = append(p.Items, PlayItem{m[1], n})
+		}
+		return p
+	}
+	return d
+}
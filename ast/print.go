@@ -0,0 +1,114 @@
+package ast
+
+// Printing and lowering of trees.
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/fluhus/beatnik"
+)
+
+// A printer writes tokens at their positions.
+type printer struct {
+	buf       bytes.Buffer
+	line, col int  // Position of the next character, 0 line before the first.
+	comment   bool // The last token is a comment.
+}
+
+// Fprint writes the source of the nodes to w. Tokens are written at their
+// positions when they come after the previous token, so a parsed tree is
+// printed with its original layout. Other tokens are separated by spaces,
+// and tokens that follow comments start a new line.
+func Fprint(w io.Writer, nodes []Node) error {
+	p := &printer{}
+	p.nodes(nodes)
+	if p.line > 0 {
+		p.buf.WriteString("\n")
+	}
+	_, err := w.Write(p.buf.Bytes())
+	return err
+}
+
+// String returns the source of the file.
+func (f *File) String() string {
+	buf := &strings.Builder{}
+	Fprint(buf, f.Nodes)
+	return buf.String()
+}
+
+// Track lowers the file to a track, by parsing its source with beatnik's
+// parser.
+func (f *File) Track() (*beatnik.Track, error) {
+	return beatnik.ParseTrack(f.String())
+}
+
+// nodes prints the given nodes.
+func (p *printer) nodes(nodes []Node) {
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case *Hit:
+			p.token(n.Position, n.String())
+		case *Wait:
+			p.token(n.Position, n.Duration)
+		case *BarLine:
+			p.token(n.Position, "|")
+		case *Comment:
+			p.token(n.Position, n.Text)
+			p.comment = true
+		case *Directive:
+			p.token(n.Position, n.Name+":"+n.Value)
+		case *Set:
+			p.token(n.Position, "set:"+n.Name+"="+n.Expr)
+		case *Alias:
+			p.token(n.Position, "alias:"+n.Name+"="+n.Drum)
+		case *Section:
+			p.token(n.Position, "section:"+n.Name)
+			p.nodes(n.Body)
+		case *Play:
+			p.token(n.Position, n.String())
+		case *Group:
+			p.token(n.Position, "[")
+			p.nodes(n.Body)
+			p.token(n.Close, "]"+n.Op)
+		}
+	}
+}
+
+// token prints a single token at the given position.
+func (p *printer) token(pos Position, s string) {
+	switch {
+	case p.line == 0:
+		p.line, p.col = 1, 1
+		if pos.Line > 0 {
+			p.moveTo(pos)
+		}
+	case pos.Line > p.line:
+		p.moveTo(pos)
+	case p.comment:
+		p.buf.WriteString("\n")
+		p.line, p.col = p.line+1, 1
+	case pos.Line == p.line && pos.Col > p.col:
+		p.moveTo(pos)
+	default:
+		p.buf.WriteString(" ")
+		p.col++
+	}
+	p.comment = false
+	p.buf.WriteString(s)
+	p.col += utf8.RuneCountInString(s)
+}
+
+// moveTo writes line breaks and spaces up to the given position.
+func (p *printer) moveTo(pos Position) {
+	if pos.Line > p.line {
+		p.buf.WriteString(strings.Repeat("\n", pos.Line-p.line))
+		p.line, p.col = pos.Line, 1
+	}
+	if pos.Col > p.col {
+		p.buf.WriteString(strings.Repeat(" ", pos.Col-p.col))
+		p.col = pos.Col
+	}
+}
@@ -0,0 +1,96 @@
+// Package backends is a registry of optional playback backends, such as midi
+// output ports.
+//
+// Each backend is kept in its own file, which registers it in an init
+// function. Backends that only work on some systems are selected by the
+// file's name, like rawmidi_linux.go and seq_linux.go, which only build on
+// Linux. The beatnik package itself never imports this package, so it stays
+// free of dependencies, while programs can list the backends that were
+// compiled in.
+package backends
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// A Kind is a capability that a backend provides.
+type Kind int
+
+// Backend kinds.
+const (
+	MIDIOut Kind = iota // Sends midi bytes to a port.
+)
+
+// String returns the kind's name.
+func (k Kind) String() string {
+	switch k {
+	case MIDIOut:
+		return "midi-out"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// A Backend is a registered playback backend.
+type Backend struct {
+	Name string // Unique name, like "rawmidi".
+	Kind Kind
+	Doc  string // One line description.
+
+	// Returns the names of the available ports. May be nil.
+	Ports func() []string
+
+	// Opens a port by name, or the default port if name is empty. The
+	// returned writer takes raw midi bytes.
+	Open func(name string) (io.WriteCloser, error)
+}
+
+var (
+	registry     = map[string]*Backend{}
+	registryLock sync.RWMutex
+)
+
+// Register adds a backend to the registry. Panics if a backend with the same
+// name is already registered.
+func Register(b *Backend) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	if _, ok := registry[b.Name]; ok {
+		panic("backends: duplicate backend " + b.Name)
+	}
+	registry[b.Name] = b
+}
+
+// List returns the registered backends, ordered by name.
+func List() []*Backend {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	result := make([]*Backend, 0, len(registry))
+	for _, b := range registry {
+		result = append(result, b)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// Get returns the backend with the given name, or nil if there is none.
+func Get(name string) *Backend {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	return registry[name]
+}
+
+// Default returns the first registered backend of the given kind, by name.
+// Returns nil if there is none.
+func Default(k Kind) *Backend {
+	for _, b := range List() {
+		if b.Kind == k {
+			return b
+		}
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package backends
+
+import (
+	"io"
+	"testing"
+)
+
+func TestRegister(t *testing.T) {
+	b := &Backend{Name: "zz-test", Kind: MIDIOut,
+		Open: func(string) (io.WriteCloser, error) { return nil, nil }}
+	Register(b)
+	defer func() {
+		registryLock.Lock()
+		delete(registry, b.Name)
+		registryLock.Unlock()
+	}()
+
+	if got := Get("zz-test"); got != b {
+		t.Errorf("Get(zz-test)=%v, want %v", got, b)
+	}
+	list := List()
+	for i := 1; i < len(list); i++ {
+		if list[i-1].Name >= list[i].Name {
+			t.Errorf("List() is not sorted: %v, %v", list[i-1].Name, list[i].Name)
+		}
+	}
+	if list[len(list)-1] != b {
+		t.Errorf("List() last=%v, want %v", list[len(list)-1], b)
+	}
+	if Default(MIDIOut) == nil {
+		t.Errorf("Default(MIDIOut)=nil, want a backend")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Register() of a duplicate did not panic")
+		}
+	}()
+	Register(&Backend{Name: "zz-test"})
+}
@@ -0,0 +1,39 @@
+package backends
+
+// Midi output through ALSA raw midi devices, which needs no libraries.
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+func init() {
+	Register(&Backend{
+		Name:  "rawmidi",
+		Kind:  MIDIOut,
+		Doc:   "ALSA raw midi devices (/dev/snd/midi*)",
+		Ports: rawMIDIPorts,
+		Open:  openRawMIDI,
+	})
+}
+
+// rawMIDIPorts returns the paths of the raw midi devices.
+func rawMIDIPorts() []string {
+	ports, _ := filepath.Glob("/dev/snd/midiC*D*")
+	return ports
+}
+
+// openRawMIDI opens a raw midi device by its path, or the first device if
+// name is empty.
+func openRawMIDI(name string) (io.WriteCloser, error) {
+	if name == "" {
+		ports := rawMIDIPorts()
+		if len(ports) == 0 {
+			return nil, errors.New("no raw midi devices found")
+		}
+		name = ports[0]
+	}
+	return os.OpenFile(name, os.O_WRONLY, 0)
+}
@@ -0,0 +1,324 @@
+package backends
+
+// Midi output through the ALSA sequencer, which needs no libraries. The
+// sequencer is driven with ioctls on /dev/snd/seq, like alsa-lib does.
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+func init() {
+	Register(&Backend{
+		Name: "seq",
+		Kind: MIDIOut,
+		Doc:  "ALSA sequencer port for qjackctl, Carla and aconnect (port is a name or client:port)",
+		Open: openALSASeq,
+	})
+}
+
+// seqDevice is the ALSA sequencer device.
+const seqDevice = "/dev/snd/seq"
+
+// Ioctl requests, as defined in <sound/asequencer.h>.
+var (
+	seqIoctlClientID      = ioc(2, 0x01, 4)
+	seqIoctlSetClientInfo = ioc(1, 0x11, unsafe.Sizeof(seqClientInfo{}))
+	seqIoctlCreatePort    = ioc(3, 0x20, unsafe.Sizeof(seqPortInfo{}))
+	seqIoctlSubscribePort = ioc(1, 0x30, unsafe.Sizeof(seqPortSubscribe{}))
+)
+
+// ioc returns an ioctl request number of the sequencer. dir is 1 for write,
+// 2 for read and 3 for both.
+func ioc(dir, nr, size uintptr) uintptr {
+	return dir<<30 | size<<16 | 'S'<<8 | nr
+}
+
+// Sequencer constants.
+const (
+	seqUserClient      = 1
+	seqCapRead         = 1 << 0
+	seqCapSubsRead     = 1 << 5
+	seqTypeMIDIGeneric = 1 << 1
+	seqTypeApplication = 1 << 20
+	seqQueueDirect     = 253
+	seqSubscribers     = 254
+	seqLengthVariable  = 1 << 2
+)
+
+// Sequencer event types.
+const (
+	seqNoteOn     = 6
+	seqNoteOff    = 7
+	seqKeyPress   = 8
+	seqController = 10
+	seqPgmChange  = 11
+	seqChanPress  = 12
+	seqPitchBend  = 13
+	seqSongPos    = 20
+	seqStart      = 30
+	seqContinue   = 31
+	seqStop       = 32
+	seqClock      = 36
+	seqSysEx      = 130
+)
+
+// nativeEndian is the byte order of the kernel's structs.
+var nativeEndian binary.ByteOrder = binary.LittleEndian
+
+func init() {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 0 {
+		nativeEndian = binary.BigEndian
+	}
+}
+
+// seqClientInfo is struct snd_seq_client_info.
+type seqClientInfo struct {
+	client          int32
+	typ             int32
+	name            [64]byte
+	filter          uint32
+	multicastFilter [8]byte
+	eventFilter     [32]byte
+	numPorts        int32
+	eventLost       int32
+	card            int32
+	pid             int32
+	reserved        [56]byte
+}
+
+// seqPortInfo is struct snd_seq_port_info.
+type seqPortInfo struct {
+	client, port byte
+	name         [64]byte
+	capability   uint32
+	typ          uint32
+	midiChannels int32
+	midiVoices   int32
+	synthVoices  int32
+	readUse      int32
+	writeUse     int32
+	kernel       uintptr
+	flags        uint32
+	timeQueue    byte
+	reserved     [59]byte
+}
+
+// seqPortSubscribe is struct snd_seq_port_subscribe.
+type seqPortSubscribe struct {
+	senderClient, senderPort byte
+	destClient, destPort     byte
+	voices                   uint32
+	flags                    uint32
+	queue                    byte
+	pad                      [3]byte
+	reserved                 [64]byte
+}
+
+// An alsaSeq is an open sequencer port that midi bytes are written to.
+type alsaSeq struct {
+	f      *os.File
+	port   byte
+	status byte // Running status.
+}
+
+// openALSASeq creates a sequencer client named beatnik with an output port.
+// name is the name of the port, or a destination port to connect to, like
+// "128:0". Empty is a port named beatnik that is not connected.
+func openALSASeq(name string) (io.WriteCloser, error) {
+	dest, connect := parseSeqAddr(name)
+	if name == "" || connect {
+		name = "beatnik"
+	}
+	f, err := os.OpenFile(seqDevice, os.O_WRONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	s := &alsaSeq{f: f}
+	if err := s.init(name, dest, connect); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// parseSeqAddr parses a "client:port" address. Returns false if s is not an
+// address.
+func parseSeqAddr(s string) ([2]byte, bool) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return [2]byte{}, false
+	}
+	c, err1 := strconv.ParseUint(parts[0], 10, 8)
+	p, err2 := strconv.ParseUint(parts[1], 10, 8)
+	if err1 != nil || err2 != nil {
+		return [2]byte{}, false
+	}
+	return [2]byte{byte(c), byte(p)}, true
+}
+
+// init names the client, creates its port, and connects the port to dest if
+// connect is true.
+func (s *alsaSeq) init(name string, dest [2]byte, connect bool) error {
+	var client int32
+	if err := s.ioctl(seqIoctlClientID, unsafe.Pointer(&client)); err != nil {
+		return err
+	}
+	info := seqClientInfo{client: client, typ: seqUserClient}
+	copy(info.name[:len(info.name)-1], "beatnik")
+	if err := s.ioctl(seqIoctlSetClientInfo, unsafe.Pointer(&info)); err != nil {
+		return err
+	}
+
+	port := seqPortInfo{client: byte(client),
+		capability:   seqCapRead | seqCapSubsRead,
+		typ:          seqTypeMIDIGeneric | seqTypeApplication,
+		midiChannels: 16}
+	copy(port.name[:len(port.name)-1], name)
+	if err := s.ioctl(seqIoctlCreatePort, unsafe.Pointer(&port)); err != nil {
+		return err
+	}
+	s.port = port.port
+
+	if connect {
+		sub := seqPortSubscribe{senderClient: byte(client), senderPort: s.port,
+			destClient: dest[0], destPort: dest[1]}
+		if err := s.ioctl(seqIoctlSubscribePort, unsafe.Pointer(&sub)); err != nil {
+			return fmt.Errorf("failed to connect to %v:%v: %v", dest[0], dest[1], err)
+		}
+	}
+	return nil
+}
+
+// ioctl calls an ioctl on the sequencer device.
+func (s *alsaSeq) ioctl(req uintptr, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, s.f.Fd(), req, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// Write sends midi messages to the port's subscribers.
+func (s *alsaSeq) Write(b []byte) (int, error) {
+	events, err := s.events(b)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := s.f.Write(events); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Close closes the sequencer client, which removes its port.
+func (s *alsaSeq) Close() error {
+	return s.f.Close()
+}
+
+// events returns the sequencer events of midi messages.
+func (s *alsaSeq) events(b []byte) ([]byte, error) {
+	var result []byte
+	for len(b) > 0 {
+		if b[0] < 0x80 {
+			if s.status == 0 {
+				return nil, errors.New("midi data without a status byte")
+			}
+			b = append([]byte{s.status}, b...)
+		}
+		status := b[0]
+		n := messageLen(b)
+		if n == 0 || n > len(b) {
+			return nil, fmt.Errorf("incomplete midi message: % X", b)
+		}
+		msg := b[:n]
+		b = b[n:]
+		if status < 0xF0 {
+			s.status = status
+		} else if status < 0xF8 {
+			s.status = 0
+		}
+
+		var ev [28]byte
+		ev[3] = seqQueueDirect
+		ev[13], ev[14] = s.port, seqSubscribers
+		data := ev[16:]
+		ch := status & 0x0F
+		switch status & 0xF0 {
+		case 0x80, 0x90, 0xA0:
+			ev[0] = [...]byte{seqNoteOff, seqNoteOn, seqKeyPress}[status>>4-8]
+			data[0], data[1], data[2] = ch, msg[1], msg[2]
+		case 0xB0:
+			ev[0] = seqController
+			data[0] = ch
+			nativeEndian.PutUint32(data[4:], uint32(msg[1]))
+			nativeEndian.PutUint32(data[8:], uint32(msg[2]))
+		case 0xC0, 0xD0:
+			ev[0] = seqPgmChange
+			if status&0xF0 == 0xD0 {
+				ev[0] = seqChanPress
+			}
+			data[0] = ch
+			nativeEndian.PutUint32(data[8:], uint32(msg[1]))
+		case 0xE0:
+			ev[0] = seqPitchBend
+			data[0] = ch
+			bend := int32(msg[1]) | int32(msg[2])<<7 - 8192
+			nativeEndian.PutUint32(data[8:], uint32(bend))
+		default:
+			switch status {
+			case 0xF0:
+				ev[0], ev[1] = seqSysEx, seqLengthVariable
+				nativeEndian.PutUint32(data[0:], uint32(len(msg)))
+				result = append(append(result, ev[:]...), msg...)
+				continue
+			case 0xF2:
+				ev[0] = seqSongPos
+				nativeEndian.PutUint32(data[8:], uint32(msg[1])|uint32(msg[2])<<7)
+			case 0xF8:
+				ev[0] = seqClock
+			case 0xFA:
+				ev[0] = seqStart
+			case 0xFB:
+				ev[0] = seqContinue
+			case 0xFC:
+				ev[0] = seqStop
+			default:
+				continue // No sequencer event.
+			}
+		}
+		result = append(result, ev[:]...)
+	}
+	return result, nil
+}
+
+// messageLen returns the length of the midi message at the start of b, or 0
+// if it is incomplete.
+func messageLen(b []byte) int {
+	switch status := b[0]; {
+	case status < 0xC0 || status >= 0xE0 && status < 0xF0:
+		return 3
+	case status < 0xE0:
+		return 2
+	case status == 0xF0:
+		for i, c := range b {
+			if c == 0xF7 {
+				return i + 1
+			}
+		}
+		return 0
+	case status == 0xF2:
+		return 3
+	case status == 0xF1 || status == 0xF3:
+		return 2
+	}
+	return 1
+}
@@ -0,0 +1,69 @@
+package backends
+
+import (
+	"reflect"
+	"testing"
+	"unsafe"
+)
+
+func TestSeqStructs(t *testing.T) {
+	sizes := map[string][2]uintptr{
+		"client info": {unsafe.Sizeof(seqClientInfo{}), 188},
+		"subscribe":   {unsafe.Sizeof(seqPortSubscribe{}), 80},
+	}
+	if unsafe.Sizeof(uintptr(0)) == 8 {
+		sizes["port info"] = [2]uintptr{unsafe.Sizeof(seqPortInfo{}), 168}
+	}
+	for name, s := range sizes {
+		if s[0] != s[1] {
+			t.Errorf("sizeof(%v)=%v, want %v", name, s[0], s[1])
+		}
+	}
+	if seqIoctlCreatePort != 0xC0A85320 && unsafe.Sizeof(uintptr(0)) == 8 {
+		t.Errorf("create port request=%X, want C0A85320", seqIoctlCreatePort)
+	}
+}
+
+// seqEvent returns a sequencer event from port 3 to subscribers, with the
+// given type and data.
+func seqEvent(typ byte, data ...byte) []byte {
+	ev := make([]byte, 28)
+	ev[0], ev[3], ev[13], ev[14] = typ, seqQueueDirect, 3, seqSubscribers
+	copy(ev[16:], data)
+	return ev
+}
+
+func TestSeqEvents(t *testing.T) {
+	s := &alsaSeq{port: 3}
+	got, err := s.events([]byte{0x99, 36, 115, 38, 100, 0xF8, 0x89, 36, 64,
+		0xB9, 7, 90, 0xE9, 0, 0x40, 0xD9, 20, 0xF0, 1, 2, 0xF7, 0xFC})
+	if err != nil {
+		t.Fatalf("events() failed: %v", err)
+	}
+	var want []byte
+	for _, ev := range [][]byte{
+		seqEvent(seqNoteOn, 9, 36, 115),
+		seqEvent(seqNoteOn, 9, 38, 100),
+		seqEvent(seqClock),
+		seqEvent(seqNoteOff, 9, 36, 64),
+		seqEvent(seqController, 9, 0, 0, 0, 7, 0, 0, 0, 90, 0, 0, 0),
+		seqEvent(seqPitchBend, 9, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0),
+		seqEvent(seqChanPress, 9, 0, 0, 0, 0, 0, 0, 0, 20, 0, 0, 0),
+	} {
+		want = append(want, ev...)
+	}
+	sysex := seqEvent(seqSysEx, 4)
+	sysex[1] = seqLengthVariable
+	want = append(append(want, sysex...), 0xF0, 1, 2, 0xF7)
+	want = append(want, seqEvent(seqStop)...)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events()=\n%v\nwant\n%v", got, want)
+	}
+
+	if _, err := (&alsaSeq{}).events([]byte{36, 100}); err == nil {
+		t.Errorf("events() of data without status succeeded")
+	}
+	if _, err := s.events([]byte{0x99, 36}); err == nil {
+		t.Errorf("events() of an incomplete message succeeded")
+	}
+}
@@ -0,0 +1,50 @@
+package beatnik
+
+// Gradual tempo changes.
+
+import (
+	"regexp"
+	"strconv"
+)
+
+// bpmRampToken matches the value of a bpmramp directive: start and end tempos
+// and a number of bars.
+var bpmRampToken = regexp.MustCompile("^([0-9]+)\\.\\.([0-9]+),([0-9]+)$")
+
+// maxRampBars is the longest tempo ramp, in bars.
+const maxRampBars = 999
+
+// bpmRampDirective changes the tempo gradually, as in "bpmramp:120..90,4".
+// The tempo goes from the first BPM to the second over the given number of
+// bars, with a tempo change on every beat, and stays at the second after
+// them. At the start of the track, the first BPM becomes the track's tempo.
+func bpmRampDirective(p *parser, s string, at DirectiveContext) error {
+	m := bpmRampToken.FindStringSubmatch(s)
+	if m == nil {
+		return newError(CodeBadBPMRamp, s)
+	}
+	from, err1 := strconv.Atoi(m[1])
+	to, err2 := strconv.Atoi(m[2])
+	bars, err3 := strconv.Atoi(m[3])
+	if err1 != nil || err2 != nil || err3 != nil || bars < 1 ||
+		bars > maxRampBars {
+		return newError(CodeBadBPMRamp, s)
+	}
+	for _, bpm := range []int{from, to} {
+		if err := p.opts.checkBPM(bpm); err != nil {
+			return err
+		}
+	}
+
+	ts := p.t.timeSig()
+	start, step := at.Tick, 96*4/ts.Denom
+	n := bars * int(ts.Num)
+	if err := p.growEvents(n + 1); err != nil {
+		return err
+	}
+	for i := 0; i <= n; i++ {
+		bpm := uint(from + (to-from)*i/n)
+		p.t.setTempo(start+uint(i)*step, bpm)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package beatnik
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBPMRamp(t *testing.T) {
+	tr := mustParse(t, "bpmramp:120..100,1 K K K K K")
+	if tr.BPM != 120 {
+		t.Errorf("BPM=%v, want 120", tr.BPM)
+	}
+	var ticks, bpms []uint
+	for _, m := range tr.Meta {
+		ticks = append(ticks, m.T)
+		bpms = append(bpms, m.bpm())
+	}
+	if want := []uint{96, 192, 288, 384}; !reflect.DeepEqual(ticks, want) {
+		t.Errorf("tempo ticks=%v, want %v", ticks, want)
+	}
+	if want := []uint{115, 110, 105, 100}; !reflect.DeepEqual(bpms, want) {
+		t.Errorf("tempos=%v, want %v", bpms, want)
+	}
+
+	tr = mustParse(t, "bpm:90 time:3/8 K~ bpmramp:90..60,1 K K")
+	if tr.BPM != 90 || len(tr.Meta) != 4 || tr.Meta[0].T != 192 ||
+		tr.Meta[3].T != 336 || tr.Meta[3].bpm() != 60 {
+		t.Errorf("ramp in 3/8=%v, want 4 tempos from tick 192 to 336", tr.Meta)
+	}
+}
+
+func TestBPMRamp_bad(t *testing.T) {
+	tests := []struct {
+		src  string
+		code Code
+	}{
+		{"bpmramp:120..90", CodeBadBPMRamp},
+		{"bpmramp:120..90,0", CodeBadBPMRamp},
+		{"bpmramp:120..90,1000", CodeBadBPMRamp},
+		{"bpmramp:120..0,1", CodeBPMRange},
+		{"bpmramp:", CodeBadBPMRamp},
+	}
+	for _, test := range tests {
+		_, err := ParseTrack(test.src)
+		if e, ok := err.(*Error); !ok || e.Code != test.code {
+			t.Errorf("ParseTrack(%q)=%v, want %v", test.src, err, test.code)
+		}
+	}
+}
+
+func TestBPMRamp_limit(t *testing.T) {
+	s := &Sandbox{}
+	if _, err := s.ParseTrack("time:255/64 bpmramp:1..500,999"); !IsLimit(err) {
+		t.Errorf("ParseTrack() error=%v, want a limit", err)
+	}
+	if _, err := s.ParseTrack("bpmramp:100..140,999 K"); err != nil {
+		t.Errorf("ParseTrack() failed: %v", err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 
 	"github.com/fluhus/beatnik"
 )
@@ -17,17 +18,28 @@ func main() {
 			fmt.Printf("failed to read %q: %v\n", f, err)
 			continue
 		}
-		t, err := beatnik.ParseTrack(string(d))
+		parse := beatnik.ParseTrack
+		if filepath.Ext(f) == ".tab" {
+			parse = beatnik.ParseTab
+		}
+		t, err := parse(string(d))
 		if err != nil {
 			fmt.Printf("failed to parse %q: %v\n", f, err)
 			continue
 		}
-		b, err := t.MarshalBinary()
+		// Validate before the output is truncated, so that a bad track keeps
+		// the file from before.
+		if err := beatnik.ErrorList(t.Validate()); len(err) > 0 {
+			fmt.Printf("failed to encode %q: %v\n", f, err)
+			continue
+		}
+		out, err := os.OpenFile(f+".mid", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
 		if err != nil {
-			fmt.Printf("failed to encode: %v\n", err)
+			fmt.Printf("failed to create %q: %v\n", f+".mid", err)
 			continue
 		}
-		err = ioutil.WriteFile(f+".mid", b, 0600)
+		_, err = t.WriteTo(out)
+		out.Close()
 		if err != nil {
 			fmt.Printf("failed to write %q: %v\n", f+".mid", err)
 			continue
@@ -0,0 +1,158 @@
+package beatnik
+
+// Directives of control events.
+
+import (
+	"regexp"
+	"strconv"
+)
+
+// ccToken matches the value of a cc directive: a controller number and a
+// value, or a ramp of values over a number of bars.
+var ccToken = regexp.MustCompile("^([0-9]+)=([0-9]+)(?:\\.\\.([0-9]+),([0-9]+))?$")
+
+// aftertouchToken matches the value of an aftertouch directive: a pressure,
+// with an optional note before it.
+var aftertouchToken = regexp.MustCompile("^(?:(" + namePattern + ")=)?([0-9]+)$")
+
+// bendToken matches the value of a bend directive: a bend, or a ramp of bends
+// over a number of bars.
+var bendToken = regexp.MustCompile("^(-?[0-9]+)(?:\\.\\.(-?[0-9]+),([0-9]+))?$")
+
+// ccRampStep is the number of ticks between the events of a control ramp.
+const ccRampStep = 12
+
+// ccDirective places control change events at the current tick, as in
+// "cc:4=64", for things like hi-hat openness. A ramp, as in "cc:4=0..127,1",
+// changes the value gradually over the given number of bars, with an event on
+// every 1/32 bar where the value changes.
+func ccDirective(p *parser, s string, at DirectiveContext) error {
+	m := ccToken.FindStringSubmatch(s)
+	if m == nil {
+		return newError(CodeBadCC, s)
+	}
+	var nums []int
+	for i, x := range m[1:] {
+		if x == "" {
+			break
+		}
+		// The last number is the ramp's bars, which is checked below.
+		n, err := strconv.Atoi(x)
+		if err != nil || i < 3 && n > 127 {
+			return newError(CodeBadCC, s)
+		}
+		nums = append(nums, n)
+	}
+	number, from := byte(nums[0]), nums[1]
+	start := at.Tick
+	if len(nums) == 2 {
+		p.t.Controls = append(p.t.Controls, &Control{start, number, byte(from),
+			ControlChange})
+		return nil
+	}
+
+	to, bars := nums[2], nums[3]
+	if bars < 1 || bars > maxRampBars {
+		return newError(CodeBadCC, s)
+	}
+	return p.ramp(from, to, bars, func(t uint, v int) {
+		p.t.Controls = append(p.t.Controls, &Control{t, number, byte(v),
+			ControlChange})
+	})
+}
+
+// ramp calls f with values that go from one to another over the given number
+// of bars from the current tick, on every 1/32 bar where the value changes.
+// Fails without calling f if the events could pass the parser's limit.
+func (p *parser) ramp(from, to, bars int, f func(t uint, v int)) error {
+	start := p.tick
+	length := bars * int(p.t.timeSig().barTicks())
+	if err := p.growEvents(length/ccRampStep + 2); err != nil {
+		return err
+	}
+	last := from - 1
+	for at := 0; at <= length; at += ccRampStep {
+		if at+ccRampStep > length {
+			at = length
+		}
+		v := from + (to-from)*at/length
+		if v != last {
+			f(start+uint(at), v)
+			last = v
+		}
+	}
+	return nil
+}
+
+// bendDirective places pitch bend events at the current tick, as in
+// "bend:-4096", for tuned drums like rototoms or 808 kicks. Bends go from
+// -8192 to 8191, where 0 is no bend, and how many semitones they span depends
+// on the receiving module. A ramp, as in "bend:0..-8192,1", changes the bend
+// gradually over the given number of bars, like cc ramps.
+func bendDirective(p *parser, s string, at DirectiveContext) error {
+	m := bendToken.FindStringSubmatch(s)
+	if m == nil {
+		return newError(CodeBadBend, s)
+	}
+	var nums []int
+	for _, x := range m[1:] {
+		if x == "" {
+			break
+		}
+		n, err := strconv.Atoi(x)
+		if err != nil {
+			return newError(CodeBadBend, s)
+		}
+		nums = append(nums, n)
+	}
+	for i, n := range nums {
+		if i < 2 && (n < -8192 || n > 8191) {
+			return newError(CodeBadBend, s)
+		}
+	}
+	add := func(t uint, v int) {
+		p.t.Controls = append(p.t.Controls, bendControl(t, v))
+	}
+	if len(nums) == 1 {
+		add(at.Tick, nums[0])
+		return nil
+	}
+	if len(nums) == 2 || nums[2] < 1 || nums[2] > maxRampBars {
+		return newError(CodeBadBend, s)
+	}
+	return p.ramp(nums[0], nums[1], nums[2], add)
+}
+
+// bendControl returns a pitch bend event of a bend from -8192 to 8191.
+func bendControl(t uint, bend int) *Control {
+	v := bend + 8192
+	return &Control{t, byte(v & 0x7F), byte(v >> 7), PitchBend}
+}
+
+// aftertouchDirective places an aftertouch event at the current tick, for
+// modules that respond to pressure, like choking cymbals. A pressure alone, as
+// in "aftertouch:100", applies to the whole channel, and a note before it, as
+// in "aftertouch:C1=127", applies to that note only.
+func aftertouchDirective(p *parser, s string, at DirectiveContext) error {
+	m := aftertouchToken.FindStringSubmatch(s)
+	if m == nil {
+		return newError(CodeBadAftertouch, s)
+	}
+	v, err := strconv.Atoi(m[2])
+	if err != nil || v > 127 {
+		return newError(CodeBadAftertouch, s)
+	}
+	c := &Control{T: at.Tick, Value: byte(v), Kind: ChannelPressure}
+	if m[1] != "" {
+		note := noteByName(m[1], p.aliases, p.drums)
+		if note == 0 || note > 127 {
+			return newError(CodeBadDrum, m[1])
+		}
+		if to, ok := p.remap[note]; ok {
+			note = to
+		}
+		c.Number, c.Kind = note, KeyPressure
+	}
+	p.t.Controls = append(p.t.Controls, c)
+	return nil
+}
@@ -0,0 +1,113 @@
+package beatnik
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestCC(t *testing.T) {
+	tr := mustParse(t, "K cc:4=64 K time:1/32 cc:1=0..6,2 K")
+	want := []*Control{{96, 4, 64, ControlChange}, {192, 1, 0, ControlChange},
+		{204, 1, 3, ControlChange}, {216, 1, 6, ControlChange}}
+	if !reflect.DeepEqual(tr.Controls, want) {
+		t.Errorf("controls=%v, want %v", tr.Controls, want)
+	}
+
+	tr = mustParse(t, "cc:4=127..0,1")
+	if n := len(tr.Controls); n != 33 || tr.Controls[n-1].T != 384 ||
+		tr.Controls[n-1].Value != 0 {
+		t.Errorf("ramp=%v, want 33 events ending with 0 at 384", tr.Controls)
+	}
+
+	tr = mustParse(t, "cc:4=0..127,200")
+	if n := len(tr.Controls); n != 128 || tr.Controls[n-1].T != 200*384 {
+		t.Errorf("long ramp=%v events ending at %v, want 128 ending at %v",
+			n, tr.Controls[n-1].T, 200*384)
+	}
+}
+
+func TestCC_bad(t *testing.T) {
+	for _, src := range []string{"cc:4", "cc:128=1", "cc:4=128",
+		"cc:4=0..128,1", "cc:4=0..127,0", "cc:4=0..127", "cc:4=0..127,1000"} {
+		_, err := ParseTrack(src)
+		if e, ok := err.(*Error); !ok || e.Code != CodeBadCC {
+			t.Errorf("ParseTrack(%q)=%v, want %v", src, err, CodeBadCC)
+		}
+	}
+}
+
+func TestAftertouch(t *testing.T) {
+	tr := mustParse(t, "alias:X=C1 remap:HC=HO1 K aftertouch:X=127 aftertouch:HC=5 "+
+		"K aftertouch:64")
+	want := []*Control{{96, ezDrummer["C1"], 127, KeyPressure},
+		{96, ezDrummer["HO1"], 5, KeyPressure}, {192, 0, 64, ChannelPressure}}
+	if !reflect.DeepEqual(tr.Controls, want) {
+		t.Errorf("controls=%v, want %v", tr.Controls, want)
+	}
+	tr.BPM = 120
+	b, err := tr.Encode(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(b, []byte{0, 0xA9, 55, 127, 0, 0xA9, 24, 5}) ||
+		!bytes.Contains(b, []byte{0xD9, 64}) {
+		t.Errorf("Encode()=%v, want aftertouch events", b)
+	}
+
+	for _, src := range []string{"aftertouch:128", "aftertouch:", "aftertouch:X=1"} {
+		if _, err := ParseTrack(src); err == nil {
+			t.Errorf("ParseTrack(%q) succeeded, want error", src)
+		}
+	}
+}
+
+// Single bends used to read past their values, which only panicked in builds
+// without optimizations, like with -race or -gcflags=-N.
+func TestBend_single(t *testing.T) {
+	for _, test := range []struct {
+		src  string
+		want *Control
+	}{
+		{"bend:-8192", &Control{0, 0, 0, PitchBend}},
+		{"bend:0", &Control{0, 0, 64, PitchBend}},
+		{"bend:8191", &Control{0, 0x7F, 0x7F, PitchBend}},
+	} {
+		tr := mustParse(t, test.src+" K")
+		if len(tr.Controls) != 1 || !reflect.DeepEqual(tr.Controls[0], test.want) {
+			t.Errorf("ParseTrack(%q).Controls=%v, want %v", test.src,
+				tr.Controls, test.want)
+		}
+	}
+}
+
+func TestBend(t *testing.T) {
+	tr := mustParse(t, "K bend:-8192 K bend:0..8191,1")
+	if len(tr.Controls) != 34 {
+		t.Fatalf("len(Controls)=%v, want 34", len(tr.Controls))
+	}
+	want := []*Control{{96, 0, 0, PitchBend}, {192, 0, 64, PitchBend},
+		{204, 0x7F, 65, PitchBend}}
+	if !reflect.DeepEqual(tr.Controls[:3], want) {
+		t.Errorf("controls=%v, want %v", tr.Controls[:3], want)
+	}
+	last := &Control{576, 0x7F, 0x7F, PitchBend}
+	if !reflect.DeepEqual(tr.Controls[33], last) {
+		t.Errorf("last control=%v, want %v", tr.Controls[33], last)
+	}
+	tr.BPM = 120
+	b, err := tr.Encode(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(b, []byte{0xE9, 0, 0}) {
+		t.Errorf("Encode()=%v, want pitch bend events", b)
+	}
+
+	for _, src := range []string{"bend:8192", "bend:-8193", "bend:0..1", "bend:0..1,0",
+		"bend:x"} {
+		if _, err := ParseTrack(src); err == nil {
+			t.Errorf("ParseTrack(%q) succeeded, want error", src)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package beatnik
+
+// Metronome tracks.
+
+// Notes and velocities of the clicks of Clicktrack.
+const (
+	ClickNote     = 37  // Sidestick.
+	ClickVelocity = MP  // Velocity of the beats.
+	ClickAccent   = FFF // Velocity of the first beat of each bar.
+)
+
+// Clicktrack returns a metronome track of the given number of bars, with a
+// click on every beat of the time signature and an accent on the first beat
+// of each bar, for practicing. The zero time signature means 4/4. If the
+// time signature is invalid, the track has no hits and fails validation.
+func Clicktrack(bars int, ts TimeSig, bpm uint) *Track {
+	result := &Track{BPM: bpm, TimeSig: ts}
+	if ts == (TimeSig{}) {
+		ts = TimeSig{4, 4}
+	}
+	if !ts.valid() {
+		return result
+	}
+	beat := 96 * 4 / ts.Denom
+	for i := 0; i < bars; i++ {
+		for j := uint(0); j < ts.Num; j++ {
+			v := Velocity(ClickVelocity)
+			if j == 0 {
+				v = ClickAccent
+			}
+			result.Hits = append(result.Hits,
+				&Hit{Notes: map[byte]Velocity{ClickNote: v}, T: beat})
+		}
+	}
+	return result
+}
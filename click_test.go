@@ -0,0 +1,24 @@
+package beatnik
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClicktrack(t *testing.T) {
+	got := Clicktrack(2, TimeSig{3, 8}, 90)
+	want, err := ParseTrack("bpm:90 time:3/8 37++. 37--. 37--. " +
+		"37++. 37--. 37--.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Clicktrack(2,3/8,90)=%v, want %v", got, want)
+	}
+	if got := Clicktrack(4, TimeSig{}, 120).Bars(); got != 4 {
+		t.Errorf("Clicktrack(4,4/4,120).Bars()=%v, want 4", got)
+	}
+	if errs := Clicktrack(1, TimeSig{4, 3}, 120).Validate(); errs == nil {
+		t.Errorf("Clicktrack(1,4/3,120).Validate()=nil, want errors")
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+// Backends command.
+
+import (
+	"fmt"
+
+	"github.com/fluhus/beatnik/backends"
+)
+
+func init() {
+	commands["backends"] = &command{
+		usage: "",
+		help:  "list the playback backends that were compiled in",
+		run:   listBackends,
+	}
+}
+
+// listBackends prints the registered backends and their ports.
+func listBackends(args []string) int {
+	fs := newFlagSet("backends")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	list := backends.List()
+	if len(list) == 0 {
+		fmt.Println("no backends compiled in")
+	}
+	for _, b := range list {
+		fmt.Printf("%-10s %-9s %s\n", b.Name, b.Kind, b.Doc)
+		if b.Ports != nil {
+			for _, p := range b.Ports() {
+				fmt.Printf("  %s\n", p)
+			}
+		}
+	}
+	return 0
+}
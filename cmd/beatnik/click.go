@@ -0,0 +1,57 @@
+package main
+
+// Click command.
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/fluhus/beatnik"
+)
+
+func init() {
+	commands["click"] = &command{
+		usage: "[-o click.mid] [-bars n] [-ts num/denom] [-bpm n]",
+		help:  "write a metronome track for practice",
+		run:   click,
+	}
+}
+
+// click writes a click track to a midi file.
+func click(args []string) int {
+	fs := newFlagSet("click")
+	out := fs.String("o", "click.mid", "Output file.")
+	bars := fs.Int("bars", 16, "Number of bars.")
+	ts := fs.String("ts", "4/4", "Time signature.")
+	bpm := fs.Uint("bpm", 120, "Tempo.")
+	lang := fs.String("lang", beatnik.DefaultLanguage, "Language of error messages.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return 2
+	}
+	var sig beatnik.TimeSig
+	if _, err := fmt.Sscanf(*ts, "%d/%d", &sig.Num, &sig.Denom); err != nil {
+		fmt.Fprintf(os.Stderr, "bad time signature: %q\n", *ts)
+		return 2
+	}
+
+	t := beatnik.Clicktrack(*bars, sig, *bpm)
+	if err := beatnik.ErrorList(t.Validate()); len(err) > 0 {
+		printError(*out, err, *lang)
+		return 1
+	}
+	b, err := t.MarshalBinary()
+	if err != nil {
+		printError(*out, err, *lang)
+		return 1
+	}
+	if err := ioutil.WriteFile(*out, b, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,159 @@
+package main
+
+// Compile command.
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/fluhus/beatnik"
+	"github.com/fluhus/beatnik/pack"
+)
+
+func init() {
+	commands["compile"] = &command{
+		usage: "[-o out.mid] [-n] [-sub n] [-seed n] [-split] [-lang code] file",
+		help:  "compile a score to a midi file",
+		run:   compile,
+	}
+}
+
+// compile parses a source file and writes it as a midi file.
+func compile(args []string) int {
+	fs := newFlagSet("compile")
+	out := fs.String("o", "", "Output file. Default is the input with a .mid extension.")
+	lang := fs.String("lang", beatnik.DefaultLanguage, "Language of error messages.")
+	dry := fs.Bool("n", false, "Dry run: print a report instead of writing the file.")
+	sub := fs.Int("sub", 0, "Add a track of this many clicks per bar, like 16 for sixteenths.")
+	subNote := fs.Uint("sub-note", 37, "Note of the subdivision clicks.")
+	subVel := fs.Uint("sub-vel", uint(beatnik.PP), "Velocity of the subdivision clicks.")
+	seed := fs.Int64("seed", 0, "Seed for choosing the notes that play by chance.")
+	split := fs.Bool("split", false, "Write kicks, snares, cymbals, toms and percussion as separate tracks.")
+	running := fs.Bool("running-status", false, "Leave out repeated status bytes, for smaller files.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	in := fs.Arg(0)
+	if *out == "" {
+		*out = strings.TrimSuffix(in, filepath.Ext(in)) + ".mid"
+	}
+
+	src, err := ioutil.ReadFile(in)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	t, err := parseTrack(in, string(src))
+	if err != nil {
+		printError(in, err, *lang)
+		return 1
+	}
+	song := &beatnik.Song{Tracks: []*beatnik.Track{t}}
+	if *sub != 0 {
+		click, err := t.Subdivision(*sub, byte(*subNote), beatnik.Velocity(*subVel))
+		if err != nil {
+			printError(in, err, *lang)
+			return 1
+		}
+		song.Tracks = append(song.Tracks, click)
+	}
+	opts := &beatnik.EncodeOptions{Seed: *seed, RunningStatus: *running}
+	if *split {
+		opts.TrackGroups = beatnik.DefaultTrackGroups
+	}
+	if *dry {
+		r, err := song.Report(opts)
+		if err != nil {
+			printError(in, err, *lang)
+			return 1
+		}
+		printReport(r)
+		return 0
+	}
+	b, err := song.Encode(opts)
+	if err != nil {
+		printError(in, err, *lang)
+		return 1
+	}
+	if err := ioutil.WriteFile(*out, b, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// parseTrack parses the source of the given file, which may include other
+// files and patterns of downloaded packs. Files with a .tab extension are
+// parsed as ASCII drum tabs.
+func parseTrack(file, src string) (*beatnik.Track, error) {
+	if filepath.Ext(file) == ".tab" {
+		return beatnik.ParseTab(src)
+	}
+	return beatnik.ParseFile(file, func(path string) ([]byte, error) {
+		if path == file {
+			return []byte(src), nil
+		}
+		return openSource(path)
+	})
+}
+
+// openSource reads an included file, or a pattern of a downloaded pack if the
+// path starts with the pack prefix.
+func openSource(path string) ([]byte, error) {
+	if strings.HasPrefix(path, pack.IncludePrefix) {
+		c, err := packClient()
+		if err != nil {
+			return nil, err
+		}
+		return c.Open(path)
+	}
+	return ioutil.ReadFile(path)
+}
+
+// printError prints err to stderr, one line per problem, prefixed with the
+// file name.
+func printError(file string, err error, lang string) {
+	if list, ok := err.(beatnik.ErrorList); ok {
+		for _, e := range list {
+			printError(file, e, lang)
+		}
+		return
+	}
+	if e, ok := err.(*beatnik.Error); ok && e.File != "" {
+		fmt.Fprintln(os.Stderr, e.Localize(lang))
+		return
+	}
+	if e, ok := err.(*beatnik.Error); ok && e.Line > 0 {
+		fmt.Fprintf(os.Stderr, "%s:%s\n", file, e.Localize(lang))
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%s: %s\n", file, beatnik.Localize(err, lang))
+}
+
+// printReport prints a compilation report to stdout.
+func printReport(r *beatnik.Report) {
+	fmt.Printf("bars:     %.2f\n", r.Bars)
+	fmt.Printf("duration: %v\n", r.Duration)
+	fmt.Printf("hits:     %v (%v rests)\n", r.Hits, r.Rests)
+	fmt.Printf("size:     %v bytes\n", r.Size)
+	for i, n := range r.Events {
+		fmt.Printf("track %v:  %v events\n", i+1, n)
+	}
+	var notes []int
+	for n := range r.Notes {
+		notes = append(notes, int(n))
+	}
+	sort.Ints(notes)
+	fmt.Println("notes:")
+	for _, n := range notes {
+		fmt.Printf("  %3v: %v\n", n, r.Notes[byte(n)])
+	}
+}
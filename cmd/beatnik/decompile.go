@@ -0,0 +1,85 @@
+package main
+
+// Decompile command.
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/fluhus/beatnik"
+)
+
+func init() {
+	commands["decompile"] = &command{
+		usage: "[-o out.txt] [-grid n] [-recover] file",
+		help:  "turn a midi file into an editable score",
+		run:   decompile,
+	}
+}
+
+// decompile reads the drum track of a midi file and writes it as a score.
+func decompile(args []string) int {
+	fs := newFlagSet("decompile")
+	out := fs.String("o", "", "Output file. Default is stdout.")
+	grid := fs.Uint("grid", 16, "Quantize notes to this many steps per whole note, or 0 to keep their timing.")
+	lenient := fs.Bool("recover", false, "Read as much as possible of a damaged file.")
+	lang := fs.String("lang", beatnik.DefaultLanguage, "Language of error messages.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	in := fs.Arg(0)
+
+	f, err := os.Open(in)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer f.Close()
+	var t *beatnik.Track
+	if *lenient {
+		var errs []error
+		t, errs = beatnik.RecoverMIDI(f)
+		for _, err := range errs {
+			printError(in, err, *lang)
+		}
+		if t == nil {
+			return 1
+		}
+	} else {
+		t, err = beatnik.ReadMIDI(f)
+		if err != nil {
+			printError(in, err, *lang)
+			return 1
+		}
+	}
+
+	if *grid != 0 {
+		if 384%*grid != 0 {
+			fmt.Fprintf(os.Stderr, "bad grid %v, should divide 384\n", *grid)
+			return 2
+		}
+		t.Quantize(384 / *grid)
+	}
+	b, err := t.MarshalText()
+	if err != nil {
+		printError(in, err, *lang)
+		return 1
+	}
+	b = append([]byte("# Decompiled from "+filepath.Base(in)+"\n"), b...)
+
+	if *out == "" {
+		os.Stdout.Write(b)
+		return 0
+	}
+	if err := ioutil.WriteFile(*out, b, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,64 @@
+package main
+
+// Diff command.
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/fluhus/beatnik"
+)
+
+func init() {
+	commands["diff"] = &command{
+		usage: "[-lang code] old new",
+		help:  "show the changed notes between two scores",
+		run:   diff,
+	}
+}
+
+// diff prints the notes that were added, removed, moved or changed velocity
+// between two scores. Exits with 1 if there are any.
+func diff(args []string) int {
+	fs := newFlagSet("diff")
+	lang := fs.String("lang", beatnik.DefaultLanguage, "Language of error messages.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	var tracks []*beatnik.Track
+	for _, in := range fs.Args() {
+		t, err := readTrack(in)
+		if err != nil {
+			printError(in, err, *lang)
+			return 2
+		}
+		tracks = append(tracks, t)
+	}
+	changes := beatnik.Diff(tracks[0], tracks[1])
+	for _, c := range changes {
+		fmt.Println(c)
+	}
+	if len(changes) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// readTrack reads a score, or the drum track of a midi file.
+func readTrack(file string) (*beatnik.Track, error) {
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if ext := filepath.Ext(file); ext == ".mid" || ext == ".midi" {
+		return beatnik.ReadMIDI(bytes.NewReader(src))
+	}
+	return parseTrack(file, string(src))
+}
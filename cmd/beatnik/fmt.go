@@ -0,0 +1,78 @@
+package main
+
+// Fmt command.
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/fluhus/beatnik"
+)
+
+func init() {
+	commands["fmt"] = &command{
+		usage: "[-w] [-l] [file ...]",
+		help:  "format scores in canonical form",
+		run:   format,
+	}
+}
+
+// format prints the canonical form of source files, or of stdin if no files
+// are given.
+func format(args []string) int {
+	fs := newFlagSet("fmt")
+	write := fs.Bool("w", false, "Write the result to the source file instead of stdout.")
+	list := fs.Bool("l", false, "List files whose formatting differs, instead of printing them.")
+	lang := fs.String("lang", beatnik.DefaultLanguage, "Language of error messages.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if fs.NArg() == 0 {
+		src, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		out, err := beatnik.Format(string(src))
+		if err != nil {
+			printError("<stdin>", err, *lang)
+			return 1
+		}
+		fmt.Print(out)
+		return 0
+	}
+
+	code := 0
+	for _, file := range fs.Args() {
+		src, err := ioutil.ReadFile(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			code = 1
+			continue
+		}
+		out, err := beatnik.Format(string(src))
+		if err != nil {
+			printError(file, err, *lang)
+			code = 1
+			continue
+		}
+		if out == string(src) && (*write || *list) {
+			continue
+		}
+		if *list {
+			fmt.Println(file)
+		}
+		if *write {
+			if err := ioutil.WriteFile(file, []byte(out), 0644); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				code = 1
+			}
+		}
+		if !*list && !*write {
+			fmt.Print(out)
+		}
+	}
+	return code
+}
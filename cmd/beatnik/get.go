@@ -0,0 +1,63 @@
+package main
+
+// Get command.
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/fluhus/beatnik/pack"
+)
+
+func init() {
+	commands["get"] = &command{
+		usage: "[-index url] pack...",
+		help:  "download groove packs from a registry",
+		run:   get,
+	}
+}
+
+// get downloads packs to the local cache, where includes can find them.
+func get(args []string) int {
+	fs := newFlagSet("get")
+	index := fs.String("index", os.Getenv("BEATNIK_INDEX"), "URL of the registry's index. Default is $BEATNIK_INDEX.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	if *index == "" {
+		fmt.Fprintln(os.Stderr, "no registry index, use -index or set BEATNIK_INDEX")
+		return 2
+	}
+	c, err := packClient()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	c.Index = *index
+
+	code := 0
+	for _, name := range fs.Args() {
+		p, err := c.Get(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			code = 1
+			continue
+		}
+		fmt.Printf("%v %v: %v patterns\n", p.Manifest.Name, p.Manifest.Version,
+			len(p.Manifest.Patterns))
+	}
+	return code
+}
+
+// packClient returns a pack client that uses the default cache.
+func packClient() (*pack.Client, error) {
+	dir, err := pack.DefaultCache()
+	if err != nil {
+		return nil, err
+	}
+	return &pack.Client{Cache: dir}, nil
+}
@@ -0,0 +1,58 @@
+package main
+
+// Lint command.
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/fluhus/beatnik"
+)
+
+func init() {
+	commands["lint"] = &command{
+		usage: "[-lang code] file...",
+		help:  "warn about suspicious parts of scores",
+		run:   lint,
+	}
+}
+
+// lint prints the diagnostics of source files. Exits with 1 if there are
+// any.
+func lint(args []string) int {
+	fs := newFlagSet("lint")
+	lang := fs.String("lang", beatnik.DefaultLanguage, "Language of messages.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	code := 0
+	for _, in := range fs.Args() {
+		src, err := ioutil.ReadFile(in)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			code = 1
+			continue
+		}
+		t, err := parseTrack(in, string(src))
+		if err != nil {
+			printError(in, err, *lang)
+			code = 1
+			continue
+		}
+		if filepath.Ext(in) == ".tab" {
+			src = nil // Positions refer to the text syntax.
+		}
+		for _, d := range beatnik.Lint(t, string(src)) {
+			printError(in, d.Error, *lang)
+			code = 1
+		}
+	}
+	return code
+}
@@ -0,0 +1,38 @@
+package main
+
+// Language server command.
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/fluhus/beatnik"
+	"github.com/fluhus/beatnik/lsp"
+)
+
+func init() {
+	commands["lsp"] = &command{
+		usage: "[-lang code]",
+		help:  "run a language server for editors over stdio",
+		run:   runLSP,
+	}
+}
+
+// runLSP serves the language server protocol on stdin and stdout.
+func runLSP(args []string) int {
+	fs := newFlagSet("lsp")
+	lang := fs.String("lang", beatnik.DefaultLanguage, "Language of diagnostic messages.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return 2
+	}
+	s := &lsp.Server{Lang: *lang}
+	if err := s.Serve(os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
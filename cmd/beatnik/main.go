@@ -0,0 +1,72 @@
+// Command beatnik compiles beatnik drum scores to midi files.
+//
+// Usage:
+//
+//	beatnik <command> [flags] [args]
+//
+// Run "beatnik help" for the list of commands.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// A command is a beatnik subcommand.
+type command struct {
+	usage string // Arguments, shown after the command name.
+	help  string // One line description.
+
+	// Runs the command with its arguments. Returns the process exit code.
+	run func(args []string) int
+}
+
+// Maps command names to commands.
+var commands = map[string]*command{}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	name := os.Args[1]
+	if name == "help" || name == "-h" || name == "--help" {
+		usage()
+		return
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "beatnik: unknown command %q\n", name)
+		usage()
+		os.Exit(2)
+	}
+	os.Exit(cmd.run(os.Args[2:]))
+}
+
+// usage prints the list of commands.
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: beatnik <command> [flags] [args]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].help)
+	}
+}
+
+// newFlagSet returns a flag set for the given command, with usage that shows
+// the command's arguments.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: beatnik %s %s\n", name, commands[name].usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
@@ -0,0 +1,119 @@
+package main
+
+// Play command.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/fluhus/beatnik"
+	"github.com/fluhus/beatnik/backends"
+	"github.com/fluhus/beatnik/link"
+)
+
+func init() {
+	commands["play"] = &command{
+		usage: "[-backend name] [-port name] [-clock] [-link] [-lang code] file",
+		help:  "play a score on a midi output port",
+		run:   play,
+	}
+}
+
+// play streams a source file to a midi output port in real time.
+func play(args []string) int {
+	fs := newFlagSet("play")
+	backend := fs.String("backend", "", "Midi output backend. Default is the first one compiled in.")
+	port := fs.String("port", "", "Midi output port. Default is the backend's first port.")
+	clock := fs.Bool("clock", false, "Send midi clock and start and stop messages, for syncing hardware.")
+	syncLink := fs.Bool("link", false, "Follow the tempo and beat of an Ableton Link session.")
+	startStop := fs.Bool("link-startstop", false, "With -link, also follow the session's start and stop.")
+	lang := fs.String("lang", beatnik.DefaultLanguage, "Language of error messages.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	in := fs.Arg(0)
+
+	src, err := ioutil.ReadFile(in)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	t, err := parseTrack(in, string(src))
+	if err != nil {
+		printError(in, err, *lang)
+		return 1
+	}
+	if errs := t.Validate(); len(errs) > 0 {
+		printError(in, beatnik.ErrorList(errs), *lang)
+		return 1
+	}
+
+	out, err := openOutput(*backend, *port)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer out.Close()
+
+	// Stop and silence on interrupt.
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	player := &beatnik.Player{Clock: *clock}
+	if *syncLink {
+		s, err := link.Listen(ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "failed to join link session:", err)
+			return 1
+		}
+		s.StartStop = *startStop
+		fmt.Fprintln(os.Stderr, "Waiting for a Link session...")
+		if err := s.Wait(ctx); err != nil {
+			return 1
+		}
+		player.Transport = s
+	}
+	err = player.Play(ctx, t, writerSink{out})
+	if err == context.Canceled {
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to write to midi port:", err)
+		return 1
+	}
+	return 0
+}
+
+// openOutput opens a midi output port of the named backend, or of the default
+// backend if name is empty.
+func openOutput(name, port string) (io.WriteCloser, error) {
+	be := backends.Default(backends.MIDIOut)
+	if name != "" {
+		be = backends.Get(name)
+	}
+	if be == nil || be.Kind != backends.MIDIOut {
+		return nil, errors.New("no midi output backend, see \"beatnik backends\"")
+	}
+	return be.Open(port)
+}
+
+// A writerSink writes played events to a midi port.
+type writerSink struct {
+	w io.Writer
+}
+
+// Event writes the event to the port.
+func (s writerSink) Event(at time.Duration, data []byte) error {
+	_, err := s.w.Write(data)
+	return err
+}
@@ -0,0 +1,46 @@
+package main
+
+// Serve command.
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/fluhus/beatnik"
+	"github.com/fluhus/beatnik/serve"
+)
+
+func init() {
+	commands["serve"] = &command{
+		usage: "[-addr host:port] [-root dir] [-lang code]",
+		help:  "compile scores posted over http",
+		run:   runServe,
+	}
+}
+
+// runServe serves compilation of posted scores at /compile.
+func runServe(args []string) int {
+	fs := newFlagSet("serve")
+	addr := fs.String("addr", ":8080", "Address to listen on.")
+	root := fs.String("root", "", "Directory that scores may include files from. Default is no includes.")
+	lang := fs.String("lang", beatnik.DefaultLanguage, "Default language of diagnostic messages.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return 2
+	}
+	h := &serve.Handler{Lang: *lang, Sandbox: &beatnik.Sandbox{}}
+	if *root != "" {
+		h.Sandbox.FS = os.DirFS(*root)
+	}
+	http.Handle("/compile", h)
+	fmt.Fprintf(os.Stderr, "Serving on %v\n", *addr)
+	if err := http.ListenAndServe(*addr, nil); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,161 @@
+package main
+
+// Watch command.
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fluhus/beatnik"
+	"github.com/fluhus/beatnik/live"
+)
+
+func init() {
+	commands["watch"] = &command{
+		usage: "[-o out.mid] [-play] [-backend name] [-port name] [-live addr] [-lang code] file",
+		help:  "recompile a score whenever it changes",
+		run:   watch,
+	}
+}
+
+// watch recompiles a source file whenever it is modified, and optionally
+// plays the new version.
+func watch(args []string) int {
+	fs := newFlagSet("watch")
+	out := fs.String("o", "", "Output file. Default is the input with a .mid extension.")
+	replay := fs.Bool("play", false, "Play the score after every successful compilation.")
+	backend := fs.String("backend", "", "Midi output backend for -play. Default is the first one compiled in.")
+	port := fs.String("port", "", "Midi output port for -play. Default is the backend's first port.")
+	liveAddr := fs.String("live", "", "Address to serve the score to browsers on, like :8080.")
+	interval := fs.Duration("interval", 500*time.Millisecond, "How often to check the file for changes.")
+	lang := fs.String("lang", beatnik.DefaultLanguage, "Language of error messages.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	in := fs.Arg(0)
+	if *out == "" {
+		*out = strings.TrimSuffix(in, filepath.Ext(in)) + ".mid"
+	}
+
+	var output io.WriteCloser
+	if *replay {
+		var err error
+		output, err = openOutput(*backend, *port)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer output.Close()
+	}
+
+	var srv *live.Server
+	if *liveAddr != "" {
+		srv = &live.Server{Lang: *lang}
+		defer srv.Close()
+		go func() {
+			if err := http.ListenAndServe(*liveAddr, srv); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}()
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	// Stops the current playback, if any, and waits for it to end.
+	stop := func() {}
+	defer func() { stop() }()
+
+	c := &beatnik.Compiler{Open: openSource}
+	var last time.Time
+	tick := time.NewTicker(*interval)
+	defer tick.Stop()
+	for {
+		if info, err := os.Stat(in); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		} else if !info.ModTime().Equal(last) {
+			last = info.ModTime()
+			t, err := watchCompile(c, in, *out)
+			if err != nil {
+				printError(in, err, *lang)
+				if srv != nil {
+					srv.Error(err)
+				}
+			} else if srv != nil {
+				if err := srv.Track(t); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+				}
+			}
+			if t != nil && (output != nil || srv != nil) {
+				stop()
+				var sink beatnik.EventSink
+				if output != nil {
+					sink = writerSink{output}
+				}
+				if srv != nil {
+					sink = srv.Sink(sink, t)
+				}
+				pctx, pcancel := context.WithCancel(ctx)
+				done := make(chan struct{})
+				go func() {
+					defer close(done)
+					err := (&beatnik.Player{}).Play(pctx, t, sink)
+					if err != nil && err != context.Canceled {
+						fmt.Fprintln(os.Stderr, "failed to write to midi port:", err)
+					}
+				}()
+				stop = func() {
+					pcancel()
+					<-done
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return 0
+		case <-tick.C:
+		}
+	}
+}
+
+// watchCompile compiles a source file to a midi file and reports success.
+// Only the sections that changed since the last call are parsed again.
+// Returns the compiled track.
+func watchCompile(c *beatnik.Compiler, in, out string) (*beatnik.Track, error) {
+	var t *beatnik.Track
+	var err error
+	if filepath.Ext(in) == ".tab" {
+		var src []byte
+		src, err = ioutil.ReadFile(in)
+		if err == nil {
+			t, err = beatnik.ParseTab(string(src))
+		}
+	} else {
+		t, err = c.Compile(in)
+	}
+	if err != nil {
+		return nil, err
+	}
+	b, err := t.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(out, b, 0644); err != nil {
+		return nil, err
+	}
+	fmt.Printf("%s: compiled %s\n", time.Now().Format("15:04:05"), out)
+	return t, nil
+}
@@ -0,0 +1,67 @@
+package beatnik
+
+// Gradual velocity changes.
+
+import (
+	"regexp"
+	"strconv"
+)
+
+// crescToken matches the value of a cresc directive: start and end velocities
+// and a number of bars.
+var crescToken = regexp.MustCompile("^([a-z]+|[0-9]+)\\.\\.([a-z]+|[0-9]+),([0-9]+)$")
+
+// dynamics maps the names of dynamic marks to velocities.
+var dynamics = map[string]int{
+	"ppp": int(PPP),
+	"pp":  PP,
+	"p":   P,
+	"mp":  MP,
+	"mf":  MF,
+	"f":   F,
+	"ff":  FF,
+	"fff": FFF,
+}
+
+// crescDirective changes the velocity of the following hits gradually, as in
+// "cresc:pp..ff,2". The velocity goes from the first dynamic to the second
+// over the given number of bars, and stays at the second after them.
+// Dynamics are marks from ppp to fff, or velocities from 1 to 127. Like vel,
+// the notes' marks make them louder or softer than that.
+func crescDirective(p *parser, s string, at DirectiveContext) error {
+	m := crescToken.FindStringSubmatch(s)
+	if m == nil {
+		return newError(CodeBadCresc, s)
+	}
+	from, ok1 := parseDynamic(m[1])
+	to, ok2 := parseDynamic(m[2])
+	bars, err := strconv.Atoi(m[3])
+	if !ok1 || !ok2 || err != nil || bars < 1 {
+		return newError(CodeBadCresc, s)
+	}
+	start := int(at.Tick)
+	length := bars * int(p.t.timeSig().barTicks())
+	p.vel = func(vars func(string) (int, bool)) (int, error) {
+		// Grace notes take their time from the hit before them, so they
+		// can start before the ramp.
+		tick, _ := vars("tick")
+		if tick < start {
+			tick = start
+		}
+		if tick >= start+length {
+			return to, nil
+		}
+		return from + (to-from)*(tick-start)/length, nil
+	}
+	return nil
+}
+
+// parseDynamic returns the velocity of a dynamic mark like "mf", or of a
+// number from 1 to 127.
+func parseDynamic(s string) (int, bool) {
+	if v, ok := dynamics[s]; ok {
+		return v, true
+	}
+	v, err := strconv.Atoi(s)
+	return v, err == nil && v >= 1 && v <= 127
+}
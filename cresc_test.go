@@ -0,0 +1,47 @@
+package beatnik
+
+import (
+	"testing"
+)
+
+func TestCresc(t *testing.T) {
+	tr := mustParse(t, "K cresc:pp..ff,1 S S S S- S S~")
+	want := []Velocity{F, PP, 98, 106, 107, FF, FF}
+	for i, h := range tr.Hits {
+		for _, v := range h.Notes {
+			if v != want[i] {
+				t.Errorf("hit %v velocity=%v, want %v", i+1, v, want[i])
+			}
+		}
+	}
+
+	tr = mustParse(t, "time:2/4 cresc:100..50,2 K K K K K")
+	want = []Velocity{100, 88, 75, 63, 50}
+	for i, h := range tr.Hits {
+		if v := h.Notes[36]; v != want[i] {
+			t.Errorf("decrescendo hit %v velocity=%v, want %v", i+1, v, want[i])
+		}
+	}
+
+	// The grace note starts before the ramp, and plays at its start.
+	tr = mustParse(t, "K cresc:1..127,1 (S..) S S")
+	want = []Velocity{F, 1, 1, 32}
+	for i, h := range tr.Hits {
+		for _, v := range h.Notes {
+			if v != want[i] {
+				t.Errorf("hit %v with grace note velocity=%v, want %v", i+1,
+					v, want[i])
+			}
+		}
+	}
+}
+
+func TestCresc_bad(t *testing.T) {
+	for _, src := range []string{"cresc:pp..ff", "cresc:pp..xx,1",
+		"cresc:0..ff,1", "cresc:pp..ff,0", "cresc:"} {
+		_, err := ParseTrack(src)
+		if e, ok := err.(*Error); !ok || e.Code != CodeBadCresc {
+			t.Errorf("ParseTrack(%q)=%v, want %v", src, err, CodeBadCresc)
+		}
+	}
+}
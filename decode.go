@@ -0,0 +1,465 @@
+package beatnik
+
+// Decoding of midi files.
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"sort"
+)
+
+// drumChannel is the midi channel of drums (channel 10, counting from 1).
+const drumChannel = 9
+
+// maxMetaLen is the longest meta event payload that is kept in memory. Longer
+// events are skipped.
+const maxMetaLen = 1 << 16
+
+// ReadMIDI reads a standard midi file from r and returns its drum track. Note
+// events on the drum channel (10) of all tracks are merged into hits, and
+// tempo, time signature, text, marker and cue events are kept as track
+// metadata. Ticks are converted to beatnik's 96 per quarter note.
+//
+// The file is decoded as it is read, so only the resulting track is held in
+// memory. Chunks of unknown types are skipped.
+func ReadMIDI(r io.Reader) (*Track, error) {
+	d := &midiDecoder{r: &midiReader{r: bufio.NewReader(r)}}
+	if err := d.header(); err != nil {
+		return nil, err
+	}
+	for {
+		if err := d.chunk(); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return d.track(), nil
+}
+
+// RecoverMIDI reads a possibly damaged midi file from r, like ReadMIDI, and
+// returns as much of its drum track as can be recovered. Chunk lengths are not
+// trusted, bad events and unreadable bytes are skipped, and tracks may end
+// without an end-of-track event or with the end of the file. Returns the
+// problems that were skipped over, or nil if there were none. The track is nil
+// only if r does not start with a midi header.
+func RecoverMIDI(r io.Reader) (*Track, []error) {
+	d := &midiDecoder{r: &midiReader{r: bufio.NewReader(r)}, lenient: true}
+	if err := d.header(); err != nil {
+		return nil, []error{err}
+	}
+	for {
+		if err := d.chunk(); err == io.EOF {
+			break
+		} else if err != nil {
+			d.problems = append(d.problems, err)
+			break
+		}
+	}
+	return d.track(), d.problems
+}
+
+// UnmarshalBinary decodes a complete midi file into the track, replacing its
+// contents. See ReadMIDI.
+func (t *Track) UnmarshalBinary(data []byte) error {
+	result, err := ReadMIDI(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	*t = *result
+	return nil
+}
+
+// A midiReader reads bytes and keeps track of its offset, so that problems can
+// be reported with their position.
+type midiReader struct {
+	r *bufio.Reader
+	n int64 // Number of bytes read.
+}
+
+// truncated returns an error for a file that ended unexpectedly.
+func (m *midiReader) truncated() error {
+	return newError(CodeTruncatedMIDI, m.n)
+}
+
+// readByte reads a single byte.
+func (m *midiReader) readByte() (byte, error) {
+	b, err := m.r.ReadByte()
+	if err != nil {
+		return 0, m.truncated()
+	}
+	m.n++
+	return b, nil
+}
+
+// read reads exactly n bytes.
+func (m *midiReader) read(n int) ([]byte, error) {
+	b := make([]byte, n)
+	nn, err := io.ReadFull(m.r, b)
+	m.n += int64(nn)
+	if err != nil {
+		return nil, m.truncated()
+	}
+	return b, nil
+}
+
+// skip discards exactly n bytes.
+func (m *midiReader) skip(n int64) error {
+	nn, err := io.CopyN(ioutil.Discard, m.r, n)
+	m.n += nn
+	if err != nil {
+		return m.truncated()
+	}
+	return nil
+}
+
+// uint32 reads a big-endian 32-bit integer.
+func (m *midiReader) uint32() (uint32, error) {
+	b, err := m.read(4)
+	if err != nil {
+		return 0, err
+	}
+	return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3]),
+		nil
+}
+
+// uvarint reads a big-endian variable length int of at most 4 bytes.
+func (m *midiReader) uvarint() (uint, error) {
+	var result uint
+	for i := 0; i < 4; i++ {
+		b, err := m.readByte()
+		if err != nil {
+			return 0, err
+		}
+		result = result<<7 | uint(b&127)
+		if b < 128 {
+			return result, nil
+		}
+	}
+	return 0, newError(CodeBadMIDIEvent, m.n)
+}
+
+// A midiDecoder collects the drum events of a midi file.
+type midiDecoder struct {
+	r        *midiReader
+	division uint         // Ticks per quarter note.
+	notes    []drumStrike // Strikes in file ticks.
+	meta     []*Meta      // Meta events in file ticks.
+	end      uint         // Latest end of track, in file ticks.
+
+	lenient  bool    // Recover from problems instead of failing.
+	problems []error // Problems recovered from in lenient mode.
+	lastBad  int64   // Offset of the last bad event in lenient mode.
+}
+
+// A drumStrike is a single note-on event.
+type drumStrike struct {
+	t    uint
+	note byte
+	vel  Velocity
+}
+
+// header reads the header chunk.
+func (d *midiDecoder) header() error {
+	typ, err := d.r.read(4)
+	if err != nil || string(typ) != "MThd" {
+		return newError(CodeBadMIDIHeader)
+	}
+	n, err := d.r.uint32()
+	if err != nil {
+		return err
+	}
+	if n < 6 {
+		return newError(CodeBadMIDIHeader)
+	}
+	b, err := d.r.read(6)
+	if err != nil {
+		return err
+	}
+	if b[4]&0x80 != 0 {
+		return newError(CodeSMPTEDivision)
+	}
+	d.division = uint(b[4])<<8 | uint(b[5])
+	if d.division == 0 {
+		return newError(CodeBadMIDIHeader)
+	}
+	return d.r.skip(int64(n) - 6)
+}
+
+// chunk reads a single chunk. Returns io.EOF if there are no more chunks.
+func (d *midiDecoder) chunk() error {
+	if d.lenient {
+		return d.lenientChunk()
+	}
+	if _, err := d.r.r.Peek(1); err == io.EOF {
+		return io.EOF
+	}
+	start := d.r.n
+	typ, err := d.r.read(4)
+	if err != nil {
+		return err
+	}
+	n, err := d.r.uint32()
+	if err != nil {
+		return err
+	}
+	if string(typ) != "MTrk" {
+		return d.r.skip(int64(n))
+	}
+	return d.events(start, d.r.n+int64(n))
+}
+
+// lenientChunk reads the next track chunk, ignoring anything before it.
+// Returns io.EOF if there are no more track chunks.
+func (d *midiDecoder) lenientChunk() error {
+	start := d.r.n
+	for !d.atTrack() {
+		if _, err := d.r.r.ReadByte(); err != nil {
+			if d.r.n > start {
+				d.problems = append(d.problems,
+					newError(CodeSkippedBytes, d.r.n-start, start))
+			}
+			return io.EOF
+		}
+		d.r.n++
+	}
+	if d.r.n > start {
+		d.problems = append(d.problems,
+			newError(CodeSkippedBytes, d.r.n-start, start))
+	}
+	start = d.r.n
+	d.r.skip(4)
+	n, err := d.r.uint32()
+	if err != nil {
+		return err
+	}
+	return d.events(start, d.r.n+int64(n))
+}
+
+// atTrack returns true if the next bytes are the start of a track chunk.
+func (d *midiDecoder) atTrack() bool {
+	b, _ := d.r.r.Peek(4)
+	return string(b) == "MTrk"
+}
+
+// bad reports a bad event at the given offset. In lenient mode the problem is
+// recorded and nil is returned, so that decoding can go on.
+func (d *midiDecoder) bad(pos int64) error {
+	if !d.lenient {
+		return newError(CodeBadMIDIEvent, pos)
+	}
+	// Report a run of bad bytes once.
+	if d.lastBad == 0 || pos > d.lastBad+4 {
+		d.problems = append(d.problems, newError(CodeBadMIDIEvent, pos))
+	}
+	d.lastBad = pos
+	return nil
+}
+
+// events reads the events of a track chunk that starts and ends at the given
+// offsets. In lenient mode the chunk's length is not trusted, and events are
+// read until an end-of-track event or the next track chunk.
+func (d *midiDecoder) events(start, end int64) error {
+	var t uint
+	var running byte // Running status, 0 if none.
+	for d.r.n < end || d.lenient {
+		if d.lenient {
+			if _, err := d.r.r.Peek(1); err != nil || d.atTrack() {
+				d.problems = append(d.problems, newError(CodeMissingEOT, start))
+				return nil
+			}
+		}
+		pos := d.r.n
+		delta, err := d.r.uvarint()
+		if e, ok := err.(*Error); ok && e.Code == CodeBadMIDIEvent {
+			if err := d.bad(pos); err != nil {
+				return err
+			}
+			continue
+		} else if err != nil {
+			return err
+		}
+		t += delta
+		status, err := d.r.readByte()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case status == 0xFF:
+			running = 0
+			done, err := d.metaEvent(t, end)
+			if err != nil {
+				return err
+			}
+			if done && d.lenient {
+				if d.r.n != end {
+					d.problems = append(d.problems, newError(CodeBadChunkLength,
+						start, end-start-8, d.r.n-start-8))
+				}
+				return nil
+			}
+			if done {
+				return d.r.skip(end - d.r.n)
+			}
+			continue
+		case status == 0xF0 || status == 0xF7:
+			running = 0
+			n, err := d.r.uvarint()
+			if err != nil {
+				return err
+			}
+			if err := d.r.skip(int64(n)); err != nil {
+				return err
+			}
+			continue
+		case status > 0xF0:
+			if err := d.bad(d.r.n - 1); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Channel event.
+		var data [2]byte
+		i := 0
+		if status < 0x80 {
+			if running == 0 {
+				if err := d.bad(d.r.n - 1); err != nil {
+					return err
+				}
+				continue
+			}
+			data[0], status, i = status, running, 1
+		}
+		running = status
+		n := 2
+		if status&0xF0 == 0xC0 || status&0xF0 == 0xD0 {
+			n = 1
+		}
+		for ; i < n; i++ {
+			if data[i], err = d.r.readByte(); err != nil {
+				return err
+			}
+		}
+		if status == 0x90|drumChannel && data[1] > 0 {
+			d.notes = append(d.notes, drumStrike{t, data[0], Velocity(data[1])})
+		}
+		if t > d.end {
+			d.end = t
+		}
+	}
+	if d.r.n > end {
+		return newError(CodeBadMIDIEvent, end)
+	}
+	return nil
+}
+
+// metaEvent reads a meta event at tick t, after its 0xFF status byte. Returns
+// true if it is an end-of-track event.
+func (d *midiDecoder) metaEvent(t uint, end int64) (bool, error) {
+	typ, err := d.r.readByte()
+	if err != nil {
+		return false, err
+	}
+	n, err := d.r.uvarint()
+	if err != nil {
+		return false, err
+	}
+	if (!d.lenient && int64(n) > end-d.r.n) || n > maxMetaLen {
+		return false, d.r.skip(int64(n))
+	}
+	data, err := d.r.read(int(n))
+	if err != nil {
+		return false, err
+	}
+	if t > d.end {
+		d.end = t
+	}
+	switch typ {
+	case 0x2F:
+		return true, nil
+	case MetaTempo, 0x58:
+		if (typ == MetaTempo && n == 3) || (typ == 0x58 && n == 4) {
+			d.meta = append(d.meta, &Meta{t, typ, data})
+		}
+	case MetaText, MetaTrackName, MetaMarker, MetaCue:
+		d.meta = append(d.meta, &Meta{t, typ, data})
+	}
+	return false, nil
+}
+
+// ticks converts file ticks to beatnik ticks.
+func (d *midiDecoder) ticks(t uint) uint {
+	return (t*96 + d.division/2) / d.division
+}
+
+// track returns the decoded events as a track.
+func (d *midiDecoder) track() *Track {
+	t := &Track{}
+
+	// Meta events. The tempo is 120 BPM until the first tempo event.
+	sort.SliceStable(d.meta, func(i, j int) bool {
+		return d.meta[i].T < d.meta[j].T
+	})
+	tempos := []TempoChange{{0, 120}}
+	for _, m := range d.meta {
+		m.T = d.ticks(m.T)
+		switch m.Type {
+		case 0x58:
+			if m.T == 0 && m.Data[1] <= 6 {
+				t.TimeSig = TimeSig{uint(m.Data[0]), 1 << m.Data[1]}
+			}
+		case MetaTempo:
+			tempos = append(tempos, TempoChange{m.T, m.bpm()})
+		default:
+			t.Meta = append(t.Meta, m)
+		}
+	}
+	t.SetTempoMap(NewTempoMap(tempos...))
+	if t.TimeSig == (TimeSig{4, 4}) {
+		t.TimeSig = TimeSig{}
+	}
+
+	for i := range d.notes {
+		d.notes[i].t = d.ticks(d.notes[i].t)
+	}
+	t.Hits = strikeHits(d.notes, d.ticks(d.end))
+	return t
+}
+
+// strikeHits returns hits that play the given strikes, merging strikes on the
+// same tick. The last hit lasts until end, or until the end of its beat if end
+// is not after it. Returns nil if there are no strikes.
+func strikeHits(strikes []drumStrike, end uint) []*Hit {
+	sort.SliceStable(strikes, func(i, j int) bool {
+		return strikes[i].t < strikes[j].t
+	})
+	var result []*Hit
+	var tick uint // Tick of the last hit.
+	for _, s := range strikes {
+		if len(result) == 0 || s.t > tick {
+			if len(result) == 0 && s.t > 0 {
+				result = append(result, &Hit{T: s.t})
+			} else if len(result) > 0 {
+				result[len(result)-1].T = s.t - tick
+			}
+			result = append(result, &Hit{Notes: map[byte]Velocity{}})
+			tick = s.t
+		}
+		h := result[len(result)-1]
+		if s.vel > h.Notes[s.note] {
+			h.Notes[s.note] = s.vel
+		}
+	}
+
+	if len(result) > 0 {
+		if end <= tick {
+			end = (tick/96 + 1) * 96
+		}
+		result[len(result)-1].T = end - tick
+	}
+	return result
+}
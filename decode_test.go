@@ -0,0 +1,153 @@
+package beatnik
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestReadMIDI_roundTrip(t *testing.T) {
+	srcs := []string{
+		"bpm:90 K,HC S,HC. K,HC.. S,HC~",
+		"bpm:140 time:7/8 marker:A K. S.. marker:B K S+ HC-",
+		"bpm:60 K.. bpm:120 S.. cue:x K",
+	}
+	for _, src := range srcs {
+		want, err := ParseTrack(src)
+		if err != nil {
+			t.Fatalf("ParseTrack(%q) failed: %v", src, err)
+		}
+		b, err := want.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary(%q) failed: %v", src, err)
+		}
+		got, err := ReadMIDI(bytes.NewReader(b))
+		if err != nil {
+			t.Fatalf("ReadMIDI(%q) failed: %v", src, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("ReadMIDI(%q)=%v, want %v", src, got, want)
+		}
+	}
+}
+
+func TestReadMIDI(t *testing.T) {
+	b := []byte{
+		'M', 'T', 'h', 'd', 0, 0, 0, 6, 0, 1, 0, 2, 1, 0xE0, // 480 PPQ.
+		'X', 'Y', 'Z', 'W', 0, 0, 0, 3, 1, 2, 3, // Unknown chunk.
+		'M', 'T', 'r', 'k', 0, 0, 0, 24,
+		0, 0x99, 36, 100, // Kick.
+		0, 0xC0, 5, // Program change on another channel.
+		0x83, 0x60, 0x89, 36, 64, // Kick off after 480 ticks.
+		0, 0x99, 38, 90, // Snare, running status below.
+		0, 42, 80,
+		0x81, 0x70, 0xFF, 0x2F, 0, // End after 240 ticks.
+	}
+	want := &Track{BPM: 120, Hits: []*Hit{
+		{Notes: map[byte]Velocity{36: 100}, T: 96},
+		{Notes: map[byte]Velocity{38: 90, 42: 80}, T: 48},
+	}}
+	got, err := ReadMIDI(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("ReadMIDI() failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadMIDI()=%v, want %v", got, want)
+	}
+}
+
+func TestReadMIDI_tempo(t *testing.T) {
+	b := []byte{
+		'M', 'T', 'h', 'd', 0, 0, 0, 6, 0, 0, 0, 1, 1, 0xE0, // 480 PPQ.
+		'M', 'T', 'r', 'k', 0, 0, 0, 24,
+		0, 0x99, 36, 100, // Kick.
+		0x83, 0x60, 0xFF, 0x51, 3, 0x0F, 0x42, 0x40, // 60 BPM after 480 ticks.
+		0, 0xFF, 0x51, 3, 0x09, 0x27, 0xC0, // 100 BPM on the same tick.
+		0x83, 0x60, 0xFF, 0x2F, 0, // End after 480 ticks.
+	}
+	want := &Track{BPM: 120, Meta: []*Meta{tempoMeta(96, 100)}, Hits: []*Hit{
+		{Notes: map[byte]Velocity{36: 100}, T: 192},
+	}}
+	got, err := ReadMIDI(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("ReadMIDI() failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadMIDI()=%v, want %v", got, want)
+	}
+}
+
+func TestReadMIDI_bad(t *testing.T) {
+	tr, _ := ParseTrack("bpm:100 K S K S")
+	b, _ := tr.MarshalBinary()
+	tests := []struct {
+		b    []byte
+		code Code
+	}{
+		{[]byte("MThx"), CodeBadMIDIHeader},
+		{[]byte{'M', 'T', 'h', 'd', 0, 0, 0, 6, 0, 1, 0, 1, 0xE7, 0x28}, CodeSMPTEDivision},
+		{b[:len(b)-5], CodeTruncatedMIDI},
+		{append(b[:len(b):len(b)], 'M', 'T', 'r', 'k', 0, 0, 0, 2, 0, 0x40),
+			CodeBadMIDIEvent},
+	}
+	for _, test := range tests {
+		_, err := ReadMIDI(bytes.NewReader(test.b))
+		if e, ok := err.(*Error); !ok || e.Code != test.code {
+			t.Errorf("ReadMIDI(%v) error=%v, want %v", test.b, err, test.code)
+		}
+	}
+}
+
+func TestRecoverMIDI(t *testing.T) {
+	want, _ := ParseTrack("bpm:100 marker:A K,HC HC S,HC HC")
+	b, _ := want.MarshalBinary()
+	hits := bytes.LastIndex(b, []byte("MTrk"))
+
+	// Returns a copy of b with the given bytes replacing b[i:j].
+	edit := func(i, j int, x ...byte) []byte {
+		result := append([]byte{}, b[:i]...)
+		result = append(result, x...)
+		return append(result, b[j:]...)
+	}
+
+	tests := []struct {
+		b     []byte
+		codes []Code
+	}{
+		{b, nil},
+		{edit(hits+4, hits+8, 0, 0, 0xFF, 0xFF), []Code{CodeBadChunkLength}},
+		{edit(hits+4, hits+8, 0, 0, 0, 1), []Code{CodeBadChunkLength}},
+		{b[:len(b)-4], []Code{CodeMissingEOT}},
+		{edit(hits, hits, 1, 2, 3), []Code{CodeSkippedBytes}},
+		{edit(hits+8, hits+8, 0, 0xF4), []Code{CodeBadMIDIEvent, CodeBadChunkLength}},
+	}
+	for i, test := range tests {
+		got, errs := RecoverMIDI(bytes.NewReader(test.b))
+		var codes []Code
+		for _, err := range errs {
+			codes = append(codes, err.(*Error).Code)
+		}
+		if !reflect.DeepEqual(codes, test.codes) {
+			t.Errorf("#%v RecoverMIDI() errors=%v, want %v", i+1, errs, test.codes)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("#%v RecoverMIDI()=%v, want %v", i+1, got, want)
+		}
+	}
+}
+
+func TestRecoverMIDI_truncated(t *testing.T) {
+	tr, _ := ParseTrack("bpm:100 K S K S")
+	b, _ := tr.MarshalBinary()
+	got, errs := RecoverMIDI(bytes.NewReader(b[:len(b)-10]))
+	if len(errs) != 1 || errs[0].(*Error).Code != CodeTruncatedMIDI {
+		t.Errorf("RecoverMIDI() errors=%v, want %v", errs, CodeTruncatedMIDI)
+	}
+	if got == nil || len(got.Hits) != 3 {
+		t.Errorf("RecoverMIDI()=%v, want 3 hits", got)
+	}
+	if got, errs := RecoverMIDI(bytes.NewReader([]byte("RIFF"))); got != nil ||
+		len(errs) != 1 {
+		t.Errorf("RecoverMIDI(RIFF)=%v,%v, want nil and 1 error", got, errs)
+	}
+}
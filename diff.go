@@ -0,0 +1,200 @@
+package beatnik
+
+// Differences between tracks.
+
+import (
+	"fmt"
+	"sort"
+)
+
+// maxMove is the largest distance in ticks that a note can move between two
+// tracks and still count as the same note, a sixteenth.
+const maxMove = 24
+
+// A ChangeKind is a kind of difference in a note between two tracks.
+type ChangeKind int
+
+// Change kinds.
+const (
+	NoteAdded       ChangeKind = iota // The note is only in the second track.
+	NoteRemoved                       // The note is only in the first track.
+	NoteMoved                         // The note is played at another tick.
+	VelocityChanged                   // The note is played at another velocity.
+)
+
+// String returns the name of the change kind.
+func (k ChangeKind) String() string {
+	switch k {
+	case NoteAdded:
+		return "added"
+	case NoteRemoved:
+		return "removed"
+	case NoteMoved:
+		return "moved"
+	case VelocityChanged:
+		return "velocity"
+	}
+	return fmt.Sprintf("ChangeKind(%d)", int(k))
+}
+
+// A Change is a difference in a single strike of a note between two tracks.
+type Change struct {
+	Kind ChangeKind
+	Note byte
+
+	// Position of the strike, with its timing offset, in the first track, or
+	// in the second for added notes. Bar and beat are 1-based, by the time
+	// signature of that track, and Tick is the tick in the beat.
+	T         uint
+	Bar, Beat int
+	Tick      uint
+
+	// Ticks the note moved by, negative is earlier. Only for moved notes.
+	Move int
+
+	// Velocity of the note in each track. OldVelocity is 0 for added notes,
+	// and NewVelocity is 0 for removed notes.
+	OldVelocity, NewVelocity Velocity
+}
+
+// String returns the change in musical terms, like "2:3 S removed" or
+// "1:1+12 HC moved 6 ticks later".
+func (c Change) String() string {
+	pos := fmt.Sprintf("%v:%v", c.Bar, c.Beat)
+	if c.Tick != 0 {
+		pos += fmt.Sprintf("+%v", c.Tick)
+	}
+	name := fmt.Sprint(c.Note)
+	if n, ok := noteNames[c.Note]; ok {
+		name = n
+	}
+
+	var what string
+	switch c.Kind {
+	case NoteAdded:
+		what = fmt.Sprintf("added (velocity %v)", c.NewVelocity)
+	case NoteRemoved:
+		what = "removed"
+	case NoteMoved:
+		if c.Move < 0 {
+			what = fmt.Sprintf("moved %v ticks earlier", -c.Move)
+		} else {
+			what = fmt.Sprintf("moved %v ticks later", c.Move)
+		}
+		if c.OldVelocity != c.NewVelocity {
+			what += fmt.Sprintf(", velocity %v -> %v", c.OldVelocity,
+				c.NewVelocity)
+		}
+	case VelocityChanged:
+		what = fmt.Sprintf("velocity %v -> %v", c.OldVelocity, c.NewVelocity)
+	}
+	return fmt.Sprintf("%v %v %v", pos, name, what)
+}
+
+// Diff returns the differences between the notes of two tracks, ordered by
+// position. Each strike of a note in a is matched with a strike of the same
+// note in b, preferring strikes at the same tick. A strike that is matched
+// within a sixteenth of its tick has moved. Timing offsets count as part of
+// the strikes' ticks, and chances, meta events and controls are ignored.
+func Diff(a, b *Track) []Change {
+	as, bs := a.strikes(), b.strikes()
+	var notes []byte
+	for n := range as {
+		notes = append(notes, n)
+	}
+	for n := range bs {
+		if as[n] == nil {
+			notes = append(notes, n)
+		}
+	}
+	sort.Slice(notes, func(i, j int) bool { return notes[i] < notes[j] })
+
+	var result []Change
+	for _, n := range notes {
+		result = append(result, diffNote(n, as[n], bs[n])...)
+	}
+	ats, bts := a.timeSig(), b.timeSig()
+	for i := range result {
+		c := &result[i]
+		ts := ats
+		if c.Kind == NoteAdded {
+			ts = bts
+		}
+		beat := 96 * 4 / ts.Denom
+		c.Bar = int(c.T/ts.barTicks()) + 1
+		c.Beat = int(c.T%ts.barTicks()/beat) + 1
+		c.Tick = c.T % beat
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].T != result[j].T {
+			return result[i].T < result[j].T
+		}
+		return result[i].Note < result[j].Note
+	})
+	return result
+}
+
+// strikes returns the velocity of each strike of each note of the track, by
+// note and tick, with timing offsets. Notes played before the start of the
+// track are taken to be at tick 0.
+func (t *Track) strikes() map[byte]map[uint]Velocity {
+	result := map[byte]map[uint]Velocity{}
+	tick := 0
+	for _, h := range t.Hits {
+		for n, v := range h.Notes {
+			at := tick + h.Offsets[n]
+			if at < 0 {
+				at = 0
+			}
+			if result[n] == nil {
+				result[n] = map[uint]Velocity{}
+			}
+			if v > result[n][uint(at)] {
+				result[n][uint(at)] = v
+			}
+		}
+		tick += int(h.T)
+	}
+	return result
+}
+
+// diffNote returns the changes in the strikes of a single note, given by tick
+// in each track.
+func diffNote(n byte, a, b map[uint]Velocity) []Change {
+	var result []Change
+	var ta, tb []uint // Unmatched ticks.
+	for t, v := range a {
+		if w, ok := b[t]; !ok {
+			ta = append(ta, t)
+		} else if v != w {
+			result = append(result, Change{Kind: VelocityChanged, Note: n, T: t,
+				OldVelocity: v, NewVelocity: w})
+		}
+	}
+	for t := range b {
+		if _, ok := a[t]; !ok {
+			tb = append(tb, t)
+		}
+	}
+	sort.Slice(ta, func(i, j int) bool { return ta[i] < ta[j] })
+	sort.Slice(tb, func(i, j int) bool { return tb[i] < tb[j] })
+
+	for len(ta) > 0 || len(tb) > 0 {
+		switch {
+		case len(tb) == 0 || len(ta) > 0 && ta[0]+maxMove < tb[0]:
+			result = append(result, Change{Kind: NoteRemoved, Note: n, T: ta[0],
+				OldVelocity: a[ta[0]]})
+			ta = ta[1:]
+		case len(ta) == 0 || tb[0]+maxMove < ta[0]:
+			result = append(result, Change{Kind: NoteAdded, Note: n, T: tb[0],
+				NewVelocity: b[tb[0]]})
+			tb = tb[1:]
+		default:
+			result = append(result, Change{Kind: NoteMoved, Note: n, T: ta[0],
+				Move: int(tb[0]) - int(ta[0]), OldVelocity: a[ta[0]],
+				NewVelocity: b[tb[0]]})
+			ta, tb = ta[1:], tb[1:]
+		}
+	}
+	return result
+}
@@ -0,0 +1,49 @@
+package beatnik
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	a, err := ParseTrack("HC,K. HC. HC,S. HC. | K HC,S. C1. T1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ParseTrack("HC,K. HC@6. HC,S-. HC. | K. HC. HC,S. C1. C1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := Diff(a, b)
+	want := []Change{
+		{Kind: NoteMoved, Note: 22, T: 48, Bar: 1, Beat: 1, Tick: 48, Move: 6,
+			OldVelocity: F, NewVelocity: F},
+		{Kind: VelocityChanged, Note: 38, T: 96, Bar: 1, Beat: 2,
+			OldVelocity: F, NewVelocity: MF},
+		{Kind: NoteAdded, Note: 22, T: 240, Bar: 1, Beat: 3, Tick: 48,
+			NewVelocity: F},
+		{Kind: NoteRemoved, Note: ezDrummer["T1"], T: 384, Bar: 2, Beat: 1,
+			OldVelocity: F},
+		{Kind: NoteAdded, Note: ezDrummer["C1"], T: 384, Bar: 2, Beat: 1,
+			NewVelocity: F},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Diff()=%v, want %v", got, want)
+	}
+	if got := Diff(a, a); got != nil {
+		t.Errorf("Diff(a, a)=%v, want nil", got)
+	}
+
+	wantStrings := []string{
+		"1:1+48 HC moved 6 ticks later",
+		"1:2 S velocity 115 -> 109",
+		"1:3+48 HC added (velocity 115)",
+		"2:1 T1 removed",
+		"2:1 C1 added (velocity 115)",
+	}
+	for i, want := range wantStrings {
+		if s := got[i].String(); s != want {
+			t.Errorf("Changes[%v].String()=%q, want %q", i, s, want)
+		}
+	}
+}
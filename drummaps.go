@@ -1,5 +1,11 @@
 package beatnik
 
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
 // Windows MIDI synth note mapping.
 var windowsSynth = map[string]byte{
 	"K": 36, // Kick
@@ -73,4 +79,665 @@ var ezDrummer = map[string]byte{
 	"T4R": 75, // Tom 4 rimshot
 	"T5":  41, // Tom 5
 	"T5R": 73, // Tom 5 rimshot
+
+	// Articulations of drums, after a dot.
+	"S.rim":    40, // Snare rimshot
+	"S.side":   37, // Snare sidestick
+	"HC.edge":  22, // Hi-hat closed (edge)
+	"HC.tip":   42, // Hi-hat closed (tip)
+	"HT.edge":  62, // Hi-hat tight (edge)
+	"HT.tip":   63, // Hi-hat tight (tip)
+	"HP.open":  23, // Hi-hat pedal (open)
+	"C1.choke": 56, // Crash 1 muted
+	"C2.choke": 50, // Crash 2 muted
+	"C3.choke": 58, // Crash 3 muted
+	"C4.choke": 54, // Crash 4 muted
+	"R.bell":   53, // Ride bell
+	"R.bow":    51, // Ride bow
+	"R.choke":  83, // Ride muted
+	"T1.rim":   82, // Tom 1 rimshot
+	"T2.rim":   80, // Tom 2 rimshot
+	"T3.rim":   78, // Tom 3 rimshot
+	"T4.rim":   75, // Tom 4 rimshot
+	"T5.rim":   73, // Tom 5 rimshot
+}
+
+// Descriptions of Windows MIDI synth drum names.
+var windowsSynthDescriptions = map[string]string{
+	"K": "Kick",
+
+	"SS": "Snare sidestick",
+	"S":  "Snare",
+
+	"HC": "Hi-hat closed",
+	"HO": "Hi-hat open",
+	"HP": "Hi-hat pedal",
+
+	"C1": "Crash 1",
+	"C2": "Crash 2",
+	"C3": "Chinese cymbal",
+	"C4": "Splash cymbal",
+
+	"R1": "Ride 1",
+	"R2": "Ride 2",
+	"RB": "Ride bell",
+
+	"T1": "Tom 1",
+	"T2": "Tom 2",
+	"T3": "Tom 3",
+	"T4": "Tom 4",
+	"T5": "Tom 5",
+	"T6": "Tom 6",
+}
+
+// Descriptions of EZdrummer 2 drum names.
+var ezDrummerDescriptions = map[string]string{
+	"K": "Kick",
+
+	"S":  "Snare",
+	"SR": "Snare rimshot",
+	"SS": "Snare sidestick",
+
+	"HC":  "Hi-hat closed (edge)",
+	"HCT": "Hi-hat closed (tip)",
+	"HT":  "Hi-hat tight (edge)",
+	"HTT": "Hi-hat tight (tip)",
+	"HO1": "Hi-hat open 1",
+	"HO2": "Hi-hat open 2",
+	"HO3": "Hi-hat open 3",
+	"HO4": "Hi-hat open 4",
+	"HO5": "Hi-hat open 5",
+	"HP":  "Hi-hat pedal (closed)",
+	"HPO": "Hi-hat pedal (open)",
+	"HS":  "Hi-hat seq hits",
+
+	"C1":  "Crash 1",
+	"C1M": "Crash 1 muted",
+	"C2":  "Crash 2",
+	"C2M": "Crash 2 muted",
+	"C3":  "Crash 3",
+	"C3M": "Crash 3 muted",
+	"C4":  "Crash 4",
+	"C4M": "Crash 4 muted",
+
+	"R":  "Ride",
+	"RB": "Ride bell",
+	"RW": "Ride bow",
+	"RM": "Ride muted",
+
+	"T1":  "Tom 1",
+	"T1R": "Tom 1 rimshot",
+	"T2":  "Tom 2",
+	"T2R": "Tom 2 rimshot",
+	"T3":  "Tom 3",
+	"T3R": "Tom 3 rimshot",
+	"T4":  "Tom 4",
+	"T4R": "Tom 4 rimshot",
+	"T5":  "Tom 5",
+	"T5R": "Tom 5 rimshot",
+
+	"S.rim":    "Snare rimshot",
+	"S.side":   "Snare sidestick",
+	"HC.edge":  "Hi-hat closed (edge)",
+	"HC.tip":   "Hi-hat closed (tip)",
+	"HT.edge":  "Hi-hat tight (edge)",
+	"HT.tip":   "Hi-hat tight (tip)",
+	"HP.open":  "Hi-hat pedal (open)",
+	"C1.choke": "Crash 1 muted",
+	"C2.choke": "Crash 2 muted",
+	"C3.choke": "Crash 3 muted",
+	"C4.choke": "Crash 4 muted",
+	"R.bell":   "Ride bell",
+	"R.bow":    "Ride bow",
+	"R.choke":  "Ride muted",
+	"T1.rim":   "Tom 1 rimshot",
+	"T2.rim":   "Tom 2 rimshot",
+	"T3.rim":   "Tom 3 rimshot",
+	"T4.rim":   "Tom 4 rimshot",
+	"T5.rim":   "Tom 5 rimshot",
+}
+
+// Superior Drummer 3 note mapping.
+var superiorDrummer = map[string]byte{
+	"K": 36, // Kick
+
+	"S":  38, // Snare
+	"SR": 40, // Snare rimshot
+	"SS": 37, // Snare sidestick
+
+	"HC":  22, // Hi-hat closed (edge)
+	"HCT": 42, // Hi-hat closed (tip)
+	"HT":  62, // Hi-hat tight (edge)
+	"HTT": 63, // Hi-hat tight (tip)
+	"HO1": 24, // Hi-hat open 1
+	"HO2": 25, // Hi-hat open 2
+	"HO3": 26, // Hi-hat open 3
+	"HO4": 60, // Hi-hat open 4
+	"HO5": 17, // Hi-hat open 5
+	"HP":  21, // Hi-hat pedal (closed)
+	"HPO": 23, // Hi-hat pedal (open)
+
+	"C1":  55, // Crash 1
+	"C1M": 56, // Crash 1 muted
+	"C2":  49, // Crash 2
+	"C2M": 50, // Crash 2 muted
+	"CH":  52, // China
+	"CHM": 54, // China muted
+	"SP":  57, // Splash
+
+	"R":  51, // Ride (tip)
+	"RE": 59, // Ride edge
+	"RB": 53, // Ride bell
+	"RM": 83, // Ride muted
+
+	"T1":  48, // Tom 1
+	"T1R": 82, // Tom 1 rimshot
+	"T2":  47, // Tom 2
+	"T2R": 80, // Tom 2 rimshot
+	"T3":  45, // Tom 3
+	"T3R": 78, // Tom 3 rimshot
+	"T4":  43, // Tom 4
+	"T4R": 75, // Tom 4 rimshot
+}
+
+// Descriptions of Superior Drummer 3 drum names.
+var superiorDrummerDescriptions = map[string]string{
+	"K": "Kick",
+
+	"S":  "Snare",
+	"SR": "Snare rimshot",
+	"SS": "Snare sidestick",
+
+	"HC":  "Hi-hat closed (edge)",
+	"HCT": "Hi-hat closed (tip)",
+	"HT":  "Hi-hat tight (edge)",
+	"HTT": "Hi-hat tight (tip)",
+	"HO1": "Hi-hat open 1",
+	"HO2": "Hi-hat open 2",
+	"HO3": "Hi-hat open 3",
+	"HO4": "Hi-hat open 4",
+	"HO5": "Hi-hat open 5",
+	"HP":  "Hi-hat pedal (closed)",
+	"HPO": "Hi-hat pedal (open)",
+
+	"C1":  "Crash 1",
+	"C1M": "Crash 1 muted",
+	"C2":  "Crash 2",
+	"C2M": "Crash 2 muted",
+	"CH":  "China",
+	"CHM": "China muted",
+	"SP":  "Splash",
+
+	"R":  "Ride (tip)",
+	"RE": "Ride edge",
+	"RB": "Ride bell",
+	"RM": "Ride muted",
+
+	"T1":  "Tom 1",
+	"T1R": "Tom 1 rimshot",
+	"T2":  "Tom 2",
+	"T2R": "Tom 2 rimshot",
+	"T3":  "Tom 3",
+	"T3R": "Tom 3 rimshot",
+	"T4":  "Tom 4",
+	"T4R": "Tom 4 rimshot",
+}
+
+// Addictive Drums 2 note mapping.
+var addictiveDrums = map[string]byte{
+	"K": 36, // Kick
+
+	"S":  38, // Snare open hit
+	"SR": 40, // Snare rimshot
+	"SS": 37, // Snare sidestick
+	"SF": 39, // Snare flam
+
+	"HC":  42, // Hi-hat closed (tip)
+	"HCE": 61, // Hi-hat closed (edge)
+	"HO1": 60, // Hi-hat open A
+	"HO2": 62, // Hi-hat open B
+	"HO3": 46, // Hi-hat open C
+	"HP":  44, // Hi-hat pedal (closed)
+	"HPO": 65, // Hi-hat pedal (open)
+
+	"C1": 49, // Crash 1
+	"C2": 57, // Crash 2
+	"CH": 52, // China
+	"SP": 55, // Splash
+
+	"R":  51, // Ride (tip)
+	"RE": 59, // Ride edge
+	"RB": 53, // Ride bell
+
+	"T1": 48, // Tom 1
+	"T2": 47, // Tom 2
+	"T3": 45, // Tom 3
+	"T4": 43, // Tom 4
+	"T5": 41, // Tom 5
+}
+
+// Descriptions of Addictive Drums 2 drum names.
+var addictiveDrumsDescriptions = map[string]string{
+	"K": "Kick",
+
+	"S":  "Snare open hit",
+	"SR": "Snare rimshot",
+	"SS": "Snare sidestick",
+	"SF": "Snare flam",
+
+	"HC":  "Hi-hat closed (tip)",
+	"HCE": "Hi-hat closed (edge)",
+	"HO1": "Hi-hat open A",
+	"HO2": "Hi-hat open B",
+	"HO3": "Hi-hat open C",
+	"HP":  "Hi-hat pedal (closed)",
+	"HPO": "Hi-hat pedal (open)",
+
+	"C1": "Crash 1",
+	"C2": "Crash 2",
+	"CH": "China",
+	"SP": "Splash",
+
+	"R":  "Ride (tip)",
+	"RE": "Ride edge",
+	"RB": "Ride bell",
+
+	"T1": "Tom 1",
+	"T2": "Tom 2",
+	"T3": "Tom 3",
+	"T4": "Tom 4",
+	"T5": "Tom 5",
+}
+
+// Roland TD-17 and TD-27 default note mapping.
+var rolandTD = map[string]byte{
+	"K": 36, // Kick
+
+	"S":  38, // Snare head
+	"SR": 40, // Snare rim
+	"SS": 37, // Snare cross stick
+
+	"HC":  42, // Hi-hat closed (bow)
+	"HCE": 22, // Hi-hat closed (edge)
+	"HO":  46, // Hi-hat open (bow)
+	"HOE": 26, // Hi-hat open (edge)
+	"HP":  44, // Hi-hat pedal
+
+	"C1":  49, // Crash 1 (bow)
+	"C1E": 55, // Crash 1 (edge)
+	"C2":  57, // Crash 2 (bow)
+	"C2E": 52, // Crash 2 (edge)
+
+	"R":  51, // Ride (bow)
+	"RE": 59, // Ride (edge)
+	"RB": 53, // Ride bell
+
+	"T1":  48, // Tom 1 head
+	"T1R": 50, // Tom 1 rim
+	"T2":  45, // Tom 2 head
+	"T2R": 47, // Tom 2 rim
+	"T3":  43, // Tom 3 head
+	"T3R": 58, // Tom 3 rim
+	"T4":  41, // Tom 4 head
+	"T4R": 39, // Tom 4 rim
+}
+
+// Descriptions of Roland TD drum names.
+var rolandTDDescriptions = map[string]string{
+	"K": "Kick",
+
+	"S":  "Snare head",
+	"SR": "Snare rim",
+	"SS": "Snare cross stick",
+
+	"HC":  "Hi-hat closed (bow)",
+	"HCE": "Hi-hat closed (edge)",
+	"HO":  "Hi-hat open (bow)",
+	"HOE": "Hi-hat open (edge)",
+	"HP":  "Hi-hat pedal",
+
+	"C1":  "Crash 1 (bow)",
+	"C1E": "Crash 1 (edge)",
+	"C2":  "Crash 2 (bow)",
+	"C2E": "Crash 2 (edge)",
+
+	"R":  "Ride (bow)",
+	"RE": "Ride (edge)",
+	"RB": "Ride bell",
+
+	"T1":  "Tom 1 head",
+	"T1R": "Tom 1 rim",
+	"T2":  "Tom 2 head",
+	"T2R": "Tom 2 rim",
+	"T3":  "Tom 3 head",
+	"T3R": "Tom 3 rim",
+	"T4":  "Tom 4 head",
+	"T4R": "Tom 4 rim",
+}
+
+// Alesis Nitro default note mapping.
+var alesisNitro = map[string]byte{
+	"K": 36, // Kick
+
+	"S":  38, // Snare head
+	"SR": 40, // Snare rim
+	"SS": 37, // Snare cross stick
+
+	"HC": 42, // Hi-hat closed
+	"HO": 46, // Hi-hat open
+	"HP": 44, // Hi-hat pedal
+
+	"C1": 49, // Crash
+	"R":  51, // Ride
+	"RB": 53, // Ride bell
+
+	"T1": 48, // Tom 1
+	"T2": 45, // Tom 2
+	"T3": 43, // Tom 3
+}
+
+// Descriptions of Alesis Nitro drum names.
+var alesisNitroDescriptions = map[string]string{
+	"K": "Kick",
+
+	"S":  "Snare head",
+	"SR": "Snare rim",
+	"SS": "Snare cross stick",
+
+	"HC": "Hi-hat closed",
+	"HO": "Hi-hat open",
+	"HP": "Hi-hat pedal",
+
+	"C1": "Crash",
+	"R":  "Ride",
+	"RB": "Ride bell",
+
+	"T1": "Tom 1",
+	"T2": "Tom 2",
+	"T3": "Tom 3",
+}
+
+// A Kit describes a drum machine: the names of its notes, and how the notes
+// interact.
+type Kit struct {
+	Notes map[string]byte // Drum names and their notes.
+
+	// Descriptions of drum names, like "Crash 1" for C1. Nil if none.
+	Descriptions map[string]string
+
+	// Maps notes to the notes they silence when struck, like a closed hi-hat
+	// silencing an open one. Nil if none.
+	Chokes map[byte][]byte
+
+	// Instrument class of each note. Missing notes are ClassPerc.
+	Classes map[byte]Class
+
+	// Maps notes to other notes that play them at low velocities, like a
+	// sidestick for soft snare hits. Nil if none.
+	Splits map[byte][]VelocitySplit
+}
+
+// A VelocitySplit plays a note as another note when it is struck softly.
+type VelocitySplit struct {
+	Below Velocity // Velocities below this play Note.
+	Note  byte
+}
+
+// articulation returns the note that plays the given note at the given
+// velocity. The first split that the velocity is below is used, so splits
+// should be ordered from the softest.
+func (k *Kit) articulation(note byte, v Velocity) byte {
+	for _, s := range k.Splits[note] {
+		if v < s.Below {
+			return s.Note
+		}
+	}
+	return note
+}
+
+// A Class is a kind of drum, for transforming or splitting tracks by
+// instrument regardless of the kit's notes.
+type Class int
+
+// Instrument classes.
+const (
+	ClassPerc   Class = iota // Anything else.
+	ClassKick                // Bass drums.
+	ClassSnare               // Snares, rimshots and sidesticks.
+	ClassHat                 // Hi-hats.
+	ClassTom                 // Toms.
+	ClassCymbal              // Crashes, rides and other cymbals.
+)
+
+// Names of instrument classes.
+var classNames = map[Class]string{
+	ClassPerc:   "perc",
+	ClassKick:   "kick",
+	ClassSnare:  "snare",
+	ClassHat:    "hat",
+	ClassTom:    "tom",
+	ClassCymbal: "cymbal",
+}
+
+// String returns the class's name, such as "kick" or "hat".
+func (c Class) String() string {
+	if name, ok := classNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("Class(%d)", int(c))
+}
+
+// ClassOf returns the instrument class of a note in the kit.
+func (k *Kit) ClassOf(note byte) Class {
+	return k.Classes[note]
+}
+
+// ClassOf returns the instrument class of a note, reading it as an EZdrummer
+// note like beatnik's default drum names.
+func ClassOf(note byte) Class {
+	return Kits["ezdrummer"].ClassOf(note)
+}
+
+// Kits holds the built-in drum machines by name, for use in EncodeOptions.
+var Kits = map[string]*Kit{
+	"gm": {
+		Notes:        windowsSynth,
+		Descriptions: windowsSynthDescriptions,
+		Chokes: chokeMap(windowsSynth, map[string][]string{
+			"HC": {"HO"},
+			"HP": {"HO"},
+		}),
+		Classes: classMap(windowsSynth, map[Class][]string{
+			ClassKick:   {"K"},
+			ClassSnare:  {"S", "SS"},
+			ClassHat:    {"HC", "HO", "HP"},
+			ClassTom:    {"T1", "T2", "T3", "T4", "T5", "T6"},
+			ClassCymbal: {"C1", "C2", "C3", "C4", "R1", "R2", "RB"},
+		}),
+	},
+	"ezdrummer": {
+		Notes:        ezDrummer,
+		Descriptions: ezDrummerDescriptions,
+		Chokes: chokeMap(ezDrummer, map[string][]string{
+			"HC":  ezOpenHats,
+			"HCT": ezOpenHats,
+			"HT":  ezOpenHats,
+			"HTT": ezOpenHats,
+			"HP":  ezOpenHats,
+			"C1M": {"C1"},
+			"C2M": {"C2"},
+			"C3M": {"C3"},
+			"C4M": {"C4"},
+			"RM":  {"R", "RB", "RW"},
+		}),
+		Classes: classMap(ezDrummer, map[Class][]string{
+			ClassKick:  {"K"},
+			ClassSnare: {"S", "SR", "SS"},
+			ClassHat: {"HC", "HCT", "HT", "HTT", "HO1", "HO2", "HO3", "HO4",
+				"HO5", "HP", "HPO", "HS"},
+			ClassTom: {"T1", "T1R", "T2", "T2R", "T3", "T3R", "T4", "T4R", "T5",
+				"T5R"},
+			ClassCymbal: {"C1", "C1M", "C2", "C2M", "C3", "C3M", "C4", "C4M", "R",
+				"RB", "RW", "RM"},
+		}),
+	},
+	"sd3": {
+		Notes:        superiorDrummer,
+		Descriptions: superiorDrummerDescriptions,
+		Chokes: chokeMap(superiorDrummer, map[string][]string{
+			"HC":  sdOpenHats,
+			"HCT": sdOpenHats,
+			"HT":  sdOpenHats,
+			"HTT": sdOpenHats,
+			"HP":  sdOpenHats,
+			"C1M": {"C1"},
+			"C2M": {"C2"},
+			"CHM": {"CH"},
+			"RM":  {"R", "RE", "RB"},
+		}),
+		Classes: classMap(superiorDrummer, map[Class][]string{
+			ClassKick:  {"K"},
+			ClassSnare: {"S", "SR", "SS"},
+			ClassHat: {"HC", "HCT", "HT", "HTT", "HO1", "HO2", "HO3", "HO4",
+				"HO5", "HP", "HPO"},
+			ClassTom: {"T1", "T1R", "T2", "T2R", "T3", "T3R", "T4", "T4R"},
+			ClassCymbal: {"C1", "C1M", "C2", "C2M", "CH", "CHM", "SP", "R", "RE",
+				"RB", "RM"},
+		}),
+	},
+	"ad2": {
+		Notes:        addictiveDrums,
+		Descriptions: addictiveDrumsDescriptions,
+		Chokes: chokeMap(addictiveDrums, map[string][]string{
+			"HC":  adOpenHats,
+			"HCE": adOpenHats,
+			"HP":  adOpenHats,
+		}),
+		Classes: classMap(addictiveDrums, map[Class][]string{
+			ClassKick:   {"K"},
+			ClassSnare:  {"S", "SR", "SS", "SF"},
+			ClassHat:    {"HC", "HCE", "HO1", "HO2", "HO3", "HP", "HPO"},
+			ClassTom:    {"T1", "T2", "T3", "T4", "T5"},
+			ClassCymbal: {"C1", "C2", "CH", "SP", "R", "RE", "RB"},
+		}),
+	},
+	"roland": {
+		Notes:        rolandTD,
+		Descriptions: rolandTDDescriptions,
+		Chokes: chokeMap(rolandTD, map[string][]string{
+			"HC":  {"HO", "HOE"},
+			"HCE": {"HO", "HOE"},
+			"HP":  {"HO", "HOE"},
+		}),
+		Classes: classMap(rolandTD, map[Class][]string{
+			ClassKick:   {"K"},
+			ClassSnare:  {"S", "SR", "SS"},
+			ClassHat:    {"HC", "HCE", "HO", "HOE", "HP"},
+			ClassTom:    {"T1", "T1R", "T2", "T2R", "T3", "T3R", "T4", "T4R"},
+			ClassCymbal: {"C1", "C1E", "C2", "C2E", "R", "RE", "RB"},
+		}),
+	},
+	"nitro": {
+		Notes:        alesisNitro,
+		Descriptions: alesisNitroDescriptions,
+		Chokes: chokeMap(alesisNitro, map[string][]string{
+			"HC": {"HO"},
+			"HP": {"HO"},
+		}),
+		Classes: classMap(alesisNitro, map[Class][]string{
+			ClassKick:   {"K"},
+			ClassSnare:  {"S", "SR", "SS"},
+			ClassHat:    {"HC", "HO", "HP"},
+			ClassTom:    {"T1", "T2", "T3"},
+			ClassCymbal: {"C1", "R", "RB"},
+		}),
+	},
+}
+
+// Maps returns the drum names of the built-in drum machines and their notes,
+// by the machines' names in Kits, for tools that list the available drums.
+// The maps are copies, so changing them changes nothing.
+func Maps() map[string]map[string]byte {
+	result := map[string]map[string]byte{}
+	for name, kit := range Kits {
+		notes := make(map[string]byte, len(kit.Notes))
+		for k, v := range kit.Notes {
+			notes[k] = v
+		}
+		result[name] = notes
+	}
+	return result
+}
+
+// Describe returns the drum names of a note in a built-in drum machine, with
+// their descriptions, like "C2 (Crash 2)". Several names are separated by
+// commas. Returns an empty string if the machine does not exist or has no
+// name for the note.
+func Describe(note byte, mapName string) string {
+	kit := Kits[mapName]
+	if kit == nil {
+		return ""
+	}
+	var names []string
+	for name, n := range kit.Notes {
+		if n != note {
+			continue
+		}
+		if d, ok := kit.Descriptions[name]; ok {
+			name += " (" + d + ")"
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// EZdrummer 2 hi-hat notes that ring until closed.
+var ezOpenHats = []string{"HO1", "HO2", "HO3", "HO4", "HO5", "HPO"}
+
+// Superior Drummer 3 hi-hat notes that ring until closed.
+var sdOpenHats = []string{"HO1", "HO2", "HO3", "HO4", "HO5", "HPO"}
+
+// Addictive Drums 2 hi-hat notes that ring until closed.
+var adOpenHats = []string{"HO1", "HO2", "HO3", "HPO"}
+
+// chokeMap returns a choke map of notes, from a choke map of their names in
+// the given drum map.
+func chokeMap(notes map[string]byte, chokes map[string][]string) map[byte][]byte {
+	result := map[byte][]byte{}
+	for name, victims := range chokes {
+		for _, v := range victims {
+			result[notes[name]] = append(result[notes[name]], notes[v])
+		}
+	}
+	return result
+}
+
+// classMap returns the classes of notes, from the names of each class's notes
+// in the given drum map.
+func classMap(notes map[string]byte, classes map[Class][]string) map[byte]Class {
+	result := map[byte]Class{}
+	for class, names := range classes {
+		for _, name := range names {
+			result[notes[name]] = class
+		}
+	}
+	return result
+}
+
+// Named note remappings, for use with the remap directive.
+var remaps = map[string]map[byte]byte{
+	"gm": mapBetween(ezDrummer, windowsSynth),
+}
+
+// mapBetween returns a note remapping from one drum map to another, for the
+// drum names that both maps share.
+func mapBetween(from, to map[string]byte) map[byte]byte {
+	result := map[byte]byte{}
+	for name, n := range from {
+		if n2, ok := to[name]; ok {
+			result[n] = n2
+		}
+	}
+	return result
 }
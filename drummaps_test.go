@@ -0,0 +1,45 @@
+package beatnik
+
+import (
+	"testing"
+)
+
+func TestMaps(t *testing.T) {
+	maps := Maps()
+	if len(maps) != len(Kits) || maps["ezdrummer"]["C1"] != 55 || maps["gm"]["C1"] != 49 {
+		t.Fatalf("Maps()=%v, want the notes of Kits", maps)
+	}
+	maps["gm"]["C1"] = 1
+	if Kits["gm"].Notes["C1"] != 49 {
+		t.Errorf("changing Maps() changed Kits")
+	}
+	for name, kit := range Kits {
+		for drum := range kit.Notes {
+			if kit.Descriptions[drum] == "" {
+				t.Errorf("Kits[%q] has no description of %v", name, drum)
+			}
+		}
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	tests := []struct {
+		note byte
+		kit  string
+		want string
+	}{
+		{55, "ezdrummer", "C1 (Crash 1)"},
+		{55, "gm", "C4 (Splash cymbal)"},
+		{36, "gm", "K (Kick)"},
+		{22, "roland", "HCE (Hi-hat closed (edge))"},
+		{46, "nitro", "HO (Hi-hat open)"},
+		{1, "gm", ""},
+		{36, "nope", ""},
+	}
+	for _, test := range tests {
+		if got := Describe(test.note, test.kit); got != test.want {
+			t.Errorf("Describe(%v, %q)=%q, want %q", test.note, test.kit, got,
+				test.want)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package beatnik
+
+// Encoding of hits as midi events.
+
+import (
+	"io"
+	"math/rand"
+	"sort"
+)
+
+// Retrigger decides what happens when a note is struck while the same note,
+// from an earlier hit, is still sounding.
+type Retrigger int
+
+// Retrigger options.
+const (
+	RetriggerTruncate Retrigger = iota // End the sounding note, then strike.
+	RetriggerOverlap                   // Strike again, each strike ends on its time.
+	RetriggerDrop                      // Skip the new strike.
+)
+
+// A midiEvent is an encoded event waiting to be written.
+type midiEvent struct {
+	t    uint   // Absolute tick of the event.
+	off  bool   // Note-offs are written before other events on the same tick.
+	data []byte // Event without delta time.
+}
+
+// A playingNote is a note whose note-off was not written yet.
+type playingNote struct {
+	note    byte
+	on, off uint // Absolute ticks of the note's events.
+}
+
+// Sizes of the encoder's buffers.
+const (
+	writeBufferSize = 4096 // Encoded events are written to w in chunks of this size.
+	dataBlockSize   = 4096 // Event data are carved from blocks of this size.
+)
+
+// A hitEncoder writes hits as midi events one at a time. Since notes may be
+// pushed or pulled by timing offsets, events are queued and written once no
+// later hit can place an event before them. Keeps track of notes that are
+// still sounding, so that every note-on gets a matching note-off.
+type hitEncoder struct {
+	w        io.Writer
+	opts     *EncodeOptions
+	tick     uint          // Absolute tick of the next hit.
+	last     uint          // Absolute tick of the last written event.
+	lookback uint          // Largest timing offset of the track's notes.
+	queue    []midiEvent   // Unwritten events, ordered by tick.
+	playing  []playingNote // Notes with unwritten note-offs.
+	events   int           // Number of written events.
+	size     int           // Number of written bytes.
+	rnd      *rand.Rand    // Chooses notes with chances, nil until needed.
+	notes    []byte        // Reused for the sorted notes of each hit.
+	block    []byte        // Unused part of the block that event data are carved from.
+	status   byte          // Running status, 0 if none.
+	noteOff  [3]byte       // Note-off written as a note-on, for running status.
+
+	// Encoded events. If w is not nil, they are written to it whenever the
+	// buffer fills up. Otherwise they are appended here for the caller.
+	out []byte
+
+	// If true, events are only counted, and not encoded.
+	measure bool
+
+	// If not nil, events are appended here instead of being written.
+	recorded *[]midiEvent
+}
+
+// newHitEncoder returns an encoder for the given track's hits.
+func newHitEncoder(w io.Writer, t *Track, opts *EncodeOptions) *hitEncoder {
+	return &hitEncoder{w: w, opts: opts, lookback: t.maxOffset()}
+}
+
+// encode writes the hits and control events of the given track, ending with
+// an end-of-track event. The track is named first if the options name it.
+func (e *hitEncoder) encode(t *Track) {
+	if e.opts.trackName != "" {
+		m := &Meta{Type: MetaTrackName, Data: []byte(e.opts.trackName)}
+		e.push(midiEvent{0, false, m.encode()})
+	}
+	controls := t.sortedControls()
+	for _, h := range t.Hits {
+		for len(controls) > 0 && controls[0].T <= e.tick {
+			e.control(controls[0])
+			controls = controls[1:]
+		}
+		e.hit(h)
+	}
+	for _, c := range controls {
+		e.control(c)
+	}
+	e.end()
+}
+
+// hit queues the events of the given hit, and writes the queued events that
+// no later hit can precede.
+func (e *hitEncoder) hit(h *Hit) {
+	if e.tick > e.lookback {
+		e.flush(e.tick - e.lookback)
+	}
+
+	if e.opts.Annotations {
+		keys := make([]string, 0, len(h.Annotations))
+		for k := range h.Annotations {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			m := &Meta{Type: MetaText, Data: []byte(k + "=" + h.Annotations[k])}
+			e.push(midiEvent{e.tick, false, m.encode()})
+		}
+	}
+
+	length := e.opts.Gate
+	if length == 0 {
+		length = h.T
+	}
+	e.notes = appendSortedNotes(e.notes[:0], h)
+	for _, n := range e.notes {
+		if c, ok := h.Chances[n]; ok {
+			if e.rnd == nil {
+				e.rnd = rand.New(rand.NewSource(e.opts.Seed))
+			}
+			if e.rnd.Intn(100) >= c {
+				continue
+			}
+		}
+		v := h.Notes[n]
+		on := e.tick
+		if off := h.Offsets[n]; off < 0 && uint(-off) > on {
+			on = 0
+		} else {
+			on = uint(int(on) + off)
+		}
+		if e.opts.Kit != nil {
+			n = e.opts.Kit.articulation(n, v)
+		}
+		if i := e.sounding(n, on); i != -1 {
+			switch e.opts.Retrigger {
+			case RetriggerTruncate:
+				e.truncate(i, on)
+			case RetriggerDrop:
+				continue
+			}
+		}
+		if e.opts.Kit != nil {
+			e.choke(n, on)
+		}
+		e.push(midiEvent{on, false, e.data(0x99, n, byte(v))})
+		e.push(midiEvent{on + length, true, e.data(0x89, n, 64)})
+		e.playing = append(e.playing, playingNote{n, on, on + length})
+	}
+	e.tick += h.T
+}
+
+// control queues a control event. It should not be before the ticks that
+// were already flushed.
+func (e *hitEncoder) control(c *Control) {
+	if c.Kind == ChannelPressure {
+		e.push(midiEvent{c.T, false, e.data(c.Kind.status(), c.Value)})
+		return
+	}
+	e.push(midiEvent{c.T, false, e.data(c.Kind.status(), c.Number, c.Value)})
+}
+
+// end writes all queued events and an end-of-track event.
+func (e *hitEncoder) end() {
+	e.flush(^uint(0))
+	t := e.tick
+	if e.last > t {
+		t = e.last
+	}
+	e.write(midiEvent{t, false, []byte{0xFF, 0x2F, 0}})
+	if e.w != nil && len(e.out) > 0 {
+		e.w.Write(e.out)
+		e.out = e.out[:0]
+	}
+}
+
+// write writes a single event, which should not be before the last written
+// event.
+func (e *hitEncoder) write(ev midiEvent) {
+	data := ev.data
+	if e.opts.RunningStatus && e.recorded == nil {
+		data = e.running(data)
+	}
+	e.size += uvarintLen(ev.t-e.last) + len(data)
+	switch {
+	case e.recorded != nil:
+		*e.recorded = append(*e.recorded, ev)
+	case e.measure:
+	default:
+		e.out = appendUvarint(e.out, ev.t-e.last)
+		e.out = append(e.out, data...)
+		if e.w != nil && len(e.out) >= writeBufferSize {
+			e.w.Write(e.out)
+			e.out = e.out[:0]
+		}
+	}
+	e.last = ev.t
+	e.events++
+}
+
+// running returns the data of an event as written with running status. Note-offs
+// become note-ons with velocity 0, and the status byte is left out if it is the
+// same as the last event's. Meta and system exclusive events cancel the running
+// status.
+func (e *hitEncoder) running(data []byte) []byte {
+	status := data[0]
+	if status >= 0xF0 {
+		e.status = 0
+		return data
+	}
+	if status&0xF0 == 0x80 {
+		e.noteOff = [3]byte{0x90 | status&0x0F, data[1], 0}
+		data = e.noteOff[:]
+	}
+	if data[0] == e.status {
+		return data[1:]
+	}
+	e.status = data[0]
+	return data
+}
+
+// data returns the given event data in a slice that is carved from a shared
+// block, to save allocating each event on its own.
+func (e *hitEncoder) data(b ...byte) []byte {
+	if len(b) > cap(e.block) {
+		e.block = make([]byte, dataBlockSize)
+	}
+	result := e.block[:len(b):len(b)]
+	copy(result, b)
+	e.block = e.block[len(b):]
+	return result
+}
+
+// push adds an event to the queue, after the queued events that come before
+// it or with it.
+func (e *hitEncoder) push(ev midiEvent) {
+	i := sort.Search(len(e.queue), func(i int) bool {
+		q := e.queue[i]
+		return q.t > ev.t || (q.t == ev.t && !q.off && ev.off)
+	})
+	e.queue = append(e.queue, midiEvent{})
+	copy(e.queue[i+1:], e.queue[i:])
+	e.queue[i] = ev
+}
+
+// flush writes the queued events before tick t.
+func (e *hitEncoder) flush(t uint) {
+	i := 0
+	for ; i < len(e.queue) && e.queue[i].t < t; i++ {
+		e.write(e.queue[i])
+	}
+	// Moved to the front, so that the queue's capacity is reused.
+	e.queue = e.queue[:copy(e.queue, e.queue[i:])]
+
+	playing := e.playing[:0]
+	for _, p := range e.playing {
+		if p.off >= t {
+			playing = append(playing, p)
+		}
+	}
+	e.playing = playing
+}
+
+// sounding returns the index in playing of the given note, if it sounds at
+// tick t. Returns -1 if the note is not sounding.
+func (e *hitEncoder) sounding(note byte, t uint) int {
+	for i, p := range e.playing {
+		if p.note == note && p.on <= t && t < p.off {
+			return i
+		}
+	}
+	return -1
+}
+
+// truncate moves the note-off of the i'th playing note to tick t.
+func (e *hitEncoder) truncate(i int, t uint) {
+	p := e.playing[i]
+	for j, ev := range e.queue {
+		if ev.off && ev.t == p.off && ev.data[1] == p.note {
+			e.queue = append(e.queue[:j], e.queue[j+1:]...)
+			break
+		}
+	}
+	e.push(midiEvent{t, true, e.data(0x89, p.note, 64)})
+	e.playing[i].off = t
+}
+
+// choke ends the playing notes that the given note silences, if it is struck
+// at tick t. Notes that are struck on the same tick are not silenced.
+func (e *hitEncoder) choke(note byte, t uint) {
+	for _, victim := range e.opts.Kit.Chokes[note] {
+		for i, p := range e.playing {
+			if p.note == victim && p.on < t && t < p.off {
+				e.truncate(i, t)
+			}
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package beatnik
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEncodeHits_retrigger(t *testing.T) {
+	tr := &Track{
+		Hits: []*Hit{
+			{Notes: map[byte]Velocity{38: F}, T: 48},
+			{Notes: map[byte]Velocity{38: P}, T: 48},
+		},
+		BPM: 120,
+	}
+	tests := []struct {
+		r    Retrigger
+		want []byte
+	}{
+		{RetriggerTruncate, []byte{0, 0x99, 38, F, 48, 0x89, 38, 64,
+			0, 0x99, 38, P, 96, 0x89, 38, 64, 0, 0xFF, 0x2F, 0}},
+		{RetriggerOverlap, []byte{0, 0x99, 38, F, 48, 0x99, 38, P,
+			48, 0x89, 38, 64, 48, 0x89, 38, 64, 0, 0xFF, 0x2F, 0}},
+		{RetriggerDrop, []byte{0, 0x99, 38, F, 96, 0x89, 38, 64,
+			0, 0xFF, 0x2F, 0}},
+	}
+	for _, test := range tests {
+		buf := bytes.NewBuffer(nil)
+		tr.encodeHits(buf, &EncodeOptions{Gate: 96, Retrigger: test.r})
+		if got := buf.Bytes(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("encodeHits(%v)=%v, want %v", test.r, got, test.want)
+		}
+	}
+}
+
+func TestEncodeHits_noteOrder(t *testing.T) {
+	tr := &Track{
+		Hits: []*Hit{
+			{Notes: map[byte]Velocity{55: F, 36: F, 42: P, 38: F, 48: F}, T: 96},
+		},
+		BPM: 120,
+	}
+	want := []byte{0, 0x99, 36, F, 0, 0x99, 38, F, 0, 0x99, 42, P,
+		0, 0x99, 48, F, 0, 0x99, 55, F, 96, 0x89, 36, 64, 0, 0x89, 38, 64,
+		0, 0x89, 42, 64, 0, 0x89, 48, 64, 0, 0x89, 55, 64, 0, 0xFF, 0x2F, 0}
+	for i := 0; i < 20; i++ {
+		buf := bytes.NewBuffer(nil)
+		tr.encodeHits(buf, &EncodeOptions{})
+		if got := buf.Bytes(); !reflect.DeepEqual(got, want) {
+			t.Fatalf("encodeHits()=%v, want %v", got, want)
+		}
+	}
+}
+
+func TestEncodeHits_runningStatus(t *testing.T) {
+	tr := &Track{
+		Hits: []*Hit{
+			{Notes: map[byte]Velocity{36: F, 42: P}, T: 48},
+			{Notes: map[byte]Velocity{38: F}, T: 48},
+		},
+		Controls: []*Control{{T: 48, Number: 4, Value: 90}},
+		BPM:      120,
+	}
+	want := []byte{0, 0x99, 36, F, 0, 42, P, 48, 36, 0, 0, 42, 0,
+		0, 0xB9, 4, 90, 0, 0x99, 38, F, 48, 38, 0, 0, 0xFF, 0x2F, 0}
+	buf := bytes.NewBuffer(nil)
+	tr.encodeHits(buf, &EncodeOptions{RunningStatus: true})
+	if got := buf.Bytes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("encodeHits()=%v, want %v", got, want)
+	}
+	if _, got := tr.measureHits(&EncodeOptions{RunningStatus: true}); got != len(want) {
+		t.Errorf("measureHits()=%v, want %v", got, len(want))
+	}
+}
+
+func TestEncode_runningStatus(t *testing.T) {
+	tr := benchTrack(1000)
+	plain, err := tr.Encode(nil)
+	if err != nil {
+		t.Fatalf("Encode() failed: %v", err)
+	}
+	b, err := tr.Encode(&EncodeOptions{RunningStatus: true})
+	if err != nil {
+		t.Fatalf("Encode(RunningStatus) failed: %v", err)
+	}
+	if len(b) > len(plain)*4/5 {
+		t.Errorf("Encode(RunningStatus) has %v bytes, want at most 4/5 of %v",
+			len(b), len(plain))
+	}
+	got, err := ReadMIDI(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("ReadMIDI() failed: %v", err)
+	}
+	want, err := ReadMIDI(bytes.NewReader(plain))
+	if err != nil {
+		t.Fatalf("ReadMIDI() failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadMIDI(RunningStatus) differs from ReadMIDI(plain)")
+	}
+}
+
+func TestEncodeHits_noGate(t *testing.T) {
+	tr := &Track{
+		Hits: []*Hit{
+			{Notes: map[byte]Velocity{38: F}, T: 48},
+			{Notes: map[byte]Velocity{38: P}, T: 24},
+		},
+		BPM: 120,
+	}
+	want := []byte{0, 0x99, 38, F, 48, 0x89, 38, 64,
+		0, 0x99, 38, P, 24, 0x89, 38, 64, 0, 0xFF, 0x2F, 0}
+	buf := bytes.NewBuffer(nil)
+	tr.encodeHits(buf, &EncodeOptions{})
+	if got := buf.Bytes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("encodeHits()=%v, want %v", got, want)
+	}
+}
+
+func TestEncodeHits_offsets(t *testing.T) {
+	tr := &Track{
+		Hits: []*Hit{
+			{Notes: map[byte]Velocity{36: F}, T: 96},
+			{Notes: map[byte]Velocity{38: P}, T: 96, Offsets: map[byte]int{38: -3}},
+			{Notes: map[byte]Velocity{36: F}, T: 96, Offsets: map[byte]int{36: 5}},
+		},
+		BPM: 120,
+	}
+	want := []byte{0, 0x99, 36, F, 93, 0x99, 38, P, 3, 0x89, 36, 64,
+		93, 0x89, 38, 64, 8, 0x99, 36, F, 96, 0x89, 36, 64, 0, 0xFF, 0x2F, 0}
+	buf := bytes.NewBuffer(nil)
+	tr.encodeHits(buf, &EncodeOptions{})
+	if got := buf.Bytes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("encodeHits()=%v, want %v", got, want)
+	}
+}
+
+func TestEncodeHits_choke(t *testing.T) {
+	tr := &Track{
+		Hits: []*Hit{
+			{Notes: map[byte]Velocity{24: F}, T: 48},
+			{Notes: map[byte]Velocity{38: F}, T: 48},
+			{Notes: map[byte]Velocity{21: P}, T: 48},
+		},
+		BPM: 120,
+	}
+	tests := []struct {
+		kit  *Kit
+		want []byte
+	}{
+		{nil, []byte{0, 0x99, 24, F, 48, 0x99, 38, F, 48, 0x99, 21, P,
+			96, 0x89, 24, 64, 48, 0x89, 38, 64, 48, 0x89, 21, 64, 0, 0xFF, 0x2F, 0}},
+		{Kits["ezdrummer"], []byte{0, 0x99, 24, F, 48, 0x99, 38, F, 48, 0x89, 24, 64,
+			0, 0x99, 21, P, 0x81, 0x10, 0x89, 38, 64, 48, 0x89, 21, 64,
+			0, 0xFF, 0x2F, 0}},
+	}
+	for _, test := range tests {
+		buf := bytes.NewBuffer(nil)
+		tr.encodeHits(buf, &EncodeOptions{Gate: 192, Kit: test.kit})
+		if got := buf.Bytes(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("encodeHits(%v)=%v, want %v", test.kit, got, test.want)
+		}
+	}
+}
+
+func TestEncodeHits_velocitySplit(t *testing.T) {
+	tr := &Track{
+		Hits: []*Hit{
+			{Notes: map[byte]Velocity{38: 20}, T: 48},
+			{Notes: map[byte]Velocity{38: 50}, T: 48},
+			{Notes: map[byte]Velocity{38: 100}, T: 48},
+		},
+		BPM: 120,
+	}
+	kit := &Kit{Splits: map[byte][]VelocitySplit{38: {{40, 37}, {60, 40}}}}
+	want := []byte{0, 0x99, 37, 20, 48, 0x89, 37, 64, 0, 0x99, 40, 50,
+		48, 0x89, 40, 64, 0, 0x99, 38, 100, 48, 0x89, 38, 64, 0, 0xFF, 0x2F, 0}
+	buf := bytes.NewBuffer(nil)
+	tr.encodeHits(buf, &EncodeOptions{Kit: kit})
+	if got := buf.Bytes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("encodeHits()=%v, want %v", got, want)
+	}
+}
+
+func TestEncodeHits_controls(t *testing.T) {
+	tr := &Track{
+		Hits: []*Hit{
+			{Notes: map[byte]Velocity{42: F}, T: 48},
+			{Notes: map[byte]Velocity{42: F}, T: 48},
+		},
+		Controls: []*Control{
+			{120, 4, 0, ControlChange}, {48, 4, 90, ControlChange},
+			{0, 4, 10, ControlChange},
+		},
+		BPM: 120,
+	}
+	want := []byte{0, 0xB9, 4, 10, 0, 0x99, 42, F, 48, 0x89, 42, 64,
+		0, 0xB9, 4, 90, 0, 0x99, 42, F, 48, 0x89, 42, 64, 24, 0xB9, 4, 0,
+		0, 0xFF, 0x2F, 0}
+	buf := bytes.NewBuffer(nil)
+	tr.encodeHits(buf, &EncodeOptions{})
+	if got := buf.Bytes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("encodeHits()=%v, want %v", got, want)
+	}
+}
+
+func TestEncode_chances(t *testing.T) {
+	tr := mustParse(t, "bpm:90 "+strings.Repeat("K,HC?50.. ", 64))
+	count := func(seed int64) (int, []byte) {
+		b, err := tr.Encode(&EncodeOptions{Seed: seed})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return bytes.Count(b, []byte{0x99, 22}), b
+	}
+	n, b1 := count(1)
+	if n < 16 || n > 48 {
+		t.Errorf("%v of 64 hi-hats played, want about half", n)
+	}
+	if _, b := count(1); !bytes.Equal(b, b1) {
+		t.Errorf("Encode() with the same seed gave different files")
+	}
+	if _, b := count(2); bytes.Equal(b, b1) {
+		t.Errorf("Encode() with different seeds gave the same file")
+	}
+	if bytes.Count(b1, []byte{0x99, 36}) != 64 {
+		t.Errorf("Encode() dropped notes without chances")
+	}
+}
+
+func TestEncode_matchesEncodeTo(t *testing.T) {
+	tr := benchTrack(1000)
+	tr.Meta = []*Meta{{T: 96, Type: MetaMarker, Data: []byte("verse")}}
+	tr.Controls = []*Control{{T: 48, Number: 4, Value: 90}}
+	for _, opts := range []*EncodeOptions{nil, {TrackGroups: DefaultTrackGroups}} {
+		got, err := tr.Encode(opts)
+		if err != nil {
+			t.Fatalf("Encode(%v) failed: %v", opts, err)
+		}
+		buf := bytes.NewBuffer(nil)
+		if _, err := tr.EncodeTo(buf, opts); err != nil {
+			t.Fatalf("EncodeTo(%v) failed: %v", opts, err)
+		}
+		if !bytes.Equal(got, buf.Bytes()) {
+			t.Errorf("Encode(%v) and EncodeTo(%v) differ", opts, opts)
+		}
+		if len(got) != cap(got) {
+			t.Errorf("Encode(%v) has length %v and capacity %v, want equal",
+				opts, len(got), cap(got))
+		}
+	}
+}
+
+// benchTrack returns a track of n sixteenth hits, playing a rock beat with
+// some accents, ghost notes and pushed notes.
+func benchTrack(n int) *Track {
+	t := &Track{Hits: make([]*Hit, n), BPM: 120}
+	for i := range t.Hits {
+		h := &Hit{Notes: map[byte]Velocity{22: MF}, T: 24}
+		switch i % 8 {
+		case 0:
+			h.Notes[36] = F
+			h.Notes[22] = FF
+		case 4:
+			h.Notes[38] = F
+		case 6:
+			h.Notes[38] = P
+			h.Offsets = map[byte]int{38: -3}
+		}
+		t.Hits[i] = h
+	}
+	return t
+}
+
+func BenchmarkEncode(b *testing.B) {
+	tr := benchTrack(100000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := tr.Encode(nil); err != nil {
+			b.Fatalf("Encode() failed: %v", err)
+		}
+	}
+}
+
+func BenchmarkEncodeTo(b *testing.B) {
+	tr := benchTrack(100000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := tr.EncodeTo(ioutil.Discard, nil); err != nil {
+			b.Fatalf("EncodeTo() failed: %v", err)
+		}
+	}
+}
@@ -0,0 +1,429 @@
+package beatnik
+
+// Diagnostics and their localized messages.
+
+import (
+	"fmt"
+	"sync"
+)
+
+// A Code identifies a kind of problem, independently of its wording. Codes are
+// stable and can be used as keys for translated messages.
+type Code string
+
+// Diagnostic codes.
+const (
+	CodeBadHit              Code = "bad-hit"
+	CodeBadNote             Code = "bad-note"
+	CodeBadDrum             Code = "bad-drum"
+	CodeBadVelocity         Code = "bad-velocity"
+	CodeBadDuration         Code = "bad-duration"
+	CodeEmptyAnnotations    Code = "empty-annotations"
+	CodeBadAnnotation       Code = "bad-annotation"
+	CodeDuplicateAnnotation Code = "duplicate-annotation"
+	CodeHalfParenthesis     Code = "half-parenthesis"
+	CodeGraceTooLong        Code = "grace-too-long"
+	CodeGraceChainTooLong   Code = "grace-chain-too-long"
+	CodeOrphanDuration      Code = "orphan-duration"
+	CodeUnrecognizedToken   Code = "unrecognized-token"
+	CodeBadDirective        Code = "bad-directive"
+	CodeUnknownDirective    Code = "unknown-directive"
+	CodeBadBPM              Code = "bad-bpm"
+	CodeBPMRange            Code = "bpm-range"
+	CodeEmptyMarker         Code = "empty-marker"
+	CodeEmptyCue            Code = "empty-cue"
+	CodeBadAlias            Code = "bad-alias"
+	CodeNumericAlias        Code = "numeric-alias"
+	CodeZeroBPM             Code = "zero-bpm"
+	CodeBadTimeSig          Code = "bad-time-sig"
+	CodeBadRemap            Code = "bad-remap"
+	CodeMergeConflict       Code = "merge-conflict"
+	CodeUnopenedGroup       Code = "unopened-group"
+	CodeUnclosedGroup       Code = "unclosed-group"
+	CodeUnknownGroupOp      Code = "unknown-group-op"
+	CodeZeroDuration        Code = "zero-duration"
+	CodeBadNoteNumber       Code = "bad-note-number"
+	CodeBadVelocityValue    Code = "bad-velocity-value"
+	CodeTickOverflow        Code = "tick-overflow"
+	CodeBadOffset           Code = "bad-offset"
+	CodeTempoMismatch       Code = "tempo-mismatch"
+	CodeEmptySong           Code = "empty-song"
+	CodeBadTabChar          Code = "bad-tab-char"
+	CodeBadTabDrum          Code = "bad-tab-drum"
+	CodeTabBarLength        Code = "tab-bar-length"
+	CodeTabMismatch         Code = "tab-mismatch"
+	CodeBadMIDIHeader       Code = "bad-midi-header"
+	CodeSMPTEDivision       Code = "smpte-division"
+	CodeTruncatedMIDI       Code = "truncated-midi"
+	CodeBadMIDIEvent        Code = "bad-midi-event"
+	CodeSkippedBytes        Code = "skipped-bytes"
+	CodeMissingEOT          Code = "missing-eot"
+	CodeBadChunkLength      Code = "bad-chunk-length"
+	CodeBadHydrogen         Code = "bad-hydrogen"
+	CodeUnknownPattern      Code = "unknown-pattern"
+	CodeNoLilyPondName      Code = "no-lilypond-name"
+	CodeBadControl          Code = "bad-control"
+	CodeBadExpression       Code = "bad-expression"
+	CodeUnknownVariable     Code = "unknown-variable"
+	CodeUnknownFunction     Code = "unknown-function"
+	CodeFunctionArgs        Code = "function-args"
+	CodeDivisionByZero      Code = "division-by-zero"
+	CodeBadSet              Code = "bad-set"
+	CodeVelocityRange       Code = "velocity-range"
+	CodeBadSubdivision      Code = "bad-subdivision"
+	CodeLongHit             Code = "long-hit"
+	CodeOverlappingNote     Code = "overlapping-note"
+	CodeFlatVelocity        Code = "flat-velocity"
+	CodeLeadingGrace        Code = "leading-grace"
+	CodeShadowedDrum        Code = "shadowed-drum"
+	CodeUnusedAlias         Code = "unused-alias"
+	CodeBadSection          Code = "bad-section"
+	CodeDuplicateSection    Code = "duplicate-section"
+	CodeUnknownSection      Code = "unknown-section"
+	CodeBadPlay             Code = "bad-play"
+	CodeNoInclude           Code = "no-include"
+	CodeIncludeFailed       Code = "include-failed"
+	CodeIncludeCycle        Code = "include-cycle"
+	CodeTooManyHits         Code = "too-many-hits"
+	CodeSectionTooLarge     Code = "section-too-large"
+	CodeIncludeDepth        Code = "include-depth"
+	CodeTooManyTokens       Code = "too-many-tokens"
+	CodeTooManyNotes        Code = "too-many-notes"
+	CodeTooManyTicks        Code = "too-many-ticks"
+	CodeTooManyEvents       Code = "too-many-events"
+	CodeUnknownOp           Code = "unknown-op"
+	CodeOpIndex             Code = "op-index"
+	CodeOpMissing           Code = "op-missing"
+	CodeOpDirective         Code = "op-directive"
+	CodeBadFill             Code = "bad-fill"
+	CodeEmptyTitle          Code = "empty-title"
+	CodeNoLilyPond          Code = "no-lilypond"
+	CodeTrackCount          Code = "track-count"
+	CodeNoRunningStatus     Code = "no-running-status"
+	CodeUnmatchedNoteOff    Code = "unmatched-note-off"
+	CodeUnendedNote         Code = "unended-note"
+	CodeBadCresc            Code = "bad-cresc"
+	CodeBadBPMRamp          Code = "bad-bpm-ramp"
+	CodeBadChance           Code = "bad-chance"
+	CodeBadCC               Code = "bad-cc"
+	CodeBadAftertouch       Code = "bad-aftertouch"
+	CodeBadBend             Code = "bad-bend"
+	CodeBadSysEx            Code = "bad-sysex"
+	CodeUnknownMap          Code = "unknown-map"
+	CodeNumericDrum         Code = "numeric-drum"
+	CodeBadLoop             Code = "bad-loop"
+	CodeDuplicateLoop       Code = "duplicate-loop"
+	CodeLoopOrder           Code = "loop-order"
+)
+
+// An Error is a problem found in a beatnik source or track. Its message can be
+// rendered in different languages using Localize.
+type Error struct {
+	Code Code          // Kind of problem.
+	File string        // Source file, empty if unknown.
+	Line int           // 1-based line in the source, 0 if unknown.
+	Col  int           // 1-based column in runes, 0 if unknown.
+	Args []interface{} // Arguments for the code's message format.
+
+	Fixes []Fix // Suggested changes to the source, may be empty.
+}
+
+// newError returns an error with the given code and message arguments, and no
+// position.
+func newError(code Code, args ...interface{}) *Error {
+	return &Error{Code: code, Args: args}
+}
+
+// Error returns the English message of the error.
+func (e *Error) Error() string {
+	return e.Localize(DefaultLanguage)
+}
+
+// Localize returns the message of the error in the given language, prefixed
+// with its file and position if known. Falls back to English if the language
+// or the code are missing from the catalogs.
+func (e *Error) Localize(lang string) string {
+	msg := fmt.Sprintf(message(lang, e.Code), e.Args...)
+	if e.Line != 0 {
+		msg = fmt.Sprintf("%v:%v: %v", e.Line, e.Col, msg)
+	}
+	if e.File != "" && e.Line != 0 {
+		msg = e.File + ":" + msg
+	} else if e.File != "" {
+		msg = e.File + ": " + msg
+	}
+	return msg
+}
+
+// Localize returns the message of err in the given language. Errors that are
+// not of type *Error are returned as is.
+func Localize(err error, lang string) string {
+	if e, ok := err.(*Error); ok {
+		return e.Localize(lang)
+	}
+	return err.Error()
+}
+
+// atToken attaches tok's position and fix suggestions to err. Errors that
+// already have a position are returned as is.
+func atToken(err error, tok token) error {
+	e, ok := err.(*Error)
+	if !ok {
+		return fmt.Errorf("%v: %v", tok.pos(), err)
+	}
+	if e.Line == 0 {
+		e.Line, e.Col = tok.line, tok.col
+		e.Fixes = suggestFixes(e, tok)
+	}
+	return e
+}
+
+// DefaultLanguage is the language of messages returned by Error.Error.
+const DefaultLanguage = "en"
+
+// Messages maps diagnostic codes to fmt format strings. Each format takes the
+// arguments of the corresponding Error.
+type Messages map[Code]string
+
+var (
+	catalogs = map[string]Messages{
+		"en": englishMessages,
+		"es": spanishMessages,
+	}
+	catalogsLock sync.RWMutex
+)
+
+// RegisterMessages adds messages for the given language, replacing existing
+// messages for the same codes.
+func RegisterMessages(lang string, m Messages) {
+	catalogsLock.Lock()
+	defer catalogsLock.Unlock()
+	if catalogs[lang] == nil {
+		catalogs[lang] = Messages{}
+	}
+	for code, msg := range m {
+		catalogs[lang][code] = msg
+	}
+}
+
+// message returns the format string for the given code in the given
+// language, falling back to English.
+func message(lang string, code Code) string {
+	catalogsLock.RLock()
+	defer catalogsLock.RUnlock()
+	if msg, ok := catalogs[lang][code]; ok {
+		return msg
+	}
+	if msg, ok := catalogs[DefaultLanguage][code]; ok {
+		return msg
+	}
+	return string(code) + ": %v"
+}
+
+var englishMessages = Messages{
+	CodeBadHit:              "bad hit: %q",
+	CodeBadNote:             "bad note token: %q",
+	CodeBadDrum:             "bad drum number: %q",
+	CodeBadVelocity:         "bad velocity: %q",
+	CodeBadDuration:         "bad duration: %q",
+	CodeEmptyAnnotations:    "empty annotations",
+	CodeBadAnnotation:       "bad annotation: %q, should be key=value",
+	CodeDuplicateAnnotation: "duplicate annotation key: %q",
+	CodeHalfParenthesis:     "grace notes should have parenthesis on both sides",
+	CodeGraceTooLong:        "grace note is too long: %v ticks, should be less than %v",
+	CodeGraceChainTooLong:   "%v grace notes are too long: %v ticks together, should be less than %v",
+	CodeOrphanDuration:      "duration with no preceding note",
+	CodeUnrecognizedToken:   "unrecognized token: %q",
+	CodeBadDirective:        "bad directive: %q",
+	CodeUnknownDirective:    "unknown directive: %q",
+	CodeBadBPM:              "bad input to BPM: %q, should be a number",
+	CodeBPMRange:            "bad BPM: %v, must be between %v and %v",
+	CodeEmptyMarker:         "empty marker text",
+	CodeEmptyCue:            "empty cue point text",
+	CodeBadAlias:            "bad alias: %q, should be name=note",
+	CodeNumericAlias:        "bad alias name: %q, cannot be a number",
+	CodeZeroBPM:             "cannot encode with bpm=0",
+	CodeBadTimeSig:          "bad time signature: %q, should be like 4/4 or 7/8",
+	CodeBadRemap:            "bad remap: %q, should be from=to or a map name",
+	CodeMergeConflict:       "note %v is struck by both merged hits",
+	CodeUnopenedGroup:       "closing bracket with no opening bracket",
+	CodeUnclosedGroup:       "opening bracket is never closed",
+	CodeUnknownGroupOp:      "unknown group operator: %q",
+	CodeZeroDuration:        "hit #%v has zero duration",
+	CodeBadNoteNumber:       "hit #%v has bad note number %v, should be 1-127",
+	CodeBadVelocityValue:    "hit #%v: note %v has bad velocity %v, should be 1-127",
+	CodeTickOverflow:        "too long between events: %v ticks, maximum is %v",
+	CodeBadOffset:           "bad timing offset: %q, should be between -%[2]v and %[2]v",
+	CodeTempoMismatch:       "cannot merge tracks with different tempos: %v and %v BPM",
+	CodeEmptySong:           "song has no tracks",
+	CodeBadTabChar:          "unrecognized drum tab character: %q",
+	CodeBadTabDrum:          "unknown drum tab label: %q",
+	CodeTabBarLength:        "tab bar has %v steps, which do not divide a bar evenly",
+	CodeTabMismatch:         "tab row is not aligned with the rows above it",
+	CodeBadMIDIHeader:       "not a standard midi file",
+	CodeSMPTEDivision:       "midi files with SMPTE time division are not supported",
+	CodeTruncatedMIDI:       "midi file ends unexpectedly at byte %v",
+	CodeBadMIDIEvent:        "bad midi event at byte %v",
+	CodeSkippedBytes:        "skipped %v unreadable bytes at byte %v",
+	CodeMissingEOT:          "track chunk at byte %v has no end-of-track event",
+	CodeBadChunkLength:      "track chunk at byte %v has length %v, but its events take %v bytes",
+	CodeBadHydrogen:         "bad Hydrogen file: %v",
+	CodeUnknownPattern:      "song plays unknown pattern: %q",
+	CodeNoLilyPondName:      "hit #%v: note %v has no LilyPond drum name",
+	CodeBadControl:          "control #%v has controller %v and value %v, both should be 0-127",
+	CodeBadExpression:       "bad expression: %q",
+	CodeUnknownVariable:     "unknown variable: %q",
+	CodeUnknownFunction:     "unknown function: %q",
+	CodeFunctionArgs:        "function %v takes %v arguments, not %v",
+	CodeDivisionByZero:      "division by zero in %q",
+	CodeBadSet:              "bad variable definition: %q, should be name=expression",
+	CodeVelocityRange:       "bad velocity: %v, should be 1-127",
+	CodeBadSubdivision:      "cannot divide a bar of %[2]v ticks into %[1]v clicks",
+	CodeLongHit:             "hit #%v lasts %v ticks, longer than a bar of %v",
+	CodeOverlappingNote:     "hit #%v strikes note %v no later than hit #%v",
+	CodeFlatVelocity:        "all %v strikes have the same velocity %v",
+	CodeLeadingGrace:        "grace note before the first hit takes its time from an added bar of silence",
+	CodeShadowedDrum:        "alias %q hides a built-in drum name",
+	CodeUnusedAlias:         "alias %q is never used",
+	CodeBadSection:          "bad section name: %q",
+	CodeDuplicateSection:    "section %q is already defined",
+	CodeUnknownSection:      "unknown section: %q",
+	CodeBadPlay:             "bad play item: %q, should be section or section*count",
+	CodeNoInclude:           "cannot include files when parsing a string",
+	CodeIncludeFailed:       "cannot include %q: %v",
+	CodeIncludeCycle:        "%q includes itself: %v",
+	CodeTooManyHits:         "track has more than %v hits",
+	CodeSectionTooLarge:     "section %q played %v times expands to %v hits, limit is %v",
+	CodeIncludeDepth:        "cannot include %q: files are nested more than %v deep",
+	CodeTooManyTokens:       "source has more than %v tokens",
+	CodeTooManyNotes:        "hit has %v notes, limit is %v",
+	CodeTooManyTicks:        "track is longer than %v ticks (%v bars of 4/4)",
+	CodeTooManyEvents:       "track has more than %v meta and control events",
+	CodeUnknownOp:           "unknown operation: %q",
+	CodeOpIndex:             "operation at hit %v is out of range, track has %v hits",
+	CodeOpMissing:           "%v operation has no %v",
+	CodeOpDirective:         "directive %q cannot be added by an operation",
+	CodeBadFill:             "bad fill: %q, should be bars or bars,beats",
+	CodeEmptyTitle:          "empty title",
+	CodeNoLilyPond:          "cannot make a PDF: %q was not found, install LilyPond from lilypond.org",
+	CodeTrackCount:          "midi header counts %v tracks, but the file has %v",
+	CodeNoRunningStatus:     "data byte without a running status at byte %v",
+	CodeUnmatchedNoteOff:    "note-off of note %v on channel %v at byte %v has no note-on",
+	CodeUnendedNote:         "note %v on channel %v has no note-off in track chunk at byte %v",
+	CodeBadCresc:            "bad crescendo: %q, should be like pp..ff,2",
+	CodeBadBPMRamp:          "bad tempo ramp: %q, should be like 120..90,4 with up to 999 bars",
+	CodeBadChance:           "bad chance: %q, should be a percentage from 1 to 100",
+	CodeBadCC:               "bad control change: %q, should be like 4=64 or 4=0..127,1 with numbers up to 127",
+	CodeBadAftertouch:       "bad aftertouch: %q, should be a pressure up to 127, optionally after a drum, like C1=127",
+	CodeBadBend:             "bad pitch bend: %q, should be like -4096 or 0..-8192,1 with bends from -8192 to 8191",
+	CodeBadSysEx:            "bad sysex: %q, should be hex bytes from F0 to F7 with data bytes below 80 between them, like F0,41,10,F7",
+	CodeUnknownMap:          "unknown drum map: %q, should be one of: %v",
+	CodeNumericDrum:         "drum number %[1]v is not allowed, should be a name, like an alias from alias:Name=%[1]v",
+	CodeBadLoop:             "bad loop point: %q, should be marker, cc (loop start only) or empty",
+	CodeDuplicateLoop:       "%v is already placed at tick %v, a track has a single loop",
+	CodeLoopOrder:           "loop ends at tick %v, which is not after its start at tick %v",
+}
+
+var spanishMessages = Messages{
+	CodeBadHit:              "golpe inválido: %q",
+	CodeBadNote:             "nota inválida: %q",
+	CodeBadDrum:             "número de tambor inválido: %q",
+	CodeBadVelocity:         "velocidad inválida: %q",
+	CodeBadDuration:         "duración inválida: %q",
+	CodeEmptyAnnotations:    "anotaciones vacías",
+	CodeBadAnnotation:       "anotación inválida: %q, debe ser clave=valor",
+	CodeDuplicateAnnotation: "clave de anotación repetida: %q",
+	CodeHalfParenthesis:     "las notas de adorno deben tener paréntesis en ambos lados",
+	CodeGraceTooLong:        "nota de adorno demasiado larga: %v ticks, debe ser menor que %v",
+	CodeGraceChainTooLong:   "%v notas de adorno demasiado largas: %v ticks juntas, debe ser menor que %v",
+	CodeOrphanDuration:      "duración sin nota anterior",
+	CodeUnrecognizedToken:   "símbolo no reconocido: %q",
+	CodeBadDirective:        "directiva inválida: %q",
+	CodeUnknownDirective:    "directiva desconocida: %q",
+	CodeBadBPM:              "valor de BPM inválido: %q, debe ser un número",
+	CodeBPMRange:            "BPM inválido: %v, debe estar entre %v y %v",
+	CodeEmptyMarker:         "texto de marcador vacío",
+	CodeEmptyCue:            "texto de punto de referencia vacío",
+	CodeBadAlias:            "alias inválido: %q, debe ser nombre=nota",
+	CodeNumericAlias:        "nombre de alias inválido: %q, no puede ser un número",
+	CodeZeroBPM:             "no se puede codificar con bpm=0",
+	CodeBadTimeSig:          "compás inválido: %q, debe ser como 4/4 o 7/8",
+	CodeBadRemap:            "reasignación inválida: %q, debe ser origen=destino o un nombre de mapa",
+	CodeMergeConflict:       "la nota %v es golpeada por ambos golpes combinados",
+	CodeUnopenedGroup:       "corchete de cierre sin corchete de apertura",
+	CodeUnclosedGroup:       "el corchete de apertura nunca se cierra",
+	CodeUnknownGroupOp:      "operador de grupo desconocido: %q",
+	CodeZeroDuration:        "el golpe #%v tiene duración cero",
+	CodeBadNoteNumber:       "el golpe #%v tiene número de nota inválido %v, debe ser 1-127",
+	CodeBadVelocityValue:    "golpe #%v: la nota %v tiene velocidad inválida %v, debe ser 1-127",
+	CodeTickOverflow:        "demasiado tiempo entre eventos: %v ticks, el máximo es %v",
+	CodeBadOffset:           "desplazamiento inválido: %q, debe estar entre -%[2]v y %[2]v",
+	CodeTempoMismatch:       "no se pueden combinar pistas con tempos distintos: %v y %v BPM",
+	CodeEmptySong:           "la canción no tiene pistas",
+	CodeBadTabChar:          "carácter de tablatura no reconocido: %q",
+	CodeBadTabDrum:          "etiqueta de tablatura desconocida: %q",
+	CodeTabBarLength:        "el compás de la tablatura tiene %v pasos, que no dividen el compás en partes iguales",
+	CodeTabMismatch:         "la fila de la tablatura no está alineada con las filas anteriores",
+	CodeBadMIDIHeader:       "no es un archivo midi estándar",
+	CodeSMPTEDivision:       "no se admiten archivos midi con división de tiempo SMPTE",
+	CodeTruncatedMIDI:       "el archivo midi termina inesperadamente en el byte %v",
+	CodeBadMIDIEvent:        "evento midi inválido en el byte %v",
+	CodeSkippedBytes:        "se omitieron %v bytes ilegibles en el byte %v",
+	CodeMissingEOT:          "la pista en el byte %v no tiene evento de fin de pista",
+	CodeBadChunkLength:      "la pista en el byte %v tiene longitud %v, pero sus eventos ocupan %v bytes",
+	CodeBadHydrogen:         "archivo de Hydrogen inválido: %v",
+	CodeUnknownPattern:      "la canción usa un patrón desconocido: %q",
+	CodeNoLilyPondName:      "golpe #%v: la nota %v no tiene nombre de batería en LilyPond",
+	CodeBadExpression:       "expresión inválida: %q",
+	CodeUnknownVariable:     "variable desconocida: %q",
+	CodeUnknownFunction:     "función desconocida: %q",
+	CodeFunctionArgs:        "la función %v recibe %v argumentos, no %v",
+	CodeDivisionByZero:      "división por cero en %q",
+	CodeBadSet:              "definición de variable inválida: %q, debe ser nombre=expresión",
+	CodeVelocityRange:       "velocidad inválida: %v, debe ser 1-127",
+	CodeBadSubdivision:      "no se puede dividir un compás de %[2]v ticks en %[1]v clics",
+	CodeLongHit:             "el golpe #%v dura %v ticks, más que un compás de %v",
+	CodeOverlappingNote:     "el golpe #%v toca la nota %v no después que el golpe #%v",
+	CodeFlatVelocity:        "los %v golpes tienen la misma velocidad %v",
+	CodeLeadingGrace:        "la nota de adorno antes del primer golpe toma su tiempo de un compás de silencio añadido",
+	CodeShadowedDrum:        "el alias %q oculta un nombre de batería predefinido",
+	CodeUnusedAlias:         "el alias %q nunca se usa",
+	CodeBadSection:          "nombre de sección inválido: %q",
+	CodeDuplicateSection:    "la sección %q ya está definida",
+	CodeUnknownSection:      "sección desconocida: %q",
+	CodeBadPlay:             "elemento de play inválido: %q, debe ser sección o sección*veces",
+	CodeNoInclude:           "no se pueden incluir archivos al analizar una cadena",
+	CodeIncludeFailed:       "no se puede incluir %q: %v",
+	CodeIncludeCycle:        "%q se incluye a sí mismo: %v",
+	CodeTooManyHits:         "la pista tiene más de %v golpes",
+	CodeSectionTooLarge:     "la sección %q tocada %v veces se expande a %v golpes, el límite es %v",
+	CodeIncludeDepth:        "no se puede incluir %q: los archivos se anidan a más de %v niveles",
+	CodeTooManyTokens:       "la fuente tiene más de %v elementos",
+	CodeTooManyNotes:        "el golpe tiene %v notas, el límite es %v",
+	CodeTooManyTicks:        "la pista dura más de %v ticks (%v compases de 4/4)",
+	CodeTooManyEvents:       "la pista tiene más de %v eventos meta y de control",
+	CodeUnknownOp:           "operación desconocida: %q",
+	CodeOpIndex:             "la operación en el golpe %v está fuera de rango, la pista tiene %v golpes",
+	CodeOpMissing:           "la operación %v no tiene %v",
+	CodeOpDirective:         "la directiva %q no se puede agregar con una operación",
+	CodeBadFill:             "relleno inválido: %q, debe ser compases o compases,tiempos",
+	CodeEmptyTitle:          "título vacío",
+	CodeNoLilyPond:          "no se puede crear un PDF: no se encontró %q, instale LilyPond desde lilypond.org",
+	CodeTrackCount:          "el encabezado midi cuenta %v pistas, pero el archivo tiene %v",
+	CodeNoRunningStatus:     "byte de datos sin estado en curso en el byte %v",
+	CodeUnmatchedNoteOff:    "el note-off de la nota %v en el canal %v en el byte %v no tiene note-on",
+	CodeUnendedNote:         "la nota %v en el canal %v no tiene note-off en la pista en el byte %v",
+	CodeBadCresc:            "crescendo inválido: %q, debe ser como pp..ff,2",
+	CodeBadBPMRamp:          "cambio de tempo inválido: %q, debe ser como 120..90,4 con hasta 999 compases",
+	CodeBadChance:           "probabilidad inválida: %q, debe ser un porcentaje de 1 a 100",
+	CodeBadCC:               "cambio de control inválido: %q, debe ser como 4=64 o 4=0..127,1 con números hasta 127",
+	CodeBadAftertouch:       "aftertouch inválido: %q, debe ser una presión hasta 127, opcionalmente después de un tambor, como C1=127",
+	CodeBadBend:             "pitch bend inválido: %q, debe ser como -4096 o 0..-8192,1 con valores de -8192 a 8191",
+	CodeBadSysEx:            "sysex inválido: %q, debe ser bytes hexadecimales de F0 a F7 con bytes de datos menores a 80 entre ellos, como F0,41,10,F7",
+	CodeUnknownMap:          "mapa de batería desconocido: %q, debe ser uno de: %v",
+	CodeNumericDrum:         "el número de tambor %[1]v no está permitido, debe ser un nombre, como un alias de alias:Nombre=%[1]v",
+	CodeBadLoop:             "punto de bucle inválido: %q, debe ser marker, cc (solo inicio del bucle) o vacío",
+	CodeDuplicateLoop:       "%v ya está en el tick %v, una pista tiene un solo bucle",
+	CodeLoopOrder:           "el bucle termina en el tick %v, que no es posterior a su inicio en el tick %v",
+	CodeBadControl:          "el control #%v tiene controlador %v y valor %v, ambos deben ser 0-127",
+}
@@ -0,0 +1,49 @@
+package beatnik
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestLocalize(t *testing.T) {
+	_, err := ParseTrack("K S\nK Q9")
+	if err == nil {
+		t.Fatalf("ParseTrack() succeeded, want failure")
+	}
+	tests := []struct {
+		lang string
+		want string
+	}{
+		{"en", "2:3: bad drum number: \"Q9\""},
+		{"es", "2:3: número de tambor inválido: \"Q9\""},
+		{"xx", "2:3: bad drum number: \"Q9\""},
+	}
+	for _, test := range tests {
+		if got := Localize(err, test.lang); got != test.want {
+			t.Errorf("Localize(%v)=%q, want %q", test.lang, got, test.want)
+		}
+	}
+	if e, ok := err.(*Error); !ok || e.Code != CodeBadDrum {
+		t.Errorf("ParseTrack() error=%#v, want code %v", err, CodeBadDrum)
+	}
+}
+
+func TestRegisterMessages(t *testing.T) {
+	RegisterMessages("test", Messages{CodeOrphanDuration: "nothing before %v"})
+	err := &Error{Code: CodeOrphanDuration, Args: []interface{}{"here"}}
+	if got, want := err.Localize("test"), "nothing before here"; got != want {
+		t.Errorf("Localize(test)=%q, want %q", got, want)
+	}
+	other := fmt.Errorf("some error")
+	if got, want := Localize(other, "test"), "some error"; got != want {
+		t.Errorf("Localize(test)=%q, want %q", got, want)
+	}
+}
+
+func TestMessages_complete(t *testing.T) {
+	for code := range englishMessages {
+		if _, ok := spanishMessages[code]; !ok {
+			t.Errorf("spanishMessages missing code %q", code)
+		}
+	}
+}
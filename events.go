@@ -0,0 +1,38 @@
+package beatnik
+
+// Note events at absolute ticks.
+
+// A NoteEvent is the start or end of a note, at an absolute position in the
+// track.
+type NoteEvent struct {
+	T        uint     // Absolute tick of the event, from the start of the track.
+	Note     byte     // Drum note.
+	Velocity Velocity // Velocity of the note, as in midi note-offs for ends.
+	On       bool     // The event starts the note.
+}
+
+// Events returns the starts and ends of the track's notes in playing order,
+// as they would be encoded in a midi file, for tools that consume the notes
+// without decoding midi, like visualizers and analyzers. Uses the default
+// encoding options.
+func (t *Track) Events() []NoteEvent {
+	return t.EventsWith(nil)
+}
+
+// EventsWith returns the starts and ends of the track's notes like Events,
+// using the given encoding options, so note lengths, kits and chances apply
+// as they would in a midi file.
+func (t *Track) EventsWith(opts *EncodeOptions) []NoteEvent {
+	var result []NoteEvent
+	for _, ev := range t.channelEvents(opts) {
+		switch ev.data[0] {
+		case 0x99:
+			result = append(result, NoteEvent{ev.t, ev.data[1],
+				Velocity(ev.data[2]), true})
+		case 0x89:
+			result = append(result, NoteEvent{ev.t, ev.data[1],
+				Velocity(ev.data[2]), false})
+		}
+	}
+	return result
+}
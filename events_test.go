@@ -0,0 +1,21 @@
+package beatnik
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEvents(t *testing.T) {
+	tr := mustParse(t, "K,S- cc:4=10 HC@-2.")
+	want := []NoteEvent{{0, 36, F, true}, {0, 38, MF, true}, {94, 22, F, true},
+		{96, 36, 64, false}, {96, 38, 64, false}, {142, 22, 64, false}}
+	if got := tr.Events(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Events()=%v, want %v", got, want)
+	}
+
+	want = []NoteEvent{{0, 36, F, true}, {0, 38, MF, true}, {10, 36, 64, false},
+		{10, 38, 64, false}, {94, 22, F, true}, {104, 22, 64, false}}
+	if got := tr.EventsWith(&EncodeOptions{Gate: 10}); !reflect.DeepEqual(got, want) {
+		t.Errorf("EventsWith()=%v, want %v", got, want)
+	}
+}
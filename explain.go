@@ -0,0 +1,207 @@
+package beatnik
+
+// Human readable explanations of source tokens.
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var (
+	// Maps velocities to their musical names.
+	velocityNames = map[Velocity]string{
+		PPP: "pianississimo",
+		PP:  "pianissimo",
+		P:   "piano",
+		MP:  "mezzo-piano",
+		MF:  "mezzo-forte",
+		F:   "forte",
+		FF:  "fortissimo",
+		FFF: "fortississimo",
+	}
+
+	// Maps directive names to a description format, that takes the
+	// directive's value as a string.
+	directiveHelp = map[string]string{
+		"bpm":        "sets the tempo to %s BPM",
+		"marker":     "places a marker named %q",
+		"cue":        "places a cue point named %q",
+		"alias":      "defines a drum name: %s",
+		"time":       "sets the time signature to %s",
+		"remap":      "plays the following notes as other notes: %s",
+		"vel":        "sets the velocity of the following hits: %s",
+		"set":        "defines a variable: %s",
+		"section":    "starts a section named %q",
+		"play":       "plays sections again: %s",
+		"fill":       "plays a fill at the end of bars: %s",
+		"title":      "names the track %q",
+		"cresc":      "changes the velocity of the following hits gradually: %s",
+		"bpmramp":    "changes the tempo gradually: %s",
+		"cc":         "sends a control change: %s",
+		"aftertouch": "sends aftertouch: %s",
+		"bend":       "bends the pitch: %s",
+		"sysex":      "sends a system exclusive message: %s",
+		"map":        "uses the drum names of the %s map",
+		"include":    "plays the contents of file %q",
+		"loopstart":  "marks where the track loops from, with %s",
+		"loopend":    "marks where the track loops back, with %s",
+	}
+
+	// Maps group operator names to a description suffix.
+	groupHelp = map[string]string{
+		"":    "",
+		"rev": ", playing its hits in reverse order",
+	}
+
+	// Maps note values to their shortest built-in name.
+	noteNames = map[byte]string{}
+)
+
+func init() {
+	for name, note := range ezDrummer {
+		old, ok := noteNames[note]
+		if !ok || len(name) < len(old) || (len(name) == len(old) && name < old) {
+			noteNames[note] = name
+		}
+	}
+}
+
+// An Explanation describes what a single source token does, for teaching and
+// debugging.
+type Explanation struct {
+	Token   string // Source text of the token.
+	Line    int    // 1-based line of the token.
+	Col     int    // 1-based column of the token, in runes.
+	Tick    uint   // Position in the track where the token takes effect.
+	Hit     *Hit   // The hit created by the token, or nil if not a hit.
+	Meaning string // What the token means, in words.
+}
+
+// String returns the explanation as a single listing line.
+func (e *Explanation) String() string {
+	return fmt.Sprintf("%v:%v\t%v\t%v", e.Line, e.Col, e.Token, e.Meaning)
+}
+
+// Explain parses the given source and returns an explanation for each of its
+// tokens. If parsing fails, returns the explanations up to the bad token along
+// with the error.
+func Explain(src string) ([]*Explanation, error) {
+	p := newParser()
+	var result []*Explanation
+	var graces []*Explanation // Of the grace notes of the current chain.
+	for _, tok := range tokenize(src) {
+		tick := p.tick
+		nhits := len(p.t.Hits)
+		if err := p.parseToken(tok); err != nil {
+			return result, atToken(err, tok)
+		}
+		e := &Explanation{Token: tok.s, Line: tok.line, Col: tok.col, Tick: tick}
+
+		switch {
+		case len(p.t.Hits) > nhits && tokenKind(tok.s) == TokenHit:
+			h := p.t.Hits[len(p.t.Hits)-1]
+			e.Hit = h.copy()
+			e.Meaning = describeNotes(h) + ", " + p.describeTicks(h.T)
+			if parenthesized(tok.s) {
+				e.Tick = p.tick - h.T
+				from := "the previous hit"
+				switch {
+				case p.countIn != nil && p.graces.n == len(p.t.Hits)-1:
+					from = "an added bar of silence"
+				case p.graces.n > 1:
+					from = "the hit before the grace notes"
+				}
+				if p.graces.n > 1 {
+					// The chain's earlier grace notes move back.
+					for _, g := range graces {
+						g.Tick -= h.T
+					}
+				} else {
+					graces = graces[:0]
+				}
+				graces = append(graces, e)
+				e.Meaning = "grace note: " + e.Meaning + ", taken from " + from
+			}
+		case isWait(tok.s):
+			e.Meaning = "extends the previous hit by " +
+				p.describeTicks(parseDuration(tok.s))
+		case tok.s == "|":
+			e.Meaning = "a bar line, for readability"
+		case tok.s == "[":
+			e.Meaning = "starts a group"
+		case isGroupClose(tok.s):
+			e.Meaning = "ends a group" + groupHelp[tok.s[1:]]
+		default:
+			name, value, _ := splitDirective(tok.s)
+			if name == "loopstart" || name == "loopend" {
+				value = describeLoop(name, value)
+			}
+			e.Meaning = fmt.Sprintf(directiveHelp[name], value)
+		}
+		result = append(result, e)
+	}
+	return result, p.finish()
+}
+
+// describeNotes returns a description of the notes of the given hit, with
+// their velocities, timing offsets and chances, ordered by note.
+func describeNotes(h *Hit) string {
+	var keys []int
+	for n := range h.Notes {
+		keys = append(keys, int(n))
+	}
+	sort.Ints(keys)
+
+	var parts []string
+	for _, n := range keys {
+		part := fmt.Sprintf("%v %v", describeNote(byte(n)),
+			describeVelocity(h.Notes[byte(n)]))
+		if off := h.Offsets[byte(n)]; off < 0 {
+			part += fmt.Sprintf(" %v ticks early", -off)
+		} else if off > 0 {
+			part += fmt.Sprintf(" %v ticks late", off)
+		}
+		if c, ok := h.Chances[byte(n)]; ok {
+			part += fmt.Sprintf(" (%v%% chance)", c)
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, " + ")
+}
+
+// describeVelocity returns the musical name of a velocity, or its number if it
+// has no name.
+func describeVelocity(v Velocity) string {
+	if name, ok := velocityNames[v]; ok {
+		return name
+	}
+	return fmt.Sprintf("velocity %v", v)
+}
+
+// describeNote returns the name and number of a note, like "K (36)".
+func describeNote(n byte) string {
+	if name, ok := noteNames[n]; ok {
+		return fmt.Sprintf("%v (%v)", name, n)
+	}
+	return fmt.Sprint(n)
+}
+
+// describeTicks returns a duration as a fraction of a bar in the parser's
+// current time signature, like "1/8 bar (48 ticks)".
+func (p *parser) describeTicks(t uint) string {
+	bar := p.t.timeSig().barTicks()
+	d := gcd(t, bar)
+	if t == 0 {
+		d = 1
+	}
+	return fmt.Sprintf("%v/%v bar (%v ticks)", t/d, bar/d, t)
+}
+
+// gcd returns the greatest common divisor of a and b.
+func gcd(a, b uint) uint {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
@@ -0,0 +1,81 @@
+package beatnik
+
+import (
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	src := "bpm:90\nK,S+. .. (HC..) (HC...)\n  42>"
+	want := []string{
+		"1:1\tbpm:90\tsets the tempo to 90 BPM",
+		"2:1\tK,S+.\tK (36) forte + S (38) fortissimo, 1/8 bar (48 ticks)",
+		"2:7\t..\textends the previous hit by 1/16 bar (24 ticks)",
+		"2:10\t(HC..)\tgrace note: HC (22) forte, 1/16 bar (24 ticks), " +
+			"taken from the previous hit",
+		"2:17\t(HC...)\tgrace note: HC (22) forte, 1/32 bar (12 ticks), " +
+			"taken from the hit before the grace notes",
+		"3:3\t42>\tHCT (42) forte, 1/6 bar (64 ticks)",
+	}
+	wantTicks := []uint{0, 0, 48, 36, 60, 72}
+
+	got, err := Explain(src)
+	if err != nil {
+		t.Fatalf("Explain(%q) failed: %v", src, err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Explain(%q) returned %v explanations, want %v",
+			src, len(got), len(want))
+	}
+	for i := range got {
+		if got[i].String() != want[i] {
+			t.Errorf("Explain(%q)[%v]=%q, want %q", src, i, got[i], want[i])
+		}
+		if got[i].Tick != wantTicks[i] {
+			t.Errorf("Explain(%q)[%v].Tick=%v, want %v",
+				src, i, got[i].Tick, wantTicks[i])
+		}
+	}
+}
+
+func TestExplain_error(t *testing.T) {
+	src := "K S Q"
+	got, err := Explain(src)
+	if err == nil {
+		t.Fatalf("Explain(%q) succeeded, want failure", src)
+	}
+	if len(got) != 2 {
+		t.Errorf("Explain(%q) returned %v explanations, want 2", src, len(got))
+	}
+}
+
+func TestExplain_loop(t *testing.T) {
+	got, err := Explain("K loopstart: K loopstart: loopend:")
+	if err == nil {
+		t.Fatalf("Explain() succeeded, want failure")
+	}
+	want := "marks where the track loops from, with a marker and controller 111"
+	if len(got) != 3 || got[1].Meaning != want {
+		t.Fatalf("Explain()=%v, want %q second", got, want)
+	}
+
+	got, err = Explain("loopstart:cc K loopend:")
+	if err != nil {
+		t.Fatalf("Explain() failed: %v", err)
+	}
+	want = "marks where the track loops back, with a marker"
+	if got[0].Meaning != "marks where the track loops from, with controller 111" ||
+		got[2].Meaning != want {
+		t.Errorf("Explain()=%v, want loop points", got)
+	}
+}
+
+func TestExplain_velocity(t *testing.T) {
+	got, err := Explain("vel:100 K,S+")
+	if err != nil {
+		t.Fatalf("Explain() failed: %v", err)
+	}
+	want := "K (36) velocity 100 + S (38) velocity 106, 1/4 bar (96 ticks)"
+	if len(got) != 2 || got[1].Meaning != want {
+		t.Errorf("Explain()=%v, want %q", got, want)
+	}
+}
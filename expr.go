@@ -0,0 +1,248 @@
+package beatnik
+
+// Arithmetic expressions in directives.
+
+import (
+	"strconv"
+	"unicode"
+)
+
+// An expr is a compiled integer expression. vars returns the value of a
+// variable, and false if it is not defined.
+type expr func(vars func(string) (int, bool)) (int, error)
+
+// exprFuncs maps the names of functions that expressions may call to their
+// implementations and number of arguments.
+var exprFuncs = map[string]struct {
+	nargs int
+	f     func(args []int) int
+}{
+	"min": {2, func(a []int) int {
+		if a[1] < a[0] {
+			return a[1]
+		}
+		return a[0]
+	}},
+	"max": {2, func(a []int) int {
+		if a[1] > a[0] {
+			return a[1]
+		}
+		return a[0]
+	}},
+	"abs": {1, func(a []int) int {
+		if a[0] < 0 {
+			return -a[0]
+		}
+		return a[0]
+	}},
+}
+
+// compileExpr parses an integer expression with + - * / %, parentheses,
+// variables and function calls, like "base+bar*2" or "max(100-bar,80)".
+// Variables may be written with a leading $, as in "$tempo*2". Division
+// rounds towards zero.
+func compileExpr(s string) (expr, error) {
+	c := &exprCompiler{src: s}
+	e := c.sum()
+	if c.err == nil && c.i < len(c.src) {
+		c.fail()
+	}
+	if c.err != nil {
+		return nil, c.err
+	}
+	return e, nil
+}
+
+// evalExpr compiles and evaluates an expression.
+func evalExpr(s string, vars func(string) (int, bool)) (int, error) {
+	e, err := compileExpr(s)
+	if err != nil {
+		return 0, err
+	}
+	return e(vars)
+}
+
+// An exprCompiler is a recursive descent parser of expressions. Parsing
+// stops at the first error.
+type exprCompiler struct {
+	src string
+	i   int   // Position of the next byte.
+	err error // First error found.
+}
+
+// fail records a syntax error, unless an error was already found.
+func (c *exprCompiler) fail() {
+	if c.err == nil {
+		c.err = newError(CodeBadExpression, c.src)
+	}
+}
+
+// next consumes and returns true if the next byte is b.
+func (c *exprCompiler) next(b byte) bool {
+	if c.i < len(c.src) && c.src[c.i] == b {
+		c.i++
+		return true
+	}
+	return false
+}
+
+// sum parses terms separated by + and -.
+func (c *exprCompiler) sum() expr {
+	e := c.product()
+	for c.err == nil {
+		var op byte
+		switch {
+		case c.next('+'):
+			op = '+'
+		case c.next('-'):
+			op = '-'
+		default:
+			return e
+		}
+		e = c.binary(op, e, c.product())
+	}
+	return e
+}
+
+// product parses factors separated by *, / and %.
+func (c *exprCompiler) product() expr {
+	e := c.unary()
+	for c.err == nil {
+		var op byte
+		switch {
+		case c.next('*'):
+			op = '*'
+		case c.next('/'):
+			op = '/'
+		case c.next('%'):
+			op = '%'
+		default:
+			return e
+		}
+		e = c.binary(op, e, c.unary())
+	}
+	return e
+}
+
+// binary returns an expression that applies op to the values of a and b.
+func (c *exprCompiler) binary(op byte, a, b expr) expr {
+	src := c.src
+	return func(vars func(string) (int, bool)) (int, error) {
+		x, err := a(vars)
+		if err != nil {
+			return 0, err
+		}
+		y, err := b(vars)
+		if err != nil {
+			return 0, err
+		}
+		switch op {
+		case '+':
+			return x + y, nil
+		case '-':
+			return x - y, nil
+		case '*':
+			return x * y, nil
+		}
+		if y == 0 {
+			return 0, newError(CodeDivisionByZero, src)
+		}
+		if op == '/' {
+			return x / y, nil
+		}
+		return x % y, nil
+	}
+}
+
+// unary parses a factor with optional leading minus signs.
+func (c *exprCompiler) unary() expr {
+	if c.next('-') {
+		e := c.unary()
+		return func(vars func(string) (int, bool)) (int, error) {
+			x, err := e(vars)
+			return -x, err
+		}
+	}
+	return c.primary()
+}
+
+// primary parses a number, a variable, a function call or a parenthesized
+// expression.
+func (c *exprCompiler) primary() expr {
+	if c.next('(') {
+		e := c.sum()
+		if !c.next(')') {
+			c.fail()
+		}
+		return e
+	}
+
+	dollar := c.next('$')
+	start := c.i
+	for c.i < len(c.src) && isExprLetter(c.src[c.i]) {
+		c.i++
+	}
+	word := c.src[start:c.i]
+	if word == "" || dollar && word[0] >= '0' && word[0] <= '9' {
+		c.fail()
+		return nil
+	}
+	if word[0] >= '0' && word[0] <= '9' {
+		x, err := strconv.Atoi(word)
+		if err != nil {
+			c.fail()
+			return nil
+		}
+		return func(func(string) (int, bool)) (int, error) {
+			return x, nil
+		}
+	}
+	if !dollar && c.next('(') {
+		return c.call(word)
+	}
+	return func(vars func(string) (int, bool)) (int, error) {
+		x, ok := vars(word)
+		if !ok {
+			return 0, newError(CodeUnknownVariable, word)
+		}
+		return x, nil
+	}
+}
+
+// call parses the arguments of a function call, after the opening
+// parenthesis.
+func (c *exprCompiler) call(name string) expr {
+	fn, ok := exprFuncs[name]
+	if !ok {
+		if c.err == nil {
+			c.err = newError(CodeUnknownFunction, name)
+		}
+		return nil
+	}
+	var args []expr
+	for c.err == nil && !c.next(')') {
+		if len(args) > 0 && !c.next(',') {
+			c.fail()
+			return nil
+		}
+		args = append(args, c.sum())
+	}
+	if c.err == nil && len(args) != fn.nargs {
+		c.err = newError(CodeFunctionArgs, name, fn.nargs, len(args))
+	}
+	return func(vars func(string) (int, bool)) (int, error) {
+		values := make([]int, len(args))
+		for i, a := range args {
+			var err error
+			if values[i], err = a(vars); err != nil {
+				return 0, err
+			}
+		}
+		return fn.f(values), nil
+	}
+}
+
+// isExprLetter returns true if b may be part of a number or a name.
+func isExprLetter(b byte) bool {
+	return b == '_' || b < 128 && (unicode.IsLetter(rune(b)) || unicode.IsDigit(rune(b)))
+}
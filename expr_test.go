@@ -0,0 +1,65 @@
+package beatnik
+
+import (
+	"testing"
+)
+
+func TestEvalExpr(t *testing.T) {
+	vars := func(name string) (int, bool) {
+		if name == "x" {
+			return 7, true
+		}
+		return 0, false
+	}
+	tests := []struct {
+		in   string
+		want int
+	}{
+		{"1", 1},
+		{"1+2*3", 7},
+		{"(1+2)*3", 9},
+		{"x-10", -3},
+		{"--x", 7},
+		{"x/2", 3},
+		{"x%4", 3},
+		{"min(x,3)", 3},
+		{"max(x,3)+abs(-2)", 9},
+		{"max(min(x,3),2*x)", 14},
+		{"$x*2", 14},
+	}
+	for _, test := range tests {
+		got, err := evalExpr(test.in, vars)
+		if err != nil {
+			t.Errorf("evalExpr(%q) failed: %v", test.in, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("evalExpr(%q)=%v, want %v", test.in, got, test.want)
+		}
+	}
+}
+
+func TestEvalExpr_bad(t *testing.T) {
+	vars := func(string) (int, bool) { return 0, false }
+	tests := []struct {
+		in   string
+		code Code
+	}{
+		{"", CodeBadExpression},
+		{"1+", CodeBadExpression},
+		{"(1", CodeBadExpression},
+		{"1)", CodeBadExpression},
+		{"1 + 2", CodeBadExpression},
+		{"2x", CodeBadExpression},
+		{"y", CodeUnknownVariable},
+		{"f(1)", CodeUnknownFunction},
+		{"min(1)", CodeFunctionArgs},
+		{"1/(1-1)", CodeDivisionByZero},
+	}
+	for _, test := range tests {
+		_, err := evalExpr(test.in, vars)
+		if e, ok := err.(*Error); !ok || e.Code != test.code {
+			t.Errorf("evalExpr(%q) error=%v, want %v", test.in, err, test.code)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package beatnik
+
+// Fills at the ends of bars.
+
+import (
+	"regexp"
+	"strconv"
+)
+
+// fillToken matches the value of a fill directive: a number of bars with an
+// optional number of beats.
+var fillToken = regexp.MustCompile("^([0-9]+)(?:,([0-9]+))?$")
+
+// maxFillBeats is the largest number of beats in a fill directive, which is
+// the most beats that a bar can have.
+const maxFillBeats = 255
+
+// fillDrums are the drums that generated fills go through, from high to low.
+var fillDrums = []string{"S", "T1", "T2", "T3"}
+
+// A FillFunc returns the hits of a fill that ends the given bar, counted from
+// 0. beat is the length of a beat in ticks, according to the track's time
+// signature. The fill replaces the end of the bar, as long as its hits last.
+type FillFunc func(bar int, beat uint) []*Hit
+
+// TomFill returns a FillFunc of sixteenth notes that go down from the snare
+// through the toms, getting louder, over the given number of beats.
+func TomFill(beats int) FillFunc {
+	return func(bar int, beat uint) []*Hit {
+		steps := beats * 4
+		step := beat / 4
+		if step == 0 {
+			step = 1
+		}
+		var result []*Hit
+		for i := 0; i < steps; i++ {
+			v := Velocity(MF)
+			if steps > 1 {
+				v += Velocity((FF - MF) * i / (steps - 1))
+			}
+			note := ezDrummer[fillDrums[i*len(fillDrums)/steps]]
+			result = append(result, &Hit{Notes: map[byte]Velocity{note: v},
+				T: step})
+		}
+		return result
+	}
+}
+
+// InsertFills replaces the end of every Nth bar of the track with a fill made
+// by gen, starting with bar N. Bars follow the track's time signature, and
+// only whole bars get fills. Hits that cross the start of a fill are
+// shortened, and meta and control events are kept where they are.
+func InsertFills(t *Track, every int, gen FillFunc) {
+	t.insertFills(0, t.ticks(), every, gen, nil)
+}
+
+// insertFills inserts fills like InsertFills, in the bars that start at or
+// after tick from and end at or before tick to. Bars are counted from the
+// first of them. grow, if not nil, is called with the number of hits of each
+// fill before it is inserted, and can stop the insertion with an error.
+func (t *Track) insertFills(from, to uint, every int, gen FillFunc,
+	grow func(int) error) error {
+	ts := t.timeSig()
+	bar := ts.barTicks()
+	if every < 1 || uint(every) > to/bar {
+		return nil
+	}
+	first := (from + bar - 1) / bar // First whole bar.
+	for end := (first + uint(every)) * bar; end <= to; end += uint(every) * bar {
+		var hits []*Hit
+		var ticks uint
+		for _, h := range gen(int(end/bar)-1, bar/ts.Num) {
+			if ticks+h.T > bar {
+				break
+			}
+			hits = append(hits, h.copy())
+			ticks += h.T
+		}
+		if len(hits) == 0 {
+			continue
+		}
+		if grow != nil {
+			if err := grow(len(hits)); err != nil {
+				return err
+			}
+		}
+		t.replaceRange(end-ticks, end, hits)
+	}
+	return nil
+}
+
+// replaceRange replaces the hits in ticks [start,end) with the given hits,
+// that should last end-start ticks. Hits that cross the range's edges are
+// cut, and the parts that cross its end become rests.
+func (t *Track) replaceRange(start, end uint, hits []*Hit) {
+	result := make([]*Hit, 0, len(t.Hits)+len(hits))
+	inserted := false
+	insert := func() {
+		if !inserted {
+			result = append(result, hits...)
+			inserted = true
+		}
+	}
+	var pos uint
+	for _, h := range t.Hits {
+		hStart, hEnd := pos, pos+h.T
+		pos = hEnd
+		if hStart >= start {
+			insert()
+		}
+		if hEnd <= start || hStart >= end {
+			result = append(result, h)
+			continue
+		}
+		if hStart < start {
+			h.T = start - hStart
+			result = append(result, h)
+			insert()
+		}
+		if hEnd > end {
+			result = append(result, &Hit{T: hEnd - end})
+		}
+	}
+	insert()
+	t.Hits = result
+}
+
+// A fillRange is a range of the track where a fill directive is in effect.
+type fillRange struct {
+	start, end   uint          // Range of ticks.
+	open         bool          // The range did not end yet.
+	every, beats int           // Arguments of the directive.
+	remap        map[byte]byte // Remapping of the fill's notes.
+}
+
+// fillDirective plays a fill at the end of every Nth bar from here on, as in
+// "fill:4" for a fill on the last beat of every 4th bar, or "fill:4,2" for
+// the last 2 beats. Empty stops playing fills. The fills are inserted when
+// the whole track is parsed.
+func fillDirective(p *parser, s string, at DirectiveContext) error {
+	p.endFill()
+	if s == "" {
+		return nil
+	}
+	m := fillToken.FindStringSubmatch(s)
+	if m == nil {
+		return newError(CodeBadFill, s)
+	}
+	every, err := strconv.Atoi(m[1])
+	if err != nil || every < 1 {
+		return newError(CodeBadFill, s)
+	}
+	beats := 1
+	if m[2] != "" {
+		beats, err = strconv.Atoi(m[2])
+		if err != nil || beats < 1 || beats > maxFillBeats {
+			return newError(CodeBadFill, s)
+		}
+	}
+	var remap map[byte]byte
+	if len(p.remap) > 0 {
+		remap = map[byte]byte{}
+		for k, v := range p.remap {
+			remap[k] = v
+		}
+	}
+	p.fills = append(p.fills, fillRange{start: at.Tick, open: true,
+		every: every, beats: beats, remap: remap})
+	return nil
+}
+
+// endFill ends the range of the last fill directive, if it did not end yet.
+func (p *parser) endFill() {
+	if n := len(p.fills); n > 0 && p.fills[n-1].open {
+		p.fills[n-1].end = p.tick
+		p.fills[n-1].open = false
+	}
+}
+
+// insertFills inserts the fills of the parsed fill directives.
+func (p *parser) insertFills() error {
+	p.endFill()
+	for _, f := range p.fills {
+		f := f
+		fill := TomFill(f.beats)
+		gen := func(bar int, beat uint) []*Hit {
+			hits := fill(bar, beat)
+			if len(f.remap) > 0 {
+				for _, h := range hits {
+					h.remap(f.remap)
+				}
+			}
+			return hits
+		}
+		if err := p.t.insertFills(f.start, f.end, f.every, gen,
+			p.grow); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package beatnik
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInsertFills(t *testing.T) {
+	gen := func(bar int, beat uint) []*Hit {
+		return mustParse(t, "S.. T1..").Hits
+	}
+	tests := []struct {
+		src   string
+		every int
+		want  []*Hit
+	}{
+		{"K S K S K S K S", 2,
+			mustParse(t, "K S K S K S K S. S.. T1..").Hits},
+		{"K S K S", 2, mustParse(t, "K S K S").Hits},
+		{"K~~ K~~", 1, mustParse(t, "K~ . . . S.. T1.. K~ . . . S.. T1..").Hits},
+		{"K~ S. S S K", 1, append(mustParse(t, "K~ S. S S.. T1..").Hits,
+			&Hit{T: 48}, mustParse(t, "K").Hits[0])},
+	}
+	for _, test := range tests {
+		tr := mustParse(t, test.src)
+		InsertFills(tr, test.every, gen)
+		if !reflect.DeepEqual(tr.Hits, test.want) {
+			t.Errorf("InsertFills(%q,%v)=%v, want %v", test.src, test.every,
+				tr.Hits, test.want)
+		}
+	}
+}
+
+func TestParseTrack_fill(t *testing.T) {
+	tests := []struct {
+		src, want string
+	}{
+		{"fill:2 K S K S K S K S",
+			"K S K S K S K S-.. vel:113 T1.. vel:117 T2.. vel: T3+.."},
+		{"K S K fill:1,2 S K S K S fill: K S K S",
+			"K S K S K S vel:109 S.. vel:110 S.. vel:112 T1.. vel:114 T1.. " +
+				"vel: T2.. vel:117 T2.. vel:119 T3.. vel:121 T3.. vel: K S K S"},
+		{"remap:T1=T2 fill:1 K S K S",
+			"K S K S-.. vel:113 T2.. vel:117 T2.. vel: T3+.."},
+	}
+	for _, test := range tests {
+		tr, err := ParseTrack(test.src)
+		if err != nil {
+			t.Fatalf("ParseTrack(%q) failed: %v", test.src, err)
+		}
+		want := mustParse(t, test.want)
+		if !reflect.DeepEqual(tr.Hits, want.Hits) {
+			t.Errorf("ParseTrack(%q)=%v, want %v", test.src, tr.Hits, want.Hits)
+		}
+	}
+
+	for _, src := range []string{"fill:0", "fill:x", "fill:2,0", "fill:2,1000"} {
+		_, err := ParseTrack(src)
+		if e, ok := err.(*Error); !ok || e.Code != CodeBadFill {
+			t.Errorf("ParseTrack(%q)=%v, want %v", src, err, CodeBadFill)
+		}
+	}
+}
+
+// mustParse parses a track or fails the test.
+func mustParse(t *testing.T, src string) *Track {
+	tr, err := ParseTrack(src)
+	if err != nil {
+		t.Fatalf("ParseTrack(%q) failed: %v", src, err)
+	}
+	return tr
+}
@@ -0,0 +1,108 @@
+package beatnik
+
+// Machine-applicable fix suggestions for errors.
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// A Fix is a suggested change to the source that resolves an Error.
+type Fix struct {
+	Title string // What the fix does, in English.
+	Edits []Edit // Changes to apply to the source.
+}
+
+// An Edit replaces a range within a single line of the source.
+type Edit struct {
+	Line    int    // 1-based line.
+	Col     int    // 1-based first column of the range, in runes.
+	EndCol  int    // 1-based column after the range. Equals Col for insertions.
+	NewText string // Replacement text.
+}
+
+// ApplyFix returns src with the edits of f applied. Edits should not overlap.
+func ApplyFix(src string, f Fix) string {
+	lines := strings.Split(src, "\n")
+	// Apply from last to first, so that earlier positions remain valid.
+	edits := append([]Edit(nil), f.Edits...)
+	for i := 1; i < len(edits); i++ {
+		for j := i; j > 0 && editBefore(edits[j-1], edits[j]); j-- {
+			edits[j-1], edits[j] = edits[j], edits[j-1]
+		}
+	}
+	for _, e := range edits {
+		if e.Line < 1 || e.Line > len(lines) {
+			continue
+		}
+		line := lines[e.Line-1]
+		start, end := runeOffset(line, e.Col), runeOffset(line, e.EndCol)
+		lines[e.Line-1] = line[:start] + e.NewText + line[end:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// editBefore returns true if a starts before b in the source.
+func editBefore(a, b Edit) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Col < b.Col)
+}
+
+// runeOffset returns the byte offset of the given 1-based rune column in s.
+// Columns past the end of s return len(s).
+func runeOffset(s string, col int) int {
+	i := 0
+	for c := 1; c < col && i < len(s); c++ {
+		_, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+	}
+	return i
+}
+
+// suggestFixes returns fixes for common errors in the given token, or nil if
+// none apply.
+func suggestFixes(e *Error, tok token) []Fix {
+	n := utf8.RuneCountInString(tok.s)
+	switch e.Code {
+	case CodeHalfParenthesis:
+		if tok.s[0] == '(' {
+			return []Fix{{"add closing parenthesis",
+				[]Edit{{tok.line, tok.col + n, tok.col + n, ")"}}}}
+		}
+		return []Fix{{"add opening parenthesis",
+			[]Edit{{tok.line, tok.col, tok.col, "("}}}}
+	case CodeOrphanDuration:
+		return []Fix{{"remove duration",
+			[]Edit{{tok.line, tok.col, tok.col + n, ""}}}}
+	case CodeBadVelocity:
+		return velocityFixes(tok)
+	}
+	return nil
+}
+
+// velocityFixes returns a fix that clamps out of range velocity signs in a hit
+// token to the nearest valid velocity.
+func velocityFixes(tok token) []Fix {
+	m, ok := matchHit(tok.s)
+	if !ok {
+		return nil
+	}
+	col := tok.col + utf8.RuneCountInString(tok.s[:m[2]])
+	var edits []Edit
+	for _, part := range strings.Split(m.notes(tok.s), ",") {
+		nm, ok := matchNote(part)
+		if ok && parseVelocity(nm.velocity(part)) == 0 {
+			v := nm.velocity(part)
+			start := col + utf8.RuneCountInString(nm.name(part))
+			fixed := "-----"
+			if v[0] == '+' {
+				fixed = "++"
+			}
+			edits = append(edits, Edit{tok.line, start, start + len(v), fixed})
+		}
+		col += utf8.RuneCountInString(part) + 1
+	}
+	if len(edits) == 0 {
+		return nil
+	}
+	return []Fix{{"use nearest valid velocity", edits}}
+}
@@ -0,0 +1,40 @@
+package beatnik
+
+import (
+	"testing"
+)
+
+func TestSuggestFixes(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"K S (HC.. K", "K S (HC..) K"},
+		{"K S\n  HC..) K", "K S\n  (HC..) K"},
+		{"bpm:90 .. K", "bpm:90  K"},
+		{"K K,S------,HC+++.", "K K,S-----,HC++."},
+		{"alias:Б=K Б,S------", "alias:Б=K Б,S-----"},
+	}
+	for _, test := range tests {
+		_, err := ParseTrack(test.src)
+		e, ok := err.(*Error)
+		if !ok {
+			t.Errorf("ParseTrack(%q) error=%v, want *Error", test.src, err)
+			continue
+		}
+		if len(e.Fixes) != 1 {
+			t.Errorf("ParseTrack(%q) fixes=%v, want 1 fix", test.src, e.Fixes)
+			continue
+		}
+		if got := ApplyFix(test.src, e.Fixes[0]); got != test.want {
+			t.Errorf("ApplyFix(%q)=%q, want %q", test.src, got, test.want)
+		}
+	}
+}
+
+func TestSuggestFixes_none(t *testing.T) {
+	_, err := ParseTrack("K S Q")
+	if e, ok := err.(*Error); !ok || e.Fixes != nil {
+		t.Errorf("ParseTrack() error=%#v, want *Error without fixes", err)
+	}
+}
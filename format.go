@@ -0,0 +1,196 @@
+package beatnik
+
+// Canonical formatting of source text.
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Format returns the source in canonical form. Tokens are separated by single
+// spaces, and the tokens of consecutive lines of hits are aligned in columns.
+// Indentation, trailing spaces and repeated blank lines are removed, and
+// comments are kept. In hits, drum numbers are replaced by a name of the same
+// drum (a user alias if there is one), "@+N" offsets are written "@N", and
+// ">3" triplets are written ">". Fails if the source
+// does not parse.
+func Format(src string) (string, error) {
+	if _, err := ParseTrack(src); err != nil {
+		return "", err
+	}
+
+	p := newParser()
+	var lines []formatLine
+	for _, line := range strings.Split(src, "\n") {
+		fl := formatLine{}
+		if i := strings.IndexByte(line, '#'); i != -1 {
+			fl.comment = strings.TrimRightFunc(line[i:], unicode.IsSpace)
+			line = line[:i]
+		}
+		fl.align = true
+		for _, tok := range tokenize(line) {
+			fl.tokens = append(fl.tokens, p.formatToken(tok.s))
+			if tokenKind(tok.s) == TokenDirective {
+				fl.align = false
+			}
+			p.parseToken(tok)
+		}
+		if len(fl.tokens) == 0 {
+			fl.align = false
+		}
+		lines = append(lines, fl)
+	}
+
+	// Align blocks of hit lines.
+	for i := 0; i < len(lines); {
+		j := i
+		for j < len(lines) && lines[j].align {
+			j++
+		}
+		if j-i > 1 {
+			alignLines(lines[i:j])
+		}
+		if j == i {
+			j++
+		}
+		i = j
+	}
+
+	buf := &strings.Builder{}
+	blank := true // Skip leading blank lines.
+	for _, fl := range lines {
+		s := strings.TrimRightFunc(strings.Join(fl.tokens, " "), unicode.IsSpace)
+		if fl.comment != "" {
+			if s != "" {
+				s += " "
+			}
+			s += fl.comment
+		}
+		if s == "" {
+			if !blank {
+				buf.WriteString("\n")
+			}
+			blank = true
+			continue
+		}
+		buf.WriteString(s + "\n")
+		blank = false
+	}
+	return strings.TrimRight(buf.String(), "\n") + "\n", nil
+}
+
+// A formatLine is a line of formatted source.
+type formatLine struct {
+	tokens  []string // Formatted tokens.
+	comment string   // Comment including its #, or empty.
+	align   bool     // The line has only hits, and can be aligned in columns.
+}
+
+// alignLines pads the tokens of the given lines so that each column has the
+// same width.
+func alignLines(lines []formatLine) {
+	var widths []int
+	for _, fl := range lines {
+		for i, tok := range fl.tokens {
+			if i == len(widths) {
+				widths = append(widths, 0)
+			}
+			if n := utf8.RuneCountInString(tok); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	for _, fl := range lines {
+		for i, tok := range fl.tokens {
+			if i < len(fl.tokens)-1 || fl.comment != "" {
+				fl.tokens[i] = tok + strings.Repeat(" ",
+					widths[i]-utf8.RuneCountInString(tok))
+			}
+		}
+	}
+}
+
+// formatToken returns the canonical form of a valid token, according to the
+// parser's current aliases.
+func (p *parser) formatToken(s string) string {
+	switch tokenKind(s) {
+	case TokenHit:
+		grace := parenthesized(s)
+		if grace {
+			s = s[1 : len(s)-1]
+		}
+		m, _ := matchHit(s)
+		var notes []string
+		for _, part := range strings.Split(m.notes(s), ",") {
+			notes = append(notes, p.formatNote(part))
+		}
+		s = strings.Join(notes, ",") + m.annotations(s) +
+			formatDuration(m.duration(s))
+		if grace {
+			s = "(" + s + ")"
+		}
+		return s
+	case TokenWait:
+		return formatDuration(s)
+	}
+	return s
+}
+
+// formatNote returns the canonical form of a single note of a hit.
+func (p *parser) formatNote(s string) string {
+	m, _ := matchNote(s)
+	result := p.noteName(m.name(s)) + m.velocity(s)
+	if o := m.offset(s); o != "" {
+		off, _ := strconv.Atoi(o)
+		result += "@" + strconv.Itoa(off)
+	}
+	if ch := m.chance(s); ch != "" {
+		c, _ := strconv.Atoi(ch)
+		result += "?" + strconv.Itoa(c)
+	}
+	return result
+}
+
+// noteName returns a name for a drum number, or the name itself if it is not
+// a number or has no name. Prefers user aliases, shortest first.
+func (p *parser) noteName(name string) string {
+	if _, err := strconv.Atoi(name); err != nil {
+		return name
+	}
+	note := noteByName(name, p.aliases, p.drums)
+	var aliases []string
+	for alias, n := range p.aliases {
+		if n == note {
+			aliases = append(aliases, alias)
+		}
+	}
+	if len(aliases) > 0 {
+		sort.Slice(aliases, func(i, j int) bool {
+			if len(aliases[i]) != len(aliases[j]) {
+				return len(aliases[i]) < len(aliases[j])
+			}
+			return aliases[i] < aliases[j]
+		})
+		return aliases[0]
+	}
+	if builtin, ok := noteNames[note]; ok && noteByName(builtin, p.aliases, p.drums) == note {
+		return builtin
+	}
+	return name
+}
+
+// formatDuration returns the canonical form of a duration suffix.
+func formatDuration(s string) string {
+	i := strings.IndexByte(s, '>')
+	if i == -1 || i == len(s)-1 {
+		return s
+	}
+	n, _ := strconv.Atoi(s[i+1:])
+	if n == 3 {
+		return s[:i+1]
+	}
+	return s[:i+1] + strconv.Itoa(n)
+}
@@ -0,0 +1,50 @@
+package beatnik
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	src := "\n\n  bpm:90   # Slow.\nalias:Bass=36\n\n\n" +
+		"36,42  42 38,42+  42\t# Verse.\n" +
+		"Bass,42. 36.   38,42@+3 (38.>3)\n" +
+		"  K  K@0  S..>03   .. \n\n" +
+		"[ 49~ ]rev\n"
+	want := "bpm:90 # Slow.\nalias:Bass=36\n\n" +
+		"Bass,HCT  HCT   S,HCT+  HCT # Verse.\n" +
+		"Bass,HCT. Bass. S,HCT@3 (S.>)\n" +
+		"K         K@0   S..>    ..\n\n" +
+		"[ C2~ ]rev\n"
+	got, err := Format(src)
+	if err != nil {
+		t.Fatalf("Format(%q) failed: %v", src, err)
+	}
+	if got != want {
+		t.Errorf("Format(%q)=\n%s\nwant\n%s", src, got, want)
+	}
+
+	// Formatting should not change the track.
+	t1, _ := ParseTrack(src)
+	t2, _ := ParseTrack(got)
+	if !reflect.DeepEqual(t1, t2) {
+		t.Errorf("Format(%q) changed the track: %v, want %v", src, t2, t1)
+	}
+	if again, _ := Format(got); again != got {
+		t.Errorf("Format(Format(%q))=\n%s\nwant\n%s", src, again, got)
+	}
+}
+
+func TestFormat_shadowedName(t *testing.T) {
+	src := "alias:K=38 36 K"
+	want := "alias:K=38 36 K\n"
+	if got, err := Format(src); err != nil || got != want {
+		t.Errorf("Format(%q)=%q,%v, want %q", src, got, err, want)
+	}
+}
+
+func TestFormat_bad(t *testing.T) {
+	if got, err := Format("K Q"); err == nil {
+		t.Errorf("Format(\"K Q\")=%q, want error", got)
+	}
+}
@@ -0,0 +1,75 @@
+package beatnik
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// fuzzSources are seeds of the source fuzz targets.
+var fuzzSources = append([]string{
+	"bpm:120 time:3/4 HC,K. HC. (S..) HC,S. | alias:x=T1 x~ . >3",
+	"bpm:90 section:a K S [ K S ]rev play:a*3 fill:1 HC,S- cresc:pp..ff,2",
+	"bpm:100 vel:bar*2+60 K. set:n=3 S?30 alt(K|S)@-3?50 S{a=1}.. remap:K=S K",
+	"bpm:80 cc:7=100 bend:0..8191,2 sysex:F0,7E,7F,09,01,F7 bpmramp:100..140,2 map:sd3 K",
+}, scanTests...)
+
+func FuzzParseTrack(f *testing.F) {
+	for _, src := range fuzzSources {
+		f.Add(src)
+	}
+	f.Fuzz(func(t *testing.T, src string) {
+		tr, err := (&Sandbox{}).ParseTrack(src)
+		if err != nil || errorOf(tr.Validate()) != nil {
+			return
+		}
+		b, err := tr.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary() failed for %q: %v", src, err)
+		}
+		if _, err := ReadMIDI(bytes.NewReader(b)); err != nil {
+			t.Fatalf("ReadMIDI() failed for %q: %v", src, err)
+		}
+	})
+}
+
+func FuzzParseTrackAll(f *testing.F) {
+	for _, src := range fuzzSources {
+		f.Add(src)
+	}
+	f.Fuzz(func(t *testing.T, src string) {
+		ParseTrackAll(src)
+		Format(src)
+	})
+}
+
+func FuzzMatchHit(f *testing.F) {
+	for _, s := range scanTests {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		want := hitToken.FindStringSubmatchIndex(s)
+		got, ok := matchHit(s)
+		if ok != (want != nil) || ok && !reflect.DeepEqual(got[:], want) {
+			t.Fatalf("matchHit(%q)=%v,%v, want %v", s, got, ok, want)
+		}
+	})
+}
+
+func FuzzReadMIDI(f *testing.F) {
+	for _, src := range fuzzSources[:4] {
+		tr, err := ParseTrack(src)
+		if err != nil {
+			f.Fatalf("ParseTrack(%q) failed: %v", src, err)
+		}
+		b, err := tr.MarshalBinary()
+		if err != nil {
+			f.Fatalf("MarshalBinary() failed: %v", err)
+		}
+		f.Add(b)
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		ReadMIDI(bytes.NewReader(b))
+		RecoverMIDI(bytes.NewReader(b))
+	})
+}
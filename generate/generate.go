@@ -0,0 +1,124 @@
+// Package generate creates random drum grooves in common styles, as starting
+// material for writing tracks.
+//
+// Each style has a table of probabilities for every drum on every step of
+// the bar, so the grooves sound like the style but no two are the same.
+package generate
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"github.com/fluhus/beatnik"
+)
+
+// A Style is a kind of groove.
+type Style int
+
+// Available styles.
+const (
+	Rock Style = iota // Straight eighths with a backbeat.
+	Funk              // Syncopated sixteenths with ghost notes.
+	Jazz              // Swung ride pattern with feathered kick.
+)
+
+// styleNames holds the names of the styles.
+var styleNames = []string{"rock", "funk", "jazz"}
+
+// String returns the style's name, like "funk".
+func (s Style) String() string {
+	if s < 0 || int(s) >= len(styleNames) {
+		return fmt.Sprintf("Style(%d)", int(s))
+	}
+	return styleNames[s]
+}
+
+// ParseStyle returns the style with the given name, like "funk".
+func ParseStyle(name string) (Style, error) {
+	for i, s := range styleNames {
+		if strings.EqualFold(name, s) {
+			return Style(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown style %q, available styles are: %s",
+		name, strings.Join(styleNames, ", "))
+}
+
+// A voice is a drum in a preset.
+type voice struct {
+	drum   string           // EZdrummer drum name.
+	probs  []float64        // Probability of striking on each step of a bar.
+	vel    beatnik.Velocity // Loudest velocity.
+	jitter int              // How much softer than vel a strike can be.
+}
+
+// A preset describes how to generate a style.
+type preset struct {
+	steps  int // Steps per bar.
+	bpm    uint
+	voices []voice
+}
+
+// presets holds the presets of the styles.
+var presets = map[Style]*preset{
+	Rock: {8, 110, []voice{
+		{"HC", []float64{1, 1, 1, 1, 1, 1, 1, 1}, beatnik.F, 12},
+		{"K", []float64{1, .1, .25, .35, .85, .4, .2, .15}, beatnik.F, 6},
+		{"S", []float64{0, 0, 1, 0, 0, 0, 1, .1}, beatnik.FF, 6},
+		{"C1", []float64{.15, 0, 0, 0, 0, 0, 0, 0}, beatnik.F, 6},
+	}},
+	Funk: {16, 96, []voice{
+		{"HC", []float64{1, .4, 1, .4, 1, .4, 1, .4, 1, .4, 1, .4, 1, .4, 1,
+			.4}, beatnik.F, 18},
+		{"HO1", []float64{0, 0, 0, 0, 0, 0, 0, .1, 0, 0, 0, 0, 0, 0, .25, 0},
+			beatnik.MF, 6},
+		{"K", []float64{1, 0, .3, .5, 0, 0, .4, .2, .2, .3, .6, .1, 0, .2, .3,
+			.1}, beatnik.F, 6},
+		{"S", []float64{0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0},
+			beatnik.FF, 6},
+		{"S", []float64{0, .2, 0, .35, 0, .3, .2, .4, 0, .35, 0, .3, 0, .3, .2,
+			.4}, beatnik.PPP, 12},
+	}},
+	Jazz: {12, 140, []voice{
+		{"R", []float64{1, 0, 0, 1, 0, .8, 1, 0, 0, 1, 0, .8}, beatnik.F, 12},
+		{"HP", []float64{0, 0, 0, 1, 0, 0, 0, 0, 0, 1, 0, 0}, beatnik.MF, 6},
+		{"K", []float64{.7, 0, 0, .7, 0, 0, .7, 0, 0, .7, 0, 0}, beatnik.PPP,
+			6},
+		{"S", []float64{0, .05, .15, .1, .1, .2, 0, .05, .15, .1, .1, .2},
+			beatnik.MP, 18},
+	}},
+}
+
+// GenerateGroove returns a random groove of the given style and number of
+// bars, in 4/4. The same seed always gives the same groove. Drums are
+// EZdrummer notes, like beatnik's default drum names.
+func GenerateGroove(style Style, bars int, seed int64) *beatnik.Track {
+	pre, ok := presets[style]
+	if !ok {
+		panic(fmt.Sprintf("generate: unknown style: %v", style))
+	}
+	rnd := rand.New(rand.NewSource(seed))
+	notes := beatnik.Kits["ezdrummer"].Notes
+	step := uint(384 / pre.steps)
+
+	t := &beatnik.Track{BPM: pre.bpm}
+	for i := 0; i < bars*pre.steps; i++ {
+		hit := map[byte]beatnik.Velocity{}
+		for _, v := range pre.voices {
+			// Always draw, so that each voice's strikes do not depend on
+			// the others.
+			strike := rnd.Float64() < v.probs[i%pre.steps]
+			vel := v.vel - beatnik.Velocity(rnd.Intn(v.jitter+1))
+			if strike && vel > hit[notes[v.drum]] {
+				hit[notes[v.drum]] = vel
+			}
+		}
+		if len(hit) == 0 && len(t.Hits) > 0 {
+			t.Hits[len(t.Hits)-1].T += step
+			continue
+		}
+		t.Hits = append(t.Hits, &beatnik.Hit{Notes: hit, T: step})
+	}
+	return t
+}
@@ -0,0 +1,43 @@
+package generate
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGenerateGroove(t *testing.T) {
+	for _, style := range []Style{Rock, Funk, Jazz} {
+		tr := GenerateGroove(style, 4, 1)
+		if errs := tr.Validate(); errs != nil {
+			t.Errorf("GenerateGroove(%v).Validate()=%v, want nil", style, errs)
+		}
+		var ticks uint
+		for _, h := range tr.Hits {
+			ticks += h.T
+		}
+		if ticks != 4*384 {
+			t.Errorf("GenerateGroove(%v) lasts %v ticks, want %v",
+				style, ticks, 4*384)
+		}
+		if !reflect.DeepEqual(tr, GenerateGroove(style, 4, 1)) {
+			t.Errorf("GenerateGroove(%v) is different with the same seed",
+				style)
+		}
+		if reflect.DeepEqual(tr, GenerateGroove(style, 4, 2)) {
+			t.Errorf("GenerateGroove(%v) is the same with different seeds",
+				style)
+		}
+	}
+}
+
+func TestParseStyle(t *testing.T) {
+	for _, style := range []Style{Rock, Funk, Jazz} {
+		got, err := ParseStyle(style.String())
+		if err != nil || got != style {
+			t.Errorf("ParseStyle(%q)=%v,%v, want %v", style, got, err, style)
+		}
+	}
+	if _, err := ParseStyle("polka"); err == nil {
+		t.Errorf("ParseStyle(polka) succeeded, want error")
+	}
+}
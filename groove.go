@@ -0,0 +1,107 @@
+package beatnik
+
+// Groove templates.
+
+// grooveStep is the number of ticks in a step of an extracted groove, a
+// sixteenth.
+const grooveStep = 24
+
+// A Groove is the feel of a track: how its notes deviate from a rigid grid of
+// steps, in timing and velocity, at each step of a bar. The zero value has no
+// feel, and applying it changes nothing.
+type Groove struct {
+	Step uint // Number of ticks in a step.
+
+	// Average timing offset of the notes of each step of a bar, in ticks,
+	// negative is earlier.
+	Offsets []int
+
+	// Average velocity of the notes of each step of a bar, relative to the
+	// average velocity of the track, so 1 is as loud as the average.
+	Velocities []float64
+}
+
+// ExtractGroove returns the groove of the track, on a grid of sixteenths.
+// Each note, with its timing offset, belongs to the step that is nearest to
+// it. Steps that no note belongs to have no offset and a relative velocity
+// of 1.
+func ExtractGroove(t *Track) Groove {
+	steps := int(t.timeSig().barTicks() / grooveStep)
+	if steps == 0 {
+		steps = 1
+	}
+	g := Groove{grooveStep, make([]int, steps), make([]float64, steps)}
+	offsets := make([]int, steps)
+	vels := make([]int, steps)
+	counts := make([]int, steps)
+	total, count := 0, 0
+	t.eachNote(grooveStep, func(step, off int, n byte, h *Hit) {
+		i := step % steps
+		offsets[i] += off
+		vels[i] += int(h.Notes[n])
+		counts[i]++
+		total += int(h.Notes[n])
+		count++
+	})
+	for i := range g.Velocities {
+		g.Velocities[i] = 1
+		if counts[i] == 0 {
+			continue
+		}
+		g.Offsets[i] = roundDiv(offsets[i], counts[i])
+		g.Velocities[i] = float64(vels[i]) / float64(counts[i]) /
+			(float64(total) / float64(count))
+	}
+	return g
+}
+
+// ApplyGroove imposes the groove on the track. Each note moves to its nearest
+// step of the groove's grid, then is offset by the step's offset, and its
+// velocity is scaled by the step's relative velocity. The hits themselves
+// stay in place, so the track's timing is changed only by notes' offsets.
+func ApplyGroove(t *Track, g Groove) {
+	if g.Step == 0 || len(g.Offsets) == 0 || len(g.Offsets) != len(g.Velocities) {
+		return
+	}
+	steps := len(g.Offsets)
+	t.eachNote(g.Step, func(step, off int, n byte, h *Hit) {
+		i := step % steps
+		if h.Offsets == nil {
+			h.Offsets = map[byte]int{}
+		}
+		h.Offsets[n] += g.Offsets[i] - off
+		if h.Offsets[n] == 0 {
+			delete(h.Offsets, n)
+		}
+		if len(h.Offsets) == 0 {
+			h.Offsets = nil
+		}
+		h.Notes[n] = clampVelocity(float64(h.Notes[n]) * g.Velocities[i])
+	})
+}
+
+// eachNote calls f for each note of the track with the index of its nearest
+// step on a grid of the given step length, and its offset from that step.
+func (t *Track) eachNote(stepTicks uint, f func(step, off int, n byte, h *Hit)) {
+	st := int(stepTicks)
+	tick := 0
+	for _, h := range t.Hits {
+		for _, n := range sortedNotes(h) {
+			at := tick + h.Offsets[n]
+			step := roundDiv(at, st)
+			if step < 0 {
+				step = 0
+			}
+			f(step, at-step*st, n, h)
+		}
+		tick += int(h.T)
+	}
+}
+
+// roundDiv returns a/b rounded to the nearest integer, for a positive b.
+func roundDiv(a, b int) int {
+	if a < 0 {
+		return -((-a + b/2) / b)
+	}
+	return (a + b/2) / b
+}
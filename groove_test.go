@@ -0,0 +1,53 @@
+package beatnik
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractGroove(t *testing.T) {
+	g := ExtractGroove(mustParse(t, "K@-2 S+@4 K@-2,HC@-2 S+@4"))
+	if g.Step != 24 || len(g.Offsets) != 16 || len(g.Velocities) != 16 {
+		t.Fatalf("ExtractGroove()=%v, want 16 steps of 24 ticks", g)
+	}
+	wantOffsets := make([]int, 16)
+	wantOffsets[0], wantOffsets[4], wantOffsets[8], wantOffsets[12] = -2, 4, -2, 4
+	if !reflect.DeepEqual(g.Offsets, wantOffsets) {
+		t.Errorf("Offsets=%v, want %v", g.Offsets, wantOffsets)
+	}
+	avg := (3*115.0 + 2*121.0) / 5
+	for i, want := range map[int]float64{0: 115 / avg, 1: 1, 4: 121 / avg} {
+		if got := g.Velocities[i]; got < want-1e-9 || got > want+1e-9 {
+			t.Errorf("Velocities[%v]=%v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestApplyGroove(t *testing.T) {
+	g := ExtractGroove(mustParse(t, "K@-2 S+@4 K@-2 S+@4"))
+	tr := mustParse(t, "K S@1 K,HC S.. HC..")
+	ApplyGroove(tr, g)
+	k, s, hc := ezDrummer["K"], ezDrummer["S"], ezDrummer["HC"]
+	want := mustParse(t, "K@-2 S@4 K@-2,HC@-2 S@4.. HC..")
+	for _, h := range want.Hits {
+		for n := range h.Notes {
+			switch n {
+			case k:
+				h.Notes[n] = 112
+			case s:
+				h.Notes[n] = 118
+			}
+		}
+	}
+	want.Hits[2].Notes[hc] = 112
+	if !reflect.DeepEqual(tr, want) {
+		t.Errorf("ApplyGroove()=%v, want %v", tr.Hits, want.Hits)
+	}
+
+	before := mustParse(t, "K S")
+	after := mustParse(t, "K S")
+	ApplyGroove(after, Groove{})
+	if !reflect.DeepEqual(after, before) {
+		t.Errorf("ApplyGroove(zero groove) changed the track")
+	}
+}
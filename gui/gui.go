@@ -70,6 +70,21 @@ func main() {
 		w.Write([]byte(file))
 	})
 
+	// Explain handler.
+	http.HandleFunc("/explain", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		src := r.FormValue("src")
+
+		w.Header().Set("Content-Type", mimeText)
+		exp, err := beatnik.Explain(src)
+		for _, e := range exp {
+			fmt.Fprintln(w, e)
+		}
+		if err != nil {
+			fmt.Fprintln(w, "Failed to parse source:", err)
+		}
+	})
+
 	// MIDI handler.
 	http.HandleFunc("/midi/", func(w http.ResponseWriter, r *http.Request) {
 		file := r.URL.Path[len("/midi/"):]
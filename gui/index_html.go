@@ -54,6 +54,17 @@ const indexPageSrc = `<!DOCTYPE html>
 	  });
 	}
 
+	function explain() {
+	  let src = $("#src").val();
+	  $.ajax({
+	    url: "/explain",
+		data: {src: src},
+		complete: function(xhr) {
+          $("#explanation").text(xhr.responseText).show();
+        },
+	  });
+	}
+
 	function download() {
 	  let src = $("#src").val();
 	  $.ajax({
@@ -96,6 +107,11 @@ K,C2~~</textarea>
 	    data-toggle="tooltip" title="Download" onclick="download()">
 	  <span class="glyphicon glyphicon-download-alt" aria-hidden="true"></span>
 	</button>
+    <button class="btn btn-default" type="button"
+	    data-toggle="tooltip" title="Explain my beat" onclick="explain()">
+	  <span class="glyphicon glyphicon-question-sign" aria-hidden="true"></span>
+	</button>
+	<pre id="explanation" style="display: none; margin-top: 10px"></pre>
 
   <hr>
   <p><a href="https://github.com/fluhus/beatnik/blob/master/TUTORIAL.md"
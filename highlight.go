@@ -0,0 +1,130 @@
+package beatnik
+
+// Classification of source text for syntax highlighting.
+
+import (
+	"strings"
+)
+
+// A SpanKind is the syntactic class of a span of source text.
+type SpanKind int
+
+// Span kinds.
+const (
+	SpanInvalid     SpanKind = iota // A token that is not recognized.
+	SpanNote                        // A drum name, number or alias.
+	SpanVelocity                    // Velocity marks, as in "++".
+	SpanOffset                      // A timing offset, as in "@-3".
+	SpanAnnotations                 // Annotations with their braces.
+	SpanDuration                    // Duration marks, as in ".>".
+	SpanDirective                   // A directive's name and colon.
+	SpanValue                       // A directive's value.
+	SpanComment                     // A comment.
+	SpanGroup                       // A group's bracket, with its operator.
+	SpanBarLine                     // A bar line.
+	SpanPunctuation                 // Commas between notes and grace parentheses.
+	SpanChance                      // A note's chance, as in "?75".
+)
+
+// spanKindNames are the names of span kinds, by kind.
+var spanKindNames = []string{"invalid", "note", "velocity", "offset",
+	"annotations", "duration", "directive", "value", "comment", "group",
+	"bar line", "punctuation", "chance"}
+
+// String returns the kind's name, like "note" or "bar line".
+func (k SpanKind) String() string {
+	if k < 0 || int(k) >= len(spanKindNames) {
+		return "unknown"
+	}
+	return spanKindNames[k]
+}
+
+// A Span is a classified range of source text.
+type Span struct {
+	Kind  SpanKind
+	Start int // Byte offset of the first byte.
+	End   int // Byte offset after the last byte.
+}
+
+// Classify returns the spans of the source's tokens and their parts, in
+// order, for coloring the source consistently with the parser. Whitespace is
+// not covered by any span. Only the lexical rules are checked, so a span's
+// kind does not mean that its text is valid, like a drum name that does not
+// exist.
+func Classify(src string) []Span {
+	var result []Span
+	sc := newScanner(src, 1)
+	for tok, ok := sc.next(); ok; tok, ok = sc.next() {
+		result = append(result, classifyToken(newToken(tok), sc.start)...)
+	}
+	return result
+}
+
+// classifyToken returns the spans of a token that starts at the given byte
+// offset.
+func classifyToken(tok Token, start int) []Span {
+	s := tok.Text
+	span := func(kind SpanKind, from, to int) Span {
+		return Span{kind, start + from, start + to}
+	}
+	switch tok.Kind {
+	case TokenHit:
+		var result []Span
+		from, to := 0, len(s)
+		if parenthesized(s) {
+			result = append(result, span(SpanPunctuation, 0, 1))
+			from, to = 1, len(s)-1
+		}
+		m, _ := matchHit(s[from:to])
+		notes := m[2]
+		for _, part := range strings.Split(s[from+m[2]:from+m[3]], ",") {
+			if notes > m[2] {
+				result = append(result, span(SpanPunctuation, from+notes-1,
+					from+notes))
+			}
+			nm, _ := matchNote(part)
+			at := from + notes
+			result = append(result, span(SpanNote, at+nm[2], at+nm[3]))
+			if nm[5] > nm[4] {
+				result = append(result, span(SpanVelocity, at+nm[4], at+nm[5]))
+			}
+			end := len(part) // End of the offset.
+			if nm[8] != -1 {
+				end = nm[8] - 1
+			}
+			if nm[5] < end {
+				result = append(result, span(SpanOffset, at+nm[5], at+end))
+			}
+			if end < len(part) {
+				result = append(result, span(SpanChance, at+end, at+len(part)))
+			}
+			notes += len(part) + 1
+		}
+		if m[4] != -1 {
+			result = append(result, span(SpanAnnotations, from+m[4], from+m[5]))
+		}
+		if m[7] > m[6] {
+			result = append(result, span(SpanDuration, from+m[6], from+m[7]))
+		}
+		if to < len(s) {
+			result = append(result, span(SpanPunctuation, to, len(s)))
+		}
+		return result
+	case TokenWait:
+		return []Span{span(SpanDuration, 0, len(s))}
+	case TokenDirective:
+		i := strings.IndexByte(s, ':') + 1
+		result := []Span{span(SpanDirective, 0, i)}
+		if i < len(s) {
+			result = append(result, span(SpanValue, i, len(s)))
+		}
+		return result
+	case TokenComment:
+		return []Span{span(SpanComment, 0, len(s))}
+	case TokenGroupOpen, TokenGroupClose:
+		return []Span{span(SpanGroup, 0, len(s))}
+	case TokenBarLine:
+		return []Span{span(SpanBarLine, 0, len(s))}
+	}
+	return []Span{span(SpanInvalid, 0, len(s))}
+}
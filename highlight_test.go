@@ -0,0 +1,34 @@
+package beatnik
+
+import (
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	src := "bpm:90 # Fast.\n\tБочка+,S@-3?50{x=1}.> (HC..) .. | [ K ]rev ?? vel:"
+	want := []struct {
+		kind SpanKind
+		text string
+	}{
+		{SpanDirective, "bpm:"}, {SpanValue, "90"}, {SpanComment, "# Fast."},
+		{SpanNote, "Бочка"}, {SpanVelocity, "+"}, {SpanPunctuation, ","},
+		{SpanNote, "S"}, {SpanOffset, "@-3"},
+		{SpanChance, "?50"}, {SpanAnnotations, "{x=1}"},
+		{SpanDuration, ".>"}, {SpanPunctuation, "("}, {SpanNote, "HC"},
+		{SpanDuration, ".."}, {SpanPunctuation, ")"}, {SpanDuration, ".."},
+		{SpanBarLine, "|"}, {SpanGroup, "["}, {SpanNote, "K"},
+		{SpanGroup, "]rev"}, {SpanInvalid, "??"}, {SpanDirective, "vel:"},
+	}
+	got := Classify(src)
+	if len(got) != len(want) {
+		t.Fatalf("Classify(%q) returned %v spans, want %v: %v", src, len(got),
+			len(want), got)
+	}
+	for i := range want {
+		text := src[got[i].Start:got[i].End]
+		if got[i].Kind != want[i].kind || text != want[i].text {
+			t.Errorf("Classify(%q)[%v]=%v %q, want %v %q", src, i, got[i].Kind,
+				text, want[i].kind, want[i].text)
+		}
+	}
+}
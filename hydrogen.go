@@ -0,0 +1,128 @@
+package beatnik
+
+// Importer of Hydrogen drum machine files.
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// hydrogenTicks is the number of Hydrogen ticks in a quarter note.
+const hydrogenTicks = 48
+
+// hydrogenVelocity is the velocity of Hydrogen notes that do not specify one.
+const hydrogenVelocity = 0.8
+
+// An h2File is the XML of a Hydrogen song (.h2song) or pattern (.h2pattern).
+type h2File struct {
+	BPM         float64        `xml:"bpm"`
+	Instruments []h2Instrument `xml:"instrumentList>instrument"`
+	Patterns    []*h2Pattern   `xml:"patternList>pattern"`
+	Sequence    []h2Group      `xml:"patternSequence>group"`
+	Pattern     *h2Pattern     `xml:"pattern"` // In pattern files.
+}
+
+type h2Instrument struct {
+	ID   int  `xml:"id"`
+	Note *int `xml:"midiOutNote"`
+}
+
+type h2Pattern struct {
+	Name  string   `xml:"name"`
+	Size  uint     `xml:"size"` // In Hydrogen ticks.
+	Notes []h2Note `xml:"noteList>note"`
+}
+
+type h2Note struct {
+	Position   uint     `xml:"position"` // In Hydrogen ticks.
+	Velocity   *float64 `xml:"velocity"` // Between 0 and 1.
+	Instrument int      `xml:"instrument"`
+}
+
+// A h2Group is a set of patterns that play together in a song.
+type h2Group struct {
+	Patterns []string `xml:"patternID"`
+}
+
+// ReadHydrogen reads a Hydrogen song (.h2song) or pattern (.h2pattern) file.
+// Returns each of its patterns as a track, keyed by pattern name, and the
+// whole song as a single track. The song plays the pattern sequence, with a
+// marker where each part starts; patterns that play together are merged. For
+// pattern files, the song is the single pattern.
+//
+// Instruments play their midi output note, or 36 plus their ID (Hydrogen's
+// default) if they have none.
+func ReadHydrogen(r io.Reader) (song *Track, patterns map[string]*Track,
+	err error) {
+	f := &h2File{}
+	if err := xml.NewDecoder(r).Decode(f); err != nil {
+		return nil, nil, newError(CodeBadHydrogen, err)
+	}
+	bpm := uint(f.BPM + 0.5)
+	if bpm == 0 {
+		bpm = 120
+	}
+	notes := map[int]byte{}
+	for _, inst := range f.Instruments {
+		if inst.Note != nil {
+			notes[inst.ID] = byte(*inst.Note)
+		}
+	}
+
+	if f.Pattern != nil {
+		f.Patterns = []*h2Pattern{f.Pattern}
+		f.Sequence = []h2Group{{[]string{f.Pattern.Name}}}
+	}
+	patterns = map[string]*Track{}
+	for _, p := range f.Patterns {
+		patterns[p.Name] = p.track(bpm, notes)
+	}
+
+	song = &Track{BPM: bpm}
+	for _, g := range f.Sequence {
+		part := &Track{BPM: bpm}
+		for _, name := range g.Patterns {
+			p, ok := patterns[name]
+			if !ok {
+				return nil, nil, newError(CodeUnknownPattern, name)
+			}
+			if part, err = Merge(part, p); err != nil {
+				return nil, nil, err
+			}
+		}
+		if len(g.Patterns) > 0 {
+			song.Meta = append(song.Meta, &Meta{song.ticks(), MetaMarker,
+				[]byte(strings.Join(g.Patterns, "+"))})
+		}
+		song.Append(part)
+	}
+	return song, patterns, nil
+}
+
+// track returns the pattern as a track with the given tempo, playing
+// instruments with the given notes.
+func (p *h2Pattern) track(bpm uint, notes map[int]byte) *Track {
+	var strikes []drumStrike
+	for _, n := range p.Notes {
+		note, ok := notes[n.Instrument]
+		if !ok {
+			note = byte(36 + n.Instrument)
+		}
+		vel := hydrogenVelocity
+		if n.Velocity != nil {
+			vel = *n.Velocity
+		}
+		if vel <= 0 {
+			continue
+		}
+		strikes = append(strikes, drumStrike{
+			n.Position * 96 / hydrogenTicks, note, clampVelocity(vel * 127)})
+	}
+	size := p.Size * 96 / hydrogenTicks
+	t := &Track{BPM: bpm, Hits: strikeHits(strikes, size)}
+	if len(t.Hits) == 0 && size > 0 {
+		t.Hits = []*Hit{{T: size}}
+	}
+	return t
+}
@@ -0,0 +1,90 @@
+package beatnik
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testH2Song = `<?xml version="1.0" encoding="UTF-8"?>
+<song>
+ <bpm>100</bpm>
+ <instrumentList>
+  <instrument><id>0</id><name>Kick</name><midiOutNote>36</midiOutNote></instrument>
+  <instrument><id>1</id><name>Snare</name><midiOutNote>38</midiOutNote></instrument>
+ </instrumentList>
+ <patternList>
+  <pattern>
+   <name>beat</name>
+   <size>192</size>
+   <noteList>
+    <note><position>0</position><velocity>1</velocity><instrument>0</instrument></note>
+    <note><position>96</position><instrument>1</instrument></note>
+   </noteList>
+  </pattern>
+  <pattern>
+   <name>hats</name>
+   <size>96</size>
+   <noteList>
+    <note><position>48</position><velocity>0.5</velocity><instrument>6</instrument></note>
+   </noteList>
+  </pattern>
+ </patternList>
+ <patternSequence>
+  <group><patternID>beat</patternID></group>
+  <group><patternID>beat</patternID><patternID>hats</patternID></group>
+ </patternSequence>
+</song>`
+
+func TestReadHydrogen(t *testing.T) {
+	song, patterns, err := ReadHydrogen(strings.NewReader(testH2Song))
+	if err != nil {
+		t.Fatalf("ReadHydrogen() failed: %v", err)
+	}
+	want := map[string]*Track{
+		"beat": {BPM: 100, Hits: []*Hit{
+			{Notes: map[byte]Velocity{36: 127}, T: 192},
+			{Notes: map[byte]Velocity{38: 102}, T: 192},
+		}},
+		"hats": {BPM: 100, Hits: []*Hit{
+			{T: 96},
+			{Notes: map[byte]Velocity{42: 64}, T: 96},
+		}},
+	}
+	if !reflect.DeepEqual(patterns, want) {
+		t.Errorf("ReadHydrogen() patterns=%v, want %v", patterns, want)
+	}
+	wantSong := &Track{BPM: 100,
+		Hits: []*Hit{
+			{Notes: map[byte]Velocity{36: 127}, T: 192},
+			{Notes: map[byte]Velocity{38: 102}, T: 192},
+			{Notes: map[byte]Velocity{36: 127}, T: 96},
+			{Notes: map[byte]Velocity{42: 64}, T: 96},
+			{Notes: map[byte]Velocity{38: 102}, T: 192},
+		},
+		Meta: []*Meta{
+			{0, MetaMarker, []byte("beat")},
+			{384, MetaMarker, []byte("beat+hats")},
+		},
+	}
+	if !reflect.DeepEqual(song, wantSong) {
+		t.Errorf("ReadHydrogen() song=%v, want %v", song, wantSong)
+	}
+}
+
+func TestReadHydrogen_bad(t *testing.T) {
+	tests := []struct {
+		src  string
+		code Code
+	}{
+		{"<song><bpm>1", CodeBadHydrogen},
+		{"<song><patternSequence><group><patternID>x</patternID></group>" +
+			"</patternSequence></song>", CodeUnknownPattern},
+	}
+	for _, test := range tests {
+		_, _, err := ReadHydrogen(strings.NewReader(test.src))
+		if e, ok := err.(*Error); !ok || e.Code != test.code {
+			t.Errorf("ReadHydrogen(%q) error=%v, want %v", test.src, err, test.code)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package beatnik
+
+// Multi-file scores.
+
+import (
+	"io/ioutil"
+	"strings"
+)
+
+func init() {
+	// Registered here since including refers back to the directives.
+	directives["include"] = includeDirective
+}
+
+// An Opener returns the contents of a source file by path. It lets programs
+// and tests decide where included files come from.
+type Opener func(path string) ([]byte, error)
+
+// ParseFile parses the source file at the given path, like ParseTrack, and
+// allows it to include other files with "include:path". Included paths are
+// relative to the including file. open reads the files, nil for the file
+// system. Errors have the path of the file they were found in.
+//
+// Included files are read ahead, while the files before them are parsed, so
+// open may be called from several goroutines at once, and for files that are
+// not parsed in the end.
+func ParseFile(path string, open Opener) (*Track, error) {
+	if open == nil {
+		open = ioutil.ReadFile
+	}
+	p := newParser()
+	p.open = open
+	p.fetch = newFetcher(open)
+	return parseFile(path, p)
+}
+
+// parseFile parses the file at the given path with a parser that has an
+// opener.
+func parseFile(path string, p *parser) (*Track, error) {
+	src, err := p.open(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.parseFile(path, src); err != nil {
+		return nil, err
+	}
+	if err := p.finish(); err != nil {
+		if e, ok := err.(*Error); ok && e.File == "" {
+			e.File = path
+		}
+		return nil, err
+	}
+	return p.t, nil
+}
+
+// parseFile parses the source of the given file, as if it was written in
+// place of the current token.
+func (p *parser) parseFile(path string, src []byte) error {
+	return p.parseFileTokens(path, tokenize(string(src)))
+}
+
+// parseFileTokens parses the tokens of the given file, as if they were
+// written in place of the current token.
+func (p *parser) parseFileTokens(path string, toks []token) error {
+	p.files = append(p.files, path)
+	defer func() { p.files = p.files[:len(p.files)-1] }()
+
+	if p.fetch != nil {
+		p.fetch.fetchIncludes(path, toks)
+	}
+	if errs := p.parseTokens(toks, false); len(errs) > 0 {
+		if e, ok := errs[0].(*Error); ok && e.File == "" {
+			e.File = path
+		}
+		return errs[0]
+	}
+	return nil
+}
+
+// includeDirective parses another file in place, as in "include:fills.bk".
+// Only available when parsing files. Paths with a prefix, as in
+// "include:pack:rock/groove1", are given to the opener as is.
+func includeDirective(p *parser, s string, at DirectiveContext) error {
+	if p.open == nil {
+		return newError(CodeNoInclude)
+	}
+	if s == "" {
+		return newError(CodeIncludeFailed, s, "empty path")
+	}
+	s = includePath(p.files[len(p.files)-1], s)
+	for i, f := range p.files {
+		if f == s {
+			return newError(CodeIncludeCycle, s,
+				strings.Join(append(p.files[i:], s), " -> "))
+		}
+	}
+	if max := p.limits.MaxIncludeDepth; max > 0 && len(p.files) > max {
+		return newError(CodeIncludeDepth, s, max)
+	}
+	if p.fetch != nil {
+		toks, err := p.fetch.get(s)
+		if err != nil {
+			return newError(CodeIncludeFailed, s, err.Error())
+		}
+		return p.parseFileTokens(s, toks)
+	}
+	src, err := p.open(s)
+	if err != nil {
+		return newError(CodeIncludeFailed, s, err.Error())
+	}
+	return p.parseFile(s, src)
+}
+
+// hasPathPrefix returns true if the path starts with a prefix like "pack:",
+// which tells the opener where to look for it. Single letter prefixes are
+// taken for drive letters.
+func hasPathPrefix(path string) bool {
+	i := strings.IndexByte(path, ':')
+	return i > 1 && !strings.ContainsAny(path[:i], "/\\")
+}
@@ -0,0 +1,69 @@
+package beatnik
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// mapOpener returns an opener that reads files from a map.
+func mapOpener(files map[string]string) Opener {
+	return func(path string) ([]byte, error) {
+		src, ok := files[path]
+		if !ok {
+			return nil, fmt.Errorf("no such file: %v", path)
+		}
+		return []byte(src), nil
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	files := map[string]string{
+		"song/main.bk":      "bpm:90 alias:x=K include:lib/fills.bk x",
+		"song/lib/fills.bk": "S include:more.bk",
+		"song/lib/more.bk":  "T1. T2.",
+	}
+	got, err := ParseFile("song/main.bk", mapOpener(files))
+	if err != nil {
+		t.Fatalf("ParseFile() failed: %v", err)
+	}
+	want := []*Hit{
+		{Notes: map[byte]Velocity{38: F}, T: 96},
+		{Notes: map[byte]Velocity{48: F}, T: 48},
+		{Notes: map[byte]Velocity{47: F}, T: 48},
+		{Notes: map[byte]Velocity{36: F}, T: 96},
+	}
+	if !reflect.DeepEqual(got.Hits, want) {
+		t.Errorf("ParseFile().Hits=%v, want %v", got.Hits, want)
+	}
+	if got.BPM != 90 {
+		t.Errorf("ParseFile().BPM=%v, want 90", got.BPM)
+	}
+}
+
+func TestParseFile_bad(t *testing.T) {
+	files := map[string]string{
+		"main.bk":  "K\ninclude:a.bk",
+		"a.bk":     "S include:b.bk",
+		"b.bk":     "\n  include:main.bk",
+		"miss.bk":  "include:nope.bk",
+		"error.bk": "K\n S Q",
+	}
+	tests := []struct {
+		file string
+		want string
+	}{
+		{"main.bk", `b.bk:2:3: "main.bk" includes itself: main.bk -> a.bk -> b.bk -> main.bk`},
+		{"miss.bk", `miss.bk:1:1: cannot include "nope.bk": no such file: nope.bk`},
+		{"error.bk", `error.bk:2:4: bad drum number: "Q"`},
+	}
+	for _, test := range tests {
+		_, err := ParseFile(test.file, mapOpener(files))
+		if err == nil || err.Error() != test.want {
+			t.Errorf("ParseFile(%q) error=%v, want %v", test.file, err, test.want)
+		}
+	}
+	if _, err := ParseTrack("include:a.bk"); err == nil {
+		t.Errorf("ParseTrack(include) succeeded, want failure")
+	}
+}
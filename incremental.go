@@ -0,0 +1,176 @@
+package beatnik
+
+// Incremental parsing of edited files.
+
+import (
+	"crypto/sha256"
+	"io/ioutil"
+)
+
+// A Compiler parses a file again and again as it is being edited, like in
+// watch mode. Since the meaning of a section depends on everything before
+// it, the file is split into segments that start at its section directives,
+// and parsing resumes from the parser's state after the last segment that,
+// along with all the segments before it and the files they include, did not
+// change. Editing a song's ending therefore does not reparse its beginning.
+type Compiler struct {
+	Open Opener // Reads files, nil for the file system.
+
+	// Number of segments that the last call to Compile took from the cache.
+	Reused int
+
+	cache []*compiledSegment
+}
+
+// A compiledSegment is the result of parsing a segment of a file.
+type compiledSegment struct {
+	key   [sha256.Size]byte // Hash of the tokens up to the segment's end.
+	files []includedFile    // Files included by the segment.
+	state *parser           // Parser state after the segment.
+}
+
+// An includedFile is a file that was included, with the hash of its contents.
+type includedFile struct {
+	path string
+	hash [sha256.Size]byte
+}
+
+// Compile parses the file at the given path like ParseFile, reusing the
+// results of earlier calls for the unchanged beginning of the file.
+func (c *Compiler) Compile(path string) (*Track, error) {
+	open := c.Open
+	if open == nil {
+		open = ioutil.ReadFile
+	}
+	src, err := open(path)
+	if err != nil {
+		return nil, err
+	}
+	segs := splitSegments(tokenize(string(src)))
+
+	// Find the longest unchanged prefix.
+	var key [sha256.Size]byte
+	keys := make([][sha256.Size]byte, len(segs))
+	for i, seg := range segs {
+		h := sha256.New()
+		h.Write(key[:])
+		for _, tok := range seg {
+			h.Write([]byte(tok.s))
+			h.Write([]byte{0})
+		}
+		copy(key[:], h.Sum(nil))
+		keys[i] = key
+	}
+	c.Reused = 0
+	for c.Reused < len(segs) && c.Reused < len(c.cache) {
+		cs := c.cache[c.Reused]
+		if cs.key != keys[c.Reused] || !unchangedFiles(cs.files, open) {
+			break
+		}
+		c.Reused++
+	}
+	c.cache = c.cache[:c.Reused]
+
+	p := newParser()
+	if c.Reused > 0 {
+		p = c.cache[c.Reused-1].state.clone()
+	}
+	p.files = []string{path}
+	for i := c.Reused; i < len(segs); i++ {
+		var files []includedFile
+		p.open = func(path string) ([]byte, error) {
+			b, err := open(path)
+			if err == nil {
+				files = append(files, includedFile{path, sha256.Sum256(b)})
+			}
+			return b, err
+		}
+		for _, tok := range segs[i] {
+			if err := p.parseToken(tok); err != nil {
+				err = atToken(err, tok)
+				if e, ok := err.(*Error); ok && e.File == "" {
+					e.File = path
+				}
+				return nil, err
+			}
+		}
+		p.open = open
+		c.cache = append(c.cache, &compiledSegment{keys[i], files, p.clone()})
+	}
+
+	p.files = nil
+	if err := p.finish(); err != nil {
+		if e, ok := err.(*Error); ok && e.File == "" {
+			e.File = path
+		}
+		return nil, err
+	}
+	return p.t, nil
+}
+
+// splitSegments splits tokens before each section directive.
+func splitSegments(toks []token) [][]token {
+	var result [][]token
+	start := 0
+	for i, tok := range toks {
+		name, _, ok := splitDirective(tok.s)
+		if i > start && ok && name == "section" {
+			result = append(result, toks[start:i])
+			start = i
+		}
+	}
+	return append(result, toks[start:])
+}
+
+// unchangedFiles returns true if the given files still have the same
+// contents.
+func unchangedFiles(files []includedFile, open Opener) bool {
+	for _, f := range files {
+		b, err := open(f.path)
+		if err != nil || sha256.Sum256(b) != f.hash {
+			return false
+		}
+	}
+	return true
+}
+
+// clone returns a deep copy of the parser, that can go on parsing without
+// affecting p.
+func (p *parser) clone() *parser {
+	q := *p
+	q.t = Concat(p.t)
+	q.aliases = map[string]byte{}
+	for k, v := range p.aliases {
+		q.aliases[k] = v
+	}
+	q.remap = map[byte]byte{}
+	for k, v := range p.remap {
+		q.remap[k] = v
+	}
+	q.vars = map[string]int{}
+	for k, v := range p.vars {
+		q.vars[k] = v
+	}
+	q.groups = append([]group(nil), p.groups...)
+	q.sections = map[string]*section{}
+	for k, v := range p.sections {
+		sec := *v
+		q.sections[k] = &sec
+		if v == p.section {
+			q.section = &sec
+		}
+	}
+	q.fills = append([]fillRange(nil), p.fills...)
+	q.alts = map[*Hit]alts{}
+	for i, h := range p.t.Hits {
+		if a, ok := p.alts[h]; ok {
+			q.alts[q.t.Hits[i]] = a
+		}
+	}
+	if p.countIn != nil {
+		q.countIn = q.t.Hits[0]
+	}
+	q.hits = &hitSlab{buf: p.hits.buf}
+	q.files = append([]string(nil), p.files...)
+	return &q
+}
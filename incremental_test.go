@@ -0,0 +1,48 @@
+package beatnik
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompiler(t *testing.T) {
+	files := map[string]string{
+		"fill.bk": "T1. T2.",
+		"song.bk": "bpm:100 alias:x=K set:v=100 section:a vel:=v+bar x S " +
+			"section:b HC. include:fill.bk [ HC. K ]rev section:c play:a*2,b",
+	}
+	c := &Compiler{Open: mapOpener(files)}
+	check := func(reused int) {
+		t.Helper()
+		got, err := c.Compile("song.bk")
+		if err != nil {
+			t.Fatalf("Compile() failed: %v", err)
+		}
+		want, err := ParseFile("song.bk", mapOpener(files))
+		if err != nil {
+			t.Fatalf("ParseFile() failed: %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Compile()=%v, want %v", got, want)
+		}
+		if c.Reused != reused {
+			t.Errorf("Compile() reused %v segments, want %v", c.Reused, reused)
+		}
+	}
+
+	check(0)
+	check(4)
+	files["song.bk"] += " S"
+	check(3)
+	files["fill.bk"] = "T3 T4"
+	check(2)
+	files["song.bk"] = "bpm:90" + files["song.bk"][7:]
+	check(0)
+
+	files["song.bk"] += " Q"
+	if _, err := c.Compile("song.bk"); err == nil {
+		t.Errorf("Compile() with a bad token succeeded, want failure")
+	}
+	files["song.bk"] = files["song.bk"][:len(files["song.bk"])-2]
+	check(3)
+}
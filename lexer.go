@@ -0,0 +1,114 @@
+package beatnik
+
+// Lexical analysis of text format.
+
+import (
+	"bufio"
+	"io"
+)
+
+// A TokenKind is the lexical class of a token.
+type TokenKind int
+
+// Token kinds.
+const (
+	TokenInvalid    TokenKind = iota // Text that is not a token of the language.
+	TokenHit                         // Drums with a duration, as in "K,HC.".
+	TokenWait                        // A duration that extends the previous hit.
+	TokenDirective                   // A directive, as in "bpm:120".
+	TokenBarLine                     // A "|" bar line.
+	TokenComment                     // A comment, from "#" to the end of the line.
+	TokenGroupOpen                   // A "[" that opens a group.
+	TokenGroupClose                  // A "]" that closes a group, with its operator.
+)
+
+// tokenKindNames are the names of token kinds, by kind.
+var tokenKindNames = []string{"invalid", "hit", "wait", "directive", "bar line",
+	"comment", "group open", "group close"}
+
+// String returns the kind's name, like "hit" or "bar line".
+func (k TokenKind) String() string {
+	if k < 0 || int(k) >= len(tokenKindNames) {
+		return "unknown"
+	}
+	return tokenKindNames[k]
+}
+
+// A Token is a single lexical element of the source text.
+type Token struct {
+	Kind TokenKind
+	Text string // Token text. Comments include their "#".
+	Line int    // 1-based line number.
+	Col  int    // 1-based column, in runes (not bytes).
+}
+
+// A Lexer splits source text into tokens, one line at a time. It follows the
+// same rules as the parser, so it can be used by syntax highlighters and other
+// tools that work on the source.
+type Lexer struct {
+	r    *bufio.Reader
+	line int     // Number of lines read.
+	sc   scanner // Scanner of the current line.
+	err  error   // Read error, returned after the tokens before it.
+}
+
+// NewLexer returns a lexer that reads source text from r.
+func NewLexer(r io.Reader) *Lexer {
+	return &Lexer{r: bufio.NewReader(r)}
+}
+
+// Next returns the next token. Returns io.EOF at the end of the source. If the
+// text of a token is not recognized, returns it as a TokenInvalid token along
+// with an error, and the following tokens can still be read.
+func (l *Lexer) Next() (Token, error) {
+	for {
+		if tok, ok := l.sc.next(); ok {
+			t := newToken(tok)
+			if t.Kind == TokenInvalid {
+				return t, atToken(newError(CodeUnrecognizedToken, tok.s), tok)
+			}
+			return t, nil
+		}
+		if l.err != nil {
+			return Token{}, l.err
+		}
+		line, err := l.r.ReadString('\n')
+		l.err = err
+		if line == "" && err != nil {
+			continue
+		}
+		l.line++
+		l.sc = newScanner(line, l.line)
+	}
+}
+
+// newToken returns the exported form of a scanned token, with its kind.
+func newToken(tok token) Token {
+	kind := TokenComment
+	if tok.s[0] != '#' {
+		kind = tokenKind(tok.s)
+	}
+	return Token{kind, tok.s, tok.line, tok.col}
+}
+
+// tokenKind returns the lexical class of the given token text.
+func tokenKind(s string) TokenKind {
+	if _, ok := matchHit(s); ok {
+		return TokenHit
+	}
+	if isWait(s) {
+		return TokenWait
+	}
+	if _, _, ok := splitDirective(s); ok {
+		return TokenDirective
+	}
+	switch {
+	case s == "|":
+		return TokenBarLine
+	case s == "[":
+		return TokenGroupOpen
+	case isGroupClose(s):
+		return TokenGroupClose
+	}
+	return TokenInvalid
+}
@@ -0,0 +1,48 @@
+package beatnik
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLexer(t *testing.T) {
+	in := "bpm:90 # Comment.  \n\tК,S. | .. [ (S..) ]rev\n\n?? K"
+	want := []Token{
+		{TokenDirective, "bpm:90", 1, 1},
+		{TokenComment, "# Comment.", 1, 8},
+		{TokenHit, "К,S.", 2, 2},
+		{TokenBarLine, "|", 2, 7},
+		{TokenWait, "..", 2, 9},
+		{TokenGroupOpen, "[", 2, 12},
+		{TokenHit, "(S..)", 2, 14},
+		{TokenGroupClose, "]rev", 2, 20},
+		{TokenInvalid, "??", 4, 1},
+		{TokenHit, "K", 4, 4},
+	}
+	l := NewLexer(strings.NewReader(in))
+	var got []Token
+	for {
+		tok, err := l.Next()
+		if err == io.EOF {
+			break
+		}
+		if (err != nil) != (tok.Kind == TokenInvalid) {
+			t.Errorf("Next()=%v,%v, want error only for invalid tokens",
+				tok, err)
+		}
+		got = append(got, tok)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Lexer(%q)=%v, want %v", in, got, want)
+	}
+}
+
+func TestParseTrack_barLines(t *testing.T) {
+	got := mustParse(t, "K S | K S")
+	want := mustParse(t, "K S K S")
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseTrack(K S | K S)=%v, want %v", got, want)
+	}
+}
@@ -0,0 +1,134 @@
+package beatnik
+
+// Export to LilyPond drum notation.
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Maps General MIDI drum notes to LilyPond drum names.
+var lilyDrums = map[byte]string{
+	35: "bda", 36: "bd", 37: "ss", 38: "sn", 39: "hc", 40: "sne",
+	41: "tomfl", 42: "hh", 43: "tomfh", 44: "hhp", 45: "toml", 46: "hho",
+	47: "tomml", 48: "tommh", 49: "cymc", 50: "tomh", 51: "cymr", 52: "cymch",
+	53: "rb", 54: "tamb", 55: "cyms", 56: "cb", 57: "cymcb", 58: "vibs",
+	59: "cymrb", 60: "bohm", 61: "bolm", 62: "cghm", 63: "cgho", 64: "cgl",
+	65: "timh", 66: "timl", 67: "agh", 68: "agl", 69: "cab", 70: "mar",
+	71: "whs", 72: "whl", 73: "guis", 74: "guil", 75: "cl", 76: "wbh",
+	77: "wbl", 78: "cuim", 79: "cuio", 80: "trim", 81: "tri",
+}
+
+// Maps plain note values in ticks to LilyPond durations.
+var lilyValues = map[uint]string{
+	384: "1", 192: "2", 96: "4", 48: "8", 24: "16", 12: "32", 6: "64", 3: "128",
+}
+
+// MarshalLilyPond returns the track as a LilyPond \drummode block, with one
+// bar per line. Notes are named by their General MIDI drums, reading beatnik's
+// default drum names as EZdrummer notes. Loud notes (FF and up) are accented.
+// Durations that cannot be written with plain or dotted notes, such as
+// tuplets, are written as scaled durations. Fails if the track is not valid or
+// has notes with no LilyPond name.
+func (t *Track) MarshalLilyPond() ([]byte, error) {
+	if err := errorOf(t.Validate()); err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer(nil)
+	ts := t.timeSig()
+	fmt.Fprintf(buf, "\\drummode {\n  \\time %v\n", ts)
+	if bpm := t.TempoMap().BPM(0); bpm != 0 {
+		fmt.Fprintf(buf, "  \\tempo 4 = %v\n", bpm)
+	}
+	buf.WriteString("  ")
+
+	meta := t.tempoChangeMeta()
+	var tick uint
+	for i, h := range t.Hits {
+		for len(meta) > 0 && meta[0].T <= tick {
+			switch meta[0].Type {
+			case MetaMarker:
+				fmt.Fprintf(buf, "\\mark %q ", string(meta[0].Data))
+			case MetaTempo:
+				fmt.Fprintf(buf, "\\tempo 4 = %v ", meta[0].bpm())
+			}
+			meta = meta[1:]
+		}
+
+		durs := lilyDuration(h.T)
+		if h.IsRest() {
+			buf.WriteString("r" + durs[0])
+		} else {
+			chord, err := lilyChord(h, i)
+			if err != nil {
+				return nil, err
+			}
+			buf.WriteString(chord + durs[0])
+			if maxVelocity(h) >= FF {
+				buf.WriteString("->")
+			}
+		}
+		for _, d := range durs[1:] {
+			buf.WriteString(" r" + d)
+		}
+
+		tick += h.T
+		if tick%ts.barTicks() == 0 && i < len(t.Hits)-1 {
+			buf.WriteString(" |\n  ")
+		} else if i < len(t.Hits)-1 {
+			buf.WriteString(" ")
+		}
+	}
+	buf.WriteString("\n}\n")
+	return buf.Bytes(), nil
+}
+
+// lilyChord returns the LilyPond notation of a hit's notes, without duration.
+// i is the index of the hit, for error reporting.
+func lilyChord(h *Hit, i int) (string, error) {
+	var names []string
+	for n := range h.Notes {
+		name, ok := lilyDrums[gmNote(n)]
+		if !ok {
+			return "", newError(CodeNoLilyPondName, i+1, n)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) == 1 {
+		return names[0], nil
+	}
+	return "<" + strings.Join(names, " ") + ">", nil
+}
+
+// lilyDuration returns LilyPond durations that add up to the given number of
+// ticks: one for the note, followed by rests. Ticks that do not add up from
+// plain and dotted durations give a single scaled duration, like "8*2/3" for
+// an eighth note triplet.
+func lilyDuration(ticks uint) []string {
+	var result []string
+	for _, v := range splitDuration(ticks) {
+		s := lilyValues[v.base]
+		if v.dotted {
+			s += "."
+		}
+		if v.num != v.den {
+			s += fmt.Sprintf("*%v/%v", v.num, v.den)
+		}
+		result = append(result, s)
+	}
+	return result
+}
+
+// maxVelocity returns the loudest velocity of a hit's notes.
+func maxVelocity(h *Hit) Velocity {
+	var result Velocity
+	for _, v := range h.Notes {
+		if v > result {
+			result = v
+		}
+	}
+	return result
+}
@@ -0,0 +1,74 @@
+package beatnik
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMarshalLilyPond(t *testing.T) {
+	src := "bpm:90 marker:Intro K,HC HC S,HC++ HC K,HC .. S,HC. .. K~ S~ S~ " +
+		"T1.>3 T1.>3 T1.>3 K"
+	tr, err := ParseTrack(src)
+	if err != nil {
+		t.Fatalf("ParseTrack(%q) failed: %v", src, err)
+	}
+	got, err := tr.MarshalLilyPond()
+	if err != nil {
+		t.Fatalf("MarshalLilyPond(%q) failed: %v", src, err)
+	}
+	want := "\\drummode {\n" +
+		"  \\time 4/4\n" +
+		"  \\tempo 4 = 90\n" +
+		"  \\mark \"Intro\" <bd hh>4 hh4 <hh sn>4-> hh4 |\n" +
+		"  <bd hh>4 r16 <hh sn>8. bd2 |\n" +
+		"  sn2 sn2 |\n" +
+		"  tomh8*2/3 tomh8*2/3 tomh8*2/3 bd4\n" +
+		"}\n"
+	if string(got) != want {
+		t.Errorf("MarshalLilyPond(%q)=\n%s\nwant\n%s", src, got, want)
+	}
+}
+
+func TestMarshalLilyPond_tempo(t *testing.T) {
+	tr := &Track{BPM: 120, Meta: []*Meta{tempoMeta(0, 90), tempoMeta(96, 100)},
+		Hits: []*Hit{{Notes: map[byte]Velocity{36: F}, T: 96},
+			{Notes: map[byte]Velocity{38: F}, T: 96}}}
+	got, err := tr.MarshalLilyPond()
+	if err != nil {
+		t.Fatalf("MarshalLilyPond() failed: %v", err)
+	}
+	want := "\\drummode {\n" +
+		"  \\time 4/4\n" +
+		"  \\tempo 4 = 90\n" +
+		"  bd4 \\tempo 4 = 100 sn4\n" +
+		"}\n"
+	if string(got) != want {
+		t.Errorf("MarshalLilyPond()=\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestLilyDuration(t *testing.T) {
+	tests := []struct {
+		ticks uint
+		want  []string
+	}{
+		{96, []string{"4"}},
+		{144, []string{"4."}},
+		{120, []string{"4", "16"}},
+		{32, []string{"8*2/3"}},
+		{64, []string{"4*2/3"}},
+		{768, []string{"1", "1"}},
+	}
+	for _, test := range tests {
+		if got := lilyDuration(test.ticks); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("lilyDuration(%v)=%v, want %v", test.ticks, got, test.want)
+		}
+	}
+}
+
+func TestMarshalLilyPond_bad(t *testing.T) {
+	tr := &Track{BPM: 90, Hits: []*Hit{{Notes: map[byte]Velocity{120: F}, T: 96}}}
+	if _, err := tr.MarshalLilyPond(); err == nil {
+		t.Errorf("MarshalLilyPond(%v) succeeded, want error", tr)
+	}
+}
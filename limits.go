@@ -0,0 +1,170 @@
+package beatnik
+
+// Bounds on how much a source can expand.
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Limits bound how much a source can expand through repeated sections and
+// included files, so that a short source cannot make the parser use unbounded
+// time and memory. Passing a limit fails parsing with an error whose code
+// IsLimit.
+type Limits struct {
+	MaxHits         int // Largest number of hits in a track, 0 for no limit.
+	MaxIncludeDepth int // Deepest nesting of included files, 0 for no limit.
+	MaxTokens       int // Most tokens, in all included files, 0 for no limit.
+	MaxNotes        int // Most notes in a single hit, 0 for no limit.
+	MaxTicks        int // Longest track in ticks, 0 for no limit.
+	MaxEvents       int // Most meta and control events, 0 for no limit.
+}
+
+var (
+	// DefaultLimits apply to ParseTrack and ParseFile. They only stop
+	// accidental blowups, and are far above what songs need.
+	DefaultLimits = Limits{MaxHits: 10000000, MaxIncludeDepth: 64,
+		MaxTokens: 10000000, MaxTicks: 96 * 4 * 1000000, MaxEvents: 10000000}
+
+	// SandboxLimits apply to sandboxes whose limits are zero.
+	SandboxLimits = Limits{MaxHits: 100000, MaxIncludeDepth: 8,
+		MaxTokens: 100000, MaxNotes: 32, MaxTicks: 96 * 4 * 10000,
+		MaxEvents: 100000}
+)
+
+// withDefaults returns the limits with zero fields replaced by def's.
+func (l Limits) withDefaults(def Limits) Limits {
+	if l.MaxHits == 0 {
+		l.MaxHits = def.MaxHits
+	}
+	if l.MaxIncludeDepth == 0 {
+		l.MaxIncludeDepth = def.MaxIncludeDepth
+	}
+	if l.MaxTokens == 0 {
+		l.MaxTokens = def.MaxTokens
+	}
+	if l.MaxNotes == 0 {
+		l.MaxNotes = def.MaxNotes
+	}
+	if l.MaxTicks == 0 {
+		l.MaxTicks = def.MaxTicks
+	}
+	if l.MaxEvents == 0 {
+		l.MaxEvents = def.MaxEvents
+	}
+	return l
+}
+
+// limitCodes are the codes of the errors of passing limits.
+var limitCodes = map[Code]bool{
+	CodeTooManyHits:     true,
+	CodeSectionTooLarge: true,
+	CodeIncludeDepth:    true,
+	CodeTooManyTokens:   true,
+	CodeTooManyNotes:    true,
+	CodeTooManyTicks:    true,
+	CodeTooManyEvents:   true,
+}
+
+// IsLimit returns true if err is an *Error of a source that passes its
+// limits, rather than one that is wrong. Servers may report these as requests
+// that are too large.
+func IsLimit(err error) bool {
+	e, ok := err.(*Error)
+	return ok && limitCodes[e.Code]
+}
+
+// stopsParsing returns true if err is a limit that the parser cannot go on
+// after, even when it collects all errors.
+func stopsParsing(err error) bool {
+	e, ok := err.(*Error)
+	return ok && (e.Code == CodeTooManyHits || e.Code == CodeTooManyTokens)
+}
+
+// countToken checks that one more token can be parsed without passing the
+// parser's limit.
+func (p *parser) countToken() error {
+	if max := p.limits.MaxTokens; max > 0 && p.tokens >= max {
+		return newError(CodeTooManyTokens, max)
+	}
+	p.tokens++
+	return nil
+}
+
+// checkNotes checks that a hit does not have more notes than the parser's
+// limit.
+func (p *parser) checkNotes(h *Hit) error {
+	if max := p.limits.MaxNotes; max > 0 && len(h.Notes) > max {
+		return newError(CodeTooManyNotes, len(h.Notes), max)
+	}
+	return nil
+}
+
+// checkTicks checks that the track is not longer than the parser's limit.
+func (p *parser) checkTicks() error {
+	if max := p.limits.MaxTicks; max > 0 && p.t.ticks() > uint(max) {
+		return newError(CodeTooManyTicks, max, max/(4*96))
+	}
+	return nil
+}
+
+// grow checks that n more hits can be added to the track without passing the
+// parser's limit.
+func (p *parser) grow(n int) error {
+	max := p.limits.MaxHits
+	if max > 0 && n > max-len(p.t.Hits) {
+		return newError(CodeTooManyHits, max)
+	}
+	return nil
+}
+
+// growEvents checks that n more meta and control events can be added to the
+// track without passing the parser's limit.
+func (p *parser) growEvents(n int) error {
+	max := p.limits.MaxEvents
+	if max > 0 && n > max-len(p.t.Meta)-len(p.t.Controls) {
+		return newError(CodeTooManyEvents, max)
+	}
+	return nil
+}
+
+// growSection checks that the named section, of the given numbers of hits and
+// of meta and control events, can be played n more times without passing the
+// parser's limits. Sections without hits count as one hit, since their meta
+// events are copied too.
+func (p *parser) growSection(name string, hits, events, n int) error {
+	if max := p.limits.MaxHits; max > 0 {
+		if hits < 1 {
+			hits = 1
+		}
+		if n > max/hits+1 || n*hits > max-len(p.t.Hits) {
+			total := float64(hits) * float64(n)
+			return newError(CodeSectionTooLarge, name, n, countString(total),
+				countString(float64(max)))
+		}
+	}
+	if max := p.limits.MaxEvents; max > 0 && events > 0 && n > max/events+1 {
+		return newError(CodeTooManyEvents, max)
+	}
+	return p.growEvents(events * n)
+}
+
+// countString returns a short rounded form of a count, like "2M" or "100k".
+func countString(n float64) string {
+	switch {
+	case n >= 1e9:
+		return formatCount(n/1e9) + "G"
+	case n >= 1e6:
+		return formatCount(n/1e6) + "M"
+	case n >= 1e4:
+		return formatCount(n/1e3) + "k"
+	}
+	return formatCount(n)
+}
+
+// formatCount formats n with at most one decimal digit, dropping a zero
+// fraction.
+func formatCount(n float64) string {
+	s := strconv.FormatFloat(n, 'f', 1, 64)
+	return strings.TrimSuffix(s, ".0")
+}
@@ -0,0 +1,116 @@
+package beatnik
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLimits(t *testing.T) {
+	_, err := ParseTrack("section:verse K S K S play:verse*5000000")
+	want := `1:23: section "verse" played 5000000 times expands to 20M hits, limit is 10M`
+	if err == nil || err.Error() != want {
+		t.Errorf("ParseTrack() error=%v, want %v", err, want)
+	}
+
+	// Include depth.
+	fsys := fstest.MapFS{"10": {Data: []byte("S")}}
+	for i := 0; i < 10; i++ {
+		fsys[fmt.Sprint(i)] = &fstest.MapFile{
+			Data: []byte(fmt.Sprintf("K include:%v", i+1))}
+	}
+	s := &Sandbox{FS: fsys}
+	_, err = s.ParseFile("0")
+	if e, ok := err.(*Error); !ok || e.Code != CodeIncludeDepth {
+		t.Errorf("ParseFile() error=%v, want %v", err, CodeIncludeDepth)
+	}
+	s.Limits.MaxIncludeDepth = 20
+	if _, err := s.ParseFile("0"); err != nil {
+		t.Errorf("ParseFile() with depth 20 failed: %v", err)
+	}
+}
+
+func TestLimits_sizes(t *testing.T) {
+	tests := []struct {
+		src    string
+		limits Limits
+		want   Code
+		line   int
+	}{
+		{"K S K S", Limits{MaxTokens: 4}, "", 0},
+		{"K S K\nS K", Limits{MaxTokens: 4}, CodeTooManyTokens, 2},
+		{"K,S,HC", Limits{MaxNotes: 3}, "", 0},
+		{"K\nK,S,HC,T1", Limits{MaxNotes: 3}, CodeTooManyNotes, 2},
+		{"K,K,K,K", Limits{MaxNotes: 3}, "", 0},
+		{"K~ K~", Limits{MaxTicks: 96 * 4}, "", 0},
+		{"K~ K~ .", Limits{MaxTicks: 96 * 4}, CodeTooManyTicks, 0},
+		{"section:a cue:x K section:\nplay:a", Limits{MaxEvents: 4}, "", 0},
+		{"section:a cue:x K section:\nplay:a*2", Limits{MaxEvents: 4},
+			CodeTooManyEvents, 2},
+	}
+	for _, test := range tests {
+		_, err := ParseTrackWithOptions(test.src, ParseOptions{Limits: test.limits})
+		if test.want == "" {
+			if err != nil {
+				t.Errorf("ParseTrackWithOptions(%q) failed: %v", test.src, err)
+			}
+			continue
+		}
+		e, ok := err.(*Error)
+		if !ok || e.Code != test.want || e.Line != test.line {
+			t.Errorf("ParseTrackWithOptions(%q)=%v, want %v at line %v",
+				test.src, err, test.want, test.line)
+		}
+		if !IsLimit(err) {
+			t.Errorf("IsLimit(%v)=false, want true", err)
+		}
+	}
+	if _, err := ParseTrack("K,"); IsLimit(err) {
+		t.Errorf("IsLimit(%v)=true, want false", err)
+	}
+}
+
+func TestLimits_sandbox(t *testing.T) {
+	s := &Sandbox{}
+	src := "section:a " + strings.Repeat("marker:x ", 800) + "K section: play:a*800"
+	if _, err := s.ParseTrack(src); !IsLimit(err) {
+		t.Errorf("ParseTrack() error=%v, want a limit", err)
+	}
+	src = strings.Repeat("K ", SandboxLimits.MaxTokens+1)
+	if _, err := s.ParseTrack(src); !IsLimit(err) {
+		t.Errorf("ParseTrack() error=%v, want a limit", err)
+	}
+	src = strings.Repeat("K", 1000) + "."
+	if _, err := s.ParseTrack(src); IsLimit(err) || err == nil {
+		t.Errorf("ParseTrack() error=%v, want a parsing error", err)
+	}
+}
+
+func TestParseTrackAll_tokenLimit(t *testing.T) {
+	src := strings.Repeat("K,Q ", DefaultLimits.MaxTokens/1000) + "K,Q"
+	defer func(n int) { DefaultLimits.MaxTokens = n }(DefaultLimits.MaxTokens)
+	DefaultLimits.MaxTokens = 10
+	_, errs := ParseTrackAll(src)
+	if len(errs) != 11 {
+		t.Fatalf("ParseTrackAll() returned %v errors, want 11", len(errs))
+	}
+	if e, ok := errs[10].(*Error); !ok || e.Code != CodeTooManyTokens {
+		t.Errorf("last error=%v, want %v", errs[10], CodeTooManyTokens)
+	}
+}
+
+func TestCountString(t *testing.T) {
+	tests := []struct {
+		n    float64
+		want string
+	}{
+		{12, "12"}, {9999, "9999"}, {10000, "10k"}, {100000, "100k"},
+		{2500000, "2.5M"}, {2e6, "2M"}, {3e9, "3G"},
+	}
+	for _, test := range tests {
+		if got := countString(test.n); got != test.want {
+			t.Errorf("countString(%v)=%q, want %q", test.n, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+// Package link follows the tempo and beat of an Ableton Link session, so that
+// a beatnik player locks to other software on the network.
+//
+// A Session listens to the announcements of Link peers on the local network
+// and measures the session's shared clock by pinging one of them. It does not
+// announce itself, so it follows the session's tempo and beat without
+// changing them, and does not show up as a peer in other applications.
+//
+// A Session is a beatnik.Transport:
+//
+//	s, err := link.Listen(ctx)
+//	...
+//	player := &beatnik.Player{Transport: s}
+package link
+
+import (
+	"context"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// multicastAddr is where Link peers announce themselves.
+var multicastAddr = &net.UDPAddr{IP: net.IPv4(224, 76, 78, 75), Port: 20808}
+
+// maxSamples is the number of clock measurements that a session's clock
+// offset is the median of.
+const maxSamples = 9
+
+// A Session follows a Link session. Its methods may be called concurrently.
+type Session struct {
+	// Follow the session's start and stop, for peers that share them.
+	// Otherwise the session is always playing.
+	StartStop bool
+
+	mu       sync.Mutex
+	base     time.Time // Zero of the host time.
+	session  [8]byte   // Session that is followed.
+	peers    map[[8]byte]*peer
+	timeline timeline
+	playing  bool
+	samples  []int64 // Ghost time minus host time, latest last.
+	ready    chan struct{}
+	isReady  bool
+
+	pings *net.UDPConn // Measurement socket, nil for none.
+}
+
+// A peer is a known member of the followed session.
+type peer struct {
+	endpoint *net.UDPAddr
+	expires  time.Time
+}
+
+// Listen joins the Link multicast group and follows the first session that a
+// peer announces, or the session of another peer once all the followed
+// session's peers are gone. Listens until ctx is done.
+func Listen(ctx context.Context) (*Session, error) {
+	mc, err := net.ListenMulticastUDP("udp4", nil, multicastAddr)
+	if err != nil {
+		return nil, err
+	}
+	pings, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		mc.Close()
+		return nil, err
+	}
+	s := newSession()
+	s.pings = pings
+	go func() {
+		<-ctx.Done()
+		mc.Close()
+		pings.Close()
+	}()
+	go s.read(mc, s.handleDiscovery)
+	go s.read(pings, s.handlePong)
+	return s, nil
+}
+
+// newSession returns a session that has not heard from peers.
+func newSession() *Session {
+	return &Session{base: time.Now(), peers: map[[8]byte]*peer{},
+		ready: make(chan struct{})}
+}
+
+// read passes the messages of a connection to handle until it is closed.
+func (s *Session) read(conn *net.UDPConn, handle func([]byte, time.Time)) {
+	buf := make([]byte, 512)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		handle(buf[:n], time.Now())
+	}
+}
+
+// host returns the host time of t in microseconds.
+func (s *Session) host(t time.Time) int64 {
+	return int64(t.Sub(s.base) / time.Microsecond)
+}
+
+// handleDiscovery updates the session with a peer's announcement, and pings
+// the peer to measure the session's clock.
+func (s *Session) handleDiscovery(b []byte, now time.Time) {
+	p, err := parseDiscovery(b)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, q := range s.peers {
+		if now.After(q.expires) {
+			delete(s.peers, id)
+		}
+	}
+	if p.typ == msgByeBye {
+		delete(s.peers, p.ident)
+		return
+	}
+	if p.typ != msgAlive && p.typ != msgResponse {
+		return
+	}
+	if len(s.peers) == 0 && p.session != s.session {
+		s.session = p.session
+		s.samples = nil
+	}
+	if p.session != s.session {
+		return
+	}
+	s.peers[p.ident] = &peer{p.endpoint,
+		now.Add(time.Duration(p.ttl) * time.Second)}
+	s.timeline, s.playing = p.timeline, p.playing
+	if s.pings != nil && p.endpoint != nil {
+		s.pings.WriteToUDP(ping(s.host(now)), p.endpoint)
+	}
+}
+
+// handlePong adds a clock measurement from a peer's response to a ping.
+func (s *Session) handlePong(b []byte, now time.Time) {
+	p, err := parsePong(b)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p.session != s.session {
+		return
+	}
+	s.samples = append(s.samples, p.ghost-(p.host+s.host(now))/2)
+	if len(s.samples) > maxSamples {
+		s.samples = s.samples[1:]
+	}
+	if !s.isReady {
+		s.isReady = true
+		close(s.ready)
+	}
+}
+
+// offset returns the median of the clock measurements, ghost time minus host
+// time. Call with the lock held.
+func (s *Session) offset() int64 {
+	sorted := append([]int64(nil), s.samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[len(sorted)/2]
+}
+
+// Wait returns when the session's clock has been measured, or with ctx's
+// error when ctx is done.
+func (s *Session) Wait(ctx context.Context) error {
+	select {
+	case <-s.ready:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Peers returns the number of peers in the followed session.
+func (s *Session) Peers() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.peers)
+}
+
+// Beat returns the session's beat at the given time and its tempo, and
+// whether it is playing. A session whose clock has not been measured is not
+// playing.
+func (s *Session) Beat(at time.Time) (beat, bpm float64, playing bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.samples) == 0 {
+		return 0, 0, false
+	}
+	ghost := s.host(at) + s.offset()
+	return s.timeline.beat(ghost), s.timeline.bpm(),
+		s.playing || !s.StartStop
+}
@@ -0,0 +1,134 @@
+package link
+
+import (
+	"encoding/binary"
+	"math"
+	"net"
+	"testing"
+	"time"
+)
+
+// discovery returns a discovery message of a peer.
+func discovery(typ byte, ident, session byte, tl timeline, playing bool,
+	endpoint *net.UDPAddr) []byte {
+	b := append([]byte(nil), discoveryHeader...)
+	b = append(b, typ, 5, 0, 0, ident, 0, 0, 0, 0, 0, 0, 0)
+	entry := func(key uint32, v []byte) {
+		var h [8]byte
+		binary.BigEndian.PutUint32(h[:], key)
+		binary.BigEndian.PutUint32(h[4:], uint32(len(v)))
+		b = append(append(b, h[:]...), v...)
+	}
+	var v [24]byte
+	binary.BigEndian.PutUint64(v[:], uint64(tl.microsPerBeat))
+	binary.BigEndian.PutUint64(v[8:], uint64(tl.beatOrigin))
+	binary.BigEndian.PutUint64(v[16:], uint64(tl.timeOrigin))
+	entry(keyTimeline, v[:])
+	entry(keySession, []byte{session, 0, 0, 0, 0, 0, 0, 0})
+	st := make([]byte, 17)
+	if playing {
+		st[0] = 1
+	}
+	entry(keyStartStop, st)
+	if endpoint != nil {
+		ep := append([]byte(nil), endpoint.IP.To4()...)
+		ep = append(ep, byte(endpoint.Port>>8), byte(endpoint.Port))
+		entry(keyEndpoint, ep)
+	}
+	return b
+}
+
+// pongOf returns the response of a peer of the given session to a ping, at
+// the given ghost time.
+func pongOf(t *testing.T, ping []byte, session byte, ghost int64) []byte {
+	b := append(append([]byte(nil), measurementHeader...), msgPong)
+	var sess [16]byte
+	binary.BigEndian.PutUint32(sess[:], keySession)
+	binary.BigEndian.PutUint32(sess[4:], 8)
+	sess[8] = session
+	b = append(b, sess[:]...)
+	b = appendEntry(b, keyGhostTime, ghost)
+	if len(ping) <= len(measurementHeader) || ping[len(measurementHeader)] != msgPing {
+		t.Fatalf("bad ping: %v", ping)
+	}
+	return append(b, ping[len(measurementHeader)+1:]...)
+}
+
+func TestSession(t *testing.T) {
+	s := newSession()
+	now := s.base.Add(time.Second)
+	if _, _, playing := s.Beat(now); playing {
+		t.Errorf("Beat() playing before measuring")
+	}
+
+	// 120 BPM, beat 4 at ghost time 10s.
+	tl := timeline{500000, 4000000, 10000000}
+	s.handleDiscovery(discovery(msgAlive, 1, 7, tl, false, nil), now)
+	if s.Peers() != 1 {
+		t.Fatalf("Peers()=%v, want 1", s.Peers())
+	}
+	// Ghost time is host time plus 9s.
+	s.handlePong(pongOf(t, ping(s.host(now)-2000), 7, s.host(now)+9000000-1000), now)
+	s.handlePong(pongOf(t, ping(s.host(now)), 8, 0), now) // Another session.
+
+	beat, bpm, playing := s.Beat(now.Add(1500 * time.Millisecond))
+	if math.Abs(beat-7) > 1e-6 || bpm != 120 || !playing {
+		t.Errorf("Beat()=%v,%v,%v, want 7,120,true", beat, bpm, playing)
+	}
+	s.StartStop = true
+	if _, _, playing := s.Beat(now); playing {
+		t.Errorf("Beat() playing for a stopped session")
+	}
+
+	// Peers of other sessions are ignored until the session's peers leave.
+	s.handleDiscovery(discovery(msgAlive, 2, 8, timeline{1000000, 0, 0}, true,
+		nil), now)
+	if _, bpm, _ := s.Beat(now); bpm != 120 {
+		t.Errorf("Beat() bpm=%v, want 120", bpm)
+	}
+	s.handleDiscovery(discovery(msgByeBye, 1, 7, tl, false, nil), now)
+	if s.Peers() != 0 {
+		t.Fatalf("Peers()=%v, want 0", s.Peers())
+	}
+	s.handleDiscovery(discovery(msgAlive, 2, 8, timeline{1000000, 0, 0}, true,
+		nil), now)
+	if _, _, playing := s.Beat(now); playing {
+		t.Errorf("Beat() playing before measuring the new session")
+	}
+}
+
+func TestSession_ping(t *testing.T) {
+	peerConn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Skip("no UDP:", err)
+	}
+	defer peerConn.Close()
+	pings, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Skip("no UDP:", err)
+	}
+	defer pings.Close()
+
+	s := newSession()
+	s.pings = pings
+	go s.read(pings, s.handlePong)
+	go func() {
+		buf := make([]byte, 512)
+		n, addr, err := peerConn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		peerConn.WriteToUDP(pongOf(t, buf[:n], 3, 42), addr)
+	}()
+
+	s.handleDiscovery(discovery(msgResponse, 1, 3, timeline{500000, 0, 0}, true,
+		peerConn.LocalAddr().(*net.UDPAddr)), time.Now())
+	select {
+	case <-s.ready:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no clock measurement")
+	}
+	if _, bpm, playing := s.Beat(time.Now()); bpm != 120 || !playing {
+		t.Errorf("Beat()=%v,%v, want 120,true", bpm, playing)
+	}
+}
@@ -0,0 +1,192 @@
+package link
+
+// Encoding of Link protocol messages.
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+)
+
+// Protocol headers of discovery and measurement messages.
+var (
+	discoveryHeader   = []byte("_asdp_v\x01")
+	measurementHeader = []byte("_link_v\x01")
+)
+
+// Message types.
+const (
+	msgAlive    = 1 // Discovery: a peer's state.
+	msgResponse = 2 // Discovery: a peer's state, in response to an alive.
+	msgByeBye   = 3 // Discovery: a peer leaves.
+	msgPing     = 1 // Measurement: a request for the ghost time.
+	msgPong     = 2 // Measurement: the ghost time.
+)
+
+// Payload entry keys.
+const (
+	keyTimeline  = 0x746d6c6e // "tmln"
+	keySession   = 0x73657373 // "sess"
+	keyStartStop = 0x73747374 // "stst"
+	keyEndpoint  = 0x6d657034 // "mep4"
+	keyHostTime  = 0x5f5f6874 // "__ht"
+	keyGhostTime = 0x5f5f6774 // "__gt"
+)
+
+// errBadMessage is returned for messages that are not valid Link messages.
+var errBadMessage = errors.New("bad link message")
+
+// A timeline maps ghost time to beats. All values are in microseconds or
+// microbeats.
+type timeline struct {
+	microsPerBeat int64
+	beatOrigin    int64 // Beat at the time origin, in microbeats.
+	timeOrigin    int64 // Ghost time.
+}
+
+// beat returns the beat at the given ghost time.
+func (t timeline) beat(ghost int64) float64 {
+	return (float64(t.beatOrigin) + float64(ghost-t.timeOrigin)*1e6/
+		float64(t.microsPerBeat)) / 1e6
+}
+
+// bpm returns the tempo of the timeline.
+func (t timeline) bpm() float64 {
+	return 60e6 / float64(t.microsPerBeat)
+}
+
+// A peerState is the state that a peer announces in discovery messages.
+type peerState struct {
+	typ      byte
+	ttl      byte    // Seconds that the state is valid for.
+	ident    [8]byte // Id of the peer.
+	session  [8]byte // Id of the peer's session.
+	timeline timeline
+	playing  bool
+	endpoint *net.UDPAddr // Measurement endpoint, nil if unknown.
+}
+
+// parseDiscovery parses a discovery message.
+func parseDiscovery(b []byte) (*peerState, error) {
+	if len(b) < len(discoveryHeader)+12 ||
+		string(b[:len(discoveryHeader)]) != string(discoveryHeader) {
+		return nil, errBadMessage
+	}
+	b = b[len(discoveryHeader):]
+	p := &peerState{typ: b[0], ttl: b[1]}
+	copy(p.ident[:], b[4:12])
+	err := parseEntries(b[12:], func(key uint32, v []byte) error {
+		switch key {
+		case keyTimeline:
+			if len(v) < 24 {
+				return errBadMessage
+			}
+			p.timeline = timeline{int64(binary.BigEndian.Uint64(v)),
+				int64(binary.BigEndian.Uint64(v[8:])),
+				int64(binary.BigEndian.Uint64(v[16:]))}
+			if p.timeline.microsPerBeat <= 0 {
+				return errBadMessage
+			}
+		case keySession:
+			if len(v) < 8 {
+				return errBadMessage
+			}
+			copy(p.session[:], v)
+		case keyStartStop:
+			if len(v) < 1 {
+				return errBadMessage
+			}
+			p.playing = v[0] != 0
+		case keyEndpoint:
+			if len(v) < 6 {
+				return errBadMessage
+			}
+			p.endpoint = &net.UDPAddr{IP: net.IP(append([]byte(nil), v[:4]...)),
+				Port: int(binary.BigEndian.Uint16(v[4:]))}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// parseEntries calls f with each entry of a message payload.
+func parseEntries(b []byte, f func(key uint32, value []byte) error) error {
+	for len(b) > 0 {
+		if len(b) < 8 {
+			return errBadMessage
+		}
+		key, size := binary.BigEndian.Uint32(b), binary.BigEndian.Uint32(b[4:])
+		b = b[8:]
+		if uint64(size) > uint64(len(b)) {
+			return errBadMessage
+		}
+		if err := f(key, b[:size]); err != nil {
+			return err
+		}
+		b = b[size:]
+	}
+	return nil
+}
+
+// appendEntry appends a payload entry of a 64-bit value.
+func appendEntry(b []byte, key uint32, value int64) []byte {
+	var e [16]byte
+	binary.BigEndian.PutUint32(e[:], key)
+	binary.BigEndian.PutUint32(e[4:], 8)
+	binary.BigEndian.PutUint64(e[8:], uint64(value))
+	return append(b, e[:]...)
+}
+
+// ping returns a measurement request sent at the given host time.
+func ping(host int64) []byte {
+	b := append(append([]byte(nil), measurementHeader...), msgPing)
+	return appendEntry(b, keyHostTime, host)
+}
+
+// A pong is a measurement response.
+type pong struct {
+	session [8]byte
+	ghost   int64 // Ghost time when the pong was sent.
+	host    int64 // Host time when the ping was sent.
+}
+
+// parsePong parses a measurement response.
+func parsePong(b []byte) (*pong, error) {
+	if len(b) < len(measurementHeader)+1 ||
+		string(b[:len(measurementHeader)]) != string(measurementHeader) ||
+		b[len(measurementHeader)] != msgPong {
+		return nil, errBadMessage
+	}
+	p := &pong{}
+	var hasGhost, hasHost bool
+	err := parseEntries(b[len(measurementHeader)+1:], func(key uint32, v []byte) error {
+		switch key {
+		case keySession:
+			if len(v) < 8 {
+				return errBadMessage
+			}
+			copy(p.session[:], v)
+		case keyGhostTime, keyHostTime:
+			if len(v) < 8 {
+				return errBadMessage
+			}
+			t := int64(binary.BigEndian.Uint64(v))
+			if key == keyGhostTime {
+				p.ghost, hasGhost = t, true
+			} else {
+				p.host, hasHost = t, true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !hasGhost || !hasHost {
+		return nil, errBadMessage
+	}
+	return p, nil
+}
@@ -0,0 +1,152 @@
+package beatnik
+
+// Warnings about suspicious but valid tracks.
+
+import (
+	"sort"
+	"strings"
+)
+
+// A Diagnostic is a warning about a part of a track that is valid, but is
+// probably not what the author meant.
+type Diagnostic struct {
+	*Error     // Kind, message and source position of the warning.
+	Hit    int // 1-based index of the hit it refers to, 0 if none.
+}
+
+// minFlatStrikes is the number of strikes from which a track whose
+// velocities never vary is reported.
+const minFlatStrikes = 16
+
+// Lint looks for suspicious patterns in a track: hits longer than a bar,
+// velocities that never vary and notes that are struck again before their
+// previous strike. src is the track's source, which is used for positions and
+// for source-level checks: grace notes before the first hit, which add a bar
+// of silence to the track, and aliases that are never used or that hide
+// built-in drum names. src may be empty. Returns the diagnostics ordered by
+// position.
+func Lint(t *Track, src string) []*Diagnostic {
+	var result []*Diagnostic
+	var toks []token // Token of each hit, if known.
+	if src != "" {
+		var diags []*Diagnostic
+		diags, toks = lintSource(src)
+		result = append(result, diags...)
+		if len(toks) != len(t.Hits) {
+			toks = nil // Source does not match the track.
+		}
+	}
+	warn := func(hit int, code Code, args ...interface{}) {
+		d := &Diagnostic{newError(code, args...), hit}
+		if hit > 0 && toks != nil {
+			d.Line, d.Col = toks[hit-1].line, toks[hit-1].col
+		}
+		result = append(result, d)
+	}
+
+	bar := t.timeSig().barTicks()
+	velocities := map[Velocity]bool{}
+	strikes := 0
+	type strike struct {
+		at  int // Tick of the strike, with its offset.
+		hit int // 1-based index of the hit.
+	}
+	last := map[byte]strike{}
+	var tick int
+	for i, h := range t.Hits {
+		if h.T > bar {
+			warn(i+1, CodeLongHit, i+1, h.T, bar)
+		}
+		for _, n := range sortedNotes(h) {
+			velocities[h.Notes[n]] = true
+			strikes++
+			at := tick + h.Offsets[n]
+			if prev, ok := last[n]; ok && at <= prev.at {
+				warn(i+1, CodeOverlappingNote, i+1, n, prev.hit)
+			}
+			last[n] = strike{at, i + 1}
+		}
+		tick += int(h.T)
+	}
+	if strikes >= minFlatStrikes && len(velocities) == 1 {
+		for v := range velocities {
+			warn(0, CodeFlatVelocity, strikes, v)
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Col < b.Col
+	})
+	return result
+}
+
+// lintSource runs the source-level checks of Lint. Returns the diagnostics
+// and the token that created each hit, in the order of the parsed track's
+// hits. Stops at the first parse error, which is not reported.
+func lintSource(src string) ([]*Diagnostic, []token) {
+	var result []*Diagnostic
+	warn := func(tok token, code Code, args ...interface{}) {
+		e := newError(code, args...)
+		e.Line, e.Col = tok.line, tok.col
+		result = append(result, &Diagnostic{Error: e})
+	}
+
+	p := newParser()
+	hitToks := map[*Hit]token{}
+	aliases := map[string]token{} // Alias definitions.
+	used := map[string]bool{}     // Names that appear in hits and remaps.
+	for _, tok := range tokenize(src) {
+		nhits := len(p.t.Hits)
+		if err := p.parseToken(tok); err != nil {
+			break
+		}
+		if len(p.t.Hits) > nhits && tokenKind(tok.s) == TokenHit {
+			hitToks[p.t.Hits[len(p.t.Hits)-1]] = tok
+			if nhits == 0 && parenthesized(tok.s) {
+				warn(tok, CodeLeadingGrace)
+			}
+			m, _ := matchHit(tok.s)
+			for _, part := range strings.Split(m.notes(tok.s), ",") {
+				nm, _ := matchNote(part)
+				for _, name := range altNames(nm.name(part)) {
+					used[name] = true
+				}
+			}
+			continue
+		}
+		directive, value, ok := splitDirective(tok.s)
+		if !ok {
+			continue
+		}
+		switch directive {
+		case "alias":
+			name := aliasToken.FindStringSubmatch(value)[1]
+			if _, ok := drumNotes[name]; ok {
+				warn(tok, CodeShadowedDrum, name)
+			}
+			aliases[name] = tok
+			used[aliasToken.FindStringSubmatch(value)[2]] = true
+		case "remap":
+			for _, part := range strings.Split(value, ",") {
+				if pm := remapToken.FindStringSubmatch(part); pm != nil {
+					used[pm[1]], used[pm[2]] = true, true
+				}
+			}
+		}
+	}
+	for name, tok := range aliases {
+		if !used[name] {
+			warn(tok, CodeUnusedAlias, name)
+		}
+	}
+
+	toks := make([]token, len(p.t.Hits))
+	for i, h := range p.t.Hits {
+		toks[i] = hitToks[h]
+	}
+	return result, toks
+}
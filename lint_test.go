@@ -0,0 +1,55 @@
+package beatnik
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	src := "(S.) alias:K=S alias:foo=T1 alias:bar=T2\n" +
+		"bar K@+96 K- ~~ ~"
+	tr, err := ParseTrack(src)
+	if err != nil {
+		t.Fatalf("ParseTrack(%q) failed: %v", src, err)
+	}
+	type result struct {
+		code      Code
+		line, col int
+		hit       int
+	}
+	want := []result{
+		{CodeLeadingGrace, 1, 1, 0},
+		{CodeShadowedDrum, 1, 6, 0},
+		{CodeUnusedAlias, 1, 16, 0},
+		{CodeLongHit, 2, 11, 5},
+		{CodeOverlappingNote, 2, 11, 5},
+	}
+	var got []result
+	for _, d := range Lint(tr, src) {
+		got = append(got, result{d.Code, d.Line, d.Col, d.Hit})
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Lint(%q)=%v, want %v", src, got, want)
+	}
+}
+
+func TestLint_flatVelocity(t *testing.T) {
+	src := strings.Repeat("HC,K. HC. HC,S. HC. ", 4)
+	tr, err := ParseTrack(src)
+	if err != nil {
+		t.Fatalf("ParseTrack(%q) failed: %v", src, err)
+	}
+	got := Lint(tr, "")
+	if len(got) != 1 || got[0].Code != CodeFlatVelocity {
+		t.Fatalf("Lint(%q)=%v, want %v", src, got, CodeFlatVelocity)
+	}
+	if got[0].Line != 0 || got[0].Args[0] != 24 {
+		t.Errorf("Lint(%q)=%v, want 24 strikes and no position", src, got[0])
+	}
+
+	tr.Hits[0].Notes[36] = FF
+	if got := Lint(tr, ""); len(got) != 0 {
+		t.Errorf("Lint()=%v, want none", got)
+	}
+}
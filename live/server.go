@@ -0,0 +1,270 @@
+// Package live shares a beat with browsers as it is being written. A Server
+// pushes every compiled version of a track, or the errors that stopped its
+// compilation, and the playback position, over WebSocket to all connected
+// clients, so that a classroom or a band can follow one source file together.
+//
+// Messages are JSON objects, with a type field of "track", "error" or
+// "position". A new client receives the latest track or error message when
+// it connects.
+package live
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/fluhus/beatnik"
+)
+
+// clientBuffer is the number of messages that can wait to be sent to a
+// client. Clients that fall further behind are disconnected.
+const clientBuffer = 16
+
+// A Message is sent to clients.
+type Message struct {
+	Type string `json:"type"` // "track", "error" or "position".
+
+	// Track messages. MIDI is a standard midi file, encoded in base64.
+	MIDI []byte  `json:"midi,omitempty"`
+	BPM  uint    `json:"bpm,omitempty"`
+	Bars float64 `json:"bars,omitempty"`
+
+	// Error messages.
+	Errors []string `json:"errors,omitempty"`
+
+	// Position messages. Bar is counted from 0, and Millis is the playing
+	// time from the start of the track.
+	Tick   uint  `json:"tick,omitempty"`
+	Bar    int   `json:"bar,omitempty"`
+	Millis int64 `json:"millis,omitempty"`
+}
+
+// A Server broadcasts tracks and playback positions to WebSocket clients. It
+// serves a simple page that shows them to requests that are not WebSocket
+// handshakes. The zero value is ready to use.
+type Server struct {
+	Lang string // Language of error messages, empty for the default.
+
+	mu      sync.Mutex
+	clients map[*client]bool
+	last    []byte // Latest track or error message, for new clients.
+}
+
+// A client is a connected WebSocket client.
+type client struct {
+	send chan frame
+	once sync.Once
+}
+
+// close stops sending to the client.
+func (c *client) close() {
+	c.once.Do(func() { close(c.send) })
+}
+
+// ServeHTTP connects WebSocket clients, and serves the page to others.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !isUpgrade(r) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(page))
+		return
+	}
+	conn, rw, err := upgrade(w, r)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	c := &client{send: make(chan frame, clientBuffer)}
+	s.mu.Lock()
+	if s.clients == nil {
+		s.clients = map[*client]bool{}
+	}
+	s.clients[c] = true
+	if s.last != nil {
+		c.send <- frame{opText, s.last}
+	}
+	s.mu.Unlock()
+	defer s.remove(c)
+
+	// Read control frames until the client leaves.
+	go func() {
+		defer s.remove(c)
+		for {
+			f, err := readFrame(rw)
+			if err != nil {
+				return
+			}
+			switch f.op {
+			case opClose:
+				s.trySend(c, frame{opClose, nil})
+				return
+			case opPing:
+				s.trySend(c, frame{opPong, f.payload})
+			}
+		}
+	}()
+
+	for f := range c.send {
+		if err := writeFrame(conn, f); err != nil || f.op == opClose {
+			return
+		}
+	}
+}
+
+// remove disconnects a client.
+func (s *Server) remove(c *client) {
+	s.mu.Lock()
+	delete(s.clients, c)
+	s.mu.Unlock()
+	c.close()
+}
+
+// trySend sends a frame to a client if it is still connected and keeping up.
+func (s *Server) trySend(c *client, f frame) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.clients[c] {
+		select {
+		case c.send <- f:
+		default:
+		}
+	}
+}
+
+// broadcast sends a message to all clients. If keep is true, the message is
+// also sent to clients that connect later.
+func (s *Server) broadcast(m *Message, keep bool) {
+	b, err := json.Marshal(m)
+	if err != nil {
+		panic(err) // Messages always encode.
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if keep {
+		s.last = b
+	}
+	for c := range s.clients {
+		select {
+		case c.send <- frame{opText, b}:
+		default:
+			delete(s.clients, c)
+			c.close()
+		}
+	}
+}
+
+// Track sends a new version of the track to all clients.
+func (s *Server) Track(t *beatnik.Track) error {
+	b, err := t.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	s.broadcast(&Message{Type: "track", MIDI: b, BPM: t.TempoMap().BPM(0),
+		Bars: t.Bars()}, true)
+	return nil
+}
+
+// Error sends the errors that failed the compilation of the track to all
+// clients, one message per problem.
+func (s *Server) Error(err error) {
+	lang := s.Lang
+	if lang == "" {
+		lang = beatnik.DefaultLanguage
+	}
+	errs := []error{err}
+	if list, ok := err.(beatnik.ErrorList); ok {
+		errs = list
+	}
+	m := &Message{Type: "error"}
+	for _, e := range errs {
+		m.Errors = append(m.Errors, beatnik.Localize(e, lang))
+	}
+	s.broadcast(m, true)
+}
+
+// Position sends the playback position to all clients.
+func (s *Server) Position(tick uint, bar int, at time.Duration) {
+	s.broadcast(&Message{Type: "position", Tick: tick, Bar: bar,
+		Millis: int64(at / time.Millisecond)}, false)
+}
+
+// Sink returns an event sink that passes the events of playing t to sink, and
+// sends the playback position to the server's clients with each event. sink
+// may be nil, for following the position without playing.
+func (s *Server) Sink(sink beatnik.EventSink, t *beatnik.Track) beatnik.EventSink {
+	return &positionSink{s: s, sink: sink, tl: beatnik.NewTimeline(t)}
+}
+
+// A positionSink sends the position of the events that pass through it.
+type positionSink struct {
+	s    *Server
+	sink beatnik.EventSink
+	tl   *beatnik.Timeline
+	last time.Duration // Time of the last position sent.
+	sent bool          // A position was sent.
+}
+
+// Event sends the position of the event if it was not sent yet, and passes
+// the event on.
+func (p *positionSink) Event(at time.Duration, data []byte) error {
+	if !p.sent || at != p.last {
+		tick := p.tl.Tick(at)
+		bar, _ := p.tl.Bar(tick)
+		p.s.Position(tick, bar, at)
+		p.last, p.sent = at, true
+	}
+	if p.sink == nil {
+		return nil
+	}
+	return p.sink.Event(at, data)
+}
+
+// Close disconnects all clients.
+func (s *Server) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.clients {
+		delete(s.clients, c)
+		c.close()
+	}
+}
+
+// page shows the messages of the server.
+const page = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>beatnik live</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+#errors { color: #b00; white-space: pre; }
+#bar { font-size: 4em; }
+</style>
+</head>
+<body>
+<div id="status">connecting...</div>
+<div id="track"></div>
+<div id="bar"></div>
+<div id="errors"></div>
+<script>
+var ws = new WebSocket((location.protocol == "https:" ? "wss://" : "ws://") +
+    location.host + location.pathname);
+function show(id, text) { document.getElementById(id).textContent = text; }
+ws.onopen = function() { show("status", "connected"); };
+ws.onclose = function() { show("status", "disconnected"); };
+ws.onmessage = function(e) {
+  var m = JSON.parse(e.data);
+  if (m.type == "track") {
+    show("track", (m.bpm || 0) + " BPM, " + (m.bars || 0).toFixed(2) + " bars");
+    show("errors", "");
+  } else if (m.type == "error") {
+    show("errors", m.errors.join("\n"));
+  } else if (m.type == "position") {
+    show("bar", "bar " + ((m.bar || 0) + 1));
+  }
+};
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,146 @@
+package live
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fluhus/beatnik"
+)
+
+func TestServer(t *testing.T) {
+	s := &Server{}
+	hs := httptest.NewServer(s)
+	defer hs.Close()
+
+	tr, err := beatnik.ParseTrack("bpm:100 K S K S")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Track(tr); err != nil {
+		t.Fatalf("Track() failed: %v", err)
+	}
+
+	// New clients get the last track.
+	conn, r := dial(t, hs.URL)
+	defer conn.Close()
+	m := readMessage(t, r)
+	if m.Type != "track" || m.BPM != 100 || m.Bars != 1 {
+		t.Errorf("message=%+v, want a 100 BPM track of 1 bar", m)
+	}
+	want, _ := tr.MarshalBinary()
+	if !bytes.Equal(m.MIDI, want) {
+		t.Errorf("message MIDI=%v, want %v", m.MIDI, want)
+	}
+
+	_, err = beatnik.ParseTrack("K X")
+	s.Error(err)
+	if m := readMessage(t, r); m.Type != "error" || len(m.Errors) != 1 ||
+		!strings.Contains(m.Errors[0], "X") {
+		t.Errorf("message=%+v, want an error about X", m)
+	}
+
+	sink := s.Sink(nil, tr)
+	sink.Event(1200*time.Millisecond, []byte{0x99, 36, 115})
+	if m := readMessage(t, r); m.Type != "position" || m.Tick != 192 ||
+		m.Bar != 0 || m.Millis != 1200 {
+		t.Errorf("message=%+v, want position at tick 192", m)
+	}
+
+	// Clients that leave are removed.
+	writeMasked(conn, frame{opClose, nil})
+	if f, err := readFrame(r); err != nil || f.op != opClose {
+		t.Errorf("readFrame()=%v,%v, want a close frame", f, err)
+	}
+	n := -1
+	for i := 0; i < 100 && n != 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+		s.mu.Lock()
+		n = len(s.clients)
+		s.mu.Unlock()
+	}
+	if n != 0 {
+		t.Errorf("server has %v clients after close, want 0", n)
+	}
+}
+
+func TestServer_page(t *testing.T) {
+	hs := httptest.NewServer(&Server{})
+	defer hs.Close()
+	resp, err := http.Get(hs.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(b),
+		"WebSocket") {
+		t.Errorf("GET / returned %v, want the page", resp.Status)
+	}
+}
+
+func TestAcceptKey(t *testing.T) {
+	// Example from RFC 6455.
+	got := acceptKey("dGhlIHNhbXBsZSBub25jZQ==")
+	if want := "s3pPLMBiTxaQ9kYGzzhZRbK+xOo="; got != want {
+		t.Errorf("acceptKey()=%q, want %q", got, want)
+	}
+}
+
+// dial connects to a test server as a WebSocket client.
+func dial(t *testing.T, url string) (net.Conn, *bufio.Reader) {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: test\r\n"+
+		"Connection: Upgrade\r\nUpgrade: websocket\r\n"+
+		"Sec-WebSocket-Version: 13\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n")
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols ||
+		resp.Header.Get("Sec-WebSocket-Accept") !=
+			"s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("handshake response: %v %v", resp.Status, resp.Header)
+	}
+	return conn, r
+}
+
+// readMessage reads a message frame.
+func readMessage(t *testing.T, r *bufio.Reader) *Message {
+	f, err := readFrame(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.op != opText {
+		t.Fatalf("frame opcode=%v, want %v", f.op, opText)
+	}
+	m := &Message{}
+	if err := json.Unmarshal(f.payload, m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// writeMasked writes a masked frame, as clients send them.
+func writeMasked(conn net.Conn, f frame) {
+	mask := []byte{1, 2, 3, 4}
+	b := []byte{0x80 | f.op, 0x80 | byte(len(f.payload))}
+	b = append(b, mask...)
+	for i, c := range f.payload {
+		b = append(b, c^mask[i%4])
+	}
+	conn.Write(b)
+}
@@ -0,0 +1,110 @@
+package beatnik
+
+// Loop points for samplers and game engines.
+
+import (
+	"strings"
+)
+
+// loopCC is the controller whose events mark where a track loops from, as
+// RPG Maker started and many game engines and samplers follow.
+const loopCC = 111
+
+// Texts of the markers of loop points, which game middleware reads.
+const (
+	loopStartMarker = "loopStart"
+	loopEndMarker   = "loopEnd"
+)
+
+// Loop points of a track that is being parsed.
+type loopPoints struct {
+	start, end       uint // Ticks of the points.
+	hasStart, hasEnd bool
+}
+
+// loopStartDirective marks where the track loops from, as in "loopstart:".
+// The value says how: "marker" for a loopStart marker, "cc" for a controller
+// 111 event, and empty for both.
+func loopStartDirective(p *parser, s string, at DirectiveContext) error {
+	marker, cc, ok := loopKinds(s)
+	if !ok {
+		return newError(CodeBadLoop, s)
+	}
+	if p.loop.hasStart {
+		return newError(CodeDuplicateLoop, "loopstart", p.loop.start)
+	}
+	if p.loop.hasEnd {
+		return newError(CodeLoopOrder, p.loop.end, at.Tick)
+	}
+	p.loop.start, p.loop.hasStart = at.Tick, true
+	if marker {
+		p.t.Meta = append(p.t.Meta, &Meta{at.Tick, MetaMarker,
+			[]byte(loopStartMarker)})
+	}
+	if cc {
+		p.t.Controls = append(p.t.Controls, &Control{at.Tick, loopCC, 0,
+			ControlChange})
+	}
+	return nil
+}
+
+// loopEndDirective marks where the track loops back, as in "loopend:", with
+// a loopEnd marker. Controller 111 has no end, since players that follow it
+// loop at the end of the track, so the value may only be empty or "marker".
+func loopEndDirective(p *parser, s string, at DirectiveContext) error {
+	if s != "" && s != "marker" {
+		return newError(CodeBadLoop, s)
+	}
+	if p.loop.hasEnd {
+		return newError(CodeDuplicateLoop, "loopend", p.loop.end)
+	}
+	if p.loop.hasStart && at.Tick <= p.loop.start || at.Tick == 0 {
+		return newError(CodeLoopOrder, at.Tick, p.loop.start)
+	}
+	p.loop.end, p.loop.hasEnd = at.Tick, true
+	p.t.Meta = append(p.t.Meta, &Meta{at.Tick, MetaMarker,
+		[]byte(loopEndMarker)})
+	return nil
+}
+
+// loopKinds returns the kinds of loop start events that a loopstart value asks
+// for. Returns false if the value is bad.
+func loopKinds(s string) (marker, cc, ok bool) {
+	switch s {
+	case "":
+		return true, true, true
+	case "marker":
+		return true, false, true
+	case "cc":
+		return false, true, true
+	}
+	return false, false, false
+}
+
+// describeLoop returns a description of the events of a loop directive's
+// value, for explanations.
+func describeLoop(name, s string) string {
+	if name == "loopend" {
+		return "a marker"
+	}
+	marker, cc, _ := loopKinds(s)
+	var parts []string
+	if marker {
+		parts = append(parts, "a marker")
+	}
+	if cc {
+		parts = append(parts, "controller 111")
+	}
+	return strings.Join(parts, " and ")
+}
+
+// isLoopPoint returns true if the meta event marks a loop point.
+func (m *Meta) isLoopPoint() bool {
+	return m.Type == MetaMarker && (string(m.Data) == loopStartMarker ||
+		string(m.Data) == loopEndMarker)
+}
+
+// isLoopPoint returns true if the control event marks a loop start.
+func (c *Control) isLoopPoint() bool {
+	return c.Kind == ControlChange && c.Number == loopCC
+}
@@ -0,0 +1,78 @@
+package beatnik
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestLoop(t *testing.T) {
+	tests := []struct {
+		src      string
+		markers  []string
+		controls []*Control
+	}{
+		{"K loopstart: K S loopend: K",
+			[]string{"96:loopStart", "288:loopEnd"},
+			[]*Control{{96, loopCC, 0, ControlChange}}},
+		{"K loopstart:marker K loopend:marker", []string{"96:loopStart",
+			"192:loopEnd"}, nil},
+		{"K loopstart:cc K", nil, []*Control{{96, loopCC, 0, ControlChange}}},
+		{"loopstart: K loopend:", []string{"0:loopStart", "96:loopEnd"},
+			[]*Control{{0, loopCC, 0, ControlChange}}},
+		{"K K loopend:", []string{"192:loopEnd"}, nil},
+		{"section:a K loopstart: S play:a", []string{"0:a", "96:loopStart",
+			"192:a"}, []*Control{{96, loopCC, 0, ControlChange}}},
+	}
+	for _, test := range tests {
+		tr := mustParse(t, test.src)
+		var markers []string
+		for _, m := range tr.sortedMeta() {
+			markers = append(markers, fmt.Sprintf("%v:%s", m.T, m.Data))
+		}
+		if !reflect.DeepEqual(markers, test.markers) {
+			t.Errorf("ParseTrack(%q) markers=%v, want %v", test.src, markers,
+				test.markers)
+		}
+		if !reflect.DeepEqual(tr.Controls, test.controls) {
+			t.Errorf("ParseTrack(%q) controls=%v, want %v", test.src,
+				tr.Controls, test.controls)
+		}
+	}
+}
+
+func TestLoop_encode(t *testing.T) {
+	tr := mustParse(t, "bpm:120 K loopstart: K loopend:")
+	b, err := tr.Encode(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(b, []byte{0xB9, loopCC, 0}) {
+		t.Errorf("Encode()=%v, want controller 111", b)
+	}
+	if !bytes.Contains(b, append([]byte{0xFF, MetaMarker, 7}, "loopEnd"...)) {
+		t.Errorf("Encode()=%v, want a loopEnd marker", b)
+	}
+}
+
+func TestLoop_bad(t *testing.T) {
+	tests := []struct {
+		src  string
+		want Code
+	}{
+		{"loopstart:x", CodeBadLoop},
+		{"K loopend:cc", CodeBadLoop},
+		{"loopstart: K loopstart:", CodeDuplicateLoop},
+		{"K loopend: K loopend:", CodeDuplicateLoop},
+		{"K loopend: K loopstart:", CodeLoopOrder},
+		{"K loopstart: loopend:", CodeLoopOrder},
+		{"loopend: K", CodeLoopOrder},
+	}
+	for _, test := range tests {
+		_, err := ParseTrack(test.src)
+		if e, ok := err.(*Error); !ok || e.Code != test.want {
+			t.Errorf("ParseTrack(%q)=%v, want %v", test.src, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,364 @@
+// Package lsp is a language server for beatnik scores, for live feedback in
+// editors like VS Code and Neovim.
+//
+// The server speaks the Language Server Protocol over a pair of streams,
+// usually the editor's pipes to the process. It reports parse errors and lint
+// warnings as diagnostics whenever a document changes, describes the token
+// under the cursor on hover, and completes directives, drum names and the
+// document's aliases.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/fluhus/beatnik"
+)
+
+// A Server serves a single editor session.
+type Server struct {
+	Lang string // Language of diagnostic messages, default is English.
+
+	docs map[string]string // Open documents' text by URI.
+	out  io.Writer
+}
+
+// Serve reads requests from r and writes responses and notifications to w,
+// until the editor sends an exit notification or r ends.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	s.docs = map[string]string{}
+	s.out = w
+	br := bufio.NewReader(r)
+	for {
+		body, err := readMessage(br)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		req := &request{}
+		if err := json.Unmarshal(body, req); err != nil {
+			if err := s.reply(nil, nil, &responseError{codeParseError,
+				err.Error()}); err != nil {
+				return err
+			}
+			continue
+		}
+		if req.Method == "exit" {
+			return nil
+		}
+		result, rerr := s.handle(req)
+		if req.ID == nil {
+			continue // Notifications have no reply.
+		}
+		if err := s.reply(req.ID, result, rerr); err != nil {
+			return err
+		}
+	}
+}
+
+// handle runs a single request or notification. Returns the result of the
+// request, or an error.
+func (s *Server) handle(req *request) (interface{}, *responseError) {
+	var params struct {
+		TextDocument struct {
+			URI  string `json:"uri"`
+			Text string `json:"text"`
+		} `json:"textDocument"`
+		ContentChanges []struct {
+			Text string `json:"text"`
+		} `json:"contentChanges"`
+		Position position `json:"position"`
+	}
+	if len(req.Params) > 0 {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, &responseError{codeInvalidParams, err.Error()}
+		}
+	}
+	uri := params.TextDocument.URI
+
+	switch req.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync": 1, // Full text on every change.
+				"hoverProvider":    true,
+				"completionProvider": map[string]interface{}{
+					"triggerCharacters": []string{","},
+				},
+			},
+			"serverInfo": map[string]string{"name": "beatnik"},
+		}, nil
+	case "shutdown":
+		return nil, nil
+	case "textDocument/didOpen":
+		s.docs[uri] = params.TextDocument.Text
+		s.publish(uri)
+	case "textDocument/didChange":
+		if n := len(params.ContentChanges); n > 0 {
+			s.docs[uri] = params.ContentChanges[n-1].Text
+			s.publish(uri)
+		}
+	case "textDocument/didClose":
+		delete(s.docs, uri)
+		s.notify("textDocument/publishDiagnostics", map[string]interface{}{
+			"uri": uri, "diagnostics": []diagnostic{}})
+	case "textDocument/hover":
+		return s.hover(s.docs[uri], params.Position), nil
+	case "textDocument/completion":
+		return complete(s.docs[uri], params.Position), nil
+	default:
+		if req.ID != nil {
+			return nil, &responseError{codeMethodNotFound,
+				"unsupported method: " + req.Method}
+		}
+	}
+	return nil, nil
+}
+
+// reply writes the response to a request.
+func (s *Server) reply(id *json.RawMessage, result interface{},
+	rerr *responseError) error {
+	resp := &response{JSONRPC: "2.0", ID: id, Error: rerr}
+	if rerr == nil {
+		b, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		resp.Result = b
+	}
+	return writeMessage(s.out, resp)
+}
+
+// notify writes a notification.
+func (s *Server) notify(method string, params interface{}) error {
+	return writeMessage(s.out, &notification{"2.0", method, params})
+}
+
+// A position is a zero-based line and UTF-16 offset in a document.
+type position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// A span is a range in a document.
+type span struct {
+	Start position `json:"start"`
+	End   position `json:"end"`
+}
+
+// A diagnostic is a problem in a document.
+type diagnostic struct {
+	Range    span   `json:"range"`
+	Severity int    `json:"severity"`
+	Code     string `json:"code"`
+	Source   string `json:"source"`
+	Message  string `json:"message"`
+}
+
+// Diagnostic severities.
+const (
+	severityError   = 1
+	severityWarning = 2
+)
+
+// publish sends the diagnostics of a document: its parse errors, or its lint
+// warnings if it parses.
+func (s *Server) publish(uri string) error {
+	src := s.docs[uri]
+	lines := strings.Split(src, "\n")
+	diags := []diagnostic{}
+	add := func(err error, severity int) {
+		d := diagnostic{Severity: severity, Source: "beatnik"}
+		line, col := 1, 1
+		if e, ok := err.(*beatnik.Error); ok {
+			if e.Line > 0 {
+				line, col = e.Line, e.Col
+			}
+			e2 := *e
+			e2.File, e2.Line = "", 0
+			d.Code, d.Message = string(e.Code), e2.Localize(s.Lang)
+		} else {
+			d.Message = beatnik.Localize(err, s.Lang)
+		}
+		d.Range = tokenSpan(lines, line, col)
+		diags = append(diags, d)
+	}
+
+	t, errs := beatnik.ParseTrackAll(src)
+	for _, err := range errs {
+		add(err, severityError)
+	}
+	if len(errs) == 0 {
+		for _, d := range beatnik.Lint(t, src) {
+			add(d.Error, severityWarning)
+		}
+	}
+	return s.notify("textDocument/publishDiagnostics", map[string]interface{}{
+		"uri": uri, "diagnostics": diags})
+}
+
+// hover returns the description of the token at the given position, or nil
+// if there is none.
+func (s *Server) hover(src string, pos position) interface{} {
+	lines := strings.Split(src, "\n")
+	line, col := fromLSP(lines, pos)
+	expls, _ := beatnik.Explain(src)
+	for _, e := range expls {
+		n := utf8.RuneCountInString(e.Token)
+		if e.Line != line || col < e.Col || col >= e.Col+n {
+			continue
+		}
+		return map[string]interface{}{
+			"contents": map[string]string{
+				"kind":  "markdown",
+				"value": fmt.Sprintf("`%s` %s", e.Token, e.Meaning),
+			},
+			"range": tokenSpan(lines, e.Line, e.Col),
+		}
+	}
+	return nil
+}
+
+// A completionItem is a suggestion for the text at the cursor.
+type completionItem struct {
+	Label  string `json:"label"`
+	Kind   int    `json:"kind"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Completion item kinds.
+const (
+	kindVariable = 6
+	kindKeyword  = 14
+	kindConstant = 21
+)
+
+// complete returns the completions of the word at the given position:
+// directives at the start of a token, and drum names and aliases in hits.
+func complete(src string, pos position) []completionItem {
+	lines := strings.Split(src, "\n")
+	line, col := fromLSP(lines, pos)
+	word := ""
+	if line <= len(lines) {
+		runes := []rune(lines[line-1])
+		if col-1 <= len(runes) {
+			runes = runes[:col-1]
+		}
+		i := len(runes)
+		for i > 0 && !unicode.IsSpace(runes[i-1]) {
+			i--
+		}
+		word = string(runes[i:])
+	}
+	if strings.ContainsAny(word, ":#") {
+		return []completionItem{}
+	}
+
+	result := []completionItem{}
+	prefix := strings.TrimPrefix(word, "(")
+	if i := strings.LastIndexByte(prefix, ','); i != -1 {
+		prefix = prefix[i+1:]
+	} else {
+		for _, name := range beatnik.Directives() {
+			if strings.HasPrefix(name, prefix) {
+				result = append(result, completionItem{Label: name + ":",
+					Kind: kindKeyword})
+			}
+		}
+	}
+	notes := beatnik.Kits["ezdrummer"].Notes
+	var names []string
+	for name := range notes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix) {
+			result = append(result, completionItem{name, kindConstant,
+				fmt.Sprintf("drum %v", notes[name])})
+		}
+	}
+	for _, a := range aliases(src) {
+		if strings.HasPrefix(a[0], prefix) {
+			result = append(result, completionItem{a[0], kindVariable,
+				"alias of " + a[1]})
+		}
+	}
+	return result
+}
+
+// aliases returns the names and values of the aliases that the source
+// defines.
+func aliases(src string) [][2]string {
+	var result [][2]string
+	l := beatnik.NewLexer(strings.NewReader(src))
+	for {
+		tok, err := l.Next()
+		if err == io.EOF {
+			break
+		}
+		if tok.Kind != beatnik.TokenDirective ||
+			!strings.HasPrefix(tok.Text, "alias:") {
+			continue
+		}
+		if i := strings.IndexByte(tok.Text, '='); i != -1 {
+			result = append(result, [2]string{tok.Text[len("alias:"):i],
+				tok.Text[i+1:]})
+		}
+	}
+	return result
+}
+
+// tokenSpan returns the span of the token at the given 1-based line and
+// column in runes.
+func tokenSpan(lines []string, line, col int) span {
+	end := col
+	if line <= len(lines) {
+		runes := []rune(lines[line-1])
+		for end-1 < len(runes) && !unicode.IsSpace(runes[end-1]) {
+			end++
+		}
+	}
+	return span{toLSP(lines, line, col), toLSP(lines, line, end)}
+}
+
+// toLSP converts a 1-based line and column in runes to a position.
+func toLSP(lines []string, line, col int) position {
+	pos := position{Line: line - 1}
+	if line > len(lines) {
+		return pos
+	}
+	for i, r := range []rune(lines[line-1]) {
+		if i >= col-1 {
+			break
+		}
+		pos.Character += len(utf16.Encode([]rune{r}))
+	}
+	return pos
+}
+
+// fromLSP converts a position to a 1-based line and column in runes.
+func fromLSP(lines []string, pos position) (line, col int) {
+	line, col = pos.Line+1, 1
+	if line > len(lines) {
+		return line, col
+	}
+	units := 0
+	for _, r := range lines[line-1] {
+		if units >= pos.Character {
+			break
+		}
+		units += len(utf16.Encode([]rune{r}))
+		col++
+	}
+	return line, col
+}
@@ -0,0 +1,93 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestServer(t *testing.T) {
+	in := &bytes.Buffer{}
+	send := func(id int, method string, params interface{}) {
+		m := map[string]interface{}{"jsonrpc": "2.0", "method": method,
+			"params": params}
+		if id != 0 {
+			m["id"] = id
+		}
+		b, _ := json.Marshal(m)
+		fmt.Fprintf(in, "Content-Length: %d\r\n\r\n%s", len(b), b)
+	}
+	doc := map[string]string{"uri": "file:///a.bk"}
+	send(1, "initialize", map[string]interface{}{})
+	send(0, "initialized", map[string]interface{}{})
+	send(0, "textDocument/didOpen", map[string]interface{}{"textDocument": map[string]string{
+		"uri": "file:///a.bk", "text": "alias:Бочка=K\nБочка S X"}})
+	send(0, "textDocument/didChange", map[string]interface{}{
+		"textDocument": doc, "contentChanges": []map[string]string{
+			{"text": "alias:Бочка=K\nБочка S+"}}})
+	send(2, "textDocument/hover", map[string]interface{}{
+		"textDocument": doc, "position": map[string]int{"line": 1,
+			"character": 6}})
+	send(3, "textDocument/completion", map[string]interface{}{
+		"textDocument": doc, "position": map[string]int{"line": 1,
+			"character": 3}})
+	send(4, "foo", nil)
+	send(5, "shutdown", nil)
+	send(0, "exit", nil)
+
+	out := &bytes.Buffer{}
+	if err := (&Server{}).Serve(in, out); err != nil {
+		t.Fatalf("Serve() failed: %v", err)
+	}
+	var msgs []string
+	r := bufio.NewReader(out)
+	for {
+		b, err := readMessage(r)
+		if err != nil {
+			break
+		}
+		msgs = append(msgs, string(b))
+	}
+
+	wants := []string{
+		`"id":1,"result":{"capabilities":`,
+		`"diagnostics":[{"range":{"start":{"line":1,"character":8},` +
+			`"end":{"line":1,"character":9}},"severity":1,"code":"bad-drum",` +
+			`"source":"beatnik","message":"bad drum number: \"X\""}]`,
+		`"diagnostics":[]`,
+		`"id":2,"result":{"contents":{"kind":"markdown","value":` +
+			"\"`S+` S (38) fortissimo, 1/4 bar",
+		`"id":3,"result":[{"label":"Бочка","kind":6,"detail":"alias of K"}]`,
+		`"id":4,"error":{"code":-32601`,
+		`"id":5,"result":null`,
+	}
+	if len(msgs) != len(wants) {
+		t.Fatalf("Serve() wrote %v messages, want %v: %v", len(msgs),
+			len(wants), msgs)
+	}
+	for i, want := range wants {
+		if !strings.Contains(msgs[i], want) {
+			t.Errorf("message %v=%s, want %s", i+1, msgs[i], want)
+		}
+	}
+}
+
+func TestComplete(t *testing.T) {
+	got := complete("bpm:90\nK,H", position{1, 3})
+	for _, c := range got {
+		if !strings.HasPrefix(c.Label, "H") || c.Kind != kindConstant {
+			t.Errorf("complete()=%v, want only drums that start with H", got)
+			break
+		}
+	}
+	if len(got) == 0 {
+		t.Errorf("complete()=%v, want hi-hats", got)
+	}
+	got = complete("f", position{0, 1})
+	if len(got) != 1 || got[0].Label != "fill:" {
+		t.Errorf("complete(f)=%v, want fill:", got)
+	}
+}
@@ -0,0 +1,226 @@
+package beatnik
+
+// Combining simultaneous hits and overlaying tracks.
+
+import (
+	"fmt"
+	"sort"
+)
+
+// A MergeStrategy decides the velocity of a note that is struck by two hits
+// that are combined into one, for example when overlaying tracks.
+type MergeStrategy int
+
+// Merge strategies.
+const (
+	MergeMax   MergeStrategy = iota // Keep the louder velocity.
+	MergeSum                        // Sum the velocities, clamped to 127.
+	MergeLeft                       // Keep the velocity of the first hit.
+	MergeError                      // Fail with an error.
+)
+
+// String returns the name of the strategy.
+func (s MergeStrategy) String() string {
+	switch s {
+	case MergeMax:
+		return "max"
+	case MergeSum:
+		return "sum"
+	case MergeLeft:
+		return "left"
+	case MergeError:
+		return "error"
+	}
+	return fmt.Sprintf("MergeStrategy(%d)", int(s))
+}
+
+// resolve returns the velocity of a note that is struck with velocity a by
+// the first hit and b by the second.
+func (s MergeStrategy) resolve(note byte, a, b Velocity) (Velocity, error) {
+	switch s {
+	case MergeMax:
+		if b > a {
+			return b, nil
+		}
+		return a, nil
+	case MergeSum:
+		if int(a)+int(b) > 127 {
+			return 127, nil
+		}
+		return a + b, nil
+	case MergeLeft:
+		return a, nil
+	case MergeError:
+		return 0, newError(CodeMergeConflict, note)
+	}
+	return 0, fmt.Errorf("unknown merge strategy: %v", s)
+}
+
+// Merge adds the notes, timing offsets, chances and annotations of other to h.
+// Notes that both hits strike are resolved using s, and keep h's chance.
+// Offsets and annotations that both hits have keep h's value. The duration of
+// h is unchanged. On error, h is left unchanged.
+func (h *Hit) Merge(other *Hit, s MergeStrategy) error {
+	notes := make(map[byte]Velocity, len(h.Notes)+len(other.Notes))
+	for n, v := range h.Notes {
+		notes[n] = v
+	}
+	for n, v := range other.Notes {
+		if old, ok := notes[n]; ok {
+			var err error
+			v, err = s.resolve(n, old, v)
+			if err != nil {
+				return err
+			}
+		}
+		notes[n] = v
+	}
+	prev := h.Notes
+	h.Notes = notes
+
+	for n, off := range other.Offsets {
+		if h.Offsets == nil {
+			h.Offsets = map[byte]int{}
+		}
+		if _, ok := h.Offsets[n]; !ok {
+			h.Offsets[n] = off
+		}
+	}
+	for n, c := range other.Chances {
+		if _, ok := prev[n]; ok {
+			continue // Keep h's chance, which may be to always play.
+		}
+		if h.Chances == nil {
+			h.Chances = map[byte]int{}
+		}
+		h.Chances[n] = c
+	}
+	for k, v := range other.Annotations {
+		if h.Annotations == nil {
+			h.Annotations = map[string]string{}
+		}
+		if _, ok := h.Annotations[k]; !ok {
+			h.Annotations[k] = v
+		}
+	}
+	return nil
+}
+
+// Merge overlays two tracks, so that hits that start on the same tick become
+// a single hit. Notes that both tracks strike on the same tick keep the louder
+// velocity. Fails if the tracks have different tempos.
+func Merge(a, b *Track) (*Track, error) {
+	return MergeWith(a, b, MergeMax)
+}
+
+// MergeWith overlays two tracks like Merge, resolving notes that both tracks
+// strike on the same tick using s. The result has a's tempo and time
+// signature, or b's if a has none, and the meta events of both.
+func MergeWith(a, b *Track, s MergeStrategy) (*Track, error) {
+	tempo, bt := a.TempoMap(), b.TempoMap()
+	if x, y, ok := tempo.diff(bt); ok && x != 0 && y != 0 {
+		return nil, newError(CodeTempoMismatch, x, y)
+	}
+	if len(tempo.changes) == 0 {
+		tempo = bt
+	}
+	result := &Track{TimeSig: a.TimeSig}
+	if result.TimeSig == (TimeSig{}) {
+		result.TimeSig = b.TimeSig
+	}
+
+	// Combine hits that start on the same tick.
+	onsets := append(a.onsets(), b.onsets()...)
+	sort.SliceStable(onsets, func(i, j int) bool {
+		return onsets[i].t < onsets[j].t
+	})
+	var ticks []uint
+	for _, o := range onsets {
+		if len(ticks) > 0 && ticks[len(ticks)-1] == o.t {
+			if err := result.Hits[len(result.Hits)-1].Merge(o.h, s); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		ticks = append(ticks, o.t)
+		result.Hits = append(result.Hits, o.h.copy())
+	}
+
+	// Set durations by the next hit's start.
+	end := a.ticks()
+	if bt := b.ticks(); bt > end {
+		end = bt
+	}
+	for i, h := range result.Hits {
+		next := end
+		if i < len(ticks)-1 {
+			next = ticks[i+1]
+		}
+		h.T = next - ticks[i]
+	}
+	if len(ticks) == 0 && end > 0 {
+		result.Hits = []*Hit{{T: end}}
+	} else if len(ticks) > 0 && ticks[0] > 0 {
+		result.Hits = append([]*Hit{{T: ticks[0]}}, result.Hits...)
+	}
+
+	for _, m := range append(a.sortedMeta(), b.sortedMeta()...) {
+		if m.Type != MetaTempo {
+			result.Meta = append(result.Meta, m.copy())
+		}
+	}
+	result.SetTempoMap(tempo)
+	result.Meta = result.sortedMeta()
+	for _, c := range append(a.sortedControls(), b.sortedControls()...) {
+		c2 := *c
+		result.Controls = append(result.Controls, &c2)
+	}
+	result.Controls = result.sortedControls()
+	return result, nil
+}
+
+// MergeNotes overlays tracks that were split by SplitByNote, in ascending order
+// of their notes, using Merge. Since the split tracks share their meta and
+// control events, only those of the lowest note's track are kept. Fails if
+// the tracks have different tempos.
+func MergeNotes(tracks map[byte]*Track) (*Track, error) {
+	notes := make([]int, 0, len(tracks))
+	for n := range tracks {
+		notes = append(notes, int(n))
+	}
+	sort.Ints(notes)
+	result := &Track{}
+	for i, n := range notes {
+		t := tracks[byte(n)]
+		if i > 0 {
+			u := &Track{Hits: t.Hits, TimeSig: t.TimeSig}
+			u.SetTempoMap(t.TempoMap())
+			t = u
+		}
+		var err error
+		if result, err = Merge(result, t); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// An onset is a hit with its absolute start tick.
+type onset struct {
+	t uint
+	h *Hit
+}
+
+// onsets returns the hits of the track that have notes, with their start
+// ticks.
+func (t *Track) onsets() []onset {
+	var result []onset
+	var tick uint
+	for _, h := range t.Hits {
+		if !h.IsRest() {
+			result = append(result, onset{tick, h})
+		}
+		tick += h.T
+	}
+	return result
+}
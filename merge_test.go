@@ -0,0 +1,130 @@
+package beatnik
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHitMerge(t *testing.T) {
+	tests := []struct {
+		s    MergeStrategy
+		want map[byte]Velocity
+	}{
+		{MergeMax, map[byte]Velocity{36: F, 38: FF, 42: P}},
+		{MergeSum, map[byte]Velocity{36: F, 38: 127, 42: P}},
+		{MergeLeft, map[byte]Velocity{36: F, 38: MP, 42: P}},
+	}
+	for _, test := range tests {
+		a := &Hit{Notes: map[byte]Velocity{36: F, 38: MP}, T: 96,
+			Annotations: map[string]string{"a": "1"}}
+		b := &Hit{Notes: map[byte]Velocity{38: FF, 42: P}, T: 48,
+			Annotations: map[string]string{"a": "2", "b": "3"}}
+		if err := a.Merge(b, test.s); err != nil {
+			t.Errorf("Merge(%v) failed: %v", test.s, err)
+			continue
+		}
+		want := &Hit{Notes: test.want, T: 96,
+			Annotations: map[string]string{"a": "1", "b": "3"}}
+		if !reflect.DeepEqual(a, want) {
+			t.Errorf("Merge(%v)=%v, want %v", test.s, a, want)
+		}
+	}
+}
+
+func TestHitMerge_error(t *testing.T) {
+	a := &Hit{Notes: map[byte]Velocity{36: F, 38: MP}, T: 96}
+	b := &Hit{Notes: map[byte]Velocity{38: FF}, T: 96}
+	if err := a.Merge(b, MergeError); err == nil {
+		t.Fatalf("Merge(MergeError) succeeded, want failure")
+	}
+	want := map[byte]Velocity{36: F, 38: MP}
+	if !reflect.DeepEqual(a.Notes, want) {
+		t.Errorf("Merge(MergeError) changed notes to %v, want %v", a.Notes, want)
+	}
+
+	c := &Hit{Notes: map[byte]Velocity{42: FF}, T: 96}
+	if err := a.Merge(c, MergeError); err != nil {
+		t.Errorf("Merge(MergeError) failed: %v", err)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	a, err := ParseTrack("bpm:100 marker:A K S. K. S")
+	if err != nil {
+		t.Fatalf("ParseTrack() failed: %v", err)
+	}
+	b, err := ParseTrack("HC. HC. HC+. HC. HC. marker:B HC.")
+	if err != nil {
+		t.Fatalf("ParseTrack() failed: %v", err)
+	}
+	want := &Track{
+		Hits: []*Hit{
+			{Notes: map[byte]Velocity{36: F, 22: F}, T: 48},
+			{Notes: map[byte]Velocity{22: F}, T: 48},
+			{Notes: map[byte]Velocity{38: F, 22: FF}, T: 48},
+			{Notes: map[byte]Velocity{36: F, 22: F}, T: 48},
+			{Notes: map[byte]Velocity{38: F, 22: F}, T: 48},
+			{Notes: map[byte]Velocity{22: F}, T: 48},
+		},
+		BPM: 100,
+		Meta: []*Meta{
+			{0, MetaMarker, []byte("A")},
+			{240, MetaMarker, []byte("B")},
+		},
+	}
+	got, err := Merge(a, b)
+	if err != nil {
+		t.Fatalf("Merge() failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Merge()=%v, want %v", got, want)
+	}
+}
+
+func TestMerge_rests(t *testing.T) {
+	a := &Track{Hits: []*Hit{{T: 96}, {Notes: map[byte]Velocity{36: F}, T: 96}}}
+	b := &Track{Hits: []*Hit{{T: 48}, {Notes: map[byte]Velocity{38: F}, T: 48}}}
+	want := []*Hit{
+		{T: 48},
+		{Notes: map[byte]Velocity{38: F}, T: 48},
+		{Notes: map[byte]Velocity{36: F}, T: 96},
+	}
+	got, err := Merge(a, b)
+	if err != nil {
+		t.Fatalf("Merge() failed: %v", err)
+	}
+	if !reflect.DeepEqual(got.Hits, want) {
+		t.Fatalf("Merge()=%v, want %v", got.Hits, want)
+	}
+}
+
+func TestMerge_errors(t *testing.T) {
+	a := &Track{Hits: []*Hit{{Notes: map[byte]Velocity{36: F}, T: 96}}, BPM: 100}
+	b := &Track{Hits: []*Hit{{Notes: map[byte]Velocity{36: F}, T: 96}}, BPM: 120}
+	if got, err := Merge(a, b); err == nil {
+		t.Errorf("Merge()=%v, want failure", got)
+	}
+	b.BPM = 100
+	if got, err := MergeWith(a, b, MergeError); err == nil {
+		t.Errorf("MergeWith(MergeError)=%v, want failure", got)
+	}
+	b.Meta = []*Meta{tempoMeta(48, 90)}
+	if got, err := Merge(a, b); err == nil {
+		t.Errorf("Merge()=%v, want failure", got)
+	}
+}
+
+func TestMerge_tempoMap(t *testing.T) {
+	a := &Track{Hits: []*Hit{{Notes: map[byte]Velocity{36: F}, T: 96}}, BPM: 120,
+		Meta: []*Meta{tempoMeta(0, 100), tempoMeta(48, 90)}}
+	b := &Track{Hits: []*Hit{{Notes: map[byte]Velocity{38: F}, T: 96}}, BPM: 100,
+		Meta: []*Meta{tempoMeta(48, 90)}}
+	got, err := Merge(a, b)
+	if err != nil {
+		t.Fatalf("Merge() failed: %v", err)
+	}
+	if got.BPM != 100 || !reflect.DeepEqual(got.Meta, []*Meta{tempoMeta(48, 90)}) {
+		t.Errorf("Merge()=%v BPM with %v, want 100 BPM with one tempo change",
+			got.BPM, got.Meta)
+	}
+}
@@ -0,0 +1,170 @@
+package beatnik
+
+// Validation of midi files.
+
+import (
+	"encoding/binary"
+)
+
+// ValidateMIDI checks that data is a well formed standard midi file: that its
+// header is valid and counts its tracks, that chunk lengths match their
+// contents, that running status follows a channel event, that every note-on
+// has a matching note-off in the same track, and that every track ends with
+// an end-of-track event. Returns all the problems found, as an ErrorList if
+// there are several, or nil if there are none. Problems are reported with
+// their byte offset in data.
+func ValidateMIDI(data []byte) error {
+	var errs []error
+	if len(data) < 14 || string(data[:4]) != "MThd" {
+		return newError(CodeBadMIDIHeader)
+	}
+	n := int64(binary.BigEndian.Uint32(data[4:]))
+	if n < 6 || 8+n > int64(len(data)) {
+		return newError(CodeBadMIDIHeader)
+	}
+	format := binary.BigEndian.Uint16(data[8:])
+	ntracks := int(binary.BigEndian.Uint16(data[10:]))
+	if format > 2 || binary.BigEndian.Uint16(data[12:]) == 0 {
+		errs = append(errs, newError(CodeBadMIDIHeader))
+	}
+
+	tracks := 0
+	pos := 8 + n
+	for pos < int64(len(data)) {
+		if pos+8 > int64(len(data)) {
+			errs = append(errs, newError(CodeTruncatedMIDI, len(data)))
+			break
+		}
+		typ := string(data[pos : pos+4])
+		n := int64(binary.BigEndian.Uint32(data[pos+4:]))
+		end := pos + 8 + n
+		if end > int64(len(data)) {
+			errs = append(errs, newError(CodeTruncatedMIDI, len(data)))
+			end = int64(len(data))
+		}
+		if typ == "MTrk" {
+			tracks++
+			errs = append(errs, checkTrackChunk(data[:end], pos)...)
+		}
+		pos = end
+	}
+	if tracks != ntracks {
+		errs = append(errs, newError(CodeTrackCount, ntracks, tracks))
+	}
+	return errorOf(errs)
+}
+
+// checkTrackChunk checks the events of the track chunk that starts at the
+// given offset and ends at the end of data.
+func checkTrackChunk(data []byte, start int64) []error {
+	var errs []error
+	var running byte           // Running status, 0 if none.
+	notes := map[[2]byte]int{} // Number of sounding notes by channel and note.
+	ended := false
+	pos := start + 8
+	for pos < int64(len(data)) {
+		if ended {
+			errs = append(errs, newError(CodeBadChunkLength, start,
+				len(data)-int(start)-8, pos-start-8))
+			break
+		}
+		evStart := pos
+		if _, ok := readUvarint(data, &pos); !ok {
+			return append(errs, newError(CodeBadMIDIEvent, evStart))
+		}
+		if pos >= int64(len(data)) {
+			return append(errs, newError(CodeBadMIDIEvent, evStart))
+		}
+		status := data[pos]
+		switch {
+		case status == 0xFF:
+			running = 0
+			if pos+1 >= int64(len(data)) {
+				return append(errs, newError(CodeBadMIDIEvent, evStart))
+			}
+			typ := data[pos+1]
+			pos += 2
+			n, ok := readUvarint(data, &pos)
+			if !ok || pos+int64(n) > int64(len(data)) {
+				return append(errs, newError(CodeBadMIDIEvent, evStart))
+			}
+			pos += int64(n)
+			ended = typ == 0x2F
+			continue
+		case status == 0xF0 || status == 0xF7:
+			running = 0
+			pos++
+			n, ok := readUvarint(data, &pos)
+			if !ok || pos+int64(n) > int64(len(data)) {
+				return append(errs, newError(CodeBadMIDIEvent, evStart))
+			}
+			pos += int64(n)
+			continue
+		case status > 0xF0:
+			return append(errs, newError(CodeBadMIDIEvent, pos))
+		case status < 0x80:
+			if running == 0 {
+				return append(errs, newError(CodeNoRunningStatus, pos))
+			}
+			status = running
+		default:
+			pos++
+		}
+		running = status
+
+		// Channel event data.
+		n := int64(2)
+		if status&0xF0 == 0xC0 || status&0xF0 == 0xD0 {
+			n = 1
+		}
+		if pos+n > int64(len(data)) {
+			return append(errs, newError(CodeBadMIDIEvent, evStart))
+		}
+		ev := data[pos : pos+n]
+		for _, b := range ev {
+			if b >= 0x80 {
+				return append(errs, newError(CodeBadMIDIEvent, evStart))
+			}
+		}
+		pos += n
+
+		key := [2]byte{status & 0x0F, ev[0]}
+		switch {
+		case status&0xF0 == 0x90 && ev[1] > 0:
+			notes[key]++
+		case status&0xF0 == 0x80 || status&0xF0 == 0x90:
+			if notes[key] == 0 {
+				errs = append(errs, newError(CodeUnmatchedNoteOff, ev[0],
+					key[0]+1, evStart))
+				continue
+			}
+			notes[key]--
+		}
+	}
+	if !ended {
+		errs = append(errs, newError(CodeMissingEOT, start))
+	}
+	for ch := 0; ch < 16; ch++ {
+		for note := 0; note < 128; note++ {
+			if notes[[2]byte{byte(ch), byte(note)}] > 0 {
+				errs = append(errs, newError(CodeUnendedNote, note, ch+1, start))
+			}
+		}
+	}
+	return errs
+}
+
+// readUvarint reads a variable length int of at most 4 bytes at *pos, and
+// advances *pos past it. Returns false if it is too long or cut off.
+func readUvarint(data []byte, pos *int64) (uint, bool) {
+	var result uint
+	for i := 0; i < 4 && *pos < int64(len(data)); i++ {
+		b := data[*pos]
+		*pos++
+		result = result<<7 | uint(b&127)
+		if b < 128 {
+			return result, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,90 @@
+package beatnik
+
+import (
+	"testing"
+)
+
+func TestValidateMIDI_beatnik(t *testing.T) {
+	srcs := []string{
+		"bpm:90 K,HC S,HC. K,HC.. S,HC~",
+		"bpm:140 time:7/8 marker:A K. S.. marker:B K S+ HC- (S..) K",
+		"bpm:60 K.. bpm:120 S{stick=rim}.. cue:x K",
+	}
+	opts := []*EncodeOptions{nil, {Annotations: true, Gate: 200}}
+	for _, src := range srcs {
+		tr, err := ParseTrack(src)
+		if err != nil {
+			t.Fatalf("ParseTrack(%q) failed: %v", src, err)
+		}
+		for _, o := range opts {
+			b, err := tr.Encode(o)
+			if err != nil {
+				t.Fatalf("Encode(%q) failed: %v", src, err)
+			}
+			if err := ValidateMIDI(b); err != nil {
+				t.Errorf("ValidateMIDI(%q, %+v)=%v, want nil", src, o, err)
+			}
+		}
+		song := &Song{Tracks: []*Track{tr, tr}}
+		b, err := song.MarshalBinary()
+		if err != nil {
+			t.Fatalf("Song.MarshalBinary(%q) failed: %v", src, err)
+		}
+		if err := ValidateMIDI(b); err != nil {
+			t.Errorf("ValidateMIDI(song of %q)=%v, want nil", src, err)
+		}
+	}
+}
+
+func TestValidateMIDI(t *testing.T) {
+	header := []byte{'M', 'T', 'h', 'd', 0, 0, 0, 6, 0, 1, 0, 1, 0, 96}
+	chunk := func(events ...byte) []byte {
+		b := append([]byte{}, header...)
+		b = append(b, 'M', 'T', 'r', 'k', 0, 0, 0, byte(len(events)))
+		return append(b, events...)
+	}
+	tests := []struct {
+		b     []byte
+		codes []Code
+	}{
+		{chunk(0, 0x99, 36, 100, 0, 36, 0, 0, 0xFF, 0x2F, 0), nil},
+		{[]byte("MThx"), []Code{CodeBadMIDIHeader}},
+		{chunk(0, 0x99, 36, 100, 0, 0xFF, 0x2F, 0),
+			[]Code{CodeUnendedNote}},
+		{chunk(0, 0x89, 36, 64, 0, 0xFF, 0x2F, 0),
+			[]Code{CodeUnmatchedNoteOff}},
+		{chunk(0, 36, 100, 0, 0xFF, 0x2F, 0), []Code{CodeNoRunningStatus}},
+		{chunk(0, 0xC9, 5), []Code{CodeMissingEOT}},
+		{chunk(0, 0xFF, 0x2F, 0, 0, 0xC9, 5), []Code{CodeBadChunkLength}},
+		{chunk(0, 0x99, 36, 200, 0, 0xFF, 0x2F, 0),
+			[]Code{CodeBadMIDIEvent}},
+		{chunk(0, 0xFF, 0x2F, 0)[:len(header)+9], []Code{CodeTruncatedMIDI,
+			CodeBadMIDIEvent}},
+		{append(chunk(0, 0xFF, 0x2F, 0), 'M', 'T', 'r', 'k', 0, 0, 0, 4, 0,
+			0xFF, 0x2F, 0), []Code{CodeTrackCount}},
+	}
+	for _, test := range tests {
+		err := ValidateMIDI(test.b)
+		var codes []Code
+		errs := []error{err}
+		if list, ok := err.(ErrorList); ok {
+			errs = list
+		}
+		for _, e := range errs {
+			if e, ok := e.(*Error); ok {
+				codes = append(codes, e.Code)
+			}
+		}
+		if len(codes) != len(test.codes) {
+			t.Errorf("ValidateMIDI(%v)=%v, want %v", test.b, err, test.codes)
+			continue
+		}
+		for i := range codes {
+			if codes[i] != test.codes[i] {
+				t.Errorf("ValidateMIDI(%v)=%v, want %v", test.b, err,
+					test.codes)
+				break
+			}
+		}
+	}
+}
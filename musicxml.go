@@ -0,0 +1,293 @@
+package beatnik
+
+// Export to MusicXML percussion scores.
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"sort"
+)
+
+// An xmlDrum is how a General MIDI drum is written on a percussion staff.
+type xmlDrum struct {
+	name   string // Instrument name.
+	step   string // Display step (C to B).
+	octave int    // Display octave.
+	head   string // Notehead, empty for normal.
+}
+
+// Maps General MIDI drum notes to their percussion staff notation. Other notes
+// are written as generic percussion on the middle line.
+var xmlDrums = map[byte]xmlDrum{
+	35: {"Acoustic Bass Drum", "E", 4, ""},
+	36: {"Bass Drum 1", "F", 4, ""},
+	37: {"Side Stick", "C", 5, "x"},
+	38: {"Acoustic Snare", "C", 5, ""},
+	39: {"Hand Clap", "C", 5, "slash"},
+	40: {"Electric Snare", "C", 5, ""},
+	41: {"Low Floor Tom", "G", 4, ""},
+	42: {"Closed Hi-Hat", "G", 5, "x"},
+	43: {"High Floor Tom", "A", 4, ""},
+	44: {"Pedal Hi-Hat", "D", 4, "x"},
+	45: {"Low Tom", "B", 4, ""},
+	46: {"Open Hi-Hat", "G", 5, "circle-x"},
+	47: {"Low-Mid Tom", "D", 5, ""},
+	48: {"Hi-Mid Tom", "E", 5, ""},
+	49: {"Crash Cymbal 1", "A", 5, "x"},
+	50: {"High Tom", "F", 5, ""},
+	51: {"Ride Cymbal 1", "F", 5, "x"},
+	52: {"Chinese Cymbal", "B", 5, "x"},
+	53: {"Ride Bell", "F", 5, "diamond"},
+	54: {"Tambourine", "E", 5, "x"},
+	55: {"Splash Cymbal", "B", 5, "x"},
+	56: {"Cowbell", "E", 5, "triangle"},
+	57: {"Crash Cymbal 2", "A", 5, "x"},
+	59: {"Ride Cymbal 2", "E", 5, "x"},
+}
+
+// Maps plain note values in ticks to MusicXML note types.
+var xmlValues = map[uint]string{
+	384: "whole", 192: "half", 96: "quarter", 48: "eighth", 24: "16th",
+	12: "32nd", 6: "64th", 3: "128th",
+}
+
+// Dynamic marks, by their velocity.
+var xmlDynamics = []struct {
+	v    Velocity
+	name string
+}{
+	{PPP, "ppp"}, {PP, "pp"}, {P, "p"}, {MP, "mp"}, {MF, "mf"}, {F, "f"},
+	{FF, "ff"}, {FFF, "fff"},
+}
+
+// gmNote returns the General MIDI note of a note, reading beatnik's default
+// drum names as EZdrummer notes.
+func gmNote(n byte) byte {
+	if gm, ok := remaps["gm"][n]; ok {
+		return gm
+	}
+	return n
+}
+
+// MarshalMusicXML returns the track as a partwise MusicXML score with a single
+// percussion staff. Notes are written as unpitched General MIDI drums, reading
+// beatnik's default drum names as EZdrummer notes. Hits that cross a bar line
+// are cut at it, the rest of their time written as rests. A dynamic mark is
+// written wherever the loudness of the hits changes. Fails if the track is not
+// valid.
+func (t *Track) MarshalMusicXML() ([]byte, error) {
+	if err := errorOf(t.Validate()); err != nil {
+		return nil, err
+	}
+	e := &xmlEncoder{buf: bytes.NewBuffer(nil), t: t,
+		bar: t.timeSig().barTicks(), meta: t.tempoChangeMeta()}
+	e.header()
+	for _, h := range t.Hits {
+		e.hit(h)
+	}
+	if e.tick%e.bar != 0 {
+		e.rest(e.bar - e.tick%e.bar)
+	}
+	if e.tick > 0 {
+		e.buf.WriteString("    </measure>\n")
+	}
+	e.buf.WriteString("  </part>\n</score-partwise>\n")
+	return e.buf.Bytes(), nil
+}
+
+// An xmlEncoder writes a track's measures one hit at a time.
+type xmlEncoder struct {
+	buf     *bytes.Buffer
+	t       *Track
+	bar     uint    // Ticks in a bar.
+	tick    uint    // Absolute tick of the next note.
+	meta    []*Meta // Meta events that were not written yet.
+	dynamic string  // Last dynamic mark.
+}
+
+// header writes everything up to the first measure.
+func (e *xmlEncoder) header() {
+	e.buf.WriteString(xml.Header)
+	e.buf.WriteString("<!DOCTYPE score-partwise PUBLIC " +
+		"\"-//Recordare//DTD MusicXML 3.1 Partwise//EN\" " +
+		"\"http://www.musicxml.org/dtds/partwise.dtd\">\n")
+	e.buf.WriteString("<score-partwise version=\"3.1\">\n  <part-list>\n" +
+		"    <score-part id=\"P1\">\n      <part-name>Drums</part-name>\n")
+
+	notes := map[byte]bool{}
+	for _, h := range e.t.Hits {
+		for n := range h.Notes {
+			notes[gmNote(n)] = true
+		}
+	}
+	var sorted []int
+	for n := range notes {
+		sorted = append(sorted, int(n))
+	}
+	sort.Ints(sorted)
+	for _, n := range sorted {
+		fmt.Fprintf(e.buf, "      <score-instrument id=\"P1-I%v\">"+
+			"<instrument-name>%s</instrument-name></score-instrument>\n",
+			n, xmlEscape(xmlDrumOf(byte(n)).name))
+	}
+	for _, n := range sorted {
+		fmt.Fprintf(e.buf, "      <midi-instrument id=\"P1-I%v\"><midi-channel>10"+
+			"</midi-channel><midi-unpitched>%v</midi-unpitched></midi-instrument>\n",
+			n, n+1)
+	}
+	e.buf.WriteString("    </score-part>\n  </part-list>\n  <part id=\"P1\">\n")
+}
+
+// xmlDrumOf returns the notation of a General MIDI note.
+func xmlDrumOf(n byte) xmlDrum {
+	if d, ok := xmlDrums[n]; ok {
+		return d
+	}
+	return xmlDrum{fmt.Sprintf("Percussion %v", n), "C", 5, ""}
+}
+
+// hit writes a hit, cutting it at bar lines.
+func (e *xmlEncoder) hit(h *Hit) {
+	length := h.T
+	if left := e.bar - e.tick%e.bar; length > left {
+		length = left
+	}
+	if h.IsRest() {
+		e.rest(h.T)
+		return
+	}
+	e.measure()
+	if d := dynamicOf(maxVelocity(h)); d != e.dynamic {
+		fmt.Fprintf(e.buf, "      <direction placement=\"below\"><direction-type>"+
+			"<dynamics><%s/></dynamics></direction-type>"+
+			"<sound dynamics=\"%v\"/></direction>\n",
+			d, int(maxVelocity(h))*100/90)
+		e.dynamic = d
+	}
+	values := splitDuration(length)
+	var notes []int
+	for n := range h.Notes {
+		notes = append(notes, int(n))
+	}
+	sort.Ints(notes)
+	for i, n := range notes {
+		gm := gmNote(byte(n))
+		d := xmlDrumOf(gm)
+		e.buf.WriteString("      <note>")
+		if i > 0 {
+			e.buf.WriteString("<chord/>")
+		}
+		fmt.Fprintf(e.buf, "<unpitched><display-step>%s</display-step>"+
+			"<display-octave>%v</display-octave></unpitched>", d.step, d.octave)
+		e.value(values[0], fmt.Sprintf("<instrument id=\"P1-I%v\"/>", gm))
+		if d.head != "" {
+			fmt.Fprintf(e.buf, "<notehead>%s</notehead>", d.head)
+		}
+		if h.Notes[byte(n)] >= FF {
+			e.buf.WriteString("<notations><articulations><accent/>" +
+				"</articulations></notations>")
+		}
+		e.buf.WriteString("</note>\n")
+	}
+	e.tick += values[0].ticks()
+	e.rest(h.T - values[0].ticks())
+}
+
+// rest writes silence of the given length, cutting it at bar lines.
+func (e *xmlEncoder) rest(ticks uint) {
+	for ticks > 0 {
+		length := ticks
+		if left := e.bar - e.tick%e.bar; length > left {
+			length = left
+		}
+		e.measure()
+		for _, v := range splitDuration(length) {
+			e.buf.WriteString("      <note><rest/>")
+			e.value(v, "")
+			e.buf.WriteString("</note>\n")
+		}
+		e.tick += length
+		ticks -= length
+	}
+}
+
+// value writes the duration of a note, followed by its voice and type. inst is
+// written between the duration and the voice.
+func (e *xmlEncoder) value(v noteValue, inst string) {
+	fmt.Fprintf(e.buf, "<duration>%v</duration>%s<voice>1</voice><type>%s</type>",
+		v.ticks(), inst, xmlValues[v.base])
+	if v.dotted {
+		e.buf.WriteString("<dot/>")
+	}
+	if v.num != v.den {
+		fmt.Fprintf(e.buf, "<time-modification><actual-notes>%v</actual-notes>"+
+			"<normal-notes>%v</normal-notes></time-modification>", v.den, v.num)
+	}
+}
+
+// measure starts a new measure if the next note is on a bar line, and writes
+// the meta events that are due.
+func (e *xmlEncoder) measure() {
+	if e.tick%e.bar == 0 {
+		if e.tick > 0 {
+			e.buf.WriteString("    </measure>\n")
+		}
+		fmt.Fprintf(e.buf, "    <measure number=\"%v\">\n", e.tick/e.bar+1)
+		if e.tick == 0 {
+			ts := e.t.timeSig()
+			fmt.Fprintf(e.buf, "      <attributes><divisions>96</divisions>"+
+				"<time><beats>%v</beats><beat-type>%v</beat-type></time>"+
+				"<clef><sign>percussion</sign></clef></attributes>\n",
+				ts.Num, ts.Denom)
+			if bpm := e.t.TempoMap().BPM(0); bpm != 0 {
+				e.tempo(bpm)
+			}
+		}
+	}
+	for len(e.meta) > 0 && e.meta[0].T <= e.tick {
+		switch m := e.meta[0]; m.Type {
+		case MetaMarker:
+			fmt.Fprintf(e.buf, "      <direction placement=\"above\"><direction-type>"+
+				"<rehearsal>%s</rehearsal></direction-type></direction>\n",
+				xmlEscape(string(m.Data)))
+		case MetaTempo:
+			e.tempo(m.bpm())
+		}
+		e.meta = e.meta[1:]
+	}
+}
+
+// tempo writes a metronome mark.
+func (e *xmlEncoder) tempo(bpm uint) {
+	fmt.Fprintf(e.buf, "      <direction placement=\"above\"><direction-type>"+
+		"<metronome><beat-unit>quarter</beat-unit><per-minute>%v</per-minute>"+
+		"</metronome></direction-type><sound tempo=\"%v\"/></direction>\n",
+		bpm, bpm)
+}
+
+// dynamicOf returns the dynamic mark that is closest to the given velocity.
+func dynamicOf(v Velocity) string {
+	best := xmlDynamics[0]
+	for _, d := range xmlDynamics {
+		if absDiff(int(d.v), int(v)) < absDiff(int(best.v), int(v)) {
+			best = d
+		}
+	}
+	return best.name
+}
+
+// absDiff returns the absolute difference between a and b.
+func absDiff(a, b int) int {
+	if a < b {
+		return b - a
+	}
+	return a - b
+}
+
+// xmlEscape returns s with XML special characters escaped.
+func xmlEscape(s string) string {
+	buf := bytes.NewBuffer(nil)
+	xml.EscapeText(buf, []byte(s))
+	return buf.String()
+}
@@ -0,0 +1,83 @@
+package beatnik
+
+import (
+	"encoding/xml"
+	"reflect"
+	"testing"
+)
+
+func TestMarshalMusicXML(t *testing.T) {
+	src := "bpm:90 marker:Verse K,HC HC S,HC++ HC K,HC. K~ S. S.>3 S.>3 S.>3 S--"
+	tr, err := ParseTrack(src)
+	if err != nil {
+		t.Fatalf("ParseTrack(%q) failed: %v", src, err)
+	}
+	b, err := tr.MarshalMusicXML()
+	if err != nil {
+		t.Fatalf("MarshalMusicXML(%q) failed: %v", src, err)
+	}
+
+	var score struct {
+		Instruments []string `xml:"part-list>score-part>score-instrument>instrument-name"`
+		Measures    []struct {
+			Rehearsal []string `xml:"direction>direction-type>rehearsal"`
+			Dynamics  []struct {
+				Marks []struct {
+					XMLName xml.Name
+				} `xml:",any"`
+			} `xml:"direction>direction-type>dynamics"`
+			Notes []struct {
+				Chord    *struct{} `xml:"chord"`
+				Rest     *struct{} `xml:"rest"`
+				Duration uint      `xml:"duration"`
+				Type     string    `xml:"type"`
+				Actual   int       `xml:"time-modification>actual-notes"`
+			} `xml:"note"`
+		} `xml:"part>measure"`
+	}
+	if err := xml.Unmarshal(b, &score); err != nil {
+		t.Fatalf("MarshalMusicXML(%q) is not valid XML: %v\n%s", src, err, b)
+	}
+
+	wantInst := []string{"Bass Drum 1", "Acoustic Snare", "Closed Hi-Hat"}
+	if !reflect.DeepEqual(score.Instruments, wantInst) {
+		t.Errorf("instruments=%v, want %v", score.Instruments, wantInst)
+	}
+	if len(score.Measures) != 3 {
+		t.Fatalf("got %v measures, want 3:\n%s", len(score.Measures), b)
+	}
+	if got := score.Measures[0].Rehearsal; !reflect.DeepEqual(got, []string{"Verse"}) {
+		t.Errorf("measure 1 rehearsal=%v, want [Verse]", got)
+	}
+	var dynamics []string
+	for _, m := range score.Measures {
+		for _, d := range m.Dynamics {
+			for _, mark := range d.Marks {
+				dynamics = append(dynamics, mark.XMLName.Local)
+			}
+		}
+	}
+	if want := []string{"f", "fff", "f", "mp"}; !reflect.DeepEqual(dynamics, want) {
+		t.Errorf("dynamics=%v, want %v", dynamics, want)
+	}
+
+	// Every measure should be full, and triplets should be marked.
+	triplets := 0
+	for i, m := range score.Measures {
+		var total uint
+		for _, n := range m.Notes {
+			if n.Chord == nil {
+				total += n.Duration
+			}
+			if n.Actual == 3 {
+				triplets++
+			}
+		}
+		if total != 384 {
+			t.Errorf("measure %v has %v ticks, want 384", i+1, total)
+		}
+	}
+	if triplets != 3 {
+		t.Errorf("got %v triplet notes, want 3", triplets)
+	}
+}
@@ -0,0 +1,55 @@
+package beatnik
+
+// Note values for notation exporters.
+
+// A noteValue is a written duration: a plain note value, maybe dotted, maybe
+// scaled like a tuplet.
+type noteValue struct {
+	base     uint // Ticks of the plain note value (96 is a quarter).
+	dotted   bool
+	num, den uint // Scale of the duration, 1/1 if not scaled.
+}
+
+// ticks returns the length of the note value in ticks.
+func (v noteValue) ticks() uint {
+	t := v.base
+	if v.dotted {
+		t = t * 3 / 2
+	}
+	return t * v.num / v.den
+}
+
+// Plain note values in ticks, longest first.
+var plainValues = []uint{384, 192, 96, 48, 24, 12, 6, 3}
+
+// splitDuration returns note values that add up to the given number of ticks,
+// longest first. Values between a dotted half and a dotted 32nd may be
+// dotted. Ticks that do not add up from plain and dotted values give a
+// single scaled value, like 2/3 of an eighth for an eighth note triplet.
+func splitDuration(ticks uint) []noteValue {
+	var result []noteValue
+	left := ticks
+	for _, base := range plainValues {
+		if base >= 12 && base < 384 && left >= base*3/2 {
+			result = append(result, noteValue{base, true, 1, 1})
+			left -= base * 3 / 2
+		}
+		for left >= base {
+			result = append(result, noteValue{base, false, 1, 1})
+			left -= base
+		}
+	}
+	if left == 0 {
+		return result
+	}
+
+	// Scale the shortest plain value that is not shorter than ticks.
+	base := plainValues[0]
+	for _, b := range plainValues {
+		if b >= ticks {
+			base = b
+		}
+	}
+	g := gcd(ticks, base)
+	return []noteValue{{base, false, ticks / g, base / g}}
+}
@@ -0,0 +1,191 @@
+package beatnik
+
+// Operation logs for collaborative editing.
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+)
+
+// An OpKind is a kind of edit operation.
+type OpKind string
+
+// Operation kinds.
+const (
+	OpInsert    OpKind = "insert"    // Insert Hit before the hit at Index.
+	OpVelocity  OpKind = "velocity"  // Set Note's velocity in the hit at Index.
+	OpDirective OpKind = "directive" // Add Directive before the hit at Index.
+)
+
+// opDirectives holds the directives that operations can add. The others only
+// affect how the following text is parsed, so they mean nothing for a track.
+var opDirectives = map[string]bool{"bpm": true, "time": true,
+	"marker": true, "cue": true}
+
+// An Op is a single edit of a track. Editors send their ops to each other, or
+// to a server that keeps the log of a track, instead of whole tracks. Ops
+// encode to JSON, as in {"kind":"velocity","index":3,"note":38,"velocity":90}.
+type Op struct {
+	Kind  OpKind `json:"kind"`
+	Index int    `json:"index"` // Hit the op applies to, len(Hits) for the end.
+
+	Hit       *Hit     `json:"hit,omitempty"`       // Inserted hit.
+	Note      byte     `json:"note,omitempty"`      // Note whose velocity is set.
+	Velocity  Velocity `json:"velocity,omitempty"`  // New velocity, 0 removes the note.
+	Directive string   `json:"directive,omitempty"` // Added directive, as in "bpm:90".
+}
+
+// Apply applies the given ops to t in order. If an op fails, t is left
+// unchanged.
+func (t *Track) Apply(ops ...Op) error {
+	result := Concat(t)
+	for _, op := range ops {
+		if err := op.apply(result); err != nil {
+			return err
+		}
+	}
+	*t = *result
+	return nil
+}
+
+// apply applies a single op to t.
+func (op Op) apply(t *Track) error {
+	n := len(t.Hits)
+	if op.Kind == OpVelocity {
+		n-- // Velocities are set on existing hits.
+	}
+	if op.Index < 0 || op.Index > n {
+		return newError(CodeOpIndex, op.Index, len(t.Hits))
+	}
+
+	switch op.Kind {
+	case OpInsert:
+		if op.Hit == nil {
+			return newError(CodeOpMissing, op.Kind, "hit")
+		}
+		// Events after the new hit are pushed forward, and events where it
+		// starts stay there, so that they apply to it.
+		at := (&Track{Hits: t.Hits[:op.Index]}).ticks()
+		for _, m := range t.Meta {
+			if m.T > at {
+				m.T += op.Hit.T
+			}
+		}
+		for _, c := range t.Controls {
+			if c.T > at {
+				c.T += op.Hit.T
+			}
+		}
+		t.Hits = append(t.Hits, nil)
+		copy(t.Hits[op.Index+1:], t.Hits[op.Index:])
+		t.Hits[op.Index] = op.Hit.copy()
+	case OpVelocity:
+		if op.Note == 0 || op.Note > 127 {
+			return newError(CodeBadDrum, strconv.Itoa(int(op.Note)))
+		}
+		if op.Velocity > 127 {
+			return newError(CodeVelocityRange, op.Velocity)
+		}
+		h := t.Hits[op.Index]
+		if op.Velocity == 0 {
+			delete(h.Notes, op.Note)
+			delete(h.Offsets, op.Note)
+			delete(h.Chances, op.Note)
+		} else {
+			if h.Notes == nil {
+				h.Notes = map[byte]Velocity{}
+			}
+			h.Notes[op.Note] = op.Velocity
+		}
+	case OpDirective:
+		return op.applyDirective(t)
+	default:
+		return newError(CodeUnknownOp, op.Kind)
+	}
+	return nil
+}
+
+// applyDirective adds the op's directive to t, before the hit at the op's
+// index. Tempos after the start of the track become tempo change events.
+func (op Op) applyDirective(t *Track) error {
+	if op.Directive == "" {
+		return newError(CodeOpMissing, op.Kind, "directive")
+	}
+	name, _, ok := splitDirective(op.Directive)
+	if !ok {
+		return newError(CodeBadDirective, op.Directive)
+	}
+	if !opDirectives[name] {
+		return newError(CodeOpDirective, name)
+	}
+	p := newParser()
+	p.t = &Track{Hits: t.Hits[:op.Index], BPM: t.BPM, Meta: t.Meta,
+		TimeSig: t.TimeSig}
+	p.tick = p.t.ticks()
+	if err := p.parseDirective(token{s: op.Directive}); err != nil {
+		return err
+	}
+	t.TimeSig = p.t.TimeSig
+	t.Meta = p.t.Meta
+	t.BPM = p.t.BPM
+	return nil
+}
+
+// MergeOps merges two logs of ops that were made concurrently on the same
+// track, like by two users of an editor. Returns a log that applies a's ops
+// and then b's, with b's indexes moved to account for the hits that a
+// inserted. Hits that both logs insert at the same place are ordered with a's
+// first, and where both set the same velocity b's wins.
+func MergeOps(a, b []Op) []Op {
+	a = append([]Op(nil), a...)
+	result := append([]Op(nil), a...)
+	for _, y := range b {
+		for i, x := range a {
+			// Each of a's ops is moved past y too, for the following ops of b.
+			a[i] = transformOp(x, y, false)
+			y = transformOp(y, x, true)
+		}
+		result = append(result, y)
+	}
+	return result
+}
+
+// transformOp returns op with its index moved to apply after other, that was
+// made concurrently. first says whether other goes first when both insert at
+// the same place.
+func transformOp(op, other Op, first bool) Op {
+	if other.Kind != OpInsert {
+		return op
+	}
+	if other.Index < op.Index || other.Index == op.Index &&
+		(op.Kind != OpInsert || first) {
+		op.Index++
+	}
+	return op
+}
+
+// ReadOps reads a log of ops, encoded as JSON objects one after the other.
+func ReadOps(r io.Reader) ([]Op, error) {
+	var result []Op
+	dec := json.NewDecoder(r)
+	for dec.More() {
+		var op Op
+		if err := dec.Decode(&op); err != nil {
+			return nil, err
+		}
+		result = append(result, op)
+	}
+	return result, nil
+}
+
+// WriteOps writes a log of ops as JSON, one op per line.
+func WriteOps(w io.Writer, ops []Op) error {
+	enc := json.NewEncoder(w)
+	for _, op := range ops {
+		if err := enc.Encode(op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package beatnik
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestTrackApply(t *testing.T) {
+	tr, err := ParseTrack("bpm:100 K S marker:a K S")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tr.Apply(
+		Op{Kind: OpInsert, Index: 1, Hit: &Hit{Notes: map[byte]Velocity{22: F},
+			T: 48}},
+		Op{Kind: OpVelocity, Index: 0, Note: 36, Velocity: 90},
+		Op{Kind: OpVelocity, Index: 2, Note: 38},
+		Op{Kind: OpDirective, Index: 4, Directive: "bpm:120"},
+	)
+	if err != nil {
+		t.Fatalf("Apply() failed: %v", err)
+	}
+	want, err := ParseTrack("bpm:100 K HC. S marker:a K S")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want.Hits[0].Notes[36] = 90
+	want.Hits[2].Notes = map[byte]Velocity{}
+	want.Meta = append(want.Meta, tempoMeta(336, 120))
+	if !reflect.DeepEqual(tr, want) {
+		t.Errorf("Apply()=%v, want %v", tr, want)
+	}
+}
+
+func TestTrackApply_error(t *testing.T) {
+	tr, err := ParseTrack("K S")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		op   Op
+		code Code
+	}{
+		{Op{Kind: OpVelocity, Index: 3, Note: 36, Velocity: F}, CodeOpIndex},
+		{Op{Kind: OpInsert, Index: 4, Hit: &Hit{T: 96}}, CodeOpIndex},
+		{Op{Kind: OpInsert, Index: 0}, CodeOpMissing},
+		{Op{Kind: OpVelocity, Note: 36, Velocity: 200}, CodeVelocityRange},
+		{Op{Kind: OpDirective, Directive: "alias:a=K"}, CodeOpDirective},
+		{Op{Kind: OpDirective, Directive: "bpm:x"}, CodeBadBPM},
+		{Op{Kind: "delete"}, CodeUnknownOp},
+	}
+	for _, test := range tests {
+		err := tr.Apply(Op{Kind: OpInsert, Hit: &Hit{T: 96}}, test.op)
+		if e, ok := err.(*Error); !ok || e.Code != test.code {
+			t.Errorf("Apply(%+v)=%v, want %v", test.op, err, test.code)
+		}
+		if len(tr.Hits) != 2 {
+			t.Errorf("Apply(%+v) changed the track", test.op)
+		}
+	}
+}
+
+func TestMergeOps(t *testing.T) {
+	hc := &Hit{Notes: map[byte]Velocity{22: F}, T: 96}
+	t1 := &Hit{Notes: map[byte]Velocity{48: F}, T: 96}
+	a := []Op{{Kind: OpInsert, Index: 1, Hit: hc}}
+	b := []Op{
+		{Kind: OpInsert, Index: 1, Hit: t1},
+		{Kind: OpVelocity, Index: 2, Note: 38, Velocity: 90},
+		{Kind: OpInsert, Index: 0, Hit: t1},
+	}
+	got := MergeOps(a, b)
+	want := []Op{
+		{Kind: OpInsert, Index: 1, Hit: hc},
+		{Kind: OpInsert, Index: 2, Hit: t1},
+		{Kind: OpVelocity, Index: 3, Note: 38, Velocity: 90},
+		{Kind: OpInsert, Index: 0, Hit: t1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("MergeOps()=%v, want %v", got, want)
+	}
+
+	tr, err := ParseTrack("K S K S")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Apply(got...); err != nil {
+		t.Fatalf("Apply() failed: %v", err)
+	}
+	wantTrack, err := ParseTrack("T1 K HC T1 S K S")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantTrack.Hits[4].Notes[38] = 90
+	if !reflect.DeepEqual(tr, wantTrack) {
+		t.Errorf("Apply(MergeOps())=%v, want %v", tr, wantTrack)
+	}
+}
+
+func TestReadWriteOps(t *testing.T) {
+	ops := []Op{
+		{Kind: OpInsert, Index: 1, Hit: &Hit{Notes: map[byte]Velocity{22: F},
+			T: 48, Annotations: map[string]string{"stick": "rim"}}},
+		{Kind: OpVelocity, Index: 0, Note: 36, Velocity: 90},
+		{Kind: OpDirective, Index: 2, Directive: "marker:Chorus"},
+	}
+	buf := &bytes.Buffer{}
+	if err := WriteOps(buf, ops); err != nil {
+		t.Fatalf("WriteOps() failed: %v", err)
+	}
+	got, err := ReadOps(buf)
+	if err != nil {
+		t.Fatalf("ReadOps() failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, ops) {
+		t.Errorf("ReadOps(WriteOps(%v))=%v", ops, got)
+	}
+}
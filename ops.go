@@ -0,0 +1,383 @@
+package beatnik
+
+// Track transformations.
+
+// Append adds copies of other's hits and meta events to the end of t. If the
+// tempo at the end of t differs from other's tempo, a tempo change event is
+// inserted where other starts. If t has no tempo or time signature, it takes
+// other's.
+func (t *Track) Append(other *Track) {
+	bpm := other.TempoMap().BPM(0)
+	if len(t.TempoMap().changes) == 0 {
+		t.BPM = bpm
+	}
+	if t.TimeSig == (TimeSig{}) {
+		t.TimeSig = other.TimeSig
+	}
+	start := t.ticks()
+	if bpm != 0 && t.tempoAt(start) != bpm {
+		t.Meta = append(t.Meta, tempoMeta(start, bpm))
+	}
+	for _, m := range other.sortedMeta() {
+		m2 := m.copy()
+		m2.T += start
+		t.Meta = append(t.Meta, m2)
+	}
+	for _, c := range other.sortedControls() {
+		c2 := *c
+		c2.T += start
+		t.Controls = append(t.Controls, &c2)
+	}
+	for _, h := range other.Hits {
+		t.Hits = append(t.Hits, h.copy())
+	}
+}
+
+// Slice returns a copy of the bars in the range [startBar, endBar), according
+// to the track's time signature. Hits that cross the end of the range are
+// shortened, and hits that started before the range are replaced with a rest.
+// The range is clamped to the track's length.
+func (t *Track) Slice(startBar, endBar int) *Track {
+	if startBar < 0 {
+		startBar = 0
+	}
+	if endBar < startBar {
+		endBar = startBar
+	}
+	bar := t.timeSig().barTicks()
+	start, end := uint(startBar)*bar, uint(endBar)*bar
+
+	result := &Track{BPM: t.tempoAt(start), TimeSig: t.TimeSig}
+	var pos uint
+	for _, h := range t.Hits {
+		hStart, hEnd := pos, pos+h.T
+		pos = hEnd
+		if hEnd <= start || hStart >= end {
+			continue
+		}
+		if hEnd > end {
+			hEnd = end
+		}
+		if hStart < start {
+			result.Hits = append(result.Hits, &Hit{T: hEnd - start})
+			continue
+		}
+		h2 := h.copy()
+		h2.T = hEnd - hStart
+		result.Hits = append(result.Hits, h2)
+	}
+	for _, m := range t.sortedMeta() {
+		if m.T < start || m.T >= end || (m.Type == MetaTempo && m.T == start) {
+			continue
+		}
+		m2 := m.copy()
+		m2.T -= start
+		result.Meta = append(result.Meta, m2)
+	}
+	for _, c := range t.sortedControls() {
+		if c.T < start || c.T >= end {
+			continue
+		}
+		c2 := *c
+		c2.T -= start
+		result.Controls = append(result.Controls, &c2)
+	}
+	return result
+}
+
+// Remap rewrites the note numbers of all hits in the track according to m.
+// Notes that are missing from m are left as they are. If several notes of a
+// hit are mapped to the same note, the loudest one is kept, along with its
+// timing offset.
+func (t *Track) Remap(m map[byte]byte) {
+	for _, h := range t.Hits {
+		h.remap(m)
+	}
+}
+
+// remap rewrites the note numbers of the hit according to m.
+func (h *Hit) remap(m map[byte]byte) {
+	notes := make(map[byte]Velocity, len(h.Notes))
+	var offsets, chances map[byte]int
+	for n, v := range h.Notes {
+		n2 := n
+		if to, ok := m[n]; ok {
+			n2 = to
+		}
+		if v > notes[n2] {
+			notes[n2] = v
+			if off, ok := h.Offsets[n]; ok {
+				if offsets == nil {
+					offsets = map[byte]int{}
+				}
+				offsets[n2] = off
+			} else {
+				delete(offsets, n2)
+			}
+			if c, ok := h.Chances[n]; ok {
+				if chances == nil {
+					chances = map[byte]int{}
+				}
+				chances[n2] = c
+			} else {
+				delete(chances, n2)
+			}
+		}
+	}
+	h.Notes, h.Offsets, h.Chances = notes, offsets, chances
+}
+
+// Mute removes the notes of the given instrument classes from the track,
+// according to the given kit. Hits that are left with no notes become rests.
+func (t *Track) Mute(kit *Kit, classes ...Class) {
+	muted := map[Class]bool{}
+	for _, c := range classes {
+		muted[c] = true
+	}
+	t.dropNotes(func(n byte) bool {
+		return muted[kit.ClassOf(n)]
+	})
+}
+
+// Stems splits the track by instrument class, according to the given kit.
+// Returns a copy of the track for each class that it plays, with only that
+// class's notes. The stems keep the track's timing and meta events, so they
+// play in sync.
+func (t *Track) Stems(kit *Kit) map[Class]*Track {
+	result := map[Class]*Track{}
+	for _, h := range t.Hits {
+		for n := range h.Notes {
+			if c := kit.ClassOf(n); result[c] == nil {
+				stem := Concat(t)
+				stem.dropNotes(func(n byte) bool {
+					return kit.ClassOf(n) != c
+				})
+				result[c] = stem
+			}
+		}
+	}
+	return result
+}
+
+// SplitByNote splits the track by drum, for processing drums separately, like
+// humanizing only the hi-hats. Returns a copy of the track for each note that
+// it plays, with only that note. Like stems, the copies keep the track's
+// timing, meta and control events. MergeNotes joins them back.
+func (t *Track) SplitByNote() map[byte]*Track {
+	result := map[byte]*Track{}
+	for _, h := range t.Hits {
+		for n := range h.Notes {
+			if result[n] == nil {
+				note := n
+				tr := Concat(t)
+				tr.dropNotes(func(n byte) bool {
+					return n != note
+				})
+				result[note] = tr
+			}
+		}
+	}
+	return result
+}
+
+// dropNotes removes the notes for which drop returns true.
+func (t *Track) dropNotes(drop func(note byte) bool) {
+	for _, h := range t.Hits {
+		for n := range h.Notes {
+			if drop(n) {
+				delete(h.Notes, n)
+				delete(h.Offsets, n)
+				delete(h.Chances, n)
+			}
+		}
+	}
+}
+
+// ThinControls removes control events that make little difference, so that
+// dense curves do not bloat files or flood hardware. For each controller (or
+// pressed note, the channel's pressure or pitch bend), an event is dropped if
+// it comes less than 96/maxPerBeat ticks after the last kept event, or if its
+// value differs from the last kept value by less than minDelta. Pitch bends
+// are compared by their high 7 bits. The last event of each controller is
+// always kept, so curves end on their final value. Zero disables either
+// limit.
+func (t *Track) ThinControls(maxPerBeat int, minDelta int) {
+	var gap uint
+	if maxPerBeat > 0 {
+		gap = 96 / uint(maxPerBeat)
+	}
+	controls := t.sortedControls()
+	// Events of the same controller, note, channel pressure or bend share a key.
+	key := func(c *Control) [2]int {
+		if c.Kind == ChannelPressure || c.Kind == PitchBend {
+			return [2]int{int(c.Kind), 0}
+		}
+		return [2]int{int(c.Kind), int(c.Number)}
+	}
+	last := map[[2]int]int{} // Index in controls of the last event of each key.
+	for i, c := range controls {
+		last[key(c)] = i
+	}
+	kept := map[[2]int]*Control{}
+	var result []*Control
+	for i, c := range controls {
+		k := kept[key(c)]
+		if k != nil && i != last[key(c)] {
+			delta := int(c.Value) - int(k.Value)
+			if delta < 0 {
+				delta = -delta
+			}
+			if c.T-k.T < gap || delta < minDelta {
+				continue
+			}
+		}
+		kept[key(c)] = c
+		result = append(result, c)
+	}
+	t.Controls = result
+}
+
+// Reverse reverses the order of the track's hits, each keeping its own
+// duration. Meta events are left unchanged.
+func (t *Track) Reverse() {
+	reverseHits(t.Hits)
+}
+
+// reverseHits reverses the order of the given hits in place.
+func reverseHits(hits []*Hit) {
+	for i, j := 0, len(hits)-1; i < j; i, j = i+1, j-1 {
+		hits[i], hits[j] = hits[j], hits[i]
+	}
+}
+
+// ScaleVelocity multiplies the velocities of all notes in the track by
+// factor, clamping the results to 1-127.
+func (t *Track) ScaleVelocity(factor float64) {
+	for _, h := range t.Hits {
+		for n, v := range h.Notes {
+			h.Notes[n] = clampVelocity(float64(v) * factor)
+		}
+	}
+}
+
+// NormalizeVelocity scales the velocities of all notes in the track
+// proportionally, so that the loudest note gets the target velocity.
+func (t *Track) NormalizeVelocity(target Velocity) {
+	var max Velocity
+	for _, h := range t.Hits {
+		for _, v := range h.Notes {
+			if v > max {
+				max = v
+			}
+		}
+	}
+	if max == 0 {
+		return
+	}
+	t.ScaleVelocity(float64(target) / float64(max))
+}
+
+// clampVelocity rounds v to the nearest valid velocity, between 1 and 127.
+func clampVelocity(v float64) Velocity {
+	if v < 1 {
+		return 1
+	}
+	if v > 127 {
+		return 127
+	}
+	return Velocity(v + 0.5)
+}
+
+// Concat returns a new track made of copies of the given tracks, one after the
+// other. Tempo differences between the tracks become tempo change events.
+func Concat(tracks ...*Track) *Track {
+	result := &Track{}
+	for _, t := range tracks {
+		result.Append(t)
+	}
+	return result
+}
+
+// tempoAt returns the tempo that is in effect at the given tick.
+func (t *Track) tempoAt(tick uint) uint {
+	return t.TempoMap().BPM(tick)
+}
+
+// Quantize moves each note, with its timing offset, to the nearest step of a
+// grid of the given number of ticks, and removes timing offsets. Notes that
+// land on the same step play in the same hit, with the loudest velocity of
+// each drum. Hits lose their annotations and chances, and the track's length
+// is rounded to the grid. Meta events and controls stay in place. A zero grid
+// changes nothing.
+func (t *Track) Quantize(grid uint) {
+	if grid == 0 {
+		return
+	}
+	var strikes []drumStrike
+	t.eachNote(grid, func(step, off int, n byte, h *Hit) {
+		strikes = append(strikes, drumStrike{uint(step) * grid, n, h.Notes[n]})
+	})
+	if len(strikes) == 0 {
+		return
+	}
+	end := uint(roundDiv(int(t.ticks()), int(grid))) * grid
+	t.Hits = strikeHits(strikes, end)
+}
+
+// copy returns a deep copy of the hit. The source span is shared, since it
+// does not change.
+func (h *Hit) copy() *Hit {
+	result := &Hit{Notes: make(map[byte]Velocity, len(h.Notes)), T: h.T,
+		Span: h.Span}
+	for n, v := range h.Notes {
+		result.Notes[n] = v
+	}
+	if h.Annotations != nil {
+		result.Annotations = make(map[string]string, len(h.Annotations))
+		for k, v := range h.Annotations {
+			result.Annotations[k] = v
+		}
+	}
+	if h.Offsets != nil {
+		result.Offsets = make(map[byte]int, len(h.Offsets))
+		for n, off := range h.Offsets {
+			result.Offsets[n] = off
+		}
+	}
+	if h.Chances != nil {
+		result.Chances = make(map[byte]int, len(h.Chances))
+		for n, c := range h.Chances {
+			result.Chances[n] = c
+		}
+	}
+	return result
+}
+
+// copy returns a deep copy of the meta event.
+func (m *Meta) copy() *Meta {
+	return &Meta{m.T, m.Type, append([]byte(nil), m.Data...)}
+}
+
+// Subdivision returns a track of evenly spaced clicks as long as t, for
+// playing along with it as a separate midi track, like quiet sixteenths on a
+// sidestick. perBar is the number of clicks in a bar of t's time signature,
+// and should divide it evenly. The result has t's tempo and time signature.
+func (t *Track) Subdivision(perBar int, note byte, v Velocity) (*Track, error) {
+	bar := t.timeSig().barTicks()
+	if perBar < 1 || bar%uint(perBar) != 0 {
+		return nil, newError(CodeBadSubdivision, perBar, bar)
+	}
+	step := bar / uint(perBar)
+	result := &Track{TimeSig: t.TimeSig}
+	result.SetTempoMap(t.TempoMap())
+	total := t.ticks()
+	for tick := uint(0); tick < total; tick += step {
+		d := step
+		if tick+d > total {
+			d = total - tick
+		}
+		result.Hits = append(result.Hits,
+			&Hit{Notes: map[byte]Velocity{note: v}, T: d})
+	}
+	return result, nil
+}
@@ -0,0 +1,302 @@
+package beatnik
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConcat(t *testing.T) {
+	a := &Track{
+		Hits: []*Hit{{Notes: map[byte]Velocity{36: F}, T: 96}},
+		BPM:  120,
+		Meta: []*Meta{{0, MetaMarker, []byte("A")}},
+	}
+	b := &Track{
+		Hits: []*Hit{{Notes: map[byte]Velocity{38: F}, T: 48}},
+		BPM:  120,
+	}
+	c := &Track{
+		Hits: []*Hit{{Notes: map[byte]Velocity{42: F}, T: 24}},
+		BPM:  90,
+		Meta: []*Meta{{0, MetaCue, []byte("C")}},
+	}
+	want := &Track{
+		Hits: []*Hit{
+			{Notes: map[byte]Velocity{36: F}, T: 96},
+			{Notes: map[byte]Velocity{38: F}, T: 48},
+			{Notes: map[byte]Velocity{42: F}, T: 24},
+		},
+		BPM: 120,
+		Meta: []*Meta{
+			{0, MetaMarker, []byte("A")},
+			tempoMeta(144, 90),
+			{144, MetaCue, []byte("C")},
+		},
+	}
+
+	got := Concat(a, b, c)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Concat(...)=%v, want %v", got, want)
+	}
+	if got.Hits[0] == a.Hits[0] {
+		t.Errorf("Concat(...) should copy hits")
+	}
+	if bpm := got.tempoAt(143); bpm != 120 {
+		t.Errorf("tempoAt(143)=%v, want 120", bpm)
+	}
+	if bpm := got.tempoAt(144); bpm != 90 {
+		t.Errorf("tempoAt(144)=%v, want 90", bpm)
+	}
+}
+
+func TestSlice(t *testing.T) {
+	tr, err := ParseTrack("time:3/4 bpm:100 K~ S K S~~ marker:X K. S. K~ HC~")
+	if err != nil {
+		t.Fatalf("ParseTrack() failed: %v", err)
+	}
+	want := &Track{
+		Hits: []*Hit{
+			{T: 96 * 2},
+			{Notes: map[byte]Velocity{36: F}, T: 48},
+			{Notes: map[byte]Velocity{38: F}, T: 48},
+			{Notes: map[byte]Velocity{36: F}, T: 96 * 2},
+			{Notes: map[byte]Velocity{22: F}, T: 96},
+		},
+		BPM:     100,
+		Meta:    []*Meta{{96 * 2, MetaMarker, []byte("X")}},
+		TimeSig: TimeSig{3, 4},
+	}
+	got := tr.Slice(2, 4)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Slice(2, 4)=%v, want %v", got, want)
+	}
+}
+
+func TestSlice_empty(t *testing.T) {
+	tr := &Track{Hits: []*Hit{{Notes: map[byte]Velocity{36: F}, T: 96}}, BPM: 90}
+	for _, r := range [][2]int{{1, 3}, {2, 1}, {-5, 0}} {
+		got := tr.Slice(r[0], r[1])
+		if len(got.Hits) != 0 || got.BPM != 90 {
+			t.Errorf("Slice(%v, %v)=%v, want empty track", r[0], r[1], got)
+		}
+	}
+}
+
+func TestRemap(t *testing.T) {
+	tr := &Track{Hits: []*Hit{
+		{Notes: map[byte]Velocity{22: F, 36: P}, T: 96},
+		{Notes: map[byte]Velocity{22: PP, 42: FF, 38: F}, T: 48},
+	}}
+	want := []*Hit{
+		{Notes: map[byte]Velocity{42: F, 36: P}, T: 96},
+		{Notes: map[byte]Velocity{42: FF, 40: F}, T: 48},
+	}
+	tr.Remap(map[byte]byte{22: 42, 38: 40})
+	if !reflect.DeepEqual(tr.Hits, want) {
+		t.Fatalf("Remap(...)=%v, want %v", tr.Hits, want)
+	}
+}
+
+func TestQuantize(t *testing.T) {
+	tr := &Track{Hits: []*Hit{
+		{T: 5},
+		{Notes: map[byte]Velocity{36: F, 22: P}, Offsets: map[byte]int{22: 10},
+			T: 40},
+		{Notes: map[byte]Velocity{38: F}, T: 2},
+		{Notes: map[byte]Velocity{38: FF, 36: P}, T: 48},
+		{Notes: map[byte]Velocity{22: FF}, T: 3},
+	}}
+	want := []*Hit{
+		{Notes: map[byte]Velocity{36: F}, T: 24},
+		{Notes: map[byte]Velocity{22: P}, T: 24},
+		{Notes: map[byte]Velocity{38: FF, 36: P}, T: 48},
+		{Notes: map[byte]Velocity{22: FF}, T: 96},
+	}
+	tr.Quantize(24)
+	if !reflect.DeepEqual(tr.Hits, want) {
+		t.Fatalf("Quantize(24)=%v, want %v", tr.Hits, want)
+	}
+}
+
+func TestScaleVelocity(t *testing.T) {
+	tr := &Track{Hits: []*Hit{
+		{Notes: map[byte]Velocity{36: 100, 38: 50}, T: 96},
+		{Notes: map[byte]Velocity{42: 1}, T: 96},
+	}}
+	tr.ScaleVelocity(1.5)
+	want := []*Hit{
+		{Notes: map[byte]Velocity{36: 127, 38: 75}, T: 96},
+		{Notes: map[byte]Velocity{42: 2}, T: 96},
+	}
+	if !reflect.DeepEqual(tr.Hits, want) {
+		t.Fatalf("ScaleVelocity(1.5)=%v, want %v", tr.Hits, want)
+	}
+
+	tr.ScaleVelocity(0.001)
+	want = []*Hit{
+		{Notes: map[byte]Velocity{36: 1, 38: 1}, T: 96},
+		{Notes: map[byte]Velocity{42: 1}, T: 96},
+	}
+	if !reflect.DeepEqual(tr.Hits, want) {
+		t.Fatalf("ScaleVelocity(0.001)=%v, want %v", tr.Hits, want)
+	}
+}
+
+func TestNormalizeVelocity(t *testing.T) {
+	tr := &Track{Hits: []*Hit{
+		{Notes: map[byte]Velocity{36: 80, 38: 40}, T: 96},
+		{Notes: map[byte]Velocity{42: 20}, T: 96},
+		{T: 96},
+	}}
+	tr.NormalizeVelocity(120)
+	want := []*Hit{
+		{Notes: map[byte]Velocity{36: 120, 38: 60}, T: 96},
+		{Notes: map[byte]Velocity{42: 30}, T: 96},
+		{T: 96},
+	}
+	if !reflect.DeepEqual(tr.Hits, want) {
+		t.Fatalf("NormalizeVelocity(120)=%v, want %v", tr.Hits, want)
+	}
+}
+
+func TestMute(t *testing.T) {
+	tr, _ := ParseTrack("K,HC S,HC,C1 HO1 T1")
+	tr.Mute(Kits["ezdrummer"], ClassHat, ClassCymbal)
+	want := []map[byte]Velocity{{36: F}, {38: F}, {}, {48: F}}
+	for i, h := range tr.Hits {
+		if !reflect.DeepEqual(h.Notes, want[i]) {
+			t.Errorf("Mute() hit #%v=%v, want %v", i+1, h.Notes, want[i])
+		}
+	}
+}
+
+func TestStems(t *testing.T) {
+	tr, _ := ParseTrack("bpm:80 K,HC S,HC K,HC,55 HC")
+	stems := tr.Stems(Kits["ezdrummer"])
+	if len(stems) != 4 {
+		t.Fatalf("Stems() returned %v stems, want 4", len(stems))
+	}
+	wantHits := map[Class][]byte{
+		ClassKick:   {36, 0, 36, 0},
+		ClassSnare:  {0, 38, 0, 0},
+		ClassHat:    {22, 22, 22, 22},
+		ClassCymbal: {0, 0, 55, 0},
+	}
+	for c, notes := range wantHits {
+		stem := stems[c]
+		if stem == nil || stem.BPM != 80 || stem.ticks() != tr.ticks() {
+			t.Errorf("Stems()[%v]=%v, want a track in sync with the original", c, stem)
+			continue
+		}
+		for i, n := range notes {
+			h := stem.Hits[i]
+			if (n == 0 && !h.IsRest()) || (n != 0 && (len(h.Notes) != 1 || h.Notes[n] == 0)) {
+				t.Errorf("Stems()[%v] hit #%v=%v, want note %v", c, i+1, h.Notes, n)
+			}
+		}
+	}
+	if len(tr.Hits[2].Notes) != 3 {
+		t.Errorf("Stems() changed the original track: %v", tr.Hits[2].Notes)
+	}
+}
+
+func TestSplitByNote(t *testing.T) {
+	tr := mustParse(t, "bpm:80 marker:A K,HC@-2 S+,HC K,HC HC")
+	split := tr.SplitByNote()
+	if len(split) != 3 {
+		t.Fatalf("SplitByNote() returned %v tracks, want 3", len(split))
+	}
+	hc := ezDrummer["HC"]
+	want := &Track{
+		Hits: []*Hit{{Notes: map[byte]Velocity{hc: F}, T: 96,
+			Offsets: map[byte]int{hc: -2}}, NewHit(96, F, hc), NewHit(96, F, hc),
+			NewHit(96, F, hc)},
+		BPM:  80,
+		Meta: []*Meta{{0, MetaMarker, []byte("A")}},
+	}
+	if !reflect.DeepEqual(split[hc], want) {
+		t.Errorf("SplitByNote()[HC]=%v, want %v", split[hc], want)
+	}
+	if h := split[ezDrummer["S"]].Hits; !h[0].IsRest() || h[1].Notes[ezDrummer["S"]] != FF {
+		t.Errorf("SplitByNote()[S]=%v, want a rest and a loud snare", h)
+	}
+
+	got, err := MergeNotes(split)
+	if err != nil {
+		t.Fatalf("MergeNotes() failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, tr) {
+		t.Errorf("MergeNotes()=%v, want %v", got, tr)
+	}
+}
+
+func TestClassOf(t *testing.T) {
+	tests := []struct {
+		note byte
+		want Class
+	}{
+		{36, ClassKick}, {40, ClassSnare}, {24, ClassHat}, {82, ClassTom},
+		{49, ClassCymbal}, {100, ClassPerc},
+	}
+	for _, test := range tests {
+		if got := ClassOf(test.note); got != test.want {
+			t.Errorf("ClassOf(%v)=%v, want %v", test.note, got, test.want)
+		}
+	}
+	if got := Kits["gm"].ClassOf(49); got != ClassCymbal {
+		t.Errorf("gm ClassOf(49)=%v, want %v", got, ClassCymbal)
+	}
+}
+
+func TestThinControls(t *testing.T) {
+	tr := &Track{}
+	for i := uint(0); i <= 96; i += 4 {
+		tr.Controls = append(tr.Controls, &Control{i, 4, byte(i), ControlChange})
+	}
+	tr.Controls = append(tr.Controls, &Control{10, 1, 5, ControlChange},
+		&Control{11, 1, 5, ControlChange})
+	tr.ThinControls(4, 10)
+
+	var got []Control
+	for _, c := range tr.Controls {
+		got = append(got, *c)
+	}
+	want := []Control{
+		{0, 4, 0, ControlChange}, {10, 1, 5, ControlChange},
+		{11, 1, 5, ControlChange}, {24, 4, 24, ControlChange},
+		{48, 4, 48, ControlChange}, {72, 4, 72, ControlChange},
+		{96, 4, 96, ControlChange},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ThinControls(4,10)=%v, want %v", got, want)
+	}
+}
+
+func TestSubdivision(t *testing.T) {
+	tr := &Track{
+		Hits:    []*Hit{{Notes: map[byte]Velocity{36: F}, T: 100}},
+		BPM:     90,
+		TimeSig: TimeSig{3, 4},
+	}
+	got, err := tr.Subdivision(12, 37, PP)
+	if err != nil {
+		t.Fatalf("Subdivision(12) failed: %v", err)
+	}
+	want := &Track{
+		Hits: []*Hit{
+			{Notes: map[byte]Velocity{37: PP}, T: 24},
+			{Notes: map[byte]Velocity{37: PP}, T: 24},
+			{Notes: map[byte]Velocity{37: PP}, T: 24},
+			{Notes: map[byte]Velocity{37: PP}, T: 24},
+			{Notes: map[byte]Velocity{37: PP}, T: 4},
+		},
+		BPM:     90,
+		TimeSig: TimeSig{3, 4},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Subdivision(12)=%v, want %v", got, want)
+	}
+	if _, err := tr.Subdivision(7, 37, PP); err == nil {
+		t.Errorf("Subdivision(7) succeeded, want failure")
+	}
+}
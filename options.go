@@ -0,0 +1,126 @@
+package beatnik
+
+// Parsing options.
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ParseOptions control the parser, for example so that programs that embed it,
+// like web services, can bound and restrict what sources may do. The zero
+// value parses like ParseTrack.
+type ParseOptions struct {
+	// Reject drum numbers in hits, like "38", so that scores name all their
+	// drums, with built-in names or aliases, and stay portable across kits.
+	// Aliases may still be defined by number.
+	RequireAliases bool
+
+	// Bounds on the parsed track. Zero fields take the values of
+	// DefaultLimits.
+	Limits Limits
+
+	// Range of tempos that the bpm and bpmramp directives may set. Zero
+	// fields take the default range of 1 to 500.
+	MinBPM, MaxBPM int
+
+	// Record the source text of each hit in Hit.Span.
+	Spans bool
+
+	// Where the track's hits are taken from, for reusing the memory of hits
+	// across parses. Nil for new hits.
+	Hits *HitBuffer
+
+	// Handlers of custom directives by name. They replace the built-in
+	// directives of the same name, and a nil handler disables a built-in
+	// directive. Nil for only the built-in directives.
+	Directives map[string]DirectiveFunc
+}
+
+// A DirectiveFunc handles a custom directive. It gets where the directive is,
+// with the track that is being built, and the directive's value, as in "1" for
+// "mydirective:1". A returned error is reported at the directive.
+type DirectiveFunc func(at DirectiveContext, value string) error
+
+// A DirectiveContext is where a directive is, in the source and in the track
+// that is being built, for directives that act on their position, like
+// markers and tempo ramps.
+type DirectiveContext struct {
+	Track *Track // Track being built, whose hits end at the directive.
+
+	File string // File of the directive, empty if it is not from a file.
+	Line int    // 1-based line number, 0 if the directive is not from source.
+	Col  int    // 1-based column, in runes (not bytes).
+
+	Tick uint // Absolute tick of the directive, from the start of the track.
+	Bar  int  // 1-based bar of the directive, by the track's time signature.
+	Beat int  // 1-based beat of the directive within its bar.
+}
+
+// Default range of tempos.
+const (
+	defaultMinBPM = 1
+	defaultMaxBPM = 500
+)
+
+// bpmRange returns the range of tempos that the options allow.
+func (o *ParseOptions) bpmRange() (int, int) {
+	min, max := o.MinBPM, o.MaxBPM
+	if min == 0 {
+		min = defaultMinBPM
+	}
+	if max == 0 {
+		max = defaultMaxBPM
+	}
+	return min, max
+}
+
+// checkBPM checks that a tempo is in the range that the options allow.
+func (o *ParseOptions) checkBPM(bpm int) error {
+	min, max := o.bpmRange()
+	if bpm < min || bpm > max {
+		return newError(CodeBPMRange, bpm, min, max)
+	}
+	return nil
+}
+
+// ParseTrackWithOptions parses hit notations like ParseTrack, using the given
+// options. PPQ is not configurable, since tracks always have 96 ticks per
+// quarter.
+func ParseTrackWithOptions(s string, opts ParseOptions) (*Track, error) {
+	p := newParser()
+	p.opts = opts
+	p.hits.buf = opts.Hits
+	p.limits = opts.Limits.withDefaults(DefaultLimits)
+	if errs := p.parseTokens(tokenize(s), false); len(errs) > 0 {
+		return nil, errs[0]
+	}
+	if err := p.finish(); err != nil {
+		return nil, err
+	}
+	return p.t, nil
+}
+
+// checkNames checks the drum names of a hit token, without its grace
+// parentheses, according to the parser's options.
+func (p *parser) checkNames(s string) error {
+	if !p.opts.RequireAliases {
+		return nil
+	}
+	m, ok := matchHit(s)
+	if !ok {
+		return nil // Reported by parseHit.
+	}
+	for _, part := range strings.Split(m.notes(s), ",") {
+		nm, ok := matchNote(part)
+		if !ok {
+			continue
+		}
+		for _, name := range altNames(nm.name(part)) {
+			if _, err := strconv.Atoi(name); err == nil {
+				return newError(CodeNumericDrum, name)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package beatnik
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTrackWithOptions_requireAliases(t *testing.T) {
+	opts := ParseOptions{RequireAliases: true}
+	in := "alias:Cow=56 K,Cow (S..) alt(S|SR)"
+	got, err := ParseTrackWithOptions(in, opts)
+	if err != nil {
+		t.Fatalf("ParseTrackWithOptions(%q) failed: %v", in, err)
+	}
+	want, _ := ParseTrack(in)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseTrackWithOptions(%q)=%v, want %v", in, got, want)
+	}
+
+	for _, in := range []string{"K,38", "K (38..)", "alt(S|40)", "K 36+."} {
+		_, err := ParseTrackWithOptions(in, opts)
+		if e, ok := err.(*Error); !ok || e.Code != CodeNumericDrum {
+			t.Errorf("ParseTrackWithOptions(%q) error=%v, want %v", in, err,
+				CodeNumericDrum)
+		}
+		if _, err := ParseTrack(in); err != nil {
+			t.Errorf("ParseTrack(%q) failed: %v", in, err)
+		}
+	}
+}
+
+func TestParseTrackWithOptions(t *testing.T) {
+	var got []DirectiveContext
+	opts := ParseOptions{
+		Limits: Limits{MaxHits: 3},
+		MinBPM: 60,
+		MaxBPM: 200,
+		Directives: map[string]DirectiveFunc{
+			"note": func(at DirectiveContext, value string) error {
+				got = append(got, at)
+				at.Track.Meta = append(at.Track.Meta, &Meta{at.Tick, MetaText,
+					[]byte(value)})
+				return nil
+			},
+			"include": nil,
+		},
+	}
+	tr, err := ParseTrackWithOptions("bpm:60 K note:hi S~~\n note:there "+
+		"bpmramp:200..60,1", opts)
+	if err != nil {
+		t.Fatalf("ParseTrackWithOptions() failed: %v", err)
+	}
+	want := []DirectiveContext{{tr, "", 1, 10, 96, 1, 2},
+		{tr, "", 2, 2, 480, 2, 2}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("custom directive got %v, want %v", got, want)
+	}
+	if len(tr.Meta) < 2 || tr.Meta[0].T != 96 || tr.Meta[1].T != 480 {
+		t.Errorf("Meta=%v, want text events at ticks 96 and 480", tr.Meta)
+	}
+
+	tests := []struct {
+		in   string
+		want Code
+	}{
+		{"bpm:59", CodeBPMRange},
+		{"bpm:201", CodeBPMRange},
+		{"bpmramp:100..300,1", CodeBPMRange},
+		{"K S K S", CodeTooManyHits},
+		{"include:x.txt", CodeUnknownDirective},
+	}
+	for _, test := range tests {
+		_, err := ParseTrackWithOptions(test.in, opts)
+		if e, ok := err.(*Error); !ok || e.Code != test.want {
+			t.Errorf("ParseTrackWithOptions(%q) error=%v, want %v", test.in, err,
+				test.want)
+		}
+	}
+	if _, err := ParseTrack("bpm:300"); err != nil {
+		t.Errorf("ParseTrack(bpm:300) failed: %v", err)
+	}
+}
+
+func TestParseTrackWithOptions_spans(t *testing.T) {
+	in := "section:a K,HC S\n  HC. section: play:a"
+	tr, err := ParseTrackWithOptions(in, ParseOptions{Spans: true})
+	if err != nil {
+		t.Fatalf("ParseTrackWithOptions(%q) failed: %v", in, err)
+	}
+	want := []SourceSpan{{"", 1, 11, 15}, {"", 1, 16, 17}, {"", 2, 3, 6},
+		{"", 1, 11, 15}, {"", 1, 16, 17}, {"", 2, 3, 6}}
+	if len(tr.Hits) != len(want) {
+		t.Fatalf("len(Hits)=%v, want %v", len(tr.Hits), len(want))
+	}
+	for i := range want {
+		if tr.Hits[i].Span == nil || *tr.Hits[i].Span != want[i] {
+			t.Errorf("Hits[%v].Span=%v, want %v", i, tr.Hits[i].Span, want[i])
+		}
+	}
+
+	tr, _ = ParseTrack(in)
+	for i, h := range tr.Hits {
+		if h.Span != nil {
+			t.Errorf("Hits[%v].Span=%v, want nil", i, h.Span)
+		}
+	}
+}
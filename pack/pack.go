@@ -0,0 +1,215 @@
+// Package pack loads groove packs: directories of beatnik patterns described
+// by a manifest, so that patterns can be shared and used by programs.
+//
+// A pack directory holds a pack.json manifest and the pattern files it lists,
+// for example:
+//
+//	{
+//	  "name": "funk-basics",
+//	  "version": "1.2.0",
+//	  "kits": ["ezdrummer"],
+//	  "patterns": [
+//	    {"name": "groove1", "file": "groove1.bk", "minBPM": 80, "maxBPM": 110}
+//	  ]
+//	}
+package pack
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/fluhus/beatnik"
+)
+
+// ManifestFile is the name of the manifest in a pack directory.
+const ManifestFile = "pack.json"
+
+// A Manifest describes a groove pack.
+type Manifest struct {
+	Name        string     `json:"name"`
+	Version     string     `json:"version"` // Semantic version, like "1.2.0".
+	Description string     `json:"description,omitempty"`
+	Kits        []string   `json:"kits,omitempty"` // Names of required kits in beatnik.Kits.
+	Patterns    []*Pattern `json:"patterns"`
+}
+
+// A Pattern is a single groove in a pack.
+type Pattern struct {
+	Name string `json:"name"`
+	File string `json:"file"` // Path relative to the pack directory.
+
+	// Range of tempos the pattern is meant for, 0 for no limit.
+	MinBPM uint `json:"minBPM,omitempty"`
+	MaxBPM uint `json:"maxBPM,omitempty"`
+}
+
+// ReadManifest decodes a JSON manifest. The manifest is not validated.
+func ReadManifest(r io.Reader) (*Manifest, error) {
+	m := &Manifest{}
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(m); err != nil {
+		return nil, fmt.Errorf("pack: bad manifest: %v", err)
+	}
+	return m, nil
+}
+
+// namePattern matches valid pack and pattern names.
+var namePattern = regexp.MustCompile("^[a-z0-9][a-z0-9_-]*$")
+
+// Validate checks that the manifest is complete and consistent. Returns all
+// the problems found, or nil if there are none.
+func (m *Manifest) Validate() []error {
+	var errs []error
+	if !namePattern.MatchString(m.Name) {
+		errs = append(errs, fmt.Errorf("bad pack name: %q, should be lowercase "+
+			"letters, digits, - and _", m.Name))
+	}
+	if _, err := ParseVersion(m.Version); err != nil {
+		errs = append(errs, err)
+	}
+	for _, k := range m.Kits {
+		if beatnik.Kits[k] == nil {
+			errs = append(errs, fmt.Errorf("unknown kit: %q", k))
+		}
+	}
+	if len(m.Patterns) == 0 {
+		errs = append(errs, fmt.Errorf("pack has no patterns"))
+	}
+	names := map[string]bool{}
+	for _, p := range m.Patterns {
+		if !namePattern.MatchString(p.Name) {
+			errs = append(errs, fmt.Errorf("bad pattern name: %q", p.Name))
+		}
+		if names[p.Name] {
+			errs = append(errs, fmt.Errorf("duplicate pattern name: %q", p.Name))
+		}
+		names[p.Name] = true
+		if p.File == "" || filepath.IsAbs(p.File) ||
+			filepath.Clean(p.File) != p.File || p.File[0] == '.' {
+			errs = append(errs, fmt.Errorf("pattern %q: bad file: %q, should "+
+				"be a path inside the pack", p.Name, p.File))
+		}
+		if p.MaxBPM != 0 && p.MinBPM > p.MaxBPM {
+			errs = append(errs, fmt.Errorf("pattern %q: minBPM %v is above "+
+				"maxBPM %v", p.Name, p.MinBPM, p.MaxBPM))
+		}
+	}
+	return errs
+}
+
+// A Pack is a loaded groove pack.
+type Pack struct {
+	Manifest *Manifest
+	Tracks   map[string]*beatnik.Track // Parsed patterns by name.
+}
+
+// Load reads the pack in the given directory, validates its manifest and
+// parses its patterns. Files with a .tab extension are parsed as drum tabs.
+// Patterns whose tempo is outside their range fail the load.
+func Load(dir string) (*Pack, error) {
+	f, err := os.Open(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	m, err := ReadManifest(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	if errs := m.Validate(); len(errs) > 0 {
+		return nil, fmt.Errorf("pack: %v", beatnik.ErrorList(errs))
+	}
+
+	p := &Pack{Manifest: m, Tracks: map[string]*beatnik.Track{}}
+	for _, pat := range m.Patterns {
+		src, err := ioutil.ReadFile(filepath.Join(dir, pat.File))
+		if err != nil {
+			return nil, err
+		}
+		var t *beatnik.Track
+		if filepath.Ext(pat.File) == ".tab" {
+			t, err = beatnik.ParseTab(string(src))
+		} else {
+			t, err = beatnik.ParseTrack(string(src))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("pack: %v: %v", pat.File, err)
+		}
+		if bpm := t.TempoMap().BPM(0); bpm != 0 && !pat.Fits(bpm) {
+			return nil, fmt.Errorf("pack: %v: tempo %v BPM is outside the "+
+				"pattern's range", pat.File, bpm)
+		}
+		p.Tracks[pat.Name] = t
+	}
+	return p, nil
+}
+
+// Fits returns true if the given tempo is in the pattern's tempo range.
+func (p *Pattern) Fits(bpm uint) bool {
+	return bpm >= p.MinBPM && (p.MaxBPM == 0 || bpm <= p.MaxBPM)
+}
+
+// A Version is a semantic version: major.minor.patch.
+type Version struct {
+	Major, Minor, Patch int
+}
+
+// versionPattern matches semantic versions without pre-release and build
+// parts.
+var versionPattern = regexp.MustCompile("^(0|[1-9][0-9]*)\\.(0|[1-9][0-9]*)\\." +
+	"(0|[1-9][0-9]*)$")
+
+// ParseVersion parses a version like "1.2.0".
+func ParseVersion(s string) (Version, error) {
+	m := versionPattern.FindStringSubmatch(s)
+	if m == nil {
+		return Version{}, fmt.Errorf("bad version: %q, should be like 1.2.0", s)
+	}
+	var v Version
+	for i, x := range []*int{&v.Major, &v.Minor, &v.Patch} {
+		n, err := strconv.Atoi(m[i+1])
+		if err != nil {
+			return Version{}, fmt.Errorf("bad version: %q: %v", s, err)
+		}
+		*x = n
+	}
+	return v, nil
+}
+
+// String returns the version in major.minor.patch form.
+func (v Version) String() string {
+	return fmt.Sprintf("%v.%v.%v", v.Major, v.Minor, v.Patch)
+}
+
+// Compare returns -1 if v is older than other, 1 if it is newer and 0 if they
+// are equal.
+func (v Version) Compare(other Version) int {
+	a := []int{v.Major, v.Minor, v.Patch}
+	b := []int{other.Major, other.Minor, other.Patch}
+	for i := range a {
+		switch {
+		case a[i] < b[i]:
+			return -1
+		case a[i] > b[i]:
+			return 1
+		}
+	}
+	return 0
+}
+
+// Compatible returns true if a pack of version v can be used by a program
+// written for version other: same major version, and not older. Major
+// version 0 packs are compatible only within the same minor version.
+func (v Version) Compatible(other Version) bool {
+	if v.Major != other.Major || v.Compare(other) < 0 {
+		return false
+	}
+	return v.Major != 0 || v.Minor == other.Minor
+}
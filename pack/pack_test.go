@@ -0,0 +1,105 @@
+package pack
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		ManifestFile: `{"name": "test", "version": "1.0.2", "kits": ["gm"],
+			"patterns": [{"name": "a", "file": "a.bk", "minBPM": 90},
+			{"name": "b", "file": "b.tab"}]}`,
+		"a.bk":  "bpm:100 K S K S",
+		"b.tab": "HH|x-x-x-x-|\n B|o---o---|\n",
+	}
+	for name, s := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(s),
+			0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if p.Manifest.Name != "test" || len(p.Tracks) != 2 {
+		t.Fatalf("Load()=%+v, want pack test with 2 tracks", p)
+	}
+	if got := len(p.Tracks["a"].Hits); got != 4 {
+		t.Errorf("len(Tracks[a].Hits)=%v, want 4", got)
+	}
+
+	// Out of range tempo.
+	ioutil.WriteFile(filepath.Join(dir, "a.bk"), []byte("bpm:60 K"), 0644)
+	if _, err := Load(dir); err == nil {
+		t.Errorf("Load() with tempo out of range succeeded, want failure")
+	}
+}
+
+func TestManifest_Validate(t *testing.T) {
+	tests := []string{
+		`{"name": "", "version": "1.0.0", "patterns": [{"name": "a", "file": "a"}]}`,
+		`{"name": "x", "version": "1.0", "patterns": [{"name": "a", "file": "a"}]}`,
+		`{"name": "x", "version": "1.0.0", "patterns": []}`,
+		`{"name": "x", "version": "1.0.0", "kits": ["nope"], "patterns": [{"name": "a", "file": "a"}]}`,
+		`{"name": "x", "version": "1.0.0", "patterns": [{"name": "a", "file": "../a"}]}`,
+		`{"name": "x", "version": "1.0.0", "patterns": [{"name": "a", "file": "a"}, {"name": "a", "file": "b"}]}`,
+		`{"name": "x", "version": "1.0.0", "patterns": [{"name": "a", "file": "a", "minBPM": 100, "maxBPM": 90}]}`,
+	}
+	for _, test := range tests {
+		m, err := ReadManifest(strings.NewReader(test))
+		if err != nil {
+			t.Errorf("ReadManifest(%v) failed: %v", test, err)
+			continue
+		}
+		if errs := m.Validate(); len(errs) != 1 {
+			t.Errorf("Validate(%v)=%v, want 1 error", test, errs)
+		}
+	}
+}
+
+func TestVersion(t *testing.T) {
+	tests := []struct {
+		a, b       string
+		cmp        int
+		compatible bool
+	}{
+		{"1.2.3", "1.2.3", 0, true},
+		{"1.3.0", "1.2.9", 1, true},
+		{"1.2.0", "1.10.0", -1, false},
+		{"2.0.0", "1.0.0", 1, false},
+		{"0.3.1", "0.3.0", 1, true},
+		{"0.4.0", "0.3.0", 1, false},
+	}
+	for _, test := range tests {
+		a, err := ParseVersion(test.a)
+		if err != nil {
+			t.Fatalf("ParseVersion(%q) failed: %v", test.a, err)
+		}
+		b, err := ParseVersion(test.b)
+		if err != nil {
+			t.Fatalf("ParseVersion(%q) failed: %v", test.b, err)
+		}
+		if got := a.Compare(b); got != test.cmp {
+			t.Errorf("%v.Compare(%v)=%v, want %v", a, b, got, test.cmp)
+		}
+		if got := a.Compatible(b); got != test.compatible {
+			t.Errorf("%v.Compatible(%v)=%v, want %v", a, b, got, test.compatible)
+		}
+	}
+	for _, s := range []string{"", "1", "1.2", "01.2.3", "1.2.3-rc1", "v1.2.3"} {
+		if v, err := ParseVersion(s); err == nil {
+			t.Errorf("ParseVersion(%q)=%v, want failure", s, v)
+		}
+	}
+}
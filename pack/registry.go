@@ -0,0 +1,286 @@
+package pack
+
+// Client of remote pack registries.
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// An Index lists the packs that a registry offers. Registries serve it as
+// JSON.
+type Index struct {
+	Packs []*IndexEntry `json:"packs"`
+}
+
+// An IndexEntry is a single version of a pack in a registry.
+type IndexEntry struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	URL     string `json:"url"`    // Zip archive of the pack directory, relative to the index.
+	SHA256  string `json:"sha256"` // Hex checksum of the archive.
+}
+
+// maxArchiveSize is the largest pack archive that is downloaded, in bytes.
+const maxArchiveSize = 32 << 20
+
+// A Client fetches packs from a registry and keeps them in a local cache,
+// where each version of a pack is a directory named <cache>/<name>/<version>.
+type Client struct {
+	Index string       // URL of the registry's index.
+	Cache string       // Cache directory.
+	HTTP  *http.Client // Nil for http.DefaultClient.
+}
+
+// DefaultCache returns the default cache directory, under the user's cache
+// directory.
+func DefaultCache() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "beatnik", "packs"), nil
+}
+
+// Get returns the latest version of the named pack, downloading it if it is
+// not cached.
+func (c *Client) Get(name string) (*Pack, error) {
+	dir, err := c.Fetch(name)
+	if err != nil {
+		return nil, err
+	}
+	return Load(dir)
+}
+
+// Fetch makes sure that the latest version of the named pack is cached, and
+// returns its directory. The archive is verified against the index's checksum
+// before it is extracted.
+func (c *Client) Fetch(name string) (string, error) {
+	idx, err := c.fetchIndex()
+	if err != nil {
+		return "", err
+	}
+	var entry *IndexEntry
+	var latest Version
+	for _, e := range idx.Packs {
+		if e.Name != name {
+			continue
+		}
+		v, err := ParseVersion(e.Version)
+		if err != nil {
+			return "", fmt.Errorf("pack: index entry %q: %v", name, err)
+		}
+		if entry == nil || v.Compare(latest) > 0 {
+			entry, latest = e, v
+		}
+	}
+	if entry == nil {
+		return "", fmt.Errorf("pack: %q is not in the registry", name)
+	}
+	if !namePattern.MatchString(name) {
+		return "", fmt.Errorf("pack: bad pack name: %q", name)
+	}
+
+	dir := filepath.Join(c.Cache, name, latest.String())
+	if _, err := os.Stat(dir); err == nil {
+		return dir, nil
+	}
+	u, err := c.resolve(entry.URL)
+	if err != nil {
+		return "", err
+	}
+	b, err := c.download(u)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	if hex.EncodeToString(sum[:]) != strings.ToLower(entry.SHA256) {
+		return "", fmt.Errorf("pack: checksum mismatch for %v %v", name, latest)
+	}
+
+	// Extract next to the final directory, so a failed extraction never
+	// leaves a partial pack in the cache.
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return "", err
+	}
+	tmp, err := ioutil.TempDir(filepath.Dir(dir), ".tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	if err := extract(b, tmp); err != nil {
+		return "", fmt.Errorf("pack: %v %v: %v", name, latest, err)
+	}
+	if err := os.Rename(tmp, dir); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// fetchIndex downloads and decodes the registry's index.
+func (c *Client) fetchIndex() (*Index, error) {
+	b, err := c.download(c.Index)
+	if err != nil {
+		return nil, err
+	}
+	idx := &Index{}
+	if err := json.Unmarshal(b, idx); err != nil {
+		return nil, fmt.Errorf("pack: bad index: %v", err)
+	}
+	return idx, nil
+}
+
+// resolve returns the URL of an index entry's archive.
+func (c *Client) resolve(ref string) (string, error) {
+	base, err := url.Parse(c.Index)
+	if err != nil {
+		return "", err
+	}
+	u, err := base.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+// download returns the body of the given URL.
+func (c *Client) download(u string) ([]byte, error) {
+	hc := c.HTTP
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("pack: %v: %v", u, resp.Status)
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxArchiveSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxArchiveSize {
+		return nil, fmt.Errorf("pack: %v is larger than %v bytes", u,
+			maxArchiveSize)
+	}
+	return b, nil
+}
+
+// extract writes the files of a zip archive to dir. Fails on paths that
+// would end up outside dir.
+func extract(b []byte, dir string) error {
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		name := path.Clean(f.Name)
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return fmt.Errorf("bad file path in archive: %q", f.Name)
+		}
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		r, err := f.Open()
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(target, data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Cached returns the directory of the latest cached version of the named
+// pack, without contacting the registry.
+func (c *Client) Cached(name string) (string, error) {
+	if !namePattern.MatchString(name) {
+		return "", fmt.Errorf("pack: bad pack name: %q", name)
+	}
+	infos, err := ioutil.ReadDir(filepath.Join(c.Cache, name))
+	if err != nil {
+		return "", fmt.Errorf("pack: %q is not installed", name)
+	}
+	var best string
+	var latest Version
+	for _, info := range infos {
+		v, err := ParseVersion(info.Name())
+		if err != nil || !info.IsDir() {
+			continue
+		}
+		if best == "" || v.Compare(latest) > 0 {
+			best, latest = info.Name(), v
+		}
+	}
+	if best == "" {
+		return "", fmt.Errorf("pack: %q is not installed", name)
+	}
+	return filepath.Join(c.Cache, name, best), nil
+}
+
+// IncludePrefix starts include paths that refer to cached packs, as in
+// "include:pack:rock-essentials/groove1".
+const IncludePrefix = "pack:"
+
+// Open reads a pattern of a cached pack, for use in a beatnik.Opener. path is
+// the pack name and either a pattern name or a file in the pack, like
+// "rock-essentials/groove1", optionally prefixed by IncludePrefix.
+func (c *Client) Open(p string) ([]byte, error) {
+	p = strings.TrimPrefix(filepath.ToSlash(p), IncludePrefix)
+	i := strings.IndexByte(p, '/')
+	if i == -1 {
+		return nil, fmt.Errorf("pack: bad pattern path: %q, should be "+
+			"pack/pattern", p)
+	}
+	dir, err := c.Cached(p[:i])
+	if err != nil {
+		return nil, err
+	}
+	file := path.Clean(p[i+1:])
+	f, err := os.Open(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	m, err := ReadManifest(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	for _, pat := range m.Patterns {
+		if pat.Name == file {
+			file = pat.File
+			break
+		}
+	}
+	if path.IsAbs(file) || file == ".." || strings.HasPrefix(file, "../") {
+		return nil, fmt.Errorf("pack: bad pattern path: %q", p)
+	}
+	return ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(file)))
+}
@@ -0,0 +1,102 @@
+package pack
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+// zipFiles returns a zip archive of the given files.
+func zipFiles(t *testing.T, files map[string]string) []byte {
+	buf := bytes.NewBuffer(nil)
+	zw := zip.NewWriter(buf)
+	for name, s := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(s))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestClient(t *testing.T) {
+	archive := zipFiles(t, map[string]string{
+		ManifestFile: `{"name": "rock", "version": "1.1.0",
+			"patterns": [{"name": "beat", "file": "grooves/beat.bk"}]}`,
+		"grooves/beat.bk": "bpm:120 K S K S",
+	})
+	sum := sha256.Sum256(archive)
+	badArchive := zipFiles(t, map[string]string{"../evil": "x"})
+	badSum := sha256.Sum256(badArchive)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/index.json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"packs": [
+			{"name": "rock", "version": "1.0.0", "url": "old.zip", "sha256": "00"},
+			{"name": "rock", "version": "1.1.0", "url": "rock.zip", "sha256": %q},
+			{"name": "broken", "version": "1.0.0", "url": "rock.zip", "sha256": "00"},
+			{"name": "evil", "version": "1.0.0", "url": "evil.zip", "sha256": %q}
+		]}`, hex.EncodeToString(sum[:]), hex.EncodeToString(badSum[:]))
+	})
+	downloads := 0
+	mux.HandleFunc("/rock.zip", func(w http.ResponseWriter, r *http.Request) {
+		downloads++
+		w.Write(archive)
+	})
+	mux.HandleFunc("/evil.zip", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(badArchive)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	cache, err := ioutil.TempDir("", "packcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cache)
+	c := &Client{Index: srv.URL + "/index.json", Cache: cache}
+
+	for i := 0; i < 2; i++ {
+		p, err := c.Get("rock")
+		if err != nil {
+			t.Fatalf("Get(rock) failed: %v", err)
+		}
+		if p.Manifest.Version != "1.1.0" || len(p.Tracks["beat"].Hits) != 4 {
+			t.Fatalf("Get(rock)=%+v, want version 1.1.0 with 4 hits", p.Manifest)
+		}
+	}
+	if downloads != 1 {
+		t.Errorf("downloads=%v, want 1", downloads)
+	}
+
+	src, err := c.Open("pack:rock/beat")
+	if err != nil {
+		t.Fatalf("Open(pack:rock/beat) failed: %v", err)
+	}
+	if string(src) != "bpm:120 K S K S" {
+		t.Errorf("Open(pack:rock/beat)=%q, want the pattern's source", src)
+	}
+	if _, err := c.Open("pack:rock/grooves/beat.bk"); err != nil {
+		t.Errorf("Open(pack:rock/grooves/beat.bk) failed: %v", err)
+	}
+
+	for _, name := range []string{"broken", "evil", "missing"} {
+		if _, err := c.Fetch(name); err == nil {
+			t.Errorf("Fetch(%q) succeeded, want failure", name)
+		}
+	}
+	if _, err := c.Cached("broken"); err == nil {
+		t.Errorf("Cached(broken) succeeded, want failure")
+	}
+}
@@ -0,0 +1,226 @@
+package beatnik
+
+// Parallel parsing of sections and included files.
+
+import (
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+// minParallelTokens is the number of tokens below which a source's sections
+// are parsed in a single goroutine, since starting more would cost more than
+// it saves.
+var minParallelTokens = 1000
+
+// parseTokens parses the given tokens in order, and returns the errors at
+// their tokens. Stops at the first error, unless all is true, in which case
+// tokens with errors are skipped, and parsing stops only if the source passes
+// its limits of hits or tokens.
+//
+// The meaning of a section depends on everything before it, so tokens are
+// applied to the track one by one. But hits depend only on the note names in
+// use, which are usually all defined before the first section. So when the
+// first section starts, the hits of all the sections are parsed ahead in
+// other goroutines with the names at that point. Hits whose names changed
+// since are parsed again in turn.
+func (p *parser) parseTokens(toks []token, all bool) []error {
+	var ahead *lookahead
+	defer func() {
+		if ahead != nil {
+			ahead.stop()
+		}
+	}()
+
+	var errs []error
+	for i, tok := range toks {
+		err := p.countToken()
+		if err != nil {
+			errs = append(errs, atToken(err, tok))
+			break
+		}
+		if ahead == nil && len(toks)-i >= minParallelTokens && isSection(tok) {
+			ahead = p.parseAhead(toks, i)
+		}
+		if ahead != nil && ahead.names == p.names && ahead.parsed(i-ahead.start) {
+			ph := ahead.hits[i-ahead.start]
+			err = ph.err
+			if err == nil {
+				err = p.addHit(tok, ph.h, ph.alts)
+			}
+		} else {
+			err = p.parseToken(tok)
+		}
+		if err != nil {
+			errs = append(errs, atToken(err, tok))
+			if !all || stopsParsing(err) {
+				break
+			}
+		}
+	}
+	return errs
+}
+
+// isSection returns true if the token is a section directive.
+func isSection(tok token) bool {
+	name, _, ok := splitDirective(tok.s)
+	return ok && name == "section"
+}
+
+// A lookahead holds the hits of a source's sections, which are parsed ahead
+// in other goroutines.
+type lookahead struct {
+	names int         // Note names version that the hits were parsed with.
+	start int         // Index of the first token in the source.
+	hits  []parsedHit // By token, from start.
+	segs  []int       // Indexes of the tokens that start sections, from start.
+	ready []chan bool // Closed when the hits of each section are parsed.
+	done  chan bool   // Closed when the lookahead is no longer needed.
+	seg   int         // Section of the last checked token.
+	once  sync.Once   // Closes done.
+}
+
+// A parsedHit is a hit token that was parsed ahead of its turn.
+type parsedHit struct {
+	ok   bool // False for tokens that are not hits.
+	h    *Hit
+	alts alts
+	err  error
+}
+
+// parseAhead starts parsing the hits of the tokens from the given index, which
+// is a section directive, in other goroutines. Each section is parsed by one
+// goroutine, with at most one per CPU running at a time.
+func (p *parser) parseAhead(toks []token, start int) *lookahead {
+	names := &parser{aliases: map[string]byte{}, drums: p.drums, opts: p.opts}
+	for k, v := range p.aliases {
+		names.aliases[k] = v
+	}
+	toks = toks[start:]
+	a := &lookahead{names: p.names, start: start,
+		hits: make([]parsedHit, len(toks)), done: make(chan bool)}
+	for i, tok := range toks {
+		if isSection(tok) {
+			a.segs = append(a.segs, i)
+		}
+	}
+	a.segs = append(a.segs, len(toks))
+	a.ready = make([]chan bool, len(a.segs)-1)
+
+	sem := make(chan bool, runtime.GOMAXPROCS(0))
+	for k := range a.ready {
+		a.ready[k] = make(chan bool)
+		go func(k int) {
+			defer close(a.ready[k])
+			select {
+			case sem <- true:
+			case <-a.done:
+				return
+			}
+			defer func() { <-sem }()
+			q := *names
+			q.hits = &hitSlab{buf: p.hits.buf}
+			for i := a.segs[k]; i < a.segs[k+1]; i++ {
+				select {
+				case <-a.done:
+					return
+				default:
+				}
+				if tokenKind(toks[i].s) != TokenHit {
+					continue
+				}
+				h, alts, err := q.parseHitToken(toks[i].s)
+				a.hits[i] = parsedHit{true, h, alts, err}
+			}
+		}(k)
+	}
+	return a
+}
+
+// parsed returns true if the i'th token is a hit that was parsed ahead. Waits
+// for the token's section to be parsed. Tokens should be checked in order.
+func (a *lookahead) parsed(i int) bool {
+	for a.segs[a.seg+1] <= i {
+		a.seg++
+	}
+	<-a.ready[a.seg]
+	return a.hits[i].ok
+}
+
+// stop tells the goroutines that have not started parsing to skip it.
+func (a *lookahead) stop() {
+	a.once.Do(func() { close(a.done) })
+}
+
+// A fetcher reads included files ahead of time. Once a file is read, it is
+// tokenized and the files that it includes are read too, in other goroutines,
+// while the parser works on the files before them.
+type fetcher struct {
+	open  Opener
+	mu    sync.Mutex
+	files map[string]*fetchedFile
+}
+
+// A fetchedFile is a file that a fetcher reads.
+type fetchedFile struct {
+	ready chan bool // Closed when the file is read.
+	toks  []token
+	err   error
+}
+
+// newFetcher returns a fetcher that reads files with open.
+func newFetcher(open Opener) *fetcher {
+	return &fetcher{open: open, files: map[string]*fetchedFile{}}
+}
+
+// fetch starts reading the file at the given path, unless it was read
+// already, and returns it.
+func (f *fetcher) fetch(path string) *fetchedFile {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if ff, ok := f.files[path]; ok {
+		return ff
+	}
+	ff := &fetchedFile{ready: make(chan bool)}
+	f.files[path] = ff
+	go func() {
+		defer close(ff.ready)
+		src, err := f.open(path)
+		if err != nil {
+			ff.err = err
+			return
+		}
+		ff.toks = tokenize(string(src))
+		f.fetchIncludes(path, ff.toks)
+	}()
+	return ff
+}
+
+// fetchIncludes starts reading the files that the given tokens of a file
+// include.
+func (f *fetcher) fetchIncludes(path string, toks []token) {
+	for _, tok := range toks {
+		name, value, ok := splitDirective(tok.s)
+		if ok && name == "include" && value != "" {
+			f.fetch(includePath(path, value))
+		}
+	}
+}
+
+// get returns the tokens of the file at the given path, waiting for it to be
+// read.
+func (f *fetcher) get(path string) ([]token, error) {
+	ff := f.fetch(path)
+	<-ff.ready
+	return ff.toks, ff.err
+}
+
+// includePath returns the path of a file that the file at the given path
+// includes. Paths are relative to the including file, unless they are
+// absolute or have a prefix.
+func includePath(from, path string) string {
+	if filepath.IsAbs(path) || hasPathPrefix(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(from), path)
+}
@@ -0,0 +1,127 @@
+package beatnik
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// sectionsSource returns a score of n sections. If redefine is true, note
+// names change in the middle.
+func sectionsSource(n int, redefine bool) string {
+	src := "bpm:100 alias:x=K alias:y=K\n"
+	for i := 0; i < n; i++ {
+		if redefine && i == n/2 {
+			src += "alias:y=S alias:x=HC map:sd3\n"
+		}
+		src += fmt.Sprintf("section:s%v\n", i) +
+			strings.Repeat("x,HC. HC. (S..) HC,S- x,y?50 ~ | ", 20) + "\n"
+	}
+	return src
+}
+
+// sequentially calls f with parsing ahead turned off.
+func sequentially(f func()) {
+	defer func(n int) { minParallelTokens = n }(minParallelTokens)
+	minParallelTokens = int(^uint(0) >> 1)
+	f()
+}
+
+func TestParseTrack_parallel(t *testing.T) {
+	src := sectionsSource(40, true)
+	got, err := ParseTrack(src)
+	if err != nil {
+		t.Fatalf("ParseTrack() failed: %v", err)
+	}
+	var want *Track
+	sequentially(func() { want, err = ParseTrack(src) })
+	if err != nil {
+		t.Fatalf("ParseTrack() failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseTrack() in parallel differs from sequential parsing")
+	}
+}
+
+func TestParseTrack_parallelErrors(t *testing.T) {
+	src := sectionsSource(40, true)
+	i := strings.LastIndex(src, "section:")
+	src = src[:i] + "K,Q " + src[i:] // Unknown drum.
+	src = strings.Replace(src, "section:s30", "K,Z", 1)
+
+	_, got := ParseTrackAll(src)
+	var want []error
+	sequentially(func() { _, want = ParseTrackAll(src) })
+	if len(got) != 2 || !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseTrackAll()=%v, want %v", got, want)
+	}
+
+	_, err := ParseTrack(src)
+	e, ok := err.(*Error)
+	if !ok || e.Code != CodeBadDrum || e.Line != 63 || e.Col != 1 {
+		t.Errorf("ParseTrack()=%v, want bad drum at 63:1", err)
+	}
+}
+
+func TestParseFile_fetch(t *testing.T) {
+	files := map[string]string{
+		"main.bk":       "include:a.bk include:b.bk include:a.bk",
+		"a.bk":          "K include:lib/c.bk",
+		"b.bk":          "S",
+		"lib/c.bk":      "HC include:../b.bk",
+		"unused.bk":     "T1",
+		"lib/broken.bk": "K,",
+	}
+	var mu sync.Mutex
+	opened := map[string]int{}
+	open := func(path string) ([]byte, error) {
+		mu.Lock()
+		opened[path]++
+		mu.Unlock()
+		return mapOpener(files)(path)
+	}
+	got, err := ParseFile("main.bk", open)
+	if err != nil {
+		t.Fatalf("ParseFile() failed: %v", err)
+	}
+	want := mustParse(t, "K HC S S K HC S")
+	if !reflect.DeepEqual(got.Hits, want.Hits) {
+		t.Errorf("ParseFile().Hits=%v, want %v", got.Hits, want.Hits)
+	}
+	wantOpened := map[string]int{"main.bk": 1, "a.bk": 1, "b.bk": 1,
+		"lib/c.bk": 1}
+	if !reflect.DeepEqual(opened, wantOpened) {
+		t.Errorf("ParseFile() opened %v, want %v", opened, wantOpened)
+	}
+
+	files["main.bk"] = "K include:lib/broken.bk"
+	_, err = ParseFile("main.bk", open)
+	if e, ok := err.(*Error); !ok || e.Code != CodeUnrecognizedToken ||
+		e.File != "lib/broken.bk" {
+		t.Errorf("ParseFile()=%v, want unrecognized token in lib/broken.bk", err)
+	}
+}
+
+func BenchmarkParseTrack_sections(b *testing.B) {
+	src := sectionsSource(100, false)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseTrack(src); err != nil {
+			b.Fatalf("ParseTrack() failed: %v", err)
+		}
+	}
+}
+
+func BenchmarkParseTrack_sectionsSequential(b *testing.B) {
+	src := sectionsSource(100, false)
+	b.ReportAllocs()
+	sequentially(func() {
+		for i := 0; i < b.N; i++ {
+			if _, err := ParseTrack(src); err != nil {
+				b.Fatalf("ParseTrack() failed: %v", err)
+			}
+		}
+	})
+}
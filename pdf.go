@@ -0,0 +1,94 @@
+package beatnik
+
+// Printable drum charts.
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// LilyPondCommand is the LilyPond program that ExportPDF runs. It is looked
+// up in PATH if it has no path separators.
+var LilyPondCommand = "lilypond"
+
+// ExportPDF writes the track as a printable drum chart in PDF format, with
+// its title, tempo, section markers and bar numbers. The chart is engraved by
+// LilyPond from the track's LilyPond notation, so LilyPondCommand should be
+// installed. The title is set with the title directive.
+func ExportPDF(t *Track, w io.Writer) error {
+	ly, err := t.lilyPondChart()
+	if err != nil {
+		return err
+	}
+	cmd, err := exec.LookPath(LilyPondCommand)
+	if err != nil {
+		return newError(CodeNoLilyPond, LilyPondCommand)
+	}
+
+	dir, err := ioutil.TempDir("", "beatnik")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	base := filepath.Join(dir, "chart")
+	if err := ioutil.WriteFile(base+".ly", ly, 0644); err != nil {
+		return err
+	}
+	out, err := exec.Command(cmd, "--pdf", "-o", base, base+".ly").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("lilypond failed: %v\n%s", err, out)
+	}
+	f, err := os.Open(base + ".pdf")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// lilyPondChart returns a LilyPond document that engraves the track as a
+// chart on a drum staff, with its title and bar numbers at every bar.
+func (t *Track) lilyPondChart() ([]byte, error) {
+	music, err := t.MarshalLilyPond()
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer(nil)
+	buf.WriteString("\\version \"2.18.2\"\n\n\\header {\n")
+	if title := t.title(); title != "" {
+		fmt.Fprintf(buf, "  title = %s\n", lilyString(title))
+	}
+	buf.WriteString("  tagline = ##f\n}\n\n\\score {\n  \\new DrumStaff {\n" +
+		"    \\set Score.barNumberVisibility = #all-bar-numbers-visible\n" +
+		"    \\override Score.BarNumber.break-visibility = " +
+		"#end-of-line-invisible\n")
+	for _, line := range strings.Split(strings.TrimSuffix(string(music), "\n"),
+		"\n") {
+		buf.WriteString("    " + line + "\n")
+	}
+	buf.WriteString("  }\n  \\layout { }\n}\n")
+	return buf.Bytes(), nil
+}
+
+// title returns the track's name, or empty if it has none.
+func (t *Track) title() string {
+	for _, m := range t.sortedMeta() {
+		if m.Type == MetaTrackName {
+			return string(m.Data)
+		}
+	}
+	return ""
+}
+
+// lilyString returns s as a quoted LilyPond string.
+func lilyString(s string) string {
+	s = strings.Replace(s, "\\", "\\\\", -1)
+	return "\"" + strings.Replace(s, "\"", "\\\"", -1) + "\""
+}
@@ -0,0 +1,77 @@
+package beatnik
+
+import (
+	"bytes"
+	"os/exec"
+	"testing"
+)
+
+func TestLilyPondChart(t *testing.T) {
+	tr, err := ParseTrack("title:Demo\"1 bpm:90 marker:Verse K S K S")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := tr.lilyPondChart()
+	if err != nil {
+		t.Fatalf("lilyPondChart() failed: %v", err)
+	}
+	want := "\\version \"2.18.2\"\n\n" +
+		"\\header {\n" +
+		"  title = \"Demo\\\"1\"\n" +
+		"  tagline = ##f\n" +
+		"}\n\n" +
+		"\\score {\n" +
+		"  \\new DrumStaff {\n" +
+		"    \\set Score.barNumberVisibility = #all-bar-numbers-visible\n" +
+		"    \\override Score.BarNumber.break-visibility = #end-of-line-invisible\n" +
+		"    \\drummode {\n" +
+		"      \\time 4/4\n" +
+		"      \\tempo 4 = 90\n" +
+		"      \\mark \"Verse\" bd4 sn4 bd4 sn4\n" +
+		"    }\n" +
+		"  }\n" +
+		"  \\layout { }\n" +
+		"}\n"
+	if string(got) != want {
+		t.Errorf("lilyPondChart()=\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestTitleDirective(t *testing.T) {
+	tr, err := ParseTrack("title:A K S title:B K")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tr.title(); got != "B" || len(tr.Meta) != 1 {
+		t.Errorf("title()=%q with %v meta events, want B with 1", got,
+			len(tr.Meta))
+	}
+	if _, err := ParseTrack("title:"); err == nil {
+		t.Errorf("ParseTrack(title:) succeeded, want error")
+	}
+}
+
+func TestExportPDF(t *testing.T) {
+	tr, err := ParseTrack("bpm:90 K S K S")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := LilyPondCommand
+	LilyPondCommand = "beatnik-no-such-lilypond"
+	err = ExportPDF(tr, &bytes.Buffer{})
+	LilyPondCommand = old
+	if e, ok := err.(*Error); !ok || e.Code != CodeNoLilyPond {
+		t.Errorf("ExportPDF()=%v, want %v", err, CodeNoLilyPond)
+	}
+
+	if _, err := exec.LookPath(LilyPondCommand); err != nil {
+		t.Skip("LilyPond is not installed")
+	}
+	buf := &bytes.Buffer{}
+	if err := ExportPDF(tr, buf); err != nil {
+		t.Fatalf("ExportPDF() failed: %v", err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte("%PDF")) {
+		t.Errorf("ExportPDF() did not write a PDF")
+	}
+}
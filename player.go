@@ -0,0 +1,234 @@
+package beatnik
+
+// Real-time playback.
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// An EventSink receives midi events as they are played, for example a synth
+// or a midi output port.
+type EventSink interface {
+	// Event is called with a single channel event, without delta time, at
+	// its playing time. at is the event's time from the start of the track.
+	Event(at time.Duration, data []byte) error
+}
+
+// A Transport is an external clock that a player can follow, like an Ableton
+// Link session. Beats are quarter notes.
+type Transport interface {
+	// Beat returns the transport's beat position at the given time, its tempo
+	// in beats per minute, and whether it is playing.
+	Beat(at time.Time) (beat, bpm float64, playing bool)
+}
+
+// A Player plays tracks in real time. The zero value is ready to use.
+type Player struct {
+	Options *EncodeOptions // Encoding options, nil for the defaults.
+
+	// Clock to follow instead of the track's tempo, nil for none. The track
+	// starts at the transport's next bar, by the track's time signature, once
+	// the transport plays, and stops if the transport stops.
+	Transport Transport
+
+	// Send midi clock, at 24 pulses per quarter note, while playing. Playing
+	// starts with a Start message, or with a Song Position Pointer and a
+	// Continue message if it starts after the beginning of the track, and ends
+	// with a Stop message.
+	Clock bool
+
+	// Tick to start playing from, for resuming a stopped track. Hits that
+	// start before it are not played. With Clock, it is rounded down to a
+	// sixteenth, since song positions are counted in sixteenths.
+	From uint
+}
+
+// Midi real-time and system common messages.
+var (
+	clockPulse    = []byte{0xF8}
+	clockStart    = []byte{0xFA}
+	clockContinue = []byte{0xFB}
+	clockStop     = []byte{0xFC}
+)
+
+// clockTicks is the number of ticks between midi clock pulses, for 24 pulses
+// per quarter note.
+const clockTicks = 96 / 24
+
+// syncPoll is the longest time that a player following a transport waits
+// before checking the transport's tempo again.
+const syncPoll = 10 * time.Millisecond
+
+// allNotesOff silences the drum channel.
+var allNotesOff = []byte{0xB9, 123, 0}
+
+// Play sends the track's events to sink, each at its time according to the
+// track's tempo and tempo changes. Returns when the track ends, when sink
+// returns an error or when ctx is done. If ctx is done before the track ends,
+// the drum channel is silenced and ctx's error is returned.
+func (p *Player) Play(ctx context.Context, t *Track, sink EventSink) error {
+	if err := errorOf(t.Validate()); err != nil {
+		return err
+	}
+	if p.Transport != nil {
+		return p.playSynced(ctx, t, sink)
+	}
+	tempo := t.TempoMap()
+	start := time.Now()
+	from := tempo.TickToTime(p.from())
+	for _, ev := range p.events(t) {
+		at := tempo.TickToTime(ev.t) - from
+		timer := time.NewTimer(time.Until(start.Add(at)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			p.stop(sink, time.Since(start))
+			return ctx.Err()
+		case <-timer.C:
+		}
+		if err := sink.Event(at, ev.data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// playSynced plays the track like Play, following the player's transport.
+// Returns nil if the transport stops.
+func (p *Player) playSynced(ctx context.Context, t *Track, sink EventSink) error {
+	quantum := float64(t.timeSig().barTicks()) / 96
+
+	// Wait for the transport to play, and start at its next bar.
+	var startBeat float64
+	var start time.Time
+	for {
+		now := time.Now()
+		beat, bpm, playing := p.Transport.Beat(now)
+		if playing && bpm > 0 {
+			startBeat = math.Ceil(beat/quantum) * quantum
+			start = now.Add(beatsDuration(startBeat-beat, bpm))
+			break
+		}
+		timer := time.NewTimer(syncPoll)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	from := p.from()
+	for _, ev := range p.events(t) {
+		at := startBeat + float64(ev.t-from)/96
+		for {
+			now := time.Now()
+			beat, bpm, playing := p.Transport.Beat(now)
+			if !playing {
+				p.stop(sink, now.Sub(start))
+				return nil
+			}
+			if beat >= at || bpm <= 0 {
+				break
+			}
+			d := beatsDuration(at-beat, bpm)
+			if d > syncPoll {
+				d = syncPoll
+			}
+			timer := time.NewTimer(d)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				p.stop(sink, time.Since(start))
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+		if err := sink.Event(time.Since(start), ev.data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// from returns the tick that playing starts from.
+func (p *Player) from() uint {
+	if p.Clock {
+		return p.From / 24 * 24
+	}
+	return p.From
+}
+
+// events returns the events to play: the track's channel events from the
+// starting tick, and clock messages if the player sends them.
+func (p *Player) events(t *Track) []midiEvent {
+	from := p.from()
+	var events []midiEvent
+	for _, ev := range t.channelEvents(p.Options) {
+		if ev.t >= from {
+			events = append(events, ev)
+		}
+	}
+	if !p.Clock {
+		return events
+	}
+
+	end := t.ticks()
+	if len(events) > 0 && events[len(events)-1].t > end {
+		end = events[len(events)-1].t
+	}
+	var result []midiEvent
+	if from == 0 {
+		result = append(result, midiEvent{t: 0, data: clockStart})
+	} else {
+		pos := from / 24
+		result = append(result,
+			midiEvent{t: from, data: []byte{0xF2, byte(pos & 0x7F), byte(pos >> 7 & 0x7F)}},
+			midiEvent{t: from, data: clockContinue})
+	}
+	for tick := from; tick < end; tick += clockTicks {
+		for len(events) > 0 && events[0].t < tick {
+			result = append(result, events[0])
+			events = events[1:]
+		}
+		result = append(result, midiEvent{t: tick, data: clockPulse})
+	}
+	result = append(result, events...)
+	return append(result, midiEvent{t: end, data: clockStop})
+}
+
+// stop silences the drum channel, and stops the clock if the player sends it.
+func (p *Player) stop(sink EventSink, at time.Duration) {
+	sink.Event(at, allNotesOff)
+	if p.Clock {
+		sink.Event(at, clockStop)
+	}
+}
+
+// beatsDuration returns the playing time of the given number of beats at the
+// given tempo.
+func beatsDuration(beats, bpm float64) time.Duration {
+	return time.Duration(beats * 60 / bpm * float64(time.Second))
+}
+
+// channelEvents returns the track's note and control events, as they would be
+// encoded in a midi file, without meta events.
+func (t *Track) channelEvents(opts *EncodeOptions) []midiEvent {
+	if opts == nil {
+		opts = &EncodeOptions{}
+	}
+	var events []midiEvent
+	e := newHitEncoder(nil, t, opts)
+	e.recorded = &events
+	e.encode(t)
+
+	result := events[:0]
+	for _, ev := range events {
+		if ev.data[0] != 0xFF {
+			result = append(result, ev)
+		}
+	}
+	return result
+}
@@ -0,0 +1,158 @@
+package beatnik
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// A recordingSink keeps the events it receives.
+type recordingSink struct {
+	times  []time.Duration
+	events [][]byte
+}
+
+func (s *recordingSink) Event(at time.Duration, data []byte) error {
+	s.times = append(s.times, at)
+	s.events = append(s.events, append([]byte(nil), data...))
+	return nil
+}
+
+func TestPlayer(t *testing.T) {
+	tr, err := ParseTrack("bpm:375 K... S...")
+	if err != nil {
+		t.Fatalf("ParseTrack() failed: %v", err)
+	}
+	sink := &recordingSink{}
+	start := time.Now()
+	if err := (&Player{}).Play(context.Background(), tr, sink); err != nil {
+		t.Fatalf("Play() failed: %v", err)
+	}
+	want := [][]byte{
+		{0x99, 36, byte(F)},
+		{0x89, 36, 64},
+		{0x99, 38, byte(F)},
+		{0x89, 38, 64},
+	}
+	if !reflect.DeepEqual(sink.events, want) {
+		t.Errorf("Play() events=%v, want %v", sink.events, want)
+	}
+	wantTimes := []time.Duration{0, 20 * time.Millisecond,
+		20 * time.Millisecond, 40 * time.Millisecond}
+	if !reflect.DeepEqual(sink.times, wantTimes) {
+		t.Errorf("Play() times=%v, want %v", sink.times, wantTimes)
+	}
+	if d := time.Since(start); d < 40*time.Millisecond {
+		t.Errorf("Play() took %v, want at least 40ms", d)
+	}
+}
+
+func TestPlayer_cancel(t *testing.T) {
+	tr, err := ParseTrack("bpm:60 K S K S")
+	if err != nil {
+		t.Fatalf("ParseTrack() failed: %v", err)
+	}
+	sink := &recordingSink{}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := (&Player{}).Play(ctx, tr, sink); err != context.DeadlineExceeded {
+		t.Fatalf("Play()=%v, want %v", err, context.DeadlineExceeded)
+	}
+	want := [][]byte{{0x99, 36, byte(F)}, allNotesOff}
+	if !reflect.DeepEqual(sink.events, want) {
+		t.Errorf("Play() events=%v, want %v", sink.events, want)
+	}
+}
+
+// A fakeTransport plays at a steady tempo from a beat, until a beat where it
+// stops.
+type fakeTransport struct {
+	start      time.Time
+	beat, bpm  float64
+	stopAtBeat float64
+}
+
+func (f *fakeTransport) Beat(at time.Time) (float64, float64, bool) {
+	beat := f.beat + at.Sub(f.start).Minutes()*f.bpm
+	return beat, f.bpm, beat < f.stopAtBeat
+}
+
+func TestPlayer_transport(t *testing.T) {
+	tr, err := ParseTrack("bpm:60 time:1/4 K... S...")
+	if err != nil {
+		t.Fatalf("ParseTrack() failed: %v", err)
+	}
+	sink := &recordingSink{}
+	start := time.Now()
+	p := &Player{Transport: &fakeTransport{start, 0.75, 375, 100}}
+	if err := p.Play(context.Background(), tr, sink); err != nil {
+		t.Fatalf("Play() failed: %v", err)
+	}
+	want := [][]byte{
+		{0x99, 36, byte(F)},
+		{0x89, 36, 64},
+		{0x99, 38, byte(F)},
+		{0x89, 38, 64},
+	}
+	if !reflect.DeepEqual(sink.events, want) {
+		t.Errorf("Play() events=%v, want %v", sink.events, want)
+	}
+	if d := time.Since(start); d < 80*time.Millisecond {
+		t.Errorf("Play() took %v, want at least 80ms", d)
+	}
+	if d := sink.times[2] - sink.times[0]; d < 15*time.Millisecond {
+		t.Errorf("snare played %v after kick, want about 20ms", d)
+	}
+
+	sink = &recordingSink{}
+	p.Transport = &fakeTransport{time.Now(), 0.75, 375, 1.1}
+	if err := p.Play(context.Background(), tr, sink); err != nil {
+		t.Fatalf("Play() failed: %v", err)
+	}
+	want = [][]byte{{0x99, 36, byte(F)}, allNotesOff}
+	if !reflect.DeepEqual(sink.events, want) {
+		t.Errorf("Play() events=%v, want %v", sink.events, want)
+	}
+}
+
+func TestPlayer_clock(t *testing.T) {
+	tr, err := ParseTrack("bpm:375 K... S...")
+	if err != nil {
+		t.Fatalf("ParseTrack() failed: %v", err)
+	}
+	sink := &recordingSink{}
+	if err := (&Player{Clock: true}).Play(context.Background(), tr, sink); err != nil {
+		t.Fatalf("Play() failed: %v", err)
+	}
+	pulse := []byte{0xF8}
+	want := [][]byte{
+		{0xFA}, pulse, {0x99, 36, byte(F)}, pulse, pulse, pulse,
+		{0x89, 36, 64}, {0x99, 38, byte(F)}, pulse, pulse,
+		{0x89, 38, 64}, {0xFC},
+	}
+	if !reflect.DeepEqual(sink.events, want) {
+		t.Errorf("Play() events=%v, want %v", sink.events, want)
+	}
+
+	tr, err = ParseTrack("bpm:375 K.. S..")
+	if err != nil {
+		t.Fatalf("ParseTrack() failed: %v", err)
+	}
+	sink = &recordingSink{}
+	p := &Player{Clock: true, From: 30}
+	if err := p.Play(context.Background(), tr, sink); err != nil {
+		t.Fatalf("Play() failed: %v", err)
+	}
+	want = [][]byte{
+		{0xF2, 1, 0}, {0xFB}, pulse,
+		{0x89, 36, 64}, {0x99, 38, byte(F)}, pulse, pulse, pulse, pulse, pulse,
+		{0x89, 38, 64}, {0xFC},
+	}
+	if !reflect.DeepEqual(sink.events, want) {
+		t.Errorf("Play(From: 30) events=%v, want %v", sink.events, want)
+	}
+	if sink.times[0] != 0 || sink.times[len(sink.times)-1] != 40*time.Millisecond {
+		t.Errorf("Play(From: 30) times=%v, want from 0 to 40ms", sink.times)
+	}
+}
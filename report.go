@@ -0,0 +1,71 @@
+package beatnik
+
+// Reports of encoding without encoding.
+
+import (
+	"time"
+)
+
+// A Report summarizes what encoding a track or a song would produce, for
+// checking large or generated scores without writing them.
+type Report struct {
+	Bars     float64       // Length in bars.
+	Duration time.Duration // Playing time.
+	Hits     int           // Number of hits with notes.
+	Rests    int           // Number of hits without notes.
+	Notes    map[byte]int  // Number of strikes of each note.
+	Size     int64         // Size of the midi file in bytes.
+
+	// Number of events in each midi track, starting with the conductor track
+	// that holds the tempo and meta events.
+	Events []int
+}
+
+// Report returns what encoding the track with the given options would
+// produce. Fails if the track is not valid, like Encode.
+func (t *Track) Report(opts *EncodeOptions) (*Report, error) {
+	return (&Song{[]*Track{t}}).Report(opts)
+}
+
+// Report returns what encoding the song with the given options would produce.
+// Fails if the song is not valid, like Encode.
+func (s *Song) Report(opts *EncodeOptions) (*Report, error) {
+	if err := errorOf(s.Validate()); err != nil {
+		return nil, err
+	}
+	if opts == nil {
+		opts = &EncodeOptions{}
+	}
+	first := s.Tracks[0]
+	r := &Report{Notes: map[byte]int{}}
+	r.Size = int64(len(encodeHeaderChunk(len(s.Tracks)+1)) +
+		len(first.encodeMetaChunk()))
+	r.Events = []int{3 + len(first.Meta)} // Time signature, tempo, end.
+
+	for _, t := range s.Tracks {
+		// Time is measured by the first track's tempo.
+		timed := &Track{Hits: t.Hits, BPM: first.BPM, Meta: first.Meta,
+			TimeSig: first.TimeSig}
+		if bars := timed.Bars(); bars > r.Bars {
+			r.Bars = bars
+		}
+		if d := timed.Duration(); d > r.Duration {
+			r.Duration = d
+		}
+		for _, h := range t.Hits {
+			if h.IsRest() {
+				r.Rests++
+			} else {
+				r.Hits++
+			}
+			for n := range h.Notes {
+				r.Notes[n]++
+			}
+		}
+
+		events, size := t.measureHits(opts)
+		r.Events = append(r.Events, events)
+		r.Size += 8 + int64(size) // Chunk header and events.
+	}
+	return r, nil
+}
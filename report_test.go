@@ -0,0 +1,49 @@
+package beatnik
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReport(t *testing.T) {
+	tr, _ := ParseTrack("bpm:120 marker:A K,HC HC S,HC HC K,HC HC S,HC HC K~")
+	tr.Hits = append(tr.Hits, &Hit{T: 192})
+	r, err := tr.Report(nil)
+	if err != nil {
+		t.Fatalf("Report() failed: %v", err)
+	}
+	b, _ := tr.MarshalBinary()
+	want := &Report{
+		Bars:     3,
+		Duration: 6 * time.Second,
+		Hits:     9,
+		Rests:    1,
+		Notes:    map[byte]int{36: 3, 38: 2, 22: 8},
+		Size:     int64(len(b)),
+		Events:   []int{4, 27},
+	}
+	if !reflect.DeepEqual(r, want) {
+		t.Errorf("Report()=%+v, want %+v", r, want)
+	}
+}
+
+func TestSongReport(t *testing.T) {
+	a, _ := ParseTrack("bpm:60 K S K S")
+	b, _ := ParseTrack("HC HC HC HC HC HC HC HC")
+	s := &Song{[]*Track{a, b}}
+	r, err := s.Report(nil)
+	if err != nil {
+		t.Fatalf("Report() failed: %v", err)
+	}
+	enc, _ := s.MarshalBinary()
+	if r.Size != int64(len(enc)) {
+		t.Errorf("Report().Size=%v, want %v", r.Size, len(enc))
+	}
+	if r.Bars != 2 || r.Duration != 8*time.Second || r.Hits != 12 {
+		t.Errorf("Report()=%+v, want 2 bars, 8s and 12 hits", r)
+	}
+	if want := []int{3, 9, 17}; !reflect.DeepEqual(r.Events, want) {
+		t.Errorf("Report().Events=%v, want %v", r.Events, want)
+	}
+}
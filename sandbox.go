@@ -0,0 +1,62 @@
+package beatnik
+
+// Safe parsing of untrusted sources.
+
+import (
+	"io/fs"
+	"path"
+	"path/filepath"
+)
+
+// A Sandbox parses sources from untrusted users, for example on a server.
+// Sources can only include files from the sandbox's file system, have no
+// access to the process's environment, and cannot expand beyond the
+// sandbox's limits.
+type Sandbox struct {
+	FS fs.FS // Files that sources may include, nil to disallow including.
+
+	// Bounds on the parsed tracks. Zero fields take the values of
+	// SandboxLimits.
+	Limits Limits
+}
+
+// ParseTrack parses a source like the package level ParseTrack, within the
+// sandbox. Included paths are relative to the root of the sandbox's file
+// system.
+func (s *Sandbox) ParseTrack(src string) (*Track, error) {
+	p := s.newParser()
+	if err := p.parseFile("", []byte(src)); err != nil {
+		return nil, err
+	}
+	if err := p.finish(); err != nil {
+		return nil, err
+	}
+	return p.t, nil
+}
+
+// ParseFile parses a file from the sandbox's file system like the package
+// level ParseFile, within the sandbox.
+func (s *Sandbox) ParseFile(path string) (*Track, error) {
+	if s.FS == nil {
+		return nil, newError(CodeNoInclude)
+	}
+	return parseFile(path, s.newParser())
+}
+
+// newParser returns a parser with the sandbox's limits.
+func (s *Sandbox) newParser() *parser {
+	p := newParser()
+	if s.FS != nil {
+		p.open = FSOpener(s.FS)
+	}
+	p.limits = s.Limits.withDefaults(SandboxLimits)
+	return p
+}
+
+// FSOpener returns an opener that reads files from fsys. Paths that are not
+// valid in fsys, like ones that lead outside of it, fail.
+func FSOpener(fsys fs.FS) Opener {
+	return func(name string) ([]byte, error) {
+		return fs.ReadFile(fsys, path.Clean(filepath.ToSlash(name)))
+	}
+}
@@ -0,0 +1,48 @@
+package beatnik
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestSandbox(t *testing.T) {
+	fsys := fstest.MapFS{
+		"lib/fill.bk": {Data: []byte("T1. T2. include:../groove.bk")},
+		"groove.bk":   {Data: []byte("K S")},
+		"escape.bk":   {Data: []byte("include:../secret.bk")},
+	}
+	s := &Sandbox{FS: fsys, Limits: Limits{MaxHits: 10}}
+	tr, err := s.ParseTrack("include:lib/fill.bk")
+	if err != nil {
+		t.Fatalf("ParseTrack() failed: %v", err)
+	}
+	if len(tr.Hits) != 4 {
+		t.Errorf("ParseTrack() has %v hits, want 4", len(tr.Hits))
+	}
+	if _, err := s.ParseFile("lib/fill.bk"); err != nil {
+		t.Errorf("ParseFile() failed: %v", err)
+	}
+
+	tests := []struct {
+		src  string
+		code Code
+	}{
+		{"include:escape.bk", CodeIncludeFailed},
+		{"include:/etc/passwd", CodeIncludeFailed},
+		{"section:a K K K play:a*3", CodeSectionTooLarge},
+		{"section:a K play:a*1000000000", CodeSectionTooLarge},
+		{"section:a marker:x section: play:a*1000000000", CodeSectionTooLarge},
+		{"K K K K K K K K K K K", CodeTooManyHits},
+	}
+	for _, test := range tests {
+		_, err := s.ParseTrack(test.src)
+		if e, ok := err.(*Error); !ok || e.Code != test.code {
+			t.Errorf("ParseTrack(%q) error=%v, want %v", test.src, err, test.code)
+		}
+	}
+
+	s = &Sandbox{}
+	if _, err := s.ParseTrack("include:groove.bk"); err == nil {
+		t.Errorf("ParseTrack() without a file system succeeded, want failure")
+	}
+}
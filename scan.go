@@ -0,0 +1,333 @@
+package beatnik
+
+// Hand-written scanning of tokens. The functions here follow the token
+// patterns of the text format exactly, but work on byte offsets and do not
+// allocate. The patterns are kept as regexps in the tests, which check the
+// scanners against them.
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// A scanner splits source text into tokens. Any unicode white space separates
+// tokens, and comments go from a "#" to the end of the line.
+type scanner struct {
+	s     string
+	i     int // Byte offset of the next rune.
+	line  int // 1-based line of the next rune.
+	col   int // 1-based column of the next rune, in runes (not bytes).
+	start int // Byte offset of the last token.
+}
+
+// newScanner returns a scanner of s, which starts at the given line.
+func newScanner(s string, line int) scanner {
+	return scanner{s: s, line: line, col: 1}
+}
+
+// next returns the next token. Comments are returned as tokens too, without
+// trailing white space, and are the only tokens that start with "#". Returns
+// false at the end of the text.
+func (sc *scanner) next() (token, bool) {
+	for sc.i < len(sc.s) {
+		c := sc.s[sc.i]
+		if c == '\n' {
+			sc.i++
+			sc.line++
+			sc.col = 1
+			continue
+		}
+		if c == '#' {
+			end := strings.IndexByte(sc.s[sc.i:], '\n')
+			if end == -1 {
+				end = len(sc.s)
+			} else {
+				end += sc.i
+			}
+			tok := token{strings.TrimRightFunc(sc.s[sc.i:end], unicode.IsSpace),
+				sc.line, sc.col}
+			sc.start, sc.i = sc.i, end
+			return tok, true
+		}
+		if r, size := sc.rune(); unicode.IsSpace(r) {
+			sc.i += size
+			sc.col++
+			continue
+		}
+
+		sc.start = sc.i
+		col := sc.col
+		for sc.i < len(sc.s) && sc.s[sc.i] != '#' {
+			r, size := sc.rune()
+			if unicode.IsSpace(r) {
+				break
+			}
+			sc.i += size
+			sc.col++
+		}
+		return token{sc.s[sc.start:sc.i], sc.line, col}, true
+	}
+	return token{}, false
+}
+
+// rune returns the next rune and its size in bytes.
+func (sc *scanner) rune() (rune, int) {
+	if c := sc.s[sc.i]; c < utf8.RuneSelf {
+		return rune(c), 1
+	}
+	return utf8.DecodeRuneInString(sc.s[sc.i:])
+}
+
+// A hitMatch holds the byte offsets of the parts of a hit token, laid out like
+// regexp submatch indexes: the whole token, its notes, its annotations with
+// their braces (-1 if none) and its duration.
+type hitMatch [8]int
+
+// matchHit matches a hit token, which may be in grace parentheses. Returns
+// false if s is not a hit.
+func matchHit(s string) (hitMatch, bool) {
+	m := hitMatch{0, len(s)}
+	i := 0
+	if i < len(s) && s[i] == '(' {
+		i++
+	}
+	m[2] = i
+	for {
+		nm, ok := matchNoteAt(s, i)
+		if !ok {
+			return m, false
+		}
+		i = nm[1]
+		if i == len(s) || s[i] != ',' {
+			break
+		}
+		i++
+	}
+	m[3] = i
+	m[4], m[5] = -1, -1
+	if i < len(s) && s[i] == '{' {
+		j := i + 1
+		for j < len(s) && s[j] != '{' && s[j] != '}' {
+			j++
+		}
+		if j == len(s) || s[j] != '}' {
+			return m, false
+		}
+		m[4], m[5] = i, j+1
+		i = j + 1
+	}
+	m[6] = i
+	i = scanDuration(s, i)
+	m[7] = i
+	if i < len(s) && s[i] == ')' {
+		i++
+	}
+	return m, i == len(s)
+}
+
+// notes returns the notes part of the matched hit token s.
+func (m hitMatch) notes(s string) string {
+	return s[m[2]:m[3]]
+}
+
+// annotations returns the annotations of the matched hit token s with their
+// braces, or "" if none.
+func (m hitMatch) annotations(s string) string {
+	if m[4] == -1 {
+		return ""
+	}
+	return s[m[4]:m[5]]
+}
+
+// duration returns the duration part of the matched hit token s.
+func (m hitMatch) duration(s string) string {
+	return s[m[6]:m[7]]
+}
+
+// A noteMatch holds the byte offsets of the parts of a note in a hit token,
+// laid out like regexp submatch indexes: the whole note, its name or
+// alternatives, its velocity signs, its timing offset without the "@" (-1 if
+// none) and its chance without the "?" (-1 if none).
+type noteMatch [10]int
+
+// matchNote matches a single note of a hit token. Returns false if s is not a
+// note.
+func matchNote(s string) (noteMatch, bool) {
+	m, ok := matchNoteAt(s, 0)
+	return m, ok && m[1] == len(s)
+}
+
+// matchNoteAt matches the note that starts at byte i of s, and ends wherever
+// its last part ends. Returns false if there is no note at i.
+func matchNoteAt(s string, i int) (noteMatch, bool) {
+	m := noteMatch{i, 0, i, 0, 0, 0, -1, -1, -1, -1}
+	if strings.HasPrefix(s[i:], "alt(") {
+		j := i + 4
+		for n := 0; ; n++ {
+			if j = scanName(s, j); j == -1 {
+				return m, false
+			}
+			if j < len(s) && s[j] == '|' {
+				j++
+				continue
+			}
+			if n == 0 || j == len(s) || s[j] != ')' {
+				return m, false
+			}
+			break
+		}
+		i = j + 1
+	} else if i = scanName(s, i); i == -1 {
+		return m, false
+	}
+	m[3] = i
+
+	m[4] = i
+	if i < len(s) && (s[i] == '+' || s[i] == '-') {
+		i = skipByte(s, i, s[i])
+	}
+	m[5] = i
+
+	if i < len(s) && s[i] == '@' {
+		start, j := i+1, i+1
+		if j < len(s) && (s[j] == '+' || s[j] == '-') {
+			j++
+		}
+		if i = skipDigits(s, j); i == j {
+			return m, false
+		}
+		m[6], m[7] = start, i
+	}
+
+	if i < len(s) && s[i] == '?' {
+		j := i + 1
+		if i = skipDigits(s, j); i == j {
+			return m, false
+		}
+		m[8], m[9] = j, i
+	}
+	m[1] = i
+	return m, true
+}
+
+// name returns the name or alternatives of the matched note s.
+func (m noteMatch) name(s string) string {
+	return s[m[2]:m[3]]
+}
+
+// velocity returns the velocity signs of the matched note s.
+func (m noteMatch) velocity(s string) string {
+	return s[m[4]:m[5]]
+}
+
+// offset returns the timing offset of the matched note s, or "" if none.
+func (m noteMatch) offset(s string) string {
+	if m[6] == -1 {
+		return ""
+	}
+	return s[m[6]:m[7]]
+}
+
+// chance returns the chance of the matched note s, or "" if none.
+func (m noteMatch) chance(s string) string {
+	if m[8] == -1 {
+		return ""
+	}
+	return s[m[8]:m[9]]
+}
+
+// scanName returns the end of the drum name that starts at byte i of s,
+// including an articulation after a dot, as in "S.rim". Returns -1 if there is
+// no name at i.
+func scanName(s string, i int) int {
+	start := i
+	for i < len(s) {
+		if c := s[i]; c < utf8.RuneSelf {
+			if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' ||
+				'0' <= c && c <= '9') {
+				break
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if !unicode.IsLetter(r) && !unicode.IsNumber(r) {
+			break
+		}
+		i += size
+	}
+	if i == start {
+		return -1
+	}
+	if i+1 < len(s) && s[i] == '.' && isLower(s[i+1]) {
+		i += 2
+		for i < len(s) && isLower(s[i]) {
+			i++
+		}
+	}
+	return i
+}
+
+// scanDuration returns the end of the duration that starts at byte i of s: a
+// run of dots or of tildes, and an optional tuplet. A duration may be empty.
+func scanDuration(s string, i int) int {
+	if i < len(s) && (s[i] == '.' || s[i] == '~') {
+		i = skipByte(s, i, s[i])
+	}
+	if i < len(s) && s[i] == '>' {
+		i = skipDigits(s, i+1)
+	}
+	return i
+}
+
+// isWait returns true if s is a wait token, a duration on its own.
+func isWait(s string) bool {
+	return scanDuration(s, 0) == len(s)
+}
+
+// isGroupClose returns true if s is a group close token, a "]" and an optional
+// operator name.
+func isGroupClose(s string) bool {
+	if len(s) == 0 || s[0] != ']' {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if !isLower(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// splitDirective splits a directive token to its name and value. Returns
+// false if s is not a directive.
+func splitDirective(s string) (name, value string, ok bool) {
+	i := strings.IndexByte(s, ':')
+	if i < 1 || strings.IndexByte(s[i+1:], '\n') != -1 {
+		return "", "", false
+	}
+	return s[:i], s[i+1:], true
+}
+
+// skipByte returns the offset of the first byte at or after i that is not c.
+func skipByte(s string, i int, c byte) int {
+	for i < len(s) && s[i] == c {
+		i++
+	}
+	return i
+}
+
+// skipDigits returns the offset of the first byte at or after i that is not
+// a decimal digit.
+func skipDigits(s string, i int) int {
+	for i < len(s) && '0' <= s[i] && s[i] <= '9' {
+		i++
+	}
+	return i
+}
+
+// isLower returns true if c is a lowercase ASCII letter.
+func isLower(c byte) bool {
+	return 'a' <= c && c <= 'z'
+}
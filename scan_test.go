@@ -0,0 +1,199 @@
+package beatnik
+
+import (
+	"math/rand"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+// The token patterns of the text format, which the scanners follow. They are
+// kept here as an oracle for the scanners.
+
+// notePattern matches a single note in a hit: name or alternatives, velocity,
+// timing offset and chance.
+const notePattern = "(?:" + namePattern + "|alt\\(" + namePattern + "(?:\\|" +
+	namePattern + ")+\\))(?:\\+*|-*)(?:@[+-]?[0-9]+)?(?:\\?[0-9]+)?"
+
+var (
+	hitToken = regexp.MustCompile("^\\(?(" + notePattern + "(?:," + notePattern +
+		")*)(\\{[^{}]*\\})?((?:\\.*|~*)(?:>[0-9]*)?)\\)?$")
+	noteToken       = regexp.MustCompile("^(" + namePattern + "|alt\\(" + namePattern + "(?:\\|" + namePattern + ")+\\))(\\+*|-*)(?:@([+-]?[0-9]+))?(?:\\?([0-9]+))?$")
+	waitToken       = regexp.MustCompile("^(?:\\.*|~*)(?:>[0-9]*)?$")
+	directiveToken  = regexp.MustCompile("^([^:]+):(.*)$")
+	groupCloseToken = regexp.MustCompile("^\\]([a-z]*)$")
+)
+
+// refTokenize is the reference tokenizer, which splits lines and cuts
+// comments with the strings package.
+func refTokenize(s string) []token {
+	var result []token
+	for i, line := range strings.Split(s, "\n") {
+		comment := ""
+		if j := strings.IndexByte(line, '#'); j != -1 {
+			comment = strings.TrimRightFunc(line[j:], unicode.IsSpace)
+			line = line[:j]
+		}
+		start, startCol, col := -1, 0, 0
+		for j, r := range line {
+			col++
+			if unicode.IsSpace(r) {
+				if start != -1 {
+					result = append(result, token{line[start:j], i + 1, startCol})
+					start = -1
+				}
+				continue
+			}
+			if start == -1 {
+				start, startCol = j, col
+			}
+		}
+		if start != -1 {
+			result = append(result, token{line[start:], i + 1, startCol})
+		}
+		if comment != "" {
+			result = append(result, token{comment, i + 1, col + 1})
+		}
+	}
+	return result
+}
+
+// scanTests are texts that the scanners are checked on, in addition to random
+// ones.
+var scanTests = []string{
+	"", "K", "K.", "(K..)", "(K", "K)", "HC,K+.", "S--...", "S.rim", "S.rim.",
+	"S.r.", "S.Rim", "alt(K|S)", "alt(K)", "alt(K|S", "alt(K|S)+@-3?50..>5",
+	"(alt(S.rim|S)--)", "alt", "alt.", "altK", "K+-", "K@", "K@+", "K@-12",
+	"K?", "K?0", "K?50@3", "K@3?50", "K{a=1,b=2}.", "K{}", "K{a", "K{a}{b}",
+	"K.~", "K~~>", "K>12", ">", ".>3", "~", "...", ".~", "]", "]rev", "]Rev",
+	"]r1", "[", "|", "bpm:120", ":120", "a:b:c", "К,S.", "38,42-..", "K,", ",K",
+	"K,,S", "\xff", "K\xff", "ñ.", "٣", "K..)", "((K))", "K.rim+,C1.choke.",
+}
+
+// randomToken returns a random text made of pieces of tokens.
+func randomToken(rnd *rand.Rand) string {
+	pieces := []string{"K", "S", "HC", "38", "alt(", "|", ")", "(", ".", "~",
+		">", "3", "+", "-", "@", "?", ",", "{", "}", "a=1", ":", "]", "rim",
+		"ñ", "\xff", " ", "#", "\n", "\t"}
+	var b strings.Builder
+	for n := rnd.Intn(8); n >= 0; n-- {
+		b.WriteString(pieces[rnd.Intn(len(pieces))])
+	}
+	return b.String()
+}
+
+// forScanTests calls f with each of the scan tests and many random texts.
+func forScanTests(f func(s string)) {
+	for _, s := range scanTests {
+		f(s)
+	}
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 100000; i++ {
+		f(randomToken(rnd))
+	}
+}
+
+func TestMatchHit(t *testing.T) {
+	forScanTests(func(s string) {
+		want := hitToken.FindStringSubmatchIndex(s)
+		got, ok := matchHit(s)
+		if ok != (want != nil) || ok && !reflect.DeepEqual(got[:], want) {
+			t.Fatalf("matchHit(%q)=%v,%v, want %v", s, got, ok, want)
+		}
+	})
+}
+
+func TestMatchNote(t *testing.T) {
+	forScanTests(func(s string) {
+		want := noteToken.FindStringSubmatchIndex(s)
+		got, ok := matchNote(s)
+		if ok != (want != nil) || ok && !reflect.DeepEqual(got[:], want) {
+			t.Fatalf("matchNote(%q)=%v,%v, want %v", s, got, ok, want)
+		}
+	})
+}
+
+func TestTokenKind(t *testing.T) {
+	forScanTests(func(s string) {
+		if got, want := isWait(s), waitToken.MatchString(s); got != want {
+			t.Fatalf("isWait(%q)=%v, want %v", s, got, want)
+		}
+		if got, want := isGroupClose(s), groupCloseToken.MatchString(s); got != want {
+			t.Fatalf("isGroupClose(%q)=%v, want %v", s, got, want)
+		}
+		name, value, ok := splitDirective(s)
+		if m := directiveToken.FindStringSubmatch(s); ok != (m != nil) ||
+			ok && (name != m[1] || value != m[2]) {
+			t.Fatalf("splitDirective(%q)=%q,%q,%v, want %q", s, name, value,
+				ok, m)
+		}
+	})
+}
+
+func TestTokenize_oracle(t *testing.T) {
+	forScanTests(func(s string) {
+		var want []token
+		for _, tok := range refTokenize(s) {
+			if tok.s[0] != '#' {
+				want = append(want, tok)
+			}
+		}
+		if got := tokenize(s); !reflect.DeepEqual(got, want) {
+			t.Fatalf("tokenize(%q)=%v, want %v", s, got, want)
+		}
+	})
+}
+
+func TestScanner_start(t *testing.T) {
+	src := "K  ñ,S. # Comment \n\t]rev"
+	want := []int{0, 3, 9, 21}
+	var got []int
+	sc := newScanner(src, 1)
+	for tok, ok := sc.next(); ok; tok, ok = sc.next() {
+		got = append(got, sc.start)
+		if !strings.HasPrefix(src[sc.start:], tok.s) {
+			t.Errorf("token %q starts at %v: %q", tok.s, sc.start, src[sc.start:])
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("starts=%v, want %v", got, want)
+	}
+}
+
+// benchSource is a long score for benchmarks.
+var benchSource = strings.Repeat(
+	"HC,K+. HC--.. HC.. HC,S.> HC~ (S--...) K.... ~ . | # Comment.\n", 1000)
+
+func BenchmarkTokenize(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for _, tok := range tokenize(benchSource) {
+			tokenKind(tok.s)
+		}
+	}
+}
+
+func BenchmarkTokenize_regexp(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for _, tok := range refTokenize(benchSource) {
+			if tok.s[0] != '#' && !hitToken.MatchString(tok.s) {
+				waitToken.MatchString(tok.s)
+			}
+		}
+	}
+}
+
+func BenchmarkScanner(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		sc := newScanner(benchSource, 1)
+		for tok, ok := sc.next(); ok; tok, ok = sc.next() {
+			if tok.s[0] != '#' {
+				tokenKind(tok.s)
+			}
+		}
+	}
+}
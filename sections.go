@@ -0,0 +1,146 @@
+package beatnik
+
+// Song sections and arrangement.
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// playToken matches a single item of a play directive: a section name with
+// an optional repeat count.
+var playToken = regexp.MustCompile("^([\\pL\\pN_-]+)(?:\\*([0-9]+))?$")
+
+// A section is a labeled range of the track, that can be played again.
+type section struct {
+	name               string
+	start, end         int  // Range of hit indexes.
+	startTick, endTick uint // Range of ticks.
+	open               bool // The section did not end yet.
+	plays              int  // Number of times the section was played again.
+}
+
+// sectionDirective starts a new section, as in "section:verse", and ends the
+// current one. A marker with the section's name is placed at its start.
+// Empty ends the current section without starting a new one.
+func sectionDirective(p *parser, s string, at DirectiveContext) error {
+	p.endSection()
+	if s == "" {
+		return nil
+	}
+	if !playToken.MatchString(s) || strings.Contains(s, "*") {
+		return newError(CodeBadSection, s)
+	}
+	if _, ok := p.sections[s]; ok {
+		return newError(CodeDuplicateSection, s)
+	}
+	sec := &section{name: s, start: len(p.t.Hits), startTick: at.Tick}
+	p.sections[s] = sec
+	p.section = sec
+	return p.addTextMeta(MetaMarker, CodeEmptyMarker, s)
+}
+
+// playDirective plays earlier sections again, as in
+// "play:verse*2,chorus*2", and ends the current section. The section's hits,
+// meta events and control events are copied to the end of the track. Notes
+// with alternatives play the next alternative on every repetition. The value
+// has no spaces, like any token, so "play:verse x2, chorus x2" is not
+// supported.
+func playDirective(p *parser, s string, at DirectiveContext) error {
+	p.endSection()
+	type item struct {
+		sec *section
+		n   int
+	}
+	var items []item
+	for _, part := range strings.Split(s, ",") {
+		m := playToken.FindStringSubmatch(part)
+		if m == nil {
+			return newError(CodeBadPlay, part)
+		}
+		sec, ok := p.sections[m[1]]
+		if !ok {
+			return newError(CodeUnknownSection, m[1])
+		}
+		n := 1
+		if m[2] != "" {
+			var err error
+			n, err = strconv.Atoi(m[2])
+			if err != nil || n < 1 {
+				return newError(CodeBadPlay, part)
+			}
+		}
+		items = append(items, item{sec, n})
+	}
+	for _, it := range items {
+		sec := it.sec
+		meta, controls := p.t.rangeEvents(sec.startTick, sec.endTick)
+		err := p.growSection(sec.name, sec.end-sec.start,
+			len(meta)+len(controls), it.n)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < it.n; i++ {
+			at := len(p.t.Hits)
+			p.tick += p.t.copyRange(sec.start, sec.end, meta, controls,
+				sec.startTick, p.tick)
+			sec.plays++
+			p.alternate(p.t.Hits[sec.start:sec.end], p.t.Hits[at:], sec.plays)
+		}
+	}
+	return nil
+}
+
+// endSection ends the current section, if any.
+func (p *parser) endSection() {
+	if p.section == nil {
+		return
+	}
+	p.section.end = len(p.t.Hits)
+	p.section.endTick = p.tick
+	p.section = nil
+}
+
+// rangeEvents returns the meta and control events in ticks
+// [startTick,endTick), ordered by tick, for copying with copyRange. Loop points
+// are left out, since a track has a single loop.
+func (t *Track) rangeEvents(startTick, endTick uint) ([]*Meta, []*Control) {
+	var meta []*Meta
+	for _, m := range t.sortedMeta() {
+		if m.T >= startTick && m.T < endTick && !m.isLoopPoint() {
+			meta = append(meta, m)
+		}
+	}
+	var controls []*Control
+	for _, c := range t.sortedControls() {
+		if c.T >= startTick && c.T < endTick && !c.isLoopPoint() {
+			controls = append(controls, c)
+		}
+	}
+	return meta, controls
+}
+
+// copyRange appends copies of the hits in [start,end), and of the given meta
+// and control events, to the end of the track, which is at the given tick.
+// Events keep their distance from the given start tick. Returns the ticks of
+// the copied hits.
+func (t *Track) copyRange(start, end int, meta []*Meta, controls []*Control,
+	startTick, at uint) uint {
+	for _, m := range meta {
+		m2 := m.copy()
+		m2.T = m.T - startTick + at
+		t.Meta = append(t.Meta, m2)
+	}
+	for _, c := range controls {
+		c2 := *c
+		c2.T = c.T - startTick + at
+		t.Controls = append(t.Controls, &c2)
+	}
+	var ticks uint
+	for _, h := range t.Hits[start:end] {
+		t.Hits = append(t.Hits, h.copy())
+		ticks += h.T
+	}
+	return ticks
+}
@@ -0,0 +1,137 @@
+// Package serve compiles beatnik sources over HTTP, for web playgrounds and
+// compile-as-a-service deployments.
+//
+// A Handler answers POST requests to /compile, whose body is the source text.
+// The response is a JSON Result, with the compiled midi file and the
+// diagnostics of the source. The status is 200 if the source compiled, and 422
+// if it did not.
+package serve
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/fluhus/beatnik"
+)
+
+// DefaultMaxBody is the largest source that a handler accepts when its
+// MaxBody is zero, 1 MiB.
+const DefaultMaxBody = 1 << 20
+
+// A Result is the response to a compile request.
+type Result struct {
+	// A standard midi file, encoded in base64. Empty if the source did not
+	// compile.
+	MIDI []byte `json:"midi,omitempty"`
+
+	// Errors that stopped the compilation, or warnings about a source that
+	// compiled.
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+// A Diagnostic is an error or a warning about the source.
+type Diagnostic struct {
+	Severity string `json:"severity"`       // "error" or "warning".
+	Code     string `json:"code,omitempty"` // Kind of problem, empty if unknown.
+	File     string `json:"file,omitempty"` // Included file, empty for the source.
+	Line     int    `json:"line,omitempty"` // 1-based line, 0 if unknown.
+	Col      int    `json:"col,omitempty"`  // 1-based column in runes, 0 if unknown.
+	Message  string `json:"message"`
+}
+
+// A Handler compiles sources that are posted to /compile. Sources are parsed
+// in a sandbox, since they come from untrusted users. The zero value is ready
+// to use.
+type Handler struct {
+	// Language of diagnostic messages, empty for the default. A lang query
+	// parameter, as in /compile?lang=es, overrides it.
+	Lang string
+
+	// Sandbox that sources are parsed in, nil for one that cannot include
+	// files.
+	Sandbox *beatnik.Sandbox
+
+	// Largest source in bytes, zero for DefaultMaxBody.
+	MaxBody int64
+}
+
+// ServeHTTP compiles the source in the request's body.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/compile" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	max := h.MaxBody
+	if max == 0 {
+		max = DefaultMaxBody
+	}
+	src, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, max))
+	if err != nil {
+		http.Error(w, "source too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	lang := r.URL.Query().Get("lang")
+	if lang == "" {
+		lang = h.Lang
+	}
+	if lang == "" {
+		lang = beatnik.DefaultLanguage
+	}
+
+	result, ok := h.compile(string(src), lang)
+	w.Header().Set("Content-Type", "application/json")
+	if !ok {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+// compile returns the result of compiling the source, and whether it
+// compiled.
+func (h *Handler) compile(src, lang string) (*Result, bool) {
+	result := &Result{Diagnostics: []Diagnostic{}}
+	sandbox := h.Sandbox
+	if sandbox == nil {
+		sandbox = &beatnik.Sandbox{}
+	}
+	t, err := sandbox.ParseTrack(src)
+	if err == nil {
+		result.MIDI, err = t.MarshalBinary()
+	}
+	if err != nil {
+		errs := []error{err}
+		if list, ok := err.(beatnik.ErrorList); ok {
+			errs = list
+		}
+		for _, err := range errs {
+			result.Diagnostics = append(result.Diagnostics,
+				diagnostic("error", err, lang))
+		}
+		return result, false
+	}
+	for _, d := range beatnik.Lint(t, src) {
+		result.Diagnostics = append(result.Diagnostics,
+			diagnostic("warning", d.Error, lang))
+	}
+	return result, true
+}
+
+// diagnostic returns a diagnostic of the given severity for an error.
+func diagnostic(severity string, err error, lang string) Diagnostic {
+	d := Diagnostic{Severity: severity}
+	if e, ok := err.(*beatnik.Error); ok {
+		e2 := *e
+		e2.File, e2.Line = "", 0
+		d.Code, d.File, d.Line, d.Col = string(e.Code), e.File, e.Line, e.Col
+		d.Message = e2.Localize(lang)
+	} else {
+		d.Message = beatnik.Localize(err, lang)
+	}
+	return d
+}
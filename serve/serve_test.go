@@ -0,0 +1,71 @@
+package serve
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fluhus/beatnik"
+)
+
+func post(t *testing.T, h http.Handler, url, src string) (*httptest.ResponseRecorder, *Result) {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", url, strings.NewReader(src)))
+	var result Result
+	if w.Code == http.StatusOK || w.Code == http.StatusUnprocessableEntity {
+		if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatalf("bad response %q: %v", w.Body, err)
+		}
+	}
+	return w, &result
+}
+
+func TestHandler(t *testing.T) {
+	h := &Handler{}
+	w, result := post(t, h, "/compile", "bpm:100 K S K S")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status=%v, want %v", w.Code, http.StatusOK)
+	}
+	tr, _ := beatnik.ParseTrack("bpm:100 K S K S")
+	want, _ := tr.MarshalBinary()
+	if !bytes.Equal(result.MIDI, want) {
+		t.Errorf("MIDI=%v, want %v", result.MIDI, want)
+	}
+	if len(result.Diagnostics) != 0 {
+		t.Errorf("Diagnostics=%v, want none", result.Diagnostics)
+	}
+
+	w, result = post(t, h, "/compile?lang=es", "K\n  S X")
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status=%v, want %v", w.Code, http.StatusUnprocessableEntity)
+	}
+	if result.MIDI != nil || len(result.Diagnostics) != 1 {
+		t.Fatalf("result=%+v, want a single diagnostic", result)
+	}
+	d := result.Diagnostics[0]
+	msg := (&beatnik.Error{Code: beatnik.Code(d.Code),
+		Args: []interface{}{"X"}}).Localize("es")
+	wantDiag := Diagnostic{"error", string(beatnik.CodeBadDrum), "", 2, 5, msg}
+	if !reflect.DeepEqual(d, wantDiag) {
+		t.Errorf("diagnostic=%+v, want %+v", d, wantDiag)
+	}
+}
+
+func TestHandler_bad(t *testing.T) {
+	h := &Handler{MaxBody: 4}
+	if w, _ := post(t, h, "/other", "K"); w.Code != http.StatusNotFound {
+		t.Errorf("status=%v, want %v", w.Code, http.StatusNotFound)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/compile", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("status=%v, want %v", w.Code, http.StatusMethodNotAllowed)
+	}
+	if w, _ := post(t, h, "/compile", "K S K S"); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status=%v, want %v", w.Code, http.StatusRequestEntityTooLarge)
+	}
+}
@@ -0,0 +1,94 @@
+package beatnik
+
+// Songs made of several tracks.
+
+import (
+	"bytes"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// A Song is a set of tracks that play together, each encoded as its own midi
+// track. The first track's tempo, time signature and meta events apply to the
+// whole song; those of the other tracks are ignored.
+type Song struct {
+	Tracks []*Track
+}
+
+// Validate checks that the song can be encoded as a valid midi file. Returns
+// all the problems found, or nil if there are none.
+func (s *Song) Validate() []error {
+	if len(s.Tracks) == 0 {
+		return []error{newError(CodeEmptySong)}
+	}
+	errs := s.Tracks[0].Validate()
+	for _, t := range s.Tracks[1:] {
+		errs = append(errs, t.validateHits()...)
+	}
+	return errs
+}
+
+// MarshalBinary returns a binary encoding of the song as a complete midi file.
+func (s *Song) MarshalBinary() ([]byte, error) {
+	return s.Encode(nil)
+}
+
+// Encode returns a binary encoding of the song as a complete midi file, using
+// the given options.
+func (s *Song) Encode(opts *EncodeOptions) ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	if _, err := s.EncodeTo(buf, opts); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteTo writes the song to w as a complete midi file. Returns the number of
+// bytes written.
+func (s *Song) WriteTo(w io.Writer) (int64, error) {
+	return s.EncodeTo(w, nil)
+}
+
+// EncodeTo writes the song to w as a complete midi file, using the given
+// options. The song's tracks are encoded concurrently, and written in order.
+// Returns the number of bytes written. Nothing is written if the song fails
+// validation.
+func (s *Song) EncodeTo(w io.Writer, opts *EncodeOptions) (int64, error) {
+	if err := errorOf(s.Validate()); err != nil {
+		return 0, err
+	}
+	if opts == nil {
+		opts = &EncodeOptions{}
+	}
+
+	var groups []trackGroup
+	for _, t := range s.Tracks {
+		groups = append(groups, t.groups(opts)...)
+	}
+
+	// Encode tracks in parallel, at most one per CPU.
+	chunks := make([][]byte, len(groups))
+	sem := make(chan struct{}, runtime.GOMAXPROCS(0))
+	var wg sync.WaitGroup
+	for i, g := range groups {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, g trackGroup) {
+			defer wg.Done()
+			buf := bytes.NewBuffer(nil)
+			g.writeHits(buf, opts)
+			chunks[i] = buf.Bytes()
+			<-sem
+		}(i, g)
+	}
+	wg.Wait()
+
+	cw := &countingWriter{w: w}
+	cw.Write(encodeHeaderChunk(len(groups) + 1))
+	cw.Write(s.Tracks[0].encodeMetaChunk())
+	for _, c := range chunks {
+		cw.Write(c)
+	}
+	return cw.n, cw.err
+}
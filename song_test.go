@@ -0,0 +1,56 @@
+package beatnik
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestSongEncode(t *testing.T) {
+	var tracks []*Track
+	for _, src := range []string{"bpm:90 marker:A K. K", "S S. S.", "HC.. HC~ HC"} {
+		tr, err := ParseTrack(src)
+		if err != nil {
+			t.Fatalf("ParseTrack(%q) failed: %v", src, err)
+		}
+		tracks = append(tracks, tr)
+	}
+	song := &Song{tracks}
+	b, err := song.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() failed: %v", err)
+	}
+
+	if n := binary.BigEndian.Uint16(b[10:12]); n != 4 {
+		t.Errorf("MarshalBinary() has %v tracks, want 4", n)
+	}
+	b = b[14:]
+	want := [][]byte{tracks[0].encodeMetaChunk()}
+	for _, tr := range tracks {
+		buf := bytes.NewBuffer(nil)
+		tr.writeHits(buf, &EncodeOptions{})
+		want = append(want, buf.Bytes())
+	}
+	for i, w := range want {
+		if !bytes.HasPrefix(b, w) {
+			t.Fatalf("MarshalBinary() chunk #%v=%v, want %v", i+1, b, w)
+		}
+		b = b[len(w):]
+	}
+	if len(b) != 0 {
+		t.Errorf("MarshalBinary() has %v extra bytes", len(b))
+	}
+}
+
+func TestSongEncode_bad(t *testing.T) {
+	songs := []*Song{
+		{},
+		{[]*Track{{Hits: []*Hit{{Notes: map[byte]Velocity{36: F}, T: 96}}}}},
+		{[]*Track{{BPM: 90}, {Hits: []*Hit{{Notes: map[byte]Velocity{36: F}}}}}},
+	}
+	for i, s := range songs {
+		if b, err := s.MarshalBinary(); err == nil {
+			t.Errorf("#%v MarshalBinary()=%v, want failure", i+1, b)
+		}
+	}
+}
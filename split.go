@@ -0,0 +1,97 @@
+package beatnik
+
+// Splitting of encoded tracks by instrument.
+
+import (
+	"io"
+	"sort"
+)
+
+// DefaultTrackGroups groups instrument classes into the tracks that drum
+// replacement workflows usually expect, for EncodeOptions.TrackGroups.
+var DefaultTrackGroups = map[Class]string{
+	ClassKick:   "kick",
+	ClassSnare:  "snare",
+	ClassHat:    "cymbals",
+	ClassCymbal: "cymbals",
+	ClassTom:    "toms",
+	ClassPerc:   "perc",
+}
+
+// A trackGroup is a part of a track that is encoded as its own midi track.
+type trackGroup struct {
+	name  string // Name of the midi track, empty for none.
+	track *Track
+}
+
+// groups returns the parts of the track to encode as midi tracks: the groups
+// of opts.TrackGroups that the track plays, ordered by name, or the whole
+// track if it is not split. Key pressure events go with their note's group,
+// and the other control events go with the first group.
+func (t *Track) groups(opts *EncodeOptions) []trackGroup {
+	if opts.TrackGroups == nil {
+		return []trackGroup{{"", t}}
+	}
+	kit := opts.Kit
+	if kit == nil {
+		kit = Kits["ezdrummer"]
+	}
+	groupOf := func(note byte) string {
+		c := kit.ClassOf(note)
+		if name, ok := opts.TrackGroups[c]; ok {
+			return name
+		}
+		return c.String()
+	}
+
+	tracks := map[string]*Track{}
+	var names []string
+	for _, h := range t.Hits {
+		for n := range h.Notes {
+			name := groupOf(n)
+			if tracks[name] != nil {
+				continue
+			}
+			g := &Track{Hits: make([]*Hit, len(t.Hits))}
+			for i, h := range t.Hits {
+				g.Hits[i] = h.copy()
+			}
+			g.dropNotes(func(n byte) bool {
+				return groupOf(n) != name
+			})
+			tracks[name] = g
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return []trackGroup{{"", t}}
+	}
+	sort.Strings(names)
+
+	for _, c := range t.sortedControls() {
+		g := tracks[names[0]]
+		if c.Kind == KeyPressure && tracks[groupOf(c.Number)] != nil {
+			g = tracks[groupOf(c.Number)]
+		}
+		c2 := *c
+		g.Controls = append(g.Controls, &c2)
+	}
+	result := make([]trackGroup, len(names))
+	for i, name := range names {
+		result[i] = trackGroup{name, tracks[name]}
+	}
+	return result
+}
+
+// writeHits writes the group's hits as a single midi track, named after the
+// group.
+func (g trackGroup) writeHits(w io.Writer, opts *EncodeOptions) {
+	g.track.writeHits(w, g.options(opts))
+}
+
+// options returns a copy of opts that names the midi track after the group.
+func (g trackGroup) options(opts *EncodeOptions) *EncodeOptions {
+	o := *opts
+	o.trackName = g.name
+	return &o
+}
@@ -0,0 +1,52 @@
+package beatnik
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestTrackGroups(t *testing.T) {
+	tr := mustParse(t, "bpm:90 cc:4=10 K,HC S,C1 aftertouch:C1=0 T1,HC")
+	opts := &EncodeOptions{TrackGroups: DefaultTrackGroups}
+	groups := tr.groups(opts)
+	var names []string
+	for _, g := range groups {
+		names = append(names, g.name)
+	}
+	if want := []string{"cymbals", "kick", "snare", "toms"}; !reflect.DeepEqual(
+		names, want) {
+		t.Fatalf("groups=%v, want %v", names, want)
+	}
+	hc, c1 := ezDrummer["HC"], ezDrummer["C1"]
+	want := &Track{
+		Hits: []*Hit{NewHit(96, F, hc), NewHit(96, F, c1), NewHit(96, F, hc)},
+		Controls: []*Control{{0, 4, 10, ControlChange},
+			{192, c1, 0, KeyPressure}},
+	}
+	if got := groups[0].track; !reflect.DeepEqual(got, want) {
+		t.Errorf("cymbals=%v, want %v", got, want)
+	}
+	if got := groups[3].track.Hits; !reflect.DeepEqual(got, []*Hit{
+		NewHit(96, F, nil...), NewHit(96, F, nil...),
+		NewHit(96, F, ezDrummer["T1"])}) {
+		t.Errorf("toms=%v, want a single tom", got)
+	}
+
+	b, err := tr.Encode(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(b, []byte("MTrk")); n != 5 {
+		t.Errorf("Encode() has %v tracks, want 5", n)
+	}
+	if !bytes.Contains(b, []byte("\x00\xff\x03\x04kick")) {
+		t.Errorf("Encode() does not name the kick track")
+	}
+
+	opts.TrackGroups = map[Class]string{ClassKick: "low", ClassSnare: "low"}
+	if got := tr.groups(opts); len(got) != 4 || got[1].name != "hat" ||
+		got[2].name != "low" {
+		t.Errorf("groups=%v, want cymbal, hat, low and tom", got)
+	}
+}
@@ -0,0 +1,34 @@
+package beatnik
+
+// System exclusive messages.
+
+import (
+	"encoding/hex"
+	"regexp"
+	"strings"
+)
+
+// sysexToken matches the value of a sysex directive: hex bytes, optionally
+// separated by commas.
+var sysexToken = regexp.MustCompile("^[0-9A-Fa-f]{2}(?:,?[0-9A-Fa-f]{2})*$")
+
+// sysexDirective places a system exclusive message at the current tick, as in
+// "sysex:F0,41,10,42,12,F7", for things like selecting a kit on a drum module.
+// The message is written in hex bytes, with or without commas between them, and
+// should start with F0 and end with F7, with data bytes below 80 between them.
+func sysexDirective(p *parser, s string, at DirectiveContext) error {
+	if !sysexToken.MatchString(s) {
+		return newError(CodeBadSysEx, s)
+	}
+	b, err := hex.DecodeString(strings.Replace(s, ",", "", -1))
+	if err != nil || len(b) < 3 || b[0] != 0xF0 || b[len(b)-1] != 0xF7 {
+		return newError(CodeBadSysEx, s)
+	}
+	for _, x := range b[1 : len(b)-1] {
+		if x >= 0x80 {
+			return newError(CodeBadSysEx, s)
+		}
+	}
+	p.t.Meta = append(p.t.Meta, &Meta{at.Tick, MetaSysEx, b[1:]})
+	return nil
+}
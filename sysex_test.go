@@ -0,0 +1,30 @@
+package beatnik
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestSysEx(t *testing.T) {
+	tr := mustParse(t, "bpm:90 K sysex:F0,41,10,42,12,F7 K sysex:f07e7f0901f7")
+	want := []*Meta{{96, MetaSysEx, []byte{0x41, 0x10, 0x42, 0x12, 0xF7}},
+		{192, MetaSysEx, []byte{0x7E, 0x7F, 0x09, 0x01, 0xF7}}}
+	if !reflect.DeepEqual(tr.Meta, want) {
+		t.Errorf("Meta=%v, want %v", tr.Meta, want)
+	}
+	b, err := tr.Encode(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(b, []byte{96, 0xF0, 5, 0x41, 0x10, 0x42, 0x12, 0xF7}) {
+		t.Errorf("Encode()=%v, want sysex events", b)
+	}
+
+	for _, src := range []string{"sysex:", "sysex:F0", "sysex:F0F7", "sysex:41,F7",
+		"sysex:F0,41", "sysex:F0,80,F7", "sysex:F0,,41,F7", "sysex:F0,4"} {
+		if _, err := ParseTrack(src); err == nil {
+			t.Errorf("ParseTrack(%q) succeeded, want error", src)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package beatnik
+
+// Importer of ASCII drum tabs.
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// Matches a row of a drum tab: a drum label followed by bars.
+	tabRow = regexp.MustCompile("^\\s*([0-9A-Za-z]+)\\s*(\\|.*\\|)\\s*$")
+
+	// Maps common drum tab labels to notes. Other labels are looked up as
+	// beatnik note names.
+	tabDrums = map[string]byte{
+		"B": ezDrummer["K"], "BD": ezDrummer["K"], "K": ezDrummer["K"],
+		"S": ezDrummer["S"], "SD": ezDrummer["S"], "SN": ezDrummer["S"],
+		"H": ezDrummer["HC"], "HH": ezDrummer["HC"],
+		"HF": ezDrummer["HP"], "FH": ezDrummer["HP"], "HP": ezDrummer["HP"],
+		"C": ezDrummer["C1"], "CC": ezDrummer["C1"], "CR": ezDrummer["C1"],
+		"R": ezDrummer["R"], "RC": ezDrummer["R"], "RD": ezDrummer["R"],
+		"T1": ezDrummer["T1"], "HT": ezDrummer["T1"],
+		"T2": ezDrummer["T2"], "MT": ezDrummer["T2"],
+		"T3": ezDrummer["T3"], "FT": ezDrummer["T3"], "LT": ezDrummer["T3"],
+	}
+
+	// Maps drum tab characters to velocities. Dashes are silence.
+	tabVelocities = map[rune]Velocity{
+		'x': F, 'o': F, '*': F, 'f': F, 'd': F, 'b': F,
+		'X': FF, 'O': FF, '#': FF,
+		'g': PP,
+	}
+)
+
+// ParseTab parses a classic ASCII drum tab, where each row is a drum and each
+// character is a step:
+//
+//	HH|x-x-x-x-|x-x-x-x-|
+//	SD|----o---|----o---|
+//	BD|o-------|o---o---|
+//
+// Steps are spread evenly across their bar, which is taken to be 4/4. Rows
+// that are next to each other are played together, and are followed by the
+// next block of rows. Lines that are not tab rows are ignored. An 'o' on a
+// hi-hat row is an open hi-hat, a 'b' on a ride row is a ride bell, a 'g' is a
+// ghost note, and upper case letters are accents. Tabs carry no tempo, so the
+// track is set to 120 BPM.
+func ParseTab(s string) (*Track, error) {
+	t := &Track{BPM: 120}
+	var block []token
+	for i, line := range strings.Split(s, "\n") {
+		if tabRow.MatchString(line) {
+			block = append(block, token{line, i + 1, 1})
+			continue
+		}
+		if err := t.appendTabBlock(block); err != nil {
+			return nil, err
+		}
+		block = nil
+	}
+	if err := t.appendTabBlock(block); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// appendTabBlock adds the hits of a block of tab rows that play together to
+// the track.
+func (t *Track) appendTabBlock(rows []token) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	var bars [][]string // Per row.
+	for _, row := range rows {
+		m := tabRow.FindStringSubmatch(row.s)
+		bars = append(bars, strings.Split(strings.Trim(m[2], "|"), "|"))
+	}
+
+	// Check that all rows are aligned.
+	for i := range bars[1:] {
+		if len(bars[i+1]) != len(bars[0]) {
+			return tabError(newError(CodeTabMismatch), rows[i+1], 1)
+		}
+		for j := range bars[0] {
+			if len([]rune(bars[i+1][j])) != len([]rune(bars[0][j])) {
+				return tabError(newError(CodeTabMismatch), rows[i+1], 1)
+			}
+		}
+	}
+
+	// Read steps column by column.
+	col := make([]int, len(rows)) // Column of the current bar per row.
+	for i, row := range rows {
+		col[i] = len([]rune(row.s[:strings.IndexRune(row.s, '|')])) + 2
+	}
+	for j := range bars[0] {
+		steps := len([]rune(bars[0][j]))
+		barTicks := TimeSig{4, 4}.barTicks()
+		if steps == 0 || barTicks%uint(steps) != 0 {
+			return tabError(newError(CodeTabBarLength, steps), rows[0], col[0])
+		}
+		hits := make([]*Hit, steps)
+		for k := range hits {
+			hits[k] = &Hit{Notes: map[byte]Velocity{}, T: barTicks / uint(steps)}
+		}
+		for i, row := range rows {
+			label := tabRow.FindStringSubmatch(row.s)[1]
+			for k, c := range []rune(bars[i][j]) {
+				if c == '-' || c == '.' {
+					continue
+				}
+				note, vel, err := tabNote(label, c)
+				if err != nil {
+					return tabError(err, row, col[i]+k)
+				}
+				hits[k].Notes[note] = vel
+			}
+			col[i] += steps + 1
+		}
+		t.appendTabHits(hits)
+	}
+	return nil
+}
+
+// appendTabHits adds hits to the track, joining empty steps into the hit
+// before them.
+func (t *Track) appendTabHits(hits []*Hit) {
+	for _, h := range hits {
+		if len(h.Notes) == 0 && len(t.Hits) > 0 {
+			t.Hits[len(t.Hits)-1].T += h.T
+			continue
+		}
+		if len(h.Notes) == 0 {
+			h.Notes = nil
+		}
+		t.Hits = append(t.Hits, h)
+	}
+}
+
+// tabNote returns the note and velocity of a character on a tab row with the
+// given label.
+func tabNote(label string, c rune) (byte, Velocity, error) {
+	vel, ok := tabVelocities[c]
+	if !ok {
+		return 0, 0, newError(CodeBadTabChar, string(c))
+	}
+	note, ok := tabDrums[strings.ToUpper(label)]
+	if !ok {
+		note = noteByName(label, nil, nil)
+	}
+	if note == 0 {
+		return 0, 0, newError(CodeBadTabDrum, label)
+	}
+	switch {
+	case note == ezDrummer["HC"] && (c == 'o' || c == 'O'):
+		note = ezDrummer["HO1"]
+	case note == ezDrummer["R"] && c == 'b':
+		note = ezDrummer["RB"]
+	}
+	return note, vel, nil
+}
+
+// tabError places err at the given rune column of a tab row.
+func tabError(err error, row token, col int) error {
+	e := err.(*Error)
+	e.Line, e.Col = row.line, col
+	return e
+}
@@ -0,0 +1,68 @@
+package beatnik
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTab(t *testing.T) {
+	src := `Some song - verse
+HH|x-x-o---|
+SD|--g-X---|
+BD|o-----o-|
+
+CC|x---|
+BD|o---|
+`
+	want := &Track{BPM: 120, Hits: []*Hit{
+		{Notes: map[byte]Velocity{22: F, 36: F}, T: 96},
+		{Notes: map[byte]Velocity{22: F, 38: PP}, T: 96},
+		{Notes: map[byte]Velocity{24: F, 38: FF}, T: 96},
+		{Notes: map[byte]Velocity{36: F}, T: 96},
+		{Notes: map[byte]Velocity{55: F, 36: F}, T: 384},
+	}}
+	got, err := ParseTab(src)
+	if err != nil {
+		t.Fatalf("ParseTab(%q) failed: %v", src, err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseTab(%q)=%v, want %v", src, got, want)
+	}
+}
+
+func TestParseTab_leadingRest(t *testing.T) {
+	src := "SD|----o---|"
+	want := &Track{BPM: 120, Hits: []*Hit{
+		{T: 192},
+		{Notes: map[byte]Velocity{38: F}, T: 192},
+	}}
+	got, err := ParseTab(src)
+	if err != nil {
+		t.Fatalf("ParseTab(%q) failed: %v", src, err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseTab(%q)=%v, want %v", src, got, want)
+	}
+}
+
+func TestParseTab_bad(t *testing.T) {
+	tests := []struct {
+		src  string
+		code Code
+		line int
+		col  int
+	}{
+		{"HH|x-x-\nSD|--?-|", CodeBadTabChar, 2, 6},
+		{"ZZ|x-x-|", CodeBadTabDrum, 1, 4},
+		{"HH|x-x-x|", CodeTabBarLength, 1, 4},
+		{"HH|x-x-|\nSD|--o-|--o-|", CodeTabMismatch, 2, 1},
+	}
+	for _, test := range tests {
+		_, err := ParseTab(test.src)
+		e, ok := err.(*Error)
+		if !ok || e.Code != test.code || e.Line != test.line || e.Col != test.col {
+			t.Errorf("ParseTab(%q) error=%v, want %v at %v:%v",
+				test.src, err, test.code, test.line, test.col)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package beatnik
+
+// Tempo maps.
+
+import (
+	"sort"
+	"time"
+)
+
+// A TempoChange is a point of a track where the tempo changes.
+type TempoChange struct {
+	T   uint // Absolute tick of the change, from the start of the track.
+	BPM uint // Tempo from the change on.
+}
+
+// A TempoMap is a track's tempo over time, for converting between ticks and
+// playing times. Lookups are binary searches. A tempo map does not follow
+// changes to the track it was made from.
+type TempoMap struct {
+	changes []TempoChange   // Ordered by tick, starting at tick 0.
+	times   []time.Duration // Time of each change.
+}
+
+// NewTempoMap returns a tempo map with the given changes, in any order. Of
+// changes on the same tick, the last one counts, and changes to a tempo of 0
+// are ignored. The tempo before the first change is that of the first change.
+// A map without changes has no tempo, and all its times are 0.
+func NewTempoMap(changes ...TempoChange) *TempoMap {
+	sorted := make([]TempoChange, 0, len(changes))
+	for _, c := range changes {
+		if c.BPM != 0 {
+			sorted = append(sorted, c)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].T < sorted[j].T
+	})
+
+	m := &TempoMap{}
+	for _, c := range sorted {
+		if len(m.changes) == 0 {
+			c.T = 0
+		}
+		n := len(m.changes)
+		if n > 0 && m.changes[n-1].T == c.T {
+			m.changes[n-1].BPM = c.BPM
+			continue
+		}
+		var at time.Duration
+		if n > 0 {
+			last := m.changes[n-1]
+			at = m.times[n-1] + ticksDuration(c.T-last.T, last.BPM)
+		}
+		m.changes = append(m.changes, c)
+		m.times = append(m.times, at)
+	}
+	return m
+}
+
+// TempoMap returns the track's tempo map, made of its tempo and its tempo
+// change events, which override the tempo on their ticks. The map of a track
+// without a tempo or tempo events has no changes.
+func (t *Track) TempoMap() *TempoMap {
+	changes := []TempoChange{{0, t.BPM}}
+	for _, m := range t.sortedMeta() {
+		if m.Type == MetaTempo {
+			changes = append(changes, TempoChange{m.T, m.bpm()})
+		}
+	}
+	return NewTempoMap(changes...)
+}
+
+// SetTempoMap sets the track's tempo and tempo change events to those of the
+// given map, replacing the ones it had. The track's meta events are left
+// ordered by tick, with tempo changes first on their ticks.
+func (t *Track) SetTempoMap(m *TempoMap) {
+	var meta []*Meta
+	if len(m.changes) > 1 {
+		meta = m.tempoMetas()[1:]
+	}
+	for _, mt := range t.Meta {
+		if mt.Type != MetaTempo {
+			meta = append(meta, mt)
+		}
+	}
+	sort.SliceStable(meta, func(i, j int) bool {
+		return meta[i].T < meta[j].T
+	})
+	t.BPM = m.BPM(0)
+	t.Meta = meta
+}
+
+// setTempo changes the track's tempo from the given tick on, with a tempo
+// change event. At tick 0 it sets the track's tempo instead, and removes the
+// tempo events that would override it.
+func (t *Track) setTempo(at, bpm uint) {
+	if at > 0 {
+		t.Meta = append(t.Meta, tempoMeta(at, bpm))
+		return
+	}
+	t.BPM = bpm
+	var meta []*Meta
+	for _, m := range t.Meta {
+		if m.T != 0 || m.Type != MetaTempo {
+			meta = append(meta, m)
+		}
+	}
+	t.Meta = meta
+}
+
+// Changes returns the map's tempo changes, ordered by tick. The first change,
+// if there is one, is at tick 0.
+func (m *TempoMap) Changes() []TempoChange {
+	return append([]TempoChange{}, m.changes...)
+}
+
+// changeAt returns the index of the change in effect at the given tick, or -1
+// if the map has no changes.
+func (m *TempoMap) changeAt(tick uint) int {
+	return sort.Search(len(m.changes), func(i int) bool {
+		return m.changes[i].T > tick
+	}) - 1
+}
+
+// BPM returns the tempo in effect at the given tick, or 0 if the map has no
+// tempo.
+func (m *TempoMap) BPM(tick uint) uint {
+	i := m.changeAt(tick)
+	if i == -1 {
+		return 0
+	}
+	return m.changes[i].BPM
+}
+
+// TickToTime returns the playing time at the given tick. Returns 0 if the map
+// has no tempo.
+func (m *TempoMap) TickToTime(tick uint) time.Duration {
+	i := m.changeAt(tick)
+	if i == -1 {
+		return 0
+	}
+	c := m.changes[i]
+	return m.times[i] + ticksDuration(tick-c.T, c.BPM)
+}
+
+// TimeToTick returns the tick that plays at the given time, rounded down.
+// Returns 0 if the map has no tempo.
+func (m *TempoMap) TimeToTick(d time.Duration) uint {
+	if len(m.changes) == 0 || d <= 0 {
+		return 0
+	}
+	i := sort.Search(len(m.times), func(i int) bool {
+		return m.times[i] > d
+	}) - 1
+	c := m.changes[i]
+	return c.T + uint(float64(d-m.times[i])*float64(96*c.BPM)/float64(time.Minute))
+}
+
+// diff returns the tempos of the two maps at the first tick where they differ.
+// Returns false if the maps have the same tempos.
+func (m *TempoMap) diff(o *TempoMap) (a, b uint, ok bool) {
+	var at uint
+	for _, c := range append(m.Changes(), o.changes...) {
+		if x, y := m.BPM(c.T), o.BPM(c.T); x != y && (!ok || c.T < at) {
+			a, b, ok, at = x, y, true, c.T
+		}
+	}
+	return a, b, ok
+}
+
+// tempoMetas returns tempo change events of the map's changes, including the
+// one at tick 0.
+func (m *TempoMap) tempoMetas() []*Meta {
+	result := make([]*Meta, len(m.changes))
+	for i, c := range m.changes {
+		result[i] = tempoMeta(c.T, c.BPM)
+	}
+	return result
+}
@@ -0,0 +1,96 @@
+package beatnik
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTempoMap(t *testing.T) {
+	m := NewTempoMap(TempoChange{384, 60}, TempoChange{96, 120},
+		TempoChange{384, 120}, TempoChange{192, 0}, TempoChange{480, 240})
+	want := []TempoChange{{0, 120}, {384, 120}, {480, 240}}
+	if got := m.Changes(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Changes()=%v, want %v", got, want)
+	}
+	times := []struct {
+		tick uint
+		time time.Duration
+	}{
+		{0, 0},
+		{48, 250 * time.Millisecond},
+		{480, 2500 * time.Millisecond},
+		{576, 2750 * time.Millisecond},
+	}
+	for _, test := range times {
+		if got := m.TickToTime(test.tick); got != test.time {
+			t.Errorf("TickToTime(%v)=%v, want %v", test.tick, got, test.time)
+		}
+		if got := m.TimeToTick(test.time); got != test.tick {
+			t.Errorf("TimeToTick(%v)=%v, want %v", test.time, got, test.tick)
+		}
+	}
+	if got := m.BPM(479); got != 120 {
+		t.Errorf("BPM(479)=%v, want 120", got)
+	}
+	if got := m.BPM(480); got != 240 {
+		t.Errorf("BPM(480)=%v, want 240", got)
+	}
+}
+
+func TestTempoMap_empty(t *testing.T) {
+	m := NewTempoMap(TempoChange{96, 0})
+	if got := m.Changes(); len(got) != 0 {
+		t.Errorf("Changes()=%v, want none", got)
+	}
+	if got := m.TickToTime(96); got != 0 {
+		t.Errorf("TickToTime(96)=%v, want 0", got)
+	}
+	if got := m.TimeToTick(time.Second); got != 0 {
+		t.Errorf("TimeToTick(1s)=%v, want 0", got)
+	}
+	if got := (&Track{}).TempoMap().BPM(0); got != 0 {
+		t.Errorf("BPM(0)=%v, want 0", got)
+	}
+}
+
+func TestTrack_TempoMap(t *testing.T) {
+	tr, err := ParseTrack("bpm:60 marker:A K S bpmramp:120..60,1 K S K S")
+	if err != nil {
+		t.Fatalf("ParseTrack() failed: %v", err)
+	}
+	m := tr.TempoMap()
+	want := []TempoChange{{0, 60}, {192, 120}, {288, 105}, {384, 90},
+		{480, 75}, {576, 60}}
+	if got := m.Changes(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Changes()=%v, want %v", got, want)
+	}
+	if got, want := m.TickToTime(tr.ticks()), tr.Duration(); got != want {
+		t.Errorf("TickToTime(%v)=%v, want Duration() %v", tr.ticks(), got, want)
+	}
+
+	tr.SetTempoMap(NewTempoMap(TempoChange{0, 120}, TempoChange{192, 240}))
+	if tr.BPM != 120 {
+		t.Errorf("BPM=%v, want 120", tr.BPM)
+	}
+	wantMeta := []*Meta{{0, MetaMarker, []byte("A")}, tempoMeta(192, 240)}
+	if !reflect.DeepEqual(tr.Meta, wantMeta) {
+		t.Errorf("Meta=%v, want %v", tr.Meta, wantMeta)
+	}
+	if got, want := tr.Duration(), 2*time.Second; got != want {
+		t.Errorf("Duration()=%v, want %v", got, want)
+	}
+}
+
+func TestParseTrack_tempoChanges(t *testing.T) {
+	tr := mustParse(t, "bpm:60 K bpm:120 K bpm:90 K")
+	want := []TempoChange{{0, 60}, {96, 120}, {192, 90}}
+	if got := tr.TempoMap().Changes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Changes()=%v, want %v", got, want)
+	}
+
+	tr = mustParse(t, "bpmramp:100..120,1 bpm:80 K")
+	if got := tr.TempoMap().BPM(0); got != 80 || tr.BPM != 80 {
+		t.Errorf("BPM(0)=%v with BPM=%v, want 80", got, tr.BPM)
+	}
+}
@@ -5,50 +5,63 @@ package beatnik
 import (
 	"fmt"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
+// namePattern matches a drum name, with an optional articulation after a dot,
+// as in "S.rim".
+const namePattern = "[\\pL\\pN]+(?:\\.[a-z]+)?"
+
+// Patterns of directive values. Tokens are matched by the scanners in scan.go.
 var (
-	hitToken = regexp.MustCompile("^\\(?([0-9A-Z]+(?:\\+*|-*)" +
-		"(?:,[0-9A-Z]+(?:\\+*|-*))*)((?:\\.*|~*)>?)\\)?$")
-	noteToken      = regexp.MustCompile("^([0-9A-Z]+)(\\+*|-*)$")
-	waitToken      = regexp.MustCompile("^(?:\\.*|~*)>?$")
-	directiveToken = regexp.MustCompile("^([^:]+):(.*)$")
-	tokenizer      = regexp.MustCompile("(?m)\\s+")
-	comment        = regexp.MustCompile("#[^\n]*")
+	annotationToken = regexp.MustCompile("^([0-9A-Za-z_]+)=([^,=]*)$")
+	timeSigToken    = regexp.MustCompile("^([0-9]+)/([0-9]+)$")
+	remapToken      = regexp.MustCompile("^(" + namePattern + ")=(" + namePattern + ")$")
+	aliasToken      = regexp.MustCompile("^([\\pL\\pN]+)=(" + namePattern + ")$")
+	setToken        = regexp.MustCompile("^([A-Za-z_][0-9A-Za-z_]*)=(.+)$")
 
 	// Maps textual representation of notes to byte values.
 	drumNotes = map[string]byte{}
 
-	// Maps +- notation to actual velocities.
-	velocities = map[string]Velocity{
-		"-----": PPP,
-		"----":  PP,
-		"---":   P,
-		"--":    MP,
-		"-":     MF,
-		"":      F,
-		"+":     FF,
-		"++":    FFF,
-	}
-
-	// Maps notation to note duration in ticks.
-	durations = map[string]uint{
-		"~~":    96 * 4,
-		"~":     96 * 2,
-		"":      96,
-		".":     96 / 2,
-		"..":    96 / 4,
-		"...":   96 / 8,
-		"....":  96 / 16,
-		".....": 96 / 32,
+	// Maps group operator names (in text syntax) to functions that transform
+	// the group's hits in place. The empty operator does nothing.
+	groupOps = map[string]func([]*Hit){
+		"":    nil,
+		"rev": reverseHits,
 	}
 
 	// Maps directive name (in text syntax) to its handler.
 	directives = map[string]directive{
-		"bpm": bpmDirective,
+		"bpm":        bpmDirective,
+		"marker":     markerDirective,
+		"cue":        cueDirective,
+		"alias":      aliasDirective,
+		"time":       timeDirective,
+		"remap":      remapDirective,
+		"vel":        velDirective,
+		"set":        setDirective,
+		"section":    sectionDirective,
+		"play":       playDirective,
+		"fill":       fillDirective,
+		"title":      titleDirective,
+		"cresc":      crescDirective,
+		"bpmramp":    bpmRampDirective,
+		"cc":         ccDirective,
+		"aftertouch": aftertouchDirective,
+		"bend":       bendDirective,
+		"sysex":      sysexDirective,
+		"map":        mapDirective,
+		"loopstart":  loopStartDirective,
+		"loopend":    loopEndDirective,
 	}
+
+	// Names of the variables that expressions can use to refer to the
+	// position of the next hit.
+	positionVars = map[string]bool{"bar": true, "beat": true, "tick": true,
+		"hit": true}
 )
 
 func init() {
@@ -60,126 +73,514 @@ func init() {
 	for k, v := range ezDrummer {
 		drumNotes[k] = v
 	}
-
-	// Add triplets to durations.
-	for d := range durations {
-		durations[d+">"] = durations[d] * 2 / 3
-	}
 }
 
 // ParseTrack parses hit notations separated by whitespaces.
 func ParseTrack(s string) (*Track, error) {
-	t := &Track{}
-	for i, token := range tokenize(s) {
-		switch {
-		case hitToken.MatchString(token):
-			if halfParenthesized(token) {
-				return nil, fmt.Errorf(
-					"token #%v: grace notes should have parenthesis on both sides", i)
-			}
+	return ParseTrackWithOptions(s, ParseOptions{})
+}
 
-			// Check for grace.
-			grace := false
-			if parenthesized(token) {
-				grace = true
-				token = token[1 : len(token)-1]
-			}
+// ParseTrackAll parses hit notations like ParseTrack, but goes on after
+// problems and returns all of them, for showing a complete list of
+// diagnostics. Tokens with problems are skipped, and the track holds
+// everything else. Parsing stops early only if the source passes its limits of
+// hits or tokens.
+// The errors are nil if there are no problems.
+func ParseTrackAll(s string) (*Track, []error) {
+	p := newParser()
+	errs := p.parseTokens(tokenize(s), true)
+	if n := len(errs); n > 0 && stopsParsing(errs[n-1]) {
+		return p.t, errs
+	}
+	if err := p.finish(); err != nil {
+		errs = append(errs, err)
+	}
+	return p.t, errs
+}
 
-			// Parse hit.
-			h, err := parseHit(token)
-			if err != nil {
-				return nil, fmt.Errorf("token #%v: %v", i, err)
-			}
+// Directives returns the names of the available directives, sorted.
+func Directives() []string {
+	var result []string
+	for name := range directives {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
 
-			if grace {
-				// Shorten last hit.
-				if len(t.Hits) > 0 {
-					last := t.Hits[len(t.Hits)-1]
-					if last.T <= h.T {
-						return nil, fmt.Errorf("token #%v: grace note is too long: "+
-							"%v ticks, should be less than %v",
-							i, h.T, last.T)
-					}
-					last.T -= h.T
-				}
-			}
+// newParser returns a parser with an empty track.
+func newParser() *parser {
+	return &parser{t: &Track{}, aliases: map[string]byte{},
+		remap: map[byte]byte{}, vars: map[string]int{},
+		sections: map[string]*section{}, alts: map[*Hit]alts{},
+		hits: &hitSlab{}, limits: DefaultLimits}
+}
 
-			t.Hits = append(t.Hits, h)
-		case waitToken.MatchString(token):
-			d := durations[token]
-			if d == 0 {
-				return nil, fmt.Errorf("token #%v: bad duration: %q", i+1, token)
-			}
-			if len(t.Hits) == 0 {
-				return nil, fmt.Errorf("token #%v: duration with no preceding note", i+1)
-			}
-			t.Hits[len(t.Hits)-1].T += d
-		case directiveToken.MatchString(token):
-			if err := t.parseDirective(token); err != nil {
-				return nil, fmt.Errorf("token #%v: %v", i, err)
-			}
-		default:
-			return nil, fmt.Errorf("token #%v: unrecognized token: %q", i+1, token)
+// parseToken parses a single token and applies it to the parser's track.
+func (p *parser) parseToken(tok token) error {
+	t := p.t
+	token := tok.s
+	switch tokenKind(token) {
+	case TokenHit:
+		h, alts, err := p.parseHitToken(token)
+		if err != nil {
+			return err
+		}
+		return p.addHit(tok, h, alts)
+	case TokenWait:
+		d := parseDuration(token)
+		if d == 0 {
+			return newError(CodeBadDuration, token)
+		}
+		if len(t.Hits) == 0 {
+			return newError(CodeOrphanDuration)
+		}
+		t.Hits[len(t.Hits)-1].T += d
+		p.tick += d
+		p.graces = graceChain{}
+	case TokenDirective:
+		return p.parseDirective(tok)
+	case TokenBarLine:
+		// Bar lines are only for readability.
+	case TokenGroupOpen:
+		p.groups = append(p.groups, group{tok, len(t.Hits)})
+	case TokenGroupClose:
+		return p.closeGroup(token[1:])
+	default:
+		return newError(CodeUnrecognizedToken, token)
+	}
+	return nil
+}
+
+// parseHitToken parses a hit token, which may be a grace note, with the
+// parser's note names. Depends on no other state of the parser, so that hits
+// can be parsed ahead of their turn.
+func (p *parser) parseHitToken(token string) (*Hit, alts, error) {
+	if halfParenthesized(token) {
+		return nil, nil, newError(CodeHalfParenthesis)
+	}
+	if parenthesized(token) {
+		token = token[1 : len(token)-1]
+	}
+	if err := p.checkNames(token); err != nil {
+		return nil, nil, err
+	}
+	return parseHitTo(p.hits.new(), token, p.aliases, p.drums)
+}
+
+// addHit adds the parsed hit of the given token to the track, after applying
+// the parser's remaps and velocity to it.
+func (p *parser) addHit(tok token, h *Hit, alts alts) error {
+	t := p.t
+	if err := p.checkNotes(h); err != nil {
+		return err
+	}
+	if len(p.remap) > 0 {
+		h.remap(p.remap)
+		alts = alts.remap(p.remap)
+	}
+
+	if parenthesized(tok.s) {
+		if err := p.addGrace(h); err != nil {
+			return err
+		}
+	}
+	if p.vel != nil {
+		if err := p.applyVelocity(h); err != nil {
+			return err
+		}
+	}
+
+	if p.opts.Spans {
+		h.Span = p.span(tok)
+	}
+	if err := p.grow(1); err != nil {
+		return err
+	}
+	t.Hits = append(t.Hits, h)
+	p.tick += h.T
+	if alts != nil {
+		p.alts[h] = alts
+	}
+	return nil
+}
+
+// addGrace takes the time of a grace note from the hit before it. Grace notes
+// that follow each other, like a drag "(S..) (S..) S", make a chain that takes
+// its time from the hit before the chain. Grace notes before the first hit
+// take their time from a count-in, a bar of silence that is added before them.
+func (p *parser) addGrace(h *Hit) error {
+	t := p.t
+	if p.graces.end != len(t.Hits) {
+		p.graces = graceChain{}
+	}
+	i := len(t.Hits) - 1 - p.graces.n
+	if i < 0 {
+		if err := p.addCountIn(); err != nil {
+			return err
+		}
+		i = 0
+	}
+	base := t.Hits[i]
+	if base.T <= h.T {
+		if p.graces.n > 0 {
+			return newError(CodeGraceChainTooLong, p.graces.n+1,
+				p.graces.t+h.T, p.graces.t+base.T)
+		}
+		return newError(CodeGraceTooLong, h.T, base.T)
+	}
+	base.T -= h.T
+	p.tick -= h.T
+	p.graces.n++
+	p.graces.t += h.T
+	p.graces.end = len(t.Hits) + 1
+	if base == p.countIn {
+		p.moveStart(base.T + h.T)
+	}
+	return nil
+}
+
+// addCountIn adds a bar of silence to the start of a track that has no hits,
+// for grace notes to take their time from.
+func (p *parser) addCountIn() error {
+	if err := p.grow(1); err != nil {
+		return err
+	}
+	p.countIn = &Hit{Notes: map[byte]Velocity{}, T: p.t.timeSig().barTicks()}
+	p.t.Hits = append(p.t.Hits, p.countIn)
+	p.tick += p.countIn.T
+	p.moveStart(0)
+	return nil
+}
+
+// moveStart moves what was at the start of the track, from the given tick to
+// the end of the count-in: meta events other than the track's name, control
+// events, and the groups and the section that started there.
+func (p *parser) moveStart(from uint) {
+	to := p.countIn.T
+	for _, m := range p.t.Meta {
+		if m.T == from && m.Type != MetaTrackName {
+			m.T = to
+		}
+	}
+	for _, c := range p.t.Controls {
+		if c.T == from {
+			c.T = to
+		}
+	}
+	for i := range p.groups {
+		if p.groups[i].start == 0 {
+			p.groups[i].start = 1
 		}
 	}
-	return t, nil
+	if sec := p.section; sec != nil && sec.start <= 1 {
+		sec.start, sec.startTick = 1, to
+	}
+}
+
+// A graceChain is a sequence of grace notes at the end of the track.
+type graceChain struct {
+	n   int  // Number of grace notes.
+	t   uint // Ticks that they take together.
+	end int  // Number of hits in the track after the last one.
+}
+
+// A parser holds the state of a single ParseTrack call.
+type parser struct {
+	t       *Track          // Track being built.
+	tick    uint            // Length of the track so far.
+	aliases map[string]byte // User defined note names.
+	drums   map[string]byte // Names of the drum map in use, nil for EZdrummer's.
+	names   int             // Number of changes to aliases and drums.
+	remap   map[byte]byte   // Note rewrites for the following hits.
+	groups  []group         // Open groups, innermost last.
+	vars    map[string]int  // User defined expression variables.
+	vel     expr            // Velocity of the following hits, nil for forte.
+
+	sections map[string]*section // Sections by name.
+	section  *section            // Current section, nil if none.
+
+	fills []fillRange // Ranges of fill directives.
+
+	alts    map[*Hit]alts // Alternatives of the hits that have them.
+	graces  graceChain    // Grace notes that the next one follows.
+	countIn *Hit          // Silence before leading grace notes, nil if none.
+	loop    loopPoints    // Loop points so far.
+	hits    *hitSlab      // Allocates parsed hits.
+
+	open   Opener   // Reads included files, nil if including is not allowed.
+	fetch  *fetcher // Reads included files ahead of time, nil for none.
+	files  []string // Files being parsed, innermost last.
+	limits Limits   // Bounds on the track's expansion.
+	tokens int      // Number of tokens parsed, for the limit.
+
+	opts ParseOptions // Optional checks.
+}
+
+// A group is a bracketed sequence of hits that an operator applies to.
+type group struct {
+	open  token // The opening bracket token.
+	start int   // Index of the group's first hit.
+}
+
+// closeGroup closes the innermost open group and applies the given operator
+// to its hits.
+func (p *parser) closeGroup(op string) error {
+	if len(p.groups) == 0 {
+		return newError(CodeUnopenedGroup)
+	}
+	f, ok := groupOps[op]
+	if !ok {
+		return newError(CodeUnknownGroupOp, op)
+	}
+	g := p.groups[len(p.groups)-1]
+	p.groups = p.groups[:len(p.groups)-1]
+	if f != nil {
+		f(p.t.Hits[g.start:])
+		p.graces = graceChain{}
+	}
+	return nil
+}
+
+// finish checks that the parsed source is complete. Returns an error with its
+// position if not.
+func (p *parser) finish() error {
+	if len(p.groups) > 0 {
+		return atToken(newError(CodeUnclosedGroup), p.groups[len(p.groups)-1].open)
+	}
+	if err := p.insertFills(); err != nil {
+		return err
+	}
+	return p.checkTicks()
+}
+
+// A token is a single whitespace-delimited word in the source text.
+type token struct {
+	s    string // Token text.
+	line int    // 1-based line number.
+	col  int    // 1-based column, in runes (not bytes).
+}
+
+// pos returns the token's position in line:column form.
+func (t token) pos() string {
+	return fmt.Sprintf("%v:%v", t.line, t.col)
 }
 
 // tokenize extracts tokens from a text and returns them in a slice.
-// Comments are removed.
-func tokenize(s string) []string {
-	s = comment.ReplaceAllString(s, "")
-	var result []string
-	for _, t := range tokenizer.Split(s, -1) {
-		if t == "" {
-			continue
+// Comments are removed. Any unicode white space separates tokens.
+func tokenize(s string) []token {
+	var result []token
+	sc := newScanner(s, 1)
+	for tok, ok := sc.next(); ok; tok, ok = sc.next() {
+		if tok.s[0] != '#' {
+			result = append(result, tok)
 		}
-		result = append(result, t)
 	}
 	return result
 }
 
-// parseHit parses a single hit token and returns the constructed hit.
-func parseHit(s string) (*Hit, error) {
-	m := hitToken.FindStringSubmatch(s)
-	if m == nil {
-		return nil, fmt.Errorf("bad hit: %q", s)
+// parseHit parses a single hit token and returns the constructed hit, and the
+// alternatives of its notes (nil if none). aliases are user defined note names,
+// and drums are the names of the drum map in use. Both may be nil.
+func parseHit(s string, aliases, drums map[string]byte) (*Hit, alts, error) {
+	return parseHitTo(&Hit{Notes: map[byte]Velocity{}}, s, aliases, drums)
+}
+
+// parseHitTo parses a single hit token like parseHit, into the given hit,
+// which should have no fields set other than an empty Notes.
+func parseHitTo(h *Hit, s string, aliases, drums map[string]byte) (*Hit, alts, error) {
+	m, ok := matchHit(s)
+	if !ok {
+		return nil, nil, newError(CodeBadHit, s)
 	}
 
-	notes, err := parseNotes(m[1])
+	alts, err := parseNotes(h, m.notes(s), aliases, drums)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	var annotations map[string]string
+	if a := m.annotations(s); a != "" {
+		annotations, err = parseAnnotations(a[1 : len(a)-1])
+		if err != nil {
+			return nil, nil, err
+		}
 	}
 
-	d := durations[m[2]]
+	d := parseDuration(m.duration(s))
 	if d == 0 {
-		return nil, fmt.Errorf("bad duration: %q", m[2])
+		return nil, nil, newError(CodeBadDuration, m.duration(s))
 	}
 
-	return &Hit{notes, d}, nil
+	h.T, h.Annotations = d, annotations
+	return h, alts, nil
 }
 
-// parseNotes parses the notes section of a hit token.
-func parseNotes(s string) (map[byte]Velocity, error) {
-	notes := map[byte]Velocity{}
+// parseNotes parses the notes section of a hit token into h. aliases are user
+// defined note names, and drums are the names of the drum map in use. Both may
+// be nil. Sets the hit's notes, their velocities, and their timing offsets and
+// chances (nil if none), and returns the alternatives of its notes (nil if
+// none). Notes with alternatives play the first one.
+func parseNotes(h *Hit, s string, aliases, drums map[string]byte) (alts, error) {
+	var result alts
 
-	for _, part := range strings.Split(s, ",") {
-		m := noteToken.FindStringSubmatch(part)
-		if m == nil {
-			return nil, fmt.Errorf("bad note token: %q", part)
+	for more := true; more; {
+		part := s
+		if i := strings.IndexByte(s, ','); i != -1 {
+			part, s = s[:i], s[i+1:]
+		} else {
+			more = false
+		}
+		m, ok := matchNote(part)
+		if !ok {
+			return nil, newError(CodeBadNote, part)
 		}
 
-		note, v := drumNotes[m[1]], velocities[m[2]]
-		if note == 0 {
-			return nil, fmt.Errorf("bad drum number: %q", m[1])
+		var note byte
+		if name := m.name(part); strings.HasPrefix(name, "alt(") {
+			var options []byte
+			for _, name := range altNames(name) {
+				n := noteByName(name, aliases, drums)
+				if n == 0 {
+					return nil, newError(CodeBadDrum, name)
+				}
+				options = append(options, n)
+			}
+			note = options[0]
+			if result == nil {
+				result = alts{}
+			}
+			result[note] = options
+		} else if note = noteByName(name, aliases, drums); note == 0 {
+			return nil, newError(CodeBadDrum, name)
 		}
+		v := parseVelocity(m.velocity(part))
 		if v == 0 {
-			return nil, fmt.Errorf("bad velocity: %q", m[2])
+			return nil, newError(CodeBadVelocity, m.velocity(part))
+		}
+		h.Notes[note] = v
+
+		if o := m.offset(part); o != "" {
+			off, err := strconv.Atoi(o)
+			if err != nil || off < -maxNoteOffset || off > maxNoteOffset {
+				return nil, newError(CodeBadOffset, o, maxNoteOffset)
+			}
+			if h.Offsets == nil {
+				h.Offsets = map[byte]int{}
+			}
+			h.Offsets[note] = off
+		}
+
+		if c := m.chance(part); c != "" {
+			chance, err := strconv.Atoi(c)
+			if err != nil || chance < 1 || chance > 100 {
+				return nil, newError(CodeBadChance, c)
+			}
+			if chance < 100 {
+				if h.Chances == nil {
+					h.Chances = map[byte]int{}
+				}
+				h.Chances[note] = chance
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// maxNoteOffset is the largest timing offset allowed in text, a quarter bar.
+const maxNoteOffset = 96
+
+// parseVelocity returns the velocity of a +- notation, or 0 if invalid. Each -
+// lowers the velocity from forte by one step, and each + raises it.
+func parseVelocity(s string) Velocity {
+	const step = F - MF
+	switch {
+	case s == "":
+		return F
+	case s[0] == '-' && len(s) <= 5 && strings.Count(s, "-") == len(s):
+		return F - step*Velocity(len(s))
+	case s[0] == '+' && len(s) <= 2 && strings.Count(s, "+") == len(s):
+		return F + step*Velocity(len(s))
+	}
+	return 0
+}
+
+// parseDuration returns the number of ticks of a duration notation, or 0 if
+// invalid. Each . halves a quarter bar and each ~ doubles it. A following >N
+// makes it an N-tuplet, played in the time of the largest power of 2 below N
+// (> alone means a triplet).
+func parseDuration(s string) uint {
+	tuplet := ""
+	if i := strings.IndexByte(s, '>'); i != -1 {
+		s, tuplet = s[:i], s[i:]
+	}
+
+	d := uint(96)
+	switch {
+	case s == "":
+	case s[0] == '.' && len(s) <= 5 && strings.Count(s, ".") == len(s):
+		d >>= uint(len(s))
+	case s[0] == '~' && len(s) <= 2 && strings.Count(s, "~") == len(s):
+		d <<= uint(len(s))
+	default:
+		return 0
+	}
+
+	if tuplet == "" {
+		return d
+	}
+	n := 3
+	if tuplet != ">" {
+		var err error
+		n, err = strconv.Atoi(tuplet[1:])
+		if err != nil || n < 3 || n > 32 {
+			return 0
 		}
-		notes[note] = v
 	}
+	p := 2
+	for p*2 < n {
+		p *= 2
+	}
+	return d * uint(p) / uint(n)
+}
 
-	return notes, nil
+// noteByName returns the note value of the given name, or 0 if not found. User
+// defined aliases take precedence over built-in names. drums are the names of
+// the drum map in use, nil for EZdrummer's.
+func noteByName(name string, aliases, drums map[string]byte) byte {
+	if note, ok := aliases[name]; ok {
+		return note
+	}
+	if drums != nil {
+		if note, ok := drums[name]; ok {
+			return note
+		}
+		if _, err := strconv.Atoi(name); err != nil {
+			return 0
+		}
+	}
+	return drumNotes[name]
+}
+
+// parseAnnotations parses the comma separated key=value pairs inside the
+// curly braces of a hit token.
+func parseAnnotations(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, newError(CodeEmptyAnnotations)
+	}
+	result := map[string]string{}
+	for _, part := range strings.Split(s, ",") {
+		m := annotationToken.FindStringSubmatch(part)
+		if m == nil {
+			return nil, newError(CodeBadAnnotation, part)
+		}
+		if _, ok := result[m[1]]; ok {
+			return nil, newError(CodeDuplicateAnnotation, m[1])
+		}
+		result[m[1]] = m[2]
+	}
+	return result, nil
 }
 
 // parenthesized returns true if s starts and ends with parenthesis.
@@ -187,38 +588,296 @@ func parenthesized(s string) bool {
 	return len(s) > 0 && s[0] == '(' && s[len(s)-1] == ')'
 }
 
-// halfParenthesized returns true if s only starts or only ends with parenthesis.
+// halfParenthesized returns true if s only starts or only ends with parenthesis,
+// not counting the parentheses of alternatives.
 func halfParenthesized(s string) bool {
 	return len(s) > 0 &&
 		((s[0] == '(' && s[len(s)-1] != ')') ||
-			(s[0] != '(' && s[len(s)-1] == ')'))
+			strings.Count(s, "(") != strings.Count(s, ")"))
 }
 
-// A directive is a function that alters the track itself.
-type directive func(*Track, string) error
+// A directive is a function that alters the track or the parser's state.
+type directive func(p *parser, value string, at DirectiveContext) error
 
 // parseDirective parses a directive token and runs it.
-func (t *Track) parseDirective(s string) error {
-	m := directiveToken.FindStringSubmatch(s)
-	if m == nil {
-		return fmt.Errorf("bad directive: %q", s)
+func (p *parser) parseDirective(tok token) error {
+	name, value, ok := splitDirective(tok.s)
+	if !ok {
+		return newError(CodeBadDirective, tok.s)
+	}
+	at := p.directiveContext(tok)
+	if f, ok := p.opts.Directives[name]; ok {
+		if f == nil {
+			return newError(CodeUnknownDirective, name)
+		}
+		return f(at, value)
 	}
-	d := directives[m[1]]
+	d := directives[name]
 	if d == nil {
-		return fmt.Errorf("unknown directive: %q", m[1])
+		return newError(CodeUnknownDirective, name)
 	}
-	return d(t, m[2])
+	return d(p, value, at)
 }
 
-// bpmDirective changes a track's bpm.
-func bpmDirective(t *Track, s string) error {
-	bpm, err := strconv.Atoi(s)
+// span returns the source span of a token.
+func (p *parser) span(tok token) *SourceSpan {
+	s := &SourceSpan{Line: tok.line, Col: tok.col,
+		EndCol: tok.col + utf8.RuneCountInString(tok.s)}
+	if len(p.files) > 0 {
+		s.File = p.files[len(p.files)-1]
+	}
+	return s
+}
+
+// directiveContext returns where the directive of the given token is, in the
+// source and in the track.
+func (p *parser) directiveContext(tok token) DirectiveContext {
+	at := DirectiveContext{Track: p.t, Line: tok.line, Col: tok.col,
+		Tick: p.tick}
+	if len(p.files) > 0 {
+		at.File = p.files[len(p.files)-1]
+	}
+	bar, _ := p.exprVar("bar")
+	beat, _ := p.exprVar("beat")
+	at.Bar, at.Beat = bar, beat
+	return at
+}
+
+// velDirective sets the velocity of the following hits, which the notes' + and
+// - marks raise and lower. Takes a number or an expression, as in "vel:100"
+// or "vel:base-10", which is evaluated once. An expression that starts with =,
+// as in "vel:=base+bar*2", is evaluated again for every hit. Empty resets the
+// velocity to forte.
+func velDirective(p *parser, s string, at DirectiveContext) error {
+	if s == "" {
+		p.vel = nil
+		return nil
+	}
+	if s[0] == '=' {
+		e, err := compileExpr(s[1:])
+		if err != nil {
+			return err
+		}
+		p.vel = e
+		return nil
+	}
+	v, err := evalExpr(s, p.exprVar)
+	if err != nil {
+		return err
+	}
+	if v < 1 || v > 127 {
+		return newError(CodeVelocityRange, v)
+	}
+	p.vel = func(func(string) (int, bool)) (int, error) {
+		return v, nil
+	}
+	return nil
+}
+
+// applyVelocity sets the velocities of a new hit, before it is added to the
+// track, according to the parser's
+// velocity expression, keeping the differences that the notes' marks make.
+func (p *parser) applyVelocity(h *Hit) error {
+	base, err := p.vel(p.exprVar)
+	if err != nil {
+		return err
+	}
+	if base < 1 || base > 127 {
+		return newError(CodeVelocityRange, base)
+	}
+	for n, v := range h.Notes {
+		x := base + int(v) - F
+		if x < 1 {
+			x = 1
+		}
+		if x > 127 {
+			x = 127
+		}
+		h.Notes[n] = Velocity(x)
+	}
+	return nil
+}
+
+// setDirective defines a variable for expressions, as in "set:base=100". The
+// value is evaluated once.
+func setDirective(p *parser, s string, at DirectiveContext) error {
+	m := setToken.FindStringSubmatch(s)
+	if m == nil || positionVars[m[1]] {
+		return newError(CodeBadSet, s)
+	}
+	v, err := evalExpr(m[2], p.exprVar)
 	if err != nil {
-		return fmt.Errorf("bad input to BPM: %v", err)
+		return err
+	}
+	p.vars[m[1]] = v
+	return nil
+}
+
+// exprVar returns the value of an expression variable: a user defined one, or
+// the 1-based bar, beat or hit number or the tick of the next hit.
+func (p *parser) exprVar(name string) (int, bool) {
+	if v, ok := p.vars[name]; ok {
+		return v, true
+	}
+	tick := p.tick
+	ts := p.t.timeSig()
+	switch name {
+	case "bar":
+		return int(tick/ts.barTicks()) + 1, true
+	case "beat":
+		return int(tick%ts.barTicks()/(96*4/ts.Denom)) + 1, true
+	case "tick":
+		return int(tick), true
+	case "hit":
+		return len(p.t.Hits) + 1, true
+	}
+	return 0, false
+}
+
+// bpmDirective sets the track's tempo from the current tick on. Takes a number
+// or an expression, as in "bpm:$tempo*2".
+func bpmDirective(p *parser, s string, at DirectiveContext) error {
+	bpm, err := strconv.Atoi(s)
+	if err != nil && strings.ContainsAny(s, "$+-*/%()") {
+		bpm, err = evalExpr(s, p.exprVar)
+		if err != nil {
+			return err
+		}
+	} else if err != nil {
+		return newError(CodeBadBPM, s)
+	}
+	if err := p.opts.checkBPM(bpm); err != nil {
+		return err
+	}
+	p.t.setTempo(p.tick, uint(bpm))
+	return nil
+}
+
+// timeDirective changes a track's time signature, as in "time:7/8".
+func timeDirective(p *parser, s string, at DirectiveContext) error {
+	m := timeSigToken.FindStringSubmatch(s)
+	if m == nil {
+		return newError(CodeBadTimeSig, s)
+	}
+	num, _ := strconv.ParseUint(m[1], 10, 16)
+	denom, _ := strconv.ParseUint(m[2], 10, 16)
+	ts := TimeSig{uint(num), uint(denom)}
+	if !ts.valid() {
+		return newError(CodeBadTimeSig, s)
+	}
+	p.t.TimeSig = ts
+	return nil
+}
+
+// markerDirective adds a marker meta event at the current tick.
+func markerDirective(p *parser, s string, at DirectiveContext) error {
+	return p.addTextMeta(MetaMarker, CodeEmptyMarker, s)
+}
+
+// cueDirective adds a cue point meta event at the current tick.
+func cueDirective(p *parser, s string, at DirectiveContext) error {
+	return p.addTextMeta(MetaCue, CodeEmptyCue, s)
+}
+
+// titleDirective names the track, as in "title:Highway". The name is placed
+// at the start of the track, where a previous title is replaced.
+func titleDirective(p *parser, s string, at DirectiveContext) error {
+	if s == "" {
+		return newError(CodeEmptyTitle)
+	}
+	meta := p.t.Meta[:0]
+	for _, m := range p.t.Meta {
+		if m.Type != MetaTrackName {
+			meta = append(meta, m)
+		}
+	}
+	p.t.Meta = append(meta, &Meta{0, MetaTrackName, []byte(s)})
+	return nil
+}
+
+// addTextMeta adds a textual meta event at the current tick. empty is the
+// error code for when s is empty.
+func (p *parser) addTextMeta(typ byte, empty Code, s string) error {
+	if s == "" {
+		return newError(empty)
+	}
+	p.t.Meta = append(p.t.Meta, &Meta{p.tick, typ, []byte(s)})
+	return nil
+}
+
+// aliasDirective defines a new note name, as in "alias:Бочка=K". The name may
+// contain any unicode letters and digits, and the value is an existing note
+// name or number.
+func aliasDirective(p *parser, s string, at DirectiveContext) error {
+	m := aliasToken.FindStringSubmatch(s)
+	if m == nil {
+		return newError(CodeBadAlias, s)
+	}
+	if _, err := strconv.Atoi(m[1]); err == nil {
+		return newError(CodeNumericAlias, m[1])
+	}
+	note := noteByName(m[2], p.aliases, p.drums)
+	if note == 0 {
+		return newError(CodeBadDrum, m[2])
+	}
+	p.aliases[m[1]] = note
+	p.names++
+	return nil
+}
+
+// mapDirective selects the drum map whose names the following hits use, as in
+// "map:sd3". The maps are those of Kits, and "map:ezdrummer" goes back to the
+// default names. Aliases and drum numbers are not affected.
+func mapDirective(p *parser, s string, at DirectiveContext) error {
+	kit, ok := Kits[s]
+	if !ok {
+		return newError(CodeUnknownMap, s, strings.Join(kitNames(), ", "))
+	}
+	p.drums = kit.Notes
+	if s == "ezdrummer" {
+		p.drums = nil
+	}
+	p.names++
+	return nil
+}
+
+// kitNames returns the names of the built-in drum machines, sorted.
+func kitNames() []string {
+	var result []string
+	for name := range Kits {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// remapDirective rewrites the notes of the following hits. Takes either the
+// name of a built-in remapping, as in "remap:gm", or comma separated pairs of
+// notes, as in "remap:HC=42,T1=50".
+func remapDirective(p *parser, s string, at DirectiveContext) error {
+	if m, ok := remaps[s]; ok {
+		for from, to := range m {
+			p.remap[from] = to
+		}
+		return nil
+	}
+	m := map[byte]byte{}
+	for _, part := range strings.Split(s, ",") {
+		pm := remapToken.FindStringSubmatch(part)
+		if pm == nil {
+			return newError(CodeBadRemap, part)
+		}
+		from, to := noteByName(pm[1], p.aliases, p.drums), noteByName(pm[2], p.aliases, p.drums)
+		if from == 0 {
+			return newError(CodeBadDrum, pm[1])
+		}
+		if to == 0 {
+			return newError(CodeBadDrum, pm[2])
+		}
+		m[from] = to
 	}
-	if bpm < 1 || bpm > 500 {
-		return fmt.Errorf("bad BPM: %v, must be between 1 and 500", bpm)
+	for from, to := range m {
+		p.remap[from] = to
 	}
-	t.BPM = uint(bpm)
 	return nil
 }
@@ -1,7 +1,10 @@
 package beatnik
 
 import (
+	"fmt"
 	"reflect"
+	"sort"
+	"strings"
 	"testing"
 )
 
@@ -10,18 +13,22 @@ func TestParseHit(t *testing.T) {
 		in   string
 		want *Hit
 	}{
-		{"42~~", &Hit{map[byte]Velocity{42: F}, 96 * 4}},
-		{"38-..", &Hit{map[byte]Velocity{38: MF}, 96 / 4}},
-		{"36+,49,57+", &Hit{map[byte]Velocity{49: F, 57: FF, 36: FF}, 96}},
-		{"36----,49---,57++..", &Hit{map[byte]Velocity{49: P, 57: FFF, 36: PP}, 24}},
-		{"HC~~", &Hit{map[byte]Velocity{22: F}, 96 * 4}},
-		{"S-..", &Hit{map[byte]Velocity{38: MF}, 96 / 4}},
-		{"K+,C2,C3+", &Hit{map[byte]Velocity{49: F, 57: FF, 36: FF}, 96}},
-		{"K----,C2---,C3++..", &Hit{map[byte]Velocity{49: P, 57: FFF, 36: PP}, 24}},
+		{"42~~", &Hit{Notes: map[byte]Velocity{42: F}, T: 96 * 4}},
+		{"38-..", &Hit{Notes: map[byte]Velocity{38: MF}, T: 96 / 4}},
+		{"36+,49,57+", &Hit{Notes: map[byte]Velocity{49: F, 57: FF, 36: FF}, T: 96}},
+		{"36----,49---,57++..", &Hit{Notes: map[byte]Velocity{49: P, 57: FFF, 36: PP}, T: 24}},
+		{"HC~~", &Hit{Notes: map[byte]Velocity{22: F}, T: 96 * 4}},
+		{"S-..", &Hit{Notes: map[byte]Velocity{38: MF}, T: 96 / 4}},
+		{"K+,C2,C3+", &Hit{Notes: map[byte]Velocity{49: F, 57: FF, 36: FF}, T: 96}},
+		{"K----,C2---,C3++..", &Hit{Notes: map[byte]Velocity{49: P, 57: FFF, 36: PP}, T: 24}},
+		{"S.rim", &Hit{Notes: map[byte]Velocity{40: F}, T: 96}},
+		{"S.rim+,C1.choke.", &Hit{Notes: map[byte]Velocity{40: FF, 56: F}, T: 48}},
+		{"R.bell-@2..", &Hit{Notes: map[byte]Velocity{53: MF}, T: 24,
+			Offsets: map[byte]int{53: 2}}},
 	}
 
 	for i, test := range tests {
-		got, err := parseHit(test.in)
+		got, _, err := parseHit(test.in, nil, nil)
 		if err != nil {
 			t.Errorf("#%v/%v parseHit(%v), want success: %v",
 				i+1, len(tests), test.in, err)
@@ -39,18 +46,18 @@ func TestParseHit_triplets(t *testing.T) {
 		in   string
 		want *Hit
 	}{
-		{"42~~>", &Hit{map[byte]Velocity{42: F}, 96 * 8 / 3}},
-		{"38-..>", &Hit{map[byte]Velocity{38: MF}, 96 / 2 / 3}},
-		{"36+,49,57+>", &Hit{map[byte]Velocity{49: F, 57: FF, 36: FF}, 96 * 2 / 3}},
-		{"36----,49---,57++..>", &Hit{map[byte]Velocity{49: P, 57: FFF, 36: PP}, 24 * 2 / 3}},
-		{"HC~~>", &Hit{map[byte]Velocity{22: F}, 96 * 8 / 3}},
-		{"S-..>", &Hit{map[byte]Velocity{38: MF}, 96 / 2 / 3}},
-		{"K+,C2,C3+>", &Hit{map[byte]Velocity{49: F, 57: FF, 36: FF}, 96 * 2 / 3}},
-		{"K----,C2---,C3++..>", &Hit{map[byte]Velocity{49: P, 57: FFF, 36: PP}, 24 * 2 / 3}},
+		{"42~~>", &Hit{Notes: map[byte]Velocity{42: F}, T: 96 * 8 / 3}},
+		{"38-..>", &Hit{Notes: map[byte]Velocity{38: MF}, T: 96 / 2 / 3}},
+		{"36+,49,57+>", &Hit{Notes: map[byte]Velocity{49: F, 57: FF, 36: FF}, T: 96 * 2 / 3}},
+		{"36----,49---,57++..>", &Hit{Notes: map[byte]Velocity{49: P, 57: FFF, 36: PP}, T: 24 * 2 / 3}},
+		{"HC~~>", &Hit{Notes: map[byte]Velocity{22: F}, T: 96 * 8 / 3}},
+		{"S-..>", &Hit{Notes: map[byte]Velocity{38: MF}, T: 96 / 2 / 3}},
+		{"K+,C2,C3+>", &Hit{Notes: map[byte]Velocity{49: F, 57: FF, 36: FF}, T: 96 * 2 / 3}},
+		{"K----,C2---,C3++..>", &Hit{Notes: map[byte]Velocity{49: P, 57: FFF, 36: PP}, T: 24 * 2 / 3}},
 	}
 
 	for i, test := range tests {
-		got, err := parseHit(test.in)
+		got, _, err := parseHit(test.in, nil, nil)
 		if err != nil {
 			t.Errorf("#%v/%v parseHit(%v), want success: %v",
 				i+1, len(tests), test.in, err)
@@ -77,10 +84,12 @@ func TestParseHit_badInput(t *testing.T) {
 		"42.+",
 		"0",
 		".",
+		"S.rum",
+		"S..rim",
 	}
 
 	for i, test := range tests {
-		if got, err := parseHit(test); err == nil {
+		if got, _, err := parseHit(test, nil, nil); err == nil {
 			t.Errorf("#%v/%v parseHit(%v)=%v, want failure",
 				i+1, len(tests), test, got)
 		}
@@ -91,11 +100,12 @@ func TestParseTrack_graceNotes(t *testing.T) {
 	in := "bpm:111 (36) 42 38. (44,43-..) 46"
 	want := &Track{
 		Hits: []*Hit{
-			&Hit{map[byte]Velocity{36: F}, 96},
-			&Hit{map[byte]Velocity{42: F}, 96},
-			&Hit{map[byte]Velocity{38: F}, 24},
-			&Hit{map[byte]Velocity{44: F, 43: MF}, 24},
-			&Hit{map[byte]Velocity{46: F}, 96},
+			&Hit{Notes: map[byte]Velocity{}, T: 288},
+			&Hit{Notes: map[byte]Velocity{36: F}, T: 96},
+			&Hit{Notes: map[byte]Velocity{42: F}, T: 96},
+			&Hit{Notes: map[byte]Velocity{38: F}, T: 24},
+			&Hit{Notes: map[byte]Velocity{44: F, 43: MF}, T: 24},
+			&Hit{Notes: map[byte]Velocity{46: F}, T: 96},
 		},
 		BPM: 111,
 	}
@@ -108,6 +118,102 @@ func TestParseTrack_graceNotes(t *testing.T) {
 	}
 }
 
+func TestParseTrack_graceChains(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []uint
+	}{
+		{"K (S..) (S..) S", []uint{48, 24, 24, 96}},
+		{"K (S...) (S...) (S...) S", []uint{60, 12, 12, 12, 96}},
+		{"K (S..) S (S..) (S..) S", []uint{72, 24, 48, 24, 24, 96}},
+		{"K (S..) ~ (S..) S", []uint{72, 192, 24, 96}},
+		{"K [ (S..) ]rev (S...) S", []uint{72, 12, 12, 96}},
+	}
+	for _, test := range tests {
+		tr, err := ParseTrack(test.in)
+		if err != nil {
+			t.Fatalf("ParseTrack(%q) failed: %v", test.in, err)
+		}
+		var got []uint
+		for _, h := range tr.Hits {
+			got = append(got, h.T)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseTrack(%q) durations=%v, want %v", test.in, got,
+				test.want)
+		}
+	}
+}
+
+func TestParseTrack_leadingGraces(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []uint
+	}{
+		{"(S..) K S", []uint{360, 24, 96, 96}},
+		{"(S..) (S..) K", []uint{336, 24, 24, 96}},
+		{"time:3/4 (S..) K", []uint{264, 24, 96}},
+		{"[ (S..) K ]rev", []uint{360, 96, 24}},
+		{"section:a (S...) K play:a", []uint{372, 12, 96, 12, 96}},
+	}
+	for _, test := range tests {
+		tr, err := ParseTrack(test.in)
+		if err != nil {
+			t.Fatalf("ParseTrack(%q) failed: %v", test.in, err)
+		}
+		var got []uint
+		for _, h := range tr.Hits {
+			got = append(got, h.T)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseTrack(%q) durations=%v, want %v", test.in, got,
+				test.want)
+		}
+		if len(tr.Hits[0].Notes) != 0 {
+			t.Errorf("ParseTrack(%q) count-in=%v, want silence", test.in,
+				tr.Hits[0])
+		}
+	}
+
+	_, err := ParseTrack("(S) (S) (S) (S) K")
+	if e, ok := err.(*Error); !ok || e.Code != CodeGraceChainTooLong {
+		t.Errorf("ParseTrack()=%v, want %v", err, CodeGraceChainTooLong)
+	}
+}
+
+func TestParseTrack_leadingGraceEvents(t *testing.T) {
+	tr := mustParse(t, "title:x cc:7=100 section:a (S..) (S..) K "+
+		"marker:b S play:a")
+	var got []string
+	for _, m := range tr.sortedMeta() {
+		got = append(got, fmt.Sprintf("%v:%s", m.T, m.Data))
+	}
+	want := []string{"0:x", "336:a", "480:b", "576:a", "720:b"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("meta=%v, want %v", got, want)
+	}
+	var ticks []uint
+	for _, c := range tr.Controls {
+		ticks = append(ticks, c.T)
+	}
+	if want := []uint{336, 576}; !reflect.DeepEqual(ticks, want) {
+		t.Errorf("control ticks=%v, want %v", ticks, want)
+	}
+}
+
+func TestParseTrack_badGraceChain(t *testing.T) {
+	_, err := ParseTrack("K. (S..) (S..) S")
+	e, ok := err.(*Error)
+	if !ok || e.Code != CodeGraceChainTooLong || e.Col != 10 {
+		t.Fatalf("ParseTrack()=%v, want %v at column 10", err,
+			CodeGraceChainTooLong)
+	}
+	want := "1:10: 2 grace notes are too long: 48 ticks together, should be less than 48"
+	if e.Error() != want {
+		t.Errorf("Error()=%q, want %q", e.Error(), want)
+	}
+}
+
 func TestParseTrack_badGraceNote(t *testing.T) {
 	in := "bpm:111 (36) 42 38. (44,43-.) 46"
 	got, err := ParseTrack(in)
@@ -119,14 +225,14 @@ func TestParseTrack_badGraceNote(t *testing.T) {
 func TestParseTrack(t *testing.T) {
 	want := &Track{
 		Hits: []*Hit{
-			&Hit{map[byte]Velocity{42: F}, 96 * 4},
-			&Hit{map[byte]Velocity{49: FF, 57: FF, 36: FF}, 96},
-			&Hit{map[byte]Velocity{49: PP, 57: PP, 36: PP}, 24},
-			&Hit{map[byte]Velocity{46: F, 36: F}, 96 + 48 + 24},
-			&Hit{map[byte]Velocity{38: F, 42: F}, 96},
-			&Hit{map[byte]Velocity{36: F, 38: F, 22: F}, 96},
-			&Hit{map[byte]Velocity{36: F, 58: F}, 96 / 2},
-			&Hit{map[byte]Velocity{40: MF}, 96 * 2},
+			&Hit{Notes: map[byte]Velocity{42: F}, T: 96 * 4},
+			&Hit{Notes: map[byte]Velocity{49: FF, 57: FF, 36: FF}, T: 96},
+			&Hit{Notes: map[byte]Velocity{49: PP, 57: PP, 36: PP}, T: 24},
+			&Hit{Notes: map[byte]Velocity{46: F, 36: F}, T: 96 + 48 + 24},
+			&Hit{Notes: map[byte]Velocity{38: F, 42: F}, T: 96},
+			&Hit{Notes: map[byte]Velocity{36: F, 38: F, 22: F}, T: 96},
+			&Hit{Notes: map[byte]Velocity{36: F, 58: F}, T: 96 / 2},
+			&Hit{Notes: map[byte]Velocity{40: MF}, T: 96 * 2},
 		},
 		BPM: 123,
 	}
@@ -177,3 +283,461 @@ func TestHalfParenthesized(t *testing.T) {
 		}
 	}
 }
+
+func TestParseTrack_markers(t *testing.T) {
+	in := "bpm:100 marker:Intro 36 42. cue:Drop 38~ marker:Out"
+	want := []*Meta{
+		{0, MetaMarker, []byte("Intro")},
+		{96 + 48, MetaCue, []byte("Drop")},
+		{96 + 48 + 192, MetaMarker, []byte("Out")},
+	}
+	got, err := ParseTrack(in)
+	if err != nil {
+		t.Fatalf("ParseTrack(%v) should succeed, but failed: %v", in, err)
+	}
+	if !reflect.DeepEqual(got.Meta, want) {
+		t.Fatalf("ParseTrack(%v).Meta=%v, want %v", in, got.Meta, want)
+	}
+}
+
+func TestParseTrack_emptyMarker(t *testing.T) {
+	for _, in := range []string{"36 marker:", "36 cue:"} {
+		if got, err := ParseTrack(in); err == nil {
+			t.Errorf("ParseTrack(%v)=%v, want failure", in, got)
+		}
+	}
+}
+
+func TestParseHit_annotations(t *testing.T) {
+	tests := []struct {
+		in   string
+		want *Hit
+	}{
+		{"S{stick=rim}", &Hit{Notes: map[byte]Velocity{38: F}, T: 96,
+			Annotations: map[string]string{"stick": "rim"}}},
+		{"K,S+{a=1,b_2=}..", &Hit{Notes: map[byte]Velocity{36: F, 38: FF}, T: 24,
+			Annotations: map[string]string{"a": "1", "b_2": ""}}},
+	}
+
+	for i, test := range tests {
+		got, _, err := parseHit(test.in, nil, nil)
+		if err != nil {
+			t.Errorf("#%v/%v parseHit(%v), want success: %v",
+				i+1, len(tests), test.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("#%v/%v parseHit(%v)=%v, want %v",
+				i+1, len(tests), test.in, got, test.want)
+		}
+	}
+}
+
+func TestParseHit_badAnnotations(t *testing.T) {
+	tests := []string{"S{}", "S{a}", "S{a=1,a=2}", "S{a=b=c}", "S{a=1", "S{a=1}}"}
+	for i, test := range tests {
+		if got, _, err := parseHit(test, nil, nil); err == nil {
+			t.Errorf("#%v/%v parseHit(%v)=%v, want failure",
+				i+1, len(tests), test, got)
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	in := "bpm:90 # Comment.\n\tК,S.　キック  38\n"
+	want := []token{
+		{"bpm:90", 1, 1},
+		{"К,S.", 2, 2},
+		{"キック", 2, 7},
+		{"38", 2, 12},
+	}
+	got := tokenize(in)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("tokenize(%q)=%v, want %v", in, got, want)
+	}
+}
+
+func TestParseTrack_aliases(t *testing.T) {
+	in := "alias:Бочка=K alias:キック=Бочка alias:Малый=38 Бочка,Малый+ キック."
+	want := []*Hit{
+		{Notes: map[byte]Velocity{36: F, 38: FF}, T: 96},
+		{Notes: map[byte]Velocity{36: F}, T: 48},
+	}
+	got, err := ParseTrack(in)
+	if err != nil {
+		t.Fatalf("ParseTrack(%v) should succeed, but failed: %v", in, err)
+	}
+	if !reflect.DeepEqual(got.Hits, want) {
+		t.Fatalf("ParseTrack(%v).Hits=%v, want %v", in, got.Hits, want)
+	}
+}
+
+func TestParseTrack_badAliases(t *testing.T) {
+	tests := []string{"alias:12=K", "alias:A=Z9", "alias:A", "alias:=K", "alias:A=K,S"}
+	for i, test := range tests {
+		if got, err := ParseTrack(test); err == nil {
+			t.Errorf("#%v/%v ParseTrack(%v)=%v, want failure",
+				i+1, len(tests), test, got)
+		}
+	}
+}
+
+func TestParseTrack_errorPosition(t *testing.T) {
+	in := "K S\nキック K Ж"
+	_, err := ParseTrack(in)
+	if err == nil {
+		t.Fatalf("ParseTrack(%q) succeeded, want failure", in)
+	}
+	want := "2:1: bad drum number: \"キック\""
+	if err.Error() != want {
+		t.Fatalf("ParseTrack(%q) error=%q, want %q", in, err.Error(), want)
+	}
+}
+
+func TestParseTrack_remap(t *testing.T) {
+	in := "HC,T1 remap:gm HC,T1 remap:S=SR,37=K S,SS"
+	want := []*Hit{
+		{Notes: map[byte]Velocity{22: F, 48: F}, T: 96},
+		{Notes: map[byte]Velocity{42: F, 50: F}, T: 96},
+		{Notes: map[byte]Velocity{40: F, 36: F}, T: 96},
+	}
+	got, err := ParseTrack(in)
+	if err != nil {
+		t.Fatalf("ParseTrack(%v) should succeed, but failed: %v", in, err)
+	}
+	if !reflect.DeepEqual(got.Hits, want) {
+		t.Fatalf("ParseTrack(%v).Hits=%v, want %v", in, got.Hits, want)
+	}
+}
+
+func TestParseTrack_badRemap(t *testing.T) {
+	tests := []string{"remap:", "remap:xx", "remap:S=", "remap:S=Q9", "remap:Q9=S"}
+	for i, test := range tests {
+		if got, err := ParseTrack(test); err == nil {
+			t.Errorf("#%v/%v ParseTrack(%v)=%v, want failure",
+				i+1, len(tests), test, got)
+		}
+	}
+}
+
+func TestParseTrack_groups(t *testing.T) {
+	in := "K [ S. [ HC.. T1 ] T2 ]rev ."
+	want := []*Hit{
+		{Notes: map[byte]Velocity{36: F}, T: 96},
+		{Notes: map[byte]Velocity{47: F}, T: 96},
+		{Notes: map[byte]Velocity{48: F}, T: 96},
+		{Notes: map[byte]Velocity{22: F}, T: 24},
+		{Notes: map[byte]Velocity{38: F}, T: 48 + 48},
+	}
+	got, err := ParseTrack(in)
+	if err != nil {
+		t.Fatalf("ParseTrack(%v) should succeed, but failed: %v", in, err)
+	}
+	if !reflect.DeepEqual(got.Hits, want) {
+		t.Fatalf("ParseTrack(%v).Hits=%v, want %v", in, got.Hits, want)
+	}
+}
+
+func TestParseTrack_badGroups(t *testing.T) {
+	tests := []string{"K [ S", "K ] S", "[ K ]foo", "[ [ K ]", "[K ]"}
+	for i, test := range tests {
+		if got, err := ParseTrack(test); err == nil {
+			t.Errorf("#%v/%v ParseTrack(%v)=%v, want failure",
+				i+1, len(tests), test, got)
+		}
+	}
+}
+
+func BenchmarkParseTrack(b *testing.B) {
+	src := strings.Repeat("HC,K+. HC--.. HC.. HC,S.> HC~ (S--...) K.... ~ .\n", 1000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseTrack(src); err != nil {
+			b.Fatalf("ParseTrack() failed: %v", err)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in   string
+		want uint
+	}{
+		{"", 96}, {".", 48}, {"..", 24}, {"...", 12}, {"....", 6}, {".....", 3},
+		{"~", 192}, {"~~", 384},
+		{">", 64}, {">3", 64}, {"..>", 16}, {"~~>", 256}, {".....>", 2},
+		{">5", 76}, {">6", 64}, {"~~>7", 219}, {">9", 85}, {"~>32", 96},
+		{"......", 0}, {"~~~", 0}, {".~", 0}, {">2", 0}, {">33", 0}, {">x", 0},
+		{"x", 0},
+	}
+	for _, test := range tests {
+		if got := parseDuration(test.in); got != test.want {
+			t.Errorf("parseDuration(%q)=%v, want %v", test.in, got, test.want)
+		}
+	}
+}
+
+func TestParseVelocity(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Velocity
+	}{
+		{"-----", PPP}, {"----", PP}, {"---", P}, {"--", MP}, {"-", MF},
+		{"", F}, {"+", FF}, {"++", FFF},
+		{"------", 0}, {"+++", 0}, {"+-", 0}, {"x", 0},
+	}
+	for _, test := range tests {
+		if got := parseVelocity(test.in); got != test.want {
+			t.Errorf("parseVelocity(%q)=%v, want %v", test.in, got, test.want)
+		}
+	}
+}
+
+func TestParseHit_tuplets(t *testing.T) {
+	tests := []struct {
+		in   string
+		want *Hit
+	}{
+		{"42>5", &Hit{Notes: map[byte]Velocity{42: F}, T: 96 * 4 / 5}},
+		{"K,S..>7", &Hit{Notes: map[byte]Velocity{36: F, 38: F}, T: 24 * 4 / 7}},
+	}
+	for i, test := range tests {
+		got, _, err := parseHit(test.in, nil, nil)
+		if err != nil {
+			t.Errorf("#%v/%v parseHit(%v), want success: %v",
+				i+1, len(tests), test.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("#%v/%v parseHit(%v)=%v, want %v",
+				i+1, len(tests), test.in, got, test.want)
+		}
+	}
+}
+
+func BenchmarkParseDuration(b *testing.B) {
+	tokens := []string{"", "...", "~~", "..>", ".>5"}
+	for i := 0; i < b.N; i++ {
+		parseDuration(tokens[i%len(tokens)])
+	}
+}
+
+func BenchmarkParseVelocity(b *testing.B) {
+	tokens := []string{"", "---", "++", "-----", "+"}
+	for i := 0; i < b.N; i++ {
+		parseVelocity(tokens[i%len(tokens)])
+	}
+}
+
+func TestParseHit_offsets(t *testing.T) {
+	in := "K,HC-@-3,S+@+5.."
+	want := &Hit{Notes: map[byte]Velocity{36: F, 22: MF, 38: FF}, T: 24,
+		Offsets: map[byte]int{22: -3, 38: 5}}
+	got, _, err := parseHit(in, nil, nil)
+	if err != nil {
+		t.Fatalf("parseHit(%v) failed: %v", in, err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("parseHit(%v)=%v, want %v", in, got, want)
+	}
+
+	for _, in := range []string{"K@", "K@97", "K@-97", "K@3-", "K@+-3"} {
+		if got, _, err := parseHit(in, nil, nil); err == nil {
+			t.Errorf("parseHit(%v)=%v, want failure", in, got)
+		}
+	}
+}
+
+func TestParseTrack_velocity(t *testing.T) {
+	in := "set:base=100 vel:=base+bar*2 K~~ S+~~ vel: K- vel:max(90,bar) S"
+	want := []*Hit{
+		{Notes: map[byte]Velocity{36: 102}, T: 384},
+		{Notes: map[byte]Velocity{38: 110}, T: 384},
+		{Notes: map[byte]Velocity{36: MF}, T: 96},
+		{Notes: map[byte]Velocity{38: 90}, T: 96},
+	}
+	got, err := ParseTrack(in)
+	if err != nil {
+		t.Fatalf("ParseTrack(%v) should succeed, but failed: %v", in, err)
+	}
+	if !reflect.DeepEqual(got.Hits, want) {
+		t.Fatalf("ParseTrack(%v).Hits=%v, want %v", in, got.Hits, want)
+	}
+}
+
+func TestParseTrack_badVelocity(t *testing.T) {
+	tests := []string{"vel:0", "vel:200", "vel:=x K", "vel:=bar*200 K",
+		"vel:1+", "set:bar=1", "set:x", "set:x=1/0"}
+	for i, test := range tests {
+		if got, err := ParseTrack(test); err == nil {
+			t.Errorf("#%v/%v ParseTrack(%v)=%v, want failure",
+				i+1, len(tests), test, got)
+		}
+	}
+}
+
+func TestParseTrack_sections(t *testing.T) {
+	in := "section:a K cue:x S section:b HC. section: T1 play:a*2,b"
+	got, err := ParseTrack(in)
+	if err != nil {
+		t.Fatalf("ParseTrack(%v) should succeed, but failed: %v", in, err)
+	}
+	k := &Hit{Notes: map[byte]Velocity{36: F}, T: 96}
+	s := &Hit{Notes: map[byte]Velocity{38: F}, T: 96}
+	hc := &Hit{Notes: map[byte]Velocity{22: F}, T: 48}
+	t1 := &Hit{Notes: map[byte]Velocity{48: F}, T: 96}
+	want := []*Hit{k, s, hc, t1, k, s, k, s, hc}
+	if !reflect.DeepEqual(got.Hits, want) {
+		t.Errorf("ParseTrack(%v).Hits=%v, want %v", in, got.Hits, want)
+	}
+	wantMeta := []*Meta{
+		{0, MetaMarker, []byte("a")},
+		{96, MetaCue, []byte("x")},
+		{192, MetaMarker, []byte("b")},
+		{336, MetaMarker, []byte("a")},
+		{432, MetaCue, []byte("x")},
+		{528, MetaMarker, []byte("a")},
+		{624, MetaCue, []byte("x")},
+		{720, MetaMarker, []byte("b")},
+	}
+	if !reflect.DeepEqual(got.Meta, wantMeta) {
+		t.Errorf("ParseTrack(%v).Meta=%v, want %v", in, got.Meta, wantMeta)
+	}
+}
+
+func TestParser_tick(t *testing.T) {
+	srcs := []string{
+		testTrack,
+		"K (S..) (S..) S . ~ K..",
+		"(S..) (S...) K marker:a S",
+		"section:a (S..) K S . section:b K (S..) [ HC. S.. K ]rev play:a*2,b K",
+		"K section:a (S..) S play:a*3 cc:4=64 cc:4=0..127,1 K vel:=tick%127+1 S",
+	}
+	for _, src := range srcs {
+		p := newParser()
+		for _, tok := range tokenize(src) {
+			if err := p.parseToken(tok); err != nil {
+				t.Fatalf("parseToken(%q) in %q failed: %v", tok.s, src, err)
+			}
+			if got, want := p.tick, p.t.ticks(); got != want {
+				t.Fatalf("tick=%v after %q in %q, want %v", got, tok.s, src, want)
+			}
+		}
+	}
+}
+
+func BenchmarkParseTrack_directives(b *testing.B) {
+	src := strings.Repeat("cc:4=64 K ", 20000)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseTrack(src); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestParseTrack_badSections(t *testing.T) {
+	tests := []string{"section:a section:a", "section:a*2", "play:a",
+		"section:a K play:a*0", "section:a K play:a,", "section:a K play:b"}
+	for i, test := range tests {
+		if got, err := ParseTrack(test); err == nil {
+			t.Errorf("#%v/%v ParseTrack(%v)=%v, want failure",
+				i+1, len(tests), test, got)
+		}
+	}
+}
+
+func TestParseTrack_variables(t *testing.T) {
+	in := "set:tempo=70 set:double=$tempo*2 bpm:$double+(1-1) vel:=$tempo+bar K"
+	got, err := ParseTrack(in)
+	if err != nil {
+		t.Fatalf("ParseTrack(%v) should succeed, but failed: %v", in, err)
+	}
+	if got.BPM != 140 {
+		t.Errorf("ParseTrack(%v).BPM=%v, want 140", in, got.BPM)
+	}
+	if v := got.Hits[0].Notes[36]; v != 71 {
+		t.Errorf("ParseTrack(%v) velocity=%v, want 71", in, v)
+	}
+
+	for _, in := range []string{"bpm:$tempo", "set:x=1 bpm:$x*1000",
+		"bpm:$1", "bpm:$min(1,2)"} {
+		if got, err := ParseTrack(in); err == nil {
+			t.Errorf("ParseTrack(%v)=%v, want failure", in, got)
+		}
+	}
+}
+
+func TestParseTrackAll(t *testing.T) {
+	tr, errs := ParseTrackAll("bpm:90 K X S.1 foo:1 [ K S")
+	var codes []Code
+	for _, err := range errs {
+		codes = append(codes, err.(*Error).Code)
+	}
+	want := []Code{CodeBadDrum, CodeUnrecognizedToken, CodeUnknownDirective,
+		CodeUnclosedGroup}
+	if !reflect.DeepEqual(codes, want) {
+		t.Errorf("ParseTrackAll() errors=%v, want %v", errs, want)
+	}
+	if len(tr.Hits) != 3 || tr.BPM != 90 {
+		t.Errorf("ParseTrackAll()=%v, want 3 hits at 90 BPM", tr)
+	}
+	if e := errs[1].(*Error); e.Line != 1 || e.Col != 12 {
+		t.Errorf("ParseTrackAll() error 2 at %v:%v, want 1:12", e.Line, e.Col)
+	}
+
+	if _, errs := ParseTrackAll("K S"); errs != nil {
+		t.Errorf("ParseTrackAll(K S) errors=%v, want nil", errs)
+	}
+}
+
+func TestDirectives(t *testing.T) {
+	got := Directives()
+	if len(got) != len(directives) || !sort.StringsAreSorted(got) {
+		t.Errorf("Directives()=%v, want all %v directives sorted", got,
+			len(directives))
+	}
+}
+
+func TestParseTrack_chances(t *testing.T) {
+	tr := mustParse(t, "K,HC-@-3?25. 42?100 S?1")
+	want := []*Hit{
+		{Notes: map[byte]Velocity{36: F, 22: MF}, T: 48,
+			Offsets: map[byte]int{22: -3}, Chances: map[byte]int{22: 25}},
+		{Notes: map[byte]Velocity{42: F}, T: 96},
+		{Notes: map[byte]Velocity{38: F}, T: 96, Chances: map[byte]int{38: 1}},
+	}
+	if !reflect.DeepEqual(tr.Hits, want) {
+		t.Errorf("ParseTrack()=%v, want %v", tr.Hits, want)
+	}
+	for _, src := range []string{"K?0", "K?101"} {
+		_, err := ParseTrack(src)
+		if e, ok := err.(*Error); !ok || e.Code != CodeBadChance {
+			t.Errorf("ParseTrack(%q)=%v, want %v", src, err, CodeBadChance)
+		}
+	}
+}
+
+func TestParseTrack_map(t *testing.T) {
+	in := "alias:X=HC map:ad2 HC,X SF,40 map:gm HO remap:S=SS S map:ezdrummer HC"
+	want := []*Hit{
+		{Notes: map[byte]Velocity{42: F, 22: F}, T: 96},
+		{Notes: map[byte]Velocity{39: F, 40: F}, T: 96},
+		{Notes: map[byte]Velocity{46: F}, T: 96},
+		{Notes: map[byte]Velocity{37: F}, T: 96},
+		{Notes: map[byte]Velocity{22: F}, T: 96},
+	}
+	got, err := ParseTrack(in)
+	if err != nil {
+		t.Fatalf("ParseTrack(%v) should succeed, but failed: %v", in, err)
+	}
+	if !reflect.DeepEqual(got.Hits, want) {
+		t.Fatalf("ParseTrack(%v).Hits=%v, want %v", in, got.Hits, want)
+	}
+
+	for _, in := range []string{"map:", "map:sd2", "map:ad2 HCT", "map:gm SR"} {
+		if got, err := ParseTrack(in); err == nil {
+			t.Errorf("ParseTrack(%v)=%v, want failure", in, got)
+		}
+	}
+}
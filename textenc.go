@@ -0,0 +1,181 @@
+package beatnik
+
+// Export to beatnik text.
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Maps numbers of ticks to the shortest duration suffix of a hit that lasts
+// that long.
+var textDurations = map[uint]string{}
+
+func init() {
+	lengths := []string{"~~", "~", "", ".", "..", "...", "....", "....."}
+	tuplets := []string{"", ">"}
+	for n := 4; n <= 32; n++ {
+		tuplets = append(tuplets, ">"+strconv.Itoa(n))
+	}
+	for _, tuplet := range tuplets {
+		for _, length := range lengths {
+			s := length + tuplet
+			d := parseDuration(s)
+			if old, ok := textDurations[d]; !ok || len(s) < len(old) {
+				textDurations[d] = s
+			}
+		}
+	}
+}
+
+// MarshalText returns the track in beatnik's text notation, with one bar per
+// line, so that parsing the text gives back the track. Notes are named by
+// beatnik's default drum names, or by number if they have none. Velocities are
+// rounded to the nearest velocity mark, and durations that no single hit can
+// last continue with waits. Markers and cue points are written before the
+// first hit at or after them, with spaces in their text turned into
+// underscores. Tempo changes, controls and silence before the first hit are
+// left out. Fails if the track is not valid.
+func (t *Track) MarshalText() ([]byte, error) {
+	if err := errorOf(t.Validate()); err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer(nil)
+	meta := t.sortedMeta()
+	for _, m := range meta {
+		if m.Type == MetaTrackName {
+			fmt.Fprintf(buf, "title:%v\n", textMetaValue(m.Data))
+		}
+	}
+	fmt.Fprintf(buf, "bpm:%v\n", t.TempoMap().BPM(0))
+	if t.TimeSig != (TimeSig{}) {
+		fmt.Fprintf(buf, "time:%v\n", t.TimeSig)
+	}
+	buf.WriteString("\n")
+
+	hits := t.Hits
+	var tick uint
+	for len(hits) > 0 && hits[0].IsRest() {
+		tick += hits[0].T
+		hits = hits[1:]
+	}
+	barTicks := t.timeSig().barTicks()
+	line := []string{}
+	for i, h := range hits {
+		for len(meta) > 0 && meta[0].T <= tick {
+			switch meta[0].Type {
+			case MetaMarker:
+				line = append(line, "marker:"+textMetaValue(meta[0].Data))
+			case MetaCue:
+				line = append(line, "cue:"+textMetaValue(meta[0].Data))
+			}
+			meta = meta[1:]
+		}
+
+		durs := textDuration(h.T)
+		if h.IsRest() {
+			line = append(line, textWaits(durs)...)
+		} else {
+			line = append(line, textHit(h)+durs[0])
+			line = append(line, textWaits(durs[1:])...)
+		}
+
+		tick += h.T
+		if tick%barTicks == 0 || i == len(hits)-1 {
+			buf.WriteString(strings.Join(line, " ") + "\n")
+			line = line[:0]
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// textHit returns the notes and annotations of a hit in text notation,
+// without its duration.
+func textHit(h *Hit) string {
+	var notes []string
+	for _, n := range sortedNotes(h) {
+		name, ok := noteNames[n]
+		if !ok {
+			name = strconv.Itoa(int(n))
+		}
+		name += textVelocity(h.Notes[n])
+		if off := h.Offsets[n]; off != 0 {
+			name += "@" + strconv.Itoa(off)
+		}
+		if c, ok := h.Chances[n]; ok {
+			name += "?" + strconv.Itoa(c)
+		}
+		notes = append(notes, name)
+	}
+	result := strings.Join(notes, ",")
+
+	if len(h.Annotations) > 0 {
+		var annotations []string
+		for k, v := range h.Annotations {
+			annotations = append(annotations, k+"="+v)
+		}
+		sort.Strings(annotations)
+		result += "{" + strings.Join(annotations, ",") + "}"
+	}
+	return result
+}
+
+// textVelocity returns the velocity mark that is nearest to the given
+// velocity.
+func textVelocity(v Velocity) string {
+	const step = F - MF
+	steps := roundDiv(int(v)-int(F), int(step))
+	switch {
+	case steps < -5:
+		steps = -5
+	case steps > 2:
+		steps = 2
+	}
+	if steps < 0 {
+		return strings.Repeat("-", -steps)
+	}
+	return strings.Repeat("+", steps)
+}
+
+// textDuration returns duration suffixes that add up to the given number of
+// ticks, longest first. The first is for a hit and the rest are for waits
+// after it.
+func textDuration(ticks uint) []string {
+	var result []string
+	for {
+		if s, ok := textDurations[ticks]; ok {
+			return append(result, s)
+		}
+		for _, v := range plainValues {
+			if v < ticks {
+				result = append(result, textDurations[v])
+				ticks -= v
+				break
+			}
+		}
+	}
+}
+
+// textWaits returns wait tokens of the given duration suffixes. A quarter,
+// which has an empty suffix, is written as two eighths.
+func textWaits(durs []string) []string {
+	var result []string
+	for _, d := range durs {
+		if d == "" {
+			result = append(result, ".", ".")
+		} else {
+			result = append(result, d)
+		}
+	}
+	return result
+}
+
+// textMetaValue returns the text of a meta event as a directive value, with
+// spaces turned into underscores.
+func textMetaValue(data []byte) string {
+	return strings.Join(strings.Fields(strings.Replace(string(data), "#", "",
+		-1)), "_")
+}
@@ -0,0 +1,70 @@
+package beatnik
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestMarshalText(t *testing.T) {
+	tr := &Track{BPM: 90, Hits: []*Hit{
+		{T: 48},
+		NewHit(48, F, 36, 22),
+		NewHit(144, MF, 38),
+		{T: 144},
+		NewHit(5, 100, 99),
+		NewHit(283, FFF, 49),
+	}, Meta: []*Meta{
+		{0, MetaTrackName, []byte("My song")},
+		{48, MetaMarker, []byte("in")},
+	}}
+	tr.Hits[1].Offsets = map[byte]int{22: -3}
+	tr.Hits[2].Annotations = map[string]string{"b": "2", "a": "1"}
+
+	got, err := tr.MarshalText()
+	if err != nil {
+		t.Fatalf("MarshalText() failed: %v", err)
+	}
+	want := "title:My_song\nbpm:90\n\n" +
+		"marker:in HC@-3,K. S-{a=1,b=2} . . . .\n" +
+		"99---....>9 C2++~ . .. ..>5\n"
+	if string(got) != want {
+		t.Errorf("MarshalText()=\n%s\nwant\n%s", got, want)
+	}
+	if _, err := ParseTrack(string(got)); err != nil {
+		t.Errorf("ParseTrack(MarshalText()) failed: %v", err)
+	}
+}
+
+func TestMarshalText_midi(t *testing.T) {
+	src := "bpm:100 time:3/4 marker:a HC,K. HC. HC,S. HC+. HC. HC,K. | " +
+		"K,HC@-3. K. S,HC. (S..) S.> S.> S.> C1,K~ ."
+	want, err := ParseTrack(src)
+	if err != nil {
+		t.Fatalf("ParseTrack(%q) failed: %v", src, err)
+	}
+	b, err := want.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() failed: %v", err)
+	}
+	tr, err := ReadMIDI(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("ReadMIDI() failed: %v", err)
+	}
+	tr.Quantize(8)
+	text, err := tr.MarshalText()
+	if err != nil {
+		t.Fatalf("MarshalText() failed: %v", err)
+	}
+	got, err := ParseTrack(string(text))
+	if err != nil {
+		t.Fatalf("ParseTrack(%q) failed: %v", text, err)
+	}
+	want.Hits[6].Offsets = nil
+	if !reflect.DeepEqual(got.Hits, want.Hits) {
+		t.Errorf("ParseTrack(%q).Hits=%v, want %v", text, got.Hits, want.Hits)
+	}
+	if !reflect.DeepEqual(got.Meta, want.Meta) {
+		t.Errorf("ParseTrack(%q).Meta=%v, want %v", text, got.Meta, want.Meta)
+	}
+}
@@ -0,0 +1,150 @@
+package beatnik
+
+// Time lookups for displaying and scrubbing tracks.
+
+import (
+	"sort"
+	"time"
+)
+
+// A Timeline is a read-only index of a track's events in time, for quick
+// lookups while scrubbing or following playback. Lookups are binary searches.
+// A timeline does not follow changes to the track it was made from.
+type Timeline struct {
+	Events  []TimelineEvent // Hits with notes, ordered by tick.
+	Markers []TimelineEvent // Marker events, ordered by tick.
+
+	ticks  uint      // Length of the track.
+	barLen uint      // Ticks in a bar.
+	tempo  *TempoMap // Tempo of the track.
+}
+
+// A TimelineEvent is something that happens at a point of a timeline.
+type TimelineEvent struct {
+	T    uint          // Absolute tick.
+	Time time.Duration // Time from the start of the track.
+	Hit  *Hit          // Hit of a hit event, nil for markers.
+	Text string        // Text of a marker, empty for hits.
+}
+
+// NewTimeline returns a timeline of the given track.
+func NewTimeline(t *Track) *Timeline {
+	tl := &Timeline{
+		ticks:  t.ticks(),
+		barLen: t.timeSig().barTicks(),
+		tempo:  t.TempoMap(),
+	}
+	for _, m := range t.sortedMeta() {
+		if m.Type == MetaMarker {
+			tl.Markers = append(tl.Markers, TimelineEvent{T: m.T, Text: string(m.Data)})
+		}
+	}
+	for i := range tl.Markers {
+		tl.Markers[i].Time = tl.Time(tl.Markers[i].T)
+	}
+	var tick uint
+	for _, h := range t.Hits {
+		if !h.IsRest() {
+			tl.Events = append(tl.Events, TimelineEvent{T: tick, Time: tl.Time(tick),
+				Hit: h})
+		}
+		tick += h.T
+	}
+	return tl
+}
+
+// Ticks returns the length of the timeline in ticks.
+func (tl *Timeline) Ticks() uint {
+	return tl.ticks
+}
+
+// Duration returns the playing time of the timeline.
+func (tl *Timeline) Duration() time.Duration {
+	return tl.Time(tl.ticks)
+}
+
+// Time returns the playing time at the given tick. Returns 0 if the track has
+// no tempo.
+func (tl *Timeline) Time(tick uint) time.Duration {
+	return tl.tempo.TickToTime(tick)
+}
+
+// Tick returns the tick that plays at the given time, rounded down. Returns 0
+// if the track has no tempo.
+func (tl *Timeline) Tick(d time.Duration) uint {
+	return tl.tempo.TimeToTick(d)
+}
+
+// BPM returns the tempo in effect at the given tick.
+func (tl *Timeline) BPM(tick uint) uint {
+	return tl.tempo.BPM(tick)
+}
+
+// Bar returns the 0-based bar that the given tick is in, and the tick's
+// offset in that bar.
+func (tl *Timeline) Bar(tick uint) (bar int, offset uint) {
+	return int(tick / tl.barLen), tick % tl.barLen
+}
+
+// BarTick returns the tick where the given 0-based bar starts.
+func (tl *Timeline) BarTick(bar int) uint {
+	return uint(bar) * tl.barLen
+}
+
+// EventAt returns the index of the last event that starts at or before the
+// given tick, or -1 if there is none.
+func (tl *Timeline) EventAt(tick uint) int {
+	return sort.Search(len(tl.Events), func(i int) bool {
+		return tl.Events[i].T > tick
+	}) - 1
+}
+
+// EventsBetween returns the events that start in the tick range [from, to).
+func (tl *Timeline) EventsBetween(from, to uint) []TimelineEvent {
+	i := sort.Search(len(tl.Events), func(i int) bool {
+		return tl.Events[i].T >= from
+	})
+	j := sort.Search(len(tl.Events), func(i int) bool {
+		return tl.Events[i].T >= to
+	})
+	if j < i {
+		return nil
+	}
+	return tl.Events[i:j]
+}
+
+// MarkerAt returns the index of the last marker at or before the given tick,
+// or -1 if there is none.
+func (tl *Timeline) MarkerAt(tick uint) int {
+	return sort.Search(len(tl.Markers), func(i int) bool {
+		return tl.Markers[i].T > tick
+	}) - 1
+}
+
+// Overview divides the timeline into n equal parts and returns the loudness of
+// each part, as the sum of its velocities scaled so that the loudest part is
+// 1. For drawing waveform-like overviews.
+func (tl *Timeline) Overview(n int) []float64 {
+	result := make([]float64, n)
+	if n == 0 || tl.ticks == 0 {
+		return result
+	}
+	for _, e := range tl.Events {
+		i := int(uint64(e.T) * uint64(n) / uint64(tl.ticks))
+		for _, v := range e.Hit.Notes {
+			result[i] += float64(v)
+		}
+	}
+	max := 0.0
+	for _, x := range result {
+		if x > max {
+			max = x
+		}
+	}
+	if max > 0 {
+		for i := range result {
+			result[i] /= max
+		}
+	}
+	return result
+}
@@ -0,0 +1,82 @@
+package beatnik
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTimeline(t *testing.T) {
+	a, err := ParseTrack("bpm:60 marker:A K S K S")
+	if err != nil {
+		t.Fatalf("ParseTrack() failed: %v", err)
+	}
+	b, err := ParseTrack("bpm:120 marker:B K. . S.. K")
+	if err != nil {
+		t.Fatalf("ParseTrack() failed: %v", err)
+	}
+	tr := Concat(a, b)
+	tl := NewTimeline(tr)
+
+	if got, want := tl.Ticks(), uint(600); got != want {
+		t.Errorf("Ticks()=%v, want %v", got, want)
+	}
+	if got, want := tl.Duration(), tr.Duration(); got != want {
+		t.Errorf("Duration()=%v, want %v", got, want)
+	}
+	times := []struct {
+		tick uint
+		time time.Duration
+	}{
+		{0, 0},
+		{48, 500 * time.Millisecond},
+		{384, 4 * time.Second},
+		{480, 4500 * time.Millisecond},
+	}
+	for _, test := range times {
+		if got := tl.Time(test.tick); got != test.time {
+			t.Errorf("Time(%v)=%v, want %v", test.tick, got, test.time)
+		}
+		if got := tl.Tick(test.time); got != test.tick {
+			t.Errorf("Tick(%v)=%v, want %v", test.time, got, test.tick)
+		}
+	}
+	if got := tl.BPM(400); got != 120 {
+		t.Errorf("BPM(400)=%v, want 120", got)
+	}
+	if bar, off := tl.Bar(400); bar != 1 || off != 16 {
+		t.Errorf("Bar(400)=%v,%v, want 1,16", bar, off)
+	}
+	if got := tl.EventAt(500); got != 5 {
+		t.Errorf("EventAt(500)=%v, want 5", got)
+	}
+	if got := tl.EventAt(0); got != 0 {
+		t.Errorf("EventAt(0)=%v, want 0", got)
+	}
+	var ticks []uint
+	for _, e := range tl.EventsBetween(96, 528) {
+		ticks = append(ticks, e.T)
+	}
+	if want := []uint{96, 192, 288, 384, 480, 504}; !reflect.DeepEqual(ticks, want) {
+		t.Errorf("EventsBetween(96,528)=%v, want %v", ticks, want)
+	}
+	if got := tl.MarkerAt(383); got != 0 || tl.Markers[got].Text != "A" {
+		t.Errorf("MarkerAt(383)=%v, want 0", got)
+	}
+	if got := tl.Markers[1].Time; got != 4*time.Second {
+		t.Errorf("Markers[1].Time=%v, want 4s", got)
+	}
+}
+
+func TestTimeline_overview(t *testing.T) {
+	tr := &Track{BPM: 60, Hits: []*Hit{
+		{Notes: map[byte]Velocity{36: 100, 42: 100}, T: 96},
+		{T: 96},
+		{Notes: map[byte]Velocity{38: 50}, T: 192},
+	}}
+	got := NewTimeline(tr).Overview(4)
+	want := []float64{1, 0, 0.25, 0}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Overview(4)=%v, want %v", got, want)
+	}
+}
@@ -8,6 +8,9 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"io"
+	"sort"
+	"time"
 )
 
 // TODO(amit): Support different drum machine configurations.
@@ -16,30 +19,127 @@ import (
 
 // A Track is an entire drum track, with its drum data and metadata.
 type Track struct {
-	Hits []*Hit // Order of hits in this track.
-	BPM  uint   // Track tempo.
+	Hits []*Hit  // Order of hits in this track.
+	BPM  uint    // Track tempo.
+	Meta []*Meta // Meta events (markers, tempo changes...) at absolute ticks.
+
+	TimeSig TimeSig // Time signature, zero value means 4/4.
+
+	// Control change events on the drum channel, at absolute ticks. Nil if
+	// none.
+	Controls []*Control
+}
+
+// EncodeOptions control optional features of the midi encoding. A nil
+// *EncodeOptions is equivalent to the zero value.
+type EncodeOptions struct {
+	Annotations bool // Emit hit annotations as text meta events.
+
+	// Length of each note in ticks. 0 means until the next hit.
+	Gate uint
+
+	// What to do when a note is struck while it is still sounding, which can
+	// happen when Gate is longer than the hits.
+	Retrigger Retrigger
+
+	// Drum machine whose choke groups and velocity splits are applied. Choked
+	// notes end when the notes that choke them are struck, and split notes
+	// are replaced according to their velocities. Nil for neither.
+	Kit *Kit
+
+	// Seed for choosing which notes with chances play. The same seed always
+	// plays the same notes, and other seeds give other variations.
+	Seed int64
+
+	// Splits the notes into midi tracks by instrument class, for workflows
+	// that need a track per instrument, like drum replacement in a DAW. Maps
+	// classes to the names of their tracks, where classes with the same name
+	// share a track, and missing classes get a track named after the class.
+	// Classes are taken from Kit, or from EZdrummer's if it is nil. Nil for a
+	// single track. See DefaultTrackGroups.
+	TrackGroups map[Class]string
+
+	// Use running status: events that repeat the status byte of the event
+	// before them leave it out, and note-offs are written as note-ons with
+	// velocity 0, so that they share the status of the note-ons. Makes dense
+	// drum tracks about a quarter smaller.
+	RunningStatus bool
+
+	trackName string // Name of the hits' midi track, empty for none.
 }
 
 // MarshalBinary returns a binary encoding of the track as a complete midi file.
 func (t *Track) MarshalBinary() ([]byte, error) {
-	if t.BPM == 0 {
-		return nil, fmt.Errorf("cannot encode with bpm=0")
+	return t.Encode(nil)
+}
+
+// Encode returns a binary encoding of the track as a complete midi file, using
+// the given options. The size of the file is measured first, so that it is
+// encoded into a single buffer of the right size.
+func (t *Track) Encode(opts *EncodeOptions) ([]byte, error) {
+	if err := errorOf(t.Validate()); err != nil {
+		return nil, err
+	}
+	if opts == nil {
+		opts = &EncodeOptions{}
 	}
 
-	buf := bytes.NewBuffer(nil)
-	buf.Write(t.encodeHeaderChunk())
-	buf.Write(t.encodeMetaChunk())
-	buf.Write(t.encodeHits())
-	return buf.Bytes(), nil
+	groups := t.groups(opts)
+	header := encodeHeaderChunk(len(groups) + 1)
+	meta := t.encodeMetaChunk()
+	sizes := make([]int, len(groups))
+	size := len(header) + len(meta)
+	for i, g := range groups {
+		_, sizes[i] = g.track.measureHits(g.options(opts))
+		size += 8 + sizes[i]
+	}
+
+	b := make([]byte, 0, size)
+	b = append(b, header...)
+	b = append(b, meta...)
+	for i, g := range groups {
+		b = g.track.appendHits(b, g.options(opts), sizes[i])
+	}
+	return b, nil
+}
+
+// WriteTo writes the track to w as a complete midi file. Returns the number of
+// bytes written.
+func (t *Track) WriteTo(w io.Writer) (int64, error) {
+	return t.EncodeTo(w, nil)
+}
+
+// EncodeTo writes the track to w as a complete midi file, using the given
+// options. Hits are encoded and written one at a time, so the entire file is
+// never held in memory. Notes that are struck together are written in
+// ascending order, so a track always encodes to the same bytes. Returns the
+// number of bytes written. Nothing is written if the track fails validation.
+func (t *Track) EncodeTo(w io.Writer, opts *EncodeOptions) (int64, error) {
+	if err := errorOf(t.Validate()); err != nil {
+		return 0, err
+	}
+	if opts == nil {
+		opts = &EncodeOptions{}
+	}
+
+	groups := t.groups(opts)
+	cw := &countingWriter{w: w}
+	cw.Write(encodeHeaderChunk(len(groups) + 1))
+	cw.Write(t.encodeMetaChunk())
+	for _, g := range groups {
+		g.writeHits(cw, opts)
+	}
+	return cw.n, cw.err
 }
 
-// encodeHeaderChunk returns a binary encoding of the midi header track.
-func (*Track) encodeHeaderChunk() []byte {
+// encodeHeaderChunk returns a binary encoding of the midi header track, for a
+// file with the given number of tracks.
+func encodeHeaderChunk(ntracks int) []byte {
 	buf := bytes.NewBuffer(nil)
 	buf.Write([]byte("MThd"))
 	binary.Write(buf, binary.BigEndian, uint32(6))
 	binary.Write(buf, binary.BigEndian, uint16(1)) // File format (0/1/2).
-	binary.Write(buf, binary.BigEndian, uint16(2)) // Number of tracks.
+	binary.Write(buf, binary.BigEndian, uint16(ntracks))
 	binary.Write(buf, binary.BigEndian, uint16(96))
 
 	return buf.Bytes()
@@ -48,62 +148,344 @@ func (*Track) encodeHeaderChunk() []byte {
 // encodeMetaChunk returns a binary encoding of the midi first (metadata)
 // track.
 func (t *Track) encodeMetaChunk() []byte {
-	// Extract us per beat from bpm.
-	mpb := 1 / float64(t.BPM)
-	uspb := uint32(mpb * 60 * 1000000)
-
-	// Encode track.
-	buf := bytes.NewBuffer(nil)
-	buf.Write([]byte("MTrk"))
+	b := []byte("MTrk\x00\x00\x00\x00") // Length is set at the end.
 
-	buf2 := bytes.NewBuffer(nil)
 	// TODO(amit): Extract meta events to functions.
-	buf2.Write([]byte{0, 0xFF, 0x58, 4, 4, 2, 24, 8})
-	buf2.Write([]byte{0, 0xFF, 0x51, 3})
-	buf2.Write(bin(uspb)[1:])
-	buf2.Write([]byte{0, 0xFF, 0x2F, 0})
+	ts := t.timeSig()
+	b = append(b, 0, 0xFF, 0x58, 4, byte(ts.Num), ts.denomPower(), 24, 8)
+	var last uint
+	for _, m := range t.encodedMeta() {
+		b = appendUvarint(b, m.T-last)
+		b = m.appendEncoding(b)
+		last = m.T
+	}
+	b = append(b, 0, 0xFF, 0x2F, 0)
+
+	binary.BigEndian.PutUint32(b[4:], uint32(len(b)-8))
+	return b
+}
 
-	buf.Write(bin(uint32(buf2.Len())))
-	return append(buf.Bytes(), buf2.Bytes()...)
+// sortedMeta returns the track's meta events ordered by tick. Events on the
+// same tick keep their original order.
+func (t *Track) sortedMeta() []*Meta {
+	result := make([]*Meta, len(t.Meta))
+	copy(result, t.Meta)
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].T < result[j].T
+	})
+	return result
+}
+
+// encodedMeta returns the meta events to encode, ordered by tick: the changes
+// of the track's tempo map, and the track's other meta events. Tempo changes
+// come before other events on the same tick.
+func (t *Track) encodedMeta() []*Meta {
+	result := t.TempoMap().tempoMetas()
+	for _, m := range t.Meta {
+		if m.Type != MetaTempo {
+			result = append(result, m)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].T < result[j].T
+	})
+	return result
 }
 
-// encodeHits returns a binary encoding of the drum hits in this track as a
-// single midi track.
-func (t *Track) encodeHits() []byte {
-	buf := bytes.NewBuffer([]byte("MTrk"))
-	buf2 := bytes.NewBuffer(nil)
+// tempoChangeMeta returns the meta events to encode like encodedMeta, without
+// the tempo at tick 0, for formats that write the starting tempo on its own.
+func (t *Track) tempoChangeMeta() []*Meta {
+	meta := t.encodedMeta()
+	if len(meta) > 0 && meta[0].T == 0 && meta[0].Type == MetaTempo {
+		return meta[1:]
+	}
+	return meta
+}
+
+// ticks returns the total number of ticks of the hits in this track.
+func (t *Track) ticks() uint {
+	var result uint
 	for _, h := range t.Hits {
-		buf2.Write(h.encode())
+		result += h.T
 	}
-	buf2.Write([]byte{0, 0xFF, 0x2F, 0})
-	buf.Write(bin(uint32(buf2.Len())))
+	return result
+}
 
-	return append(buf.Bytes(), buf2.Bytes()...)
+// Duration returns the playing time of the track, according to its tempo and
+// tempo changes. Returns 0 if the track has no tempo.
+func (t *Track) Duration() time.Duration {
+	return t.TempoMap().TickToTime(t.ticks())
+}
+
+// Bars returns the length of the track in bars, according to its time
+// signature.
+func (t *Track) Bars() float64 {
+	return float64(t.ticks()) / float64(t.timeSig().barTicks())
+}
+
+// ticksDuration returns the playing time of the given number of ticks in the
+// given tempo.
+func ticksDuration(ticks, bpm uint) time.Duration {
+	return time.Duration(float64(ticks) * float64(time.Minute) / float64(96*bpm))
+}
+
+// writeHits writes a binary encoding of the drum hits in this track as a
+// single midi track. The chunk length is calculated in a first pass, so that
+// hits can be written one by one in the second.
+func (t *Track) writeHits(w io.Writer, opts *EncodeOptions) {
+	_, size := t.measureHits(opts)
+	w.Write(appendUint32([]byte("MTrk"), uint32(size)))
+	t.encodeHits(w, opts)
+}
+
+// appendHits appends a binary encoding of the drum hits in this track as a
+// single midi track to b. Size is the length of the encoded events, as
+// returned by measureHits.
+func (t *Track) appendHits(b []byte, opts *EncodeOptions, size int) []byte {
+	b = appendUint32(append(b, "MTrk"...), uint32(size))
+	e := newHitEncoder(nil, t, opts)
+	e.out = b
+	e.encode(t)
+	return e.out
+}
+
+// encodeHits writes the hits and control events of this track to w as midi
+// events, ending with an end-of-track event. Returns the number of events
+// written.
+func (t *Track) encodeHits(w io.Writer, opts *EncodeOptions) int {
+	e := newHitEncoder(w, t, opts)
+	e.encode(t)
+	return e.events
+}
+
+// measureHits returns the number of events that encodeHits writes and their
+// length in bytes, without encoding them.
+func (t *Track) measureHits(opts *EncodeOptions) (events, size int) {
+	e := newHitEncoder(nil, t, opts)
+	e.measure = true
+	e.encode(t)
+	return e.events, e.size
 }
 
 // A Hit is a set of drums being hit at the same time.
 type Hit struct {
-	Notes map[byte]Velocity // Notes to strike with their velocities.
-	T     uint              // Number of ticks this hit lasts (96 is a quarter bar).
+	Notes       map[byte]Velocity // Notes to strike with their velocities, empty for a rest.
+	T           uint              // Number of ticks this hit lasts (96 is a quarter bar).
+	Annotations map[string]string // Arbitrary key=value data, nil if none.
+
+	// Per-note timing offsets in ticks, negative is earlier. Notes that are
+	// missing play on time. Nil if none.
+	Offsets map[byte]int
+
+	// Per-note chances of playing in percent, from 1 to 99. The notes are
+	// chosen randomly when the track is encoded, see EncodeOptions.Seed.
+	// Notes that are missing always play. Nil if none.
+	Chances map[byte]int
+
+	// Source text that the hit was parsed from, for mapping playback back to
+	// the source. Hits that are played again, like in repeated sections, share
+	// the span of the original. Nil unless ParseOptions.Spans is set.
+	Span *SourceSpan
 }
 
-// encode returns a binary encoding of the hit as midi events.
-func (h *Hit) encode() []byte {
-	buf := bytes.NewBuffer(nil)
-	for n, v := range h.Notes {
-		buf.Write([]byte{0, 0x99, n, byte(v)})
+// A SourceSpan is a range of source text on a single line.
+type SourceSpan struct {
+	File   string // File of the text, empty if it is not from a file.
+	Line   int    // 1-based line number.
+	Col    int    // 1-based column of the first rune.
+	EndCol int    // 1-based column after the last rune.
+}
+
+// NewHit returns a hit of the given duration in ticks that strikes the given
+// notes, all with velocity v. It builds the per-note velocities of Notes from
+// a single velocity, as hits were written before notes had their own.
+func NewHit(t uint, v Velocity, notes ...byte) *Hit {
+	h := &Hit{Notes: make(map[byte]Velocity, len(notes)), T: t}
+	for _, n := range notes {
+		h.Notes[n] = v
 	}
-	first := true
+	return h
+}
+
+// IsRest returns true if the hit has no notes, meaning it is only silence.
+func (h *Hit) IsRest() bool {
+	return len(h.Notes) == 0
+}
+
+// sortedNotes returns the notes of a hit in ascending order.
+func sortedNotes(h *Hit) []byte {
+	return appendSortedNotes(make([]byte, 0, len(h.Notes)), h)
+}
+
+// appendSortedNotes appends the notes of the given hit to b in ascending
+// order. Hits have few notes, so they are sorted by insertion.
+func appendSortedNotes(b []byte, h *Hit) []byte {
+	start := len(b)
 	for n := range h.Notes {
-		if first {
-			buf.Write(uvarint(h.T))
-			first = false
-		} else {
-			buf.Write(uvarint(0))
+		i := len(b)
+		b = append(b, n)
+		for ; i > start && b[i-1] > n; i-- {
+			b[i] = b[i-1]
 		}
-		buf.Write([]byte{0x89, n, 64})
+		b[i] = n
 	}
-	return buf.Bytes()
+	return b
+}
+
+// maxOffset returns the largest absolute timing offset of the track's notes.
+func (t *Track) maxOffset() uint {
+	var result uint
+	for _, h := range t.Hits {
+		for _, off := range h.Offsets {
+			if off < 0 {
+				off = -off
+			}
+			if uint(off) > result {
+				result = uint(off)
+			}
+		}
+	}
+	return result
+}
+
+// A TimeSig is a time signature, such as 3/4 or 7/8.
+type TimeSig struct {
+	Num   uint // Number of beats in a bar.
+	Denom uint // Beat unit, a power of 2 (4 means quarter notes).
+}
+
+// String returns the time signature in "num/denom" form.
+func (ts TimeSig) String() string {
+	return fmt.Sprintf("%v/%v", ts.Num, ts.Denom)
+}
+
+// valid returns true if the time signature can be encoded in midi.
+func (ts TimeSig) valid() bool {
+	return ts.Num >= 1 && ts.Num <= 255 && ts.Denom >= 1 && ts.Denom <= 64 &&
+		ts.Denom&(ts.Denom-1) == 0
+}
+
+// barTicks returns the number of ticks in a single bar.
+func (ts TimeSig) barTicks() uint {
+	return ts.Num * 96 * 4 / ts.Denom
+}
+
+// denomPower returns the denominator as a power of 2, as encoded in midi.
+func (ts TimeSig) denomPower() byte {
+	var result byte
+	for d := ts.Denom; d > 1; d >>= 1 {
+		result++
+	}
+	return result
+}
+
+// timeSig returns the track's time signature, replacing the zero value with
+// 4/4.
+func (t *Track) timeSig() TimeSig {
+	if t.TimeSig == (TimeSig{}) {
+		return TimeSig{4, 4}
+	}
+	return t.TimeSig
+}
+
+// Meta event types.
+const (
+	MetaText      = 0x01
+	MetaTrackName = 0x03
+	MetaMarker    = 0x06
+	MetaCue       = 0x07
+	MetaTempo     = 0x51
+
+	// MetaSysEx is not a meta event type, but marks a system exclusive message,
+	// whose data are the bytes after its 0xF0 status byte.
+	MetaSysEx = 0xF0
+)
+
+// A Meta is a meta event placed at an absolute position in the track.
+type Meta struct {
+	T    uint   // Absolute tick of the event, from the start of the track.
+	Type byte   // Meta event type (see MetaText, MetaMarker...).
+	Data []byte // Event payload.
+}
+
+// encode returns a binary encoding of the meta event, without delta time.
+func (m *Meta) encode() []byte {
+	return m.appendEncoding(make([]byte, 0, 2+uvarintLen(uint(len(m.Data)))+len(m.Data)))
+}
+
+// appendEncoding appends a binary encoding of the meta event, without delta
+// time, to b.
+func (m *Meta) appendEncoding(b []byte) []byte {
+	if m.Type == MetaSysEx {
+		b = append(b, 0xF0)
+	} else {
+		b = append(b, 0xFF, m.Type)
+	}
+	b = appendUvarint(b, uint(len(m.Data)))
+	return append(b, m.Data...)
+}
+
+// tempoMeta returns a tempo change meta event at the given tick.
+func tempoMeta(t uint, bpm uint) *Meta {
+	// Extract us per beat from bpm.
+	mpb := 1 / float64(bpm)
+	uspb := uint32(mpb * 60 * 1000000)
+	return &Meta{t, MetaTempo, bin(uspb)[1:]}
+}
+
+// bpm returns the tempo of a tempo change meta event.
+func (m *Meta) bpm() uint {
+	uspb := uint32(m.Data[0])<<16 | uint32(m.Data[1])<<8 | uint32(m.Data[2])
+	return uint(60*1000000/float64(uspb) + 0.5)
+}
+
+// A Control is a control change event, such as hi-hat openness, or another
+// channel message that is not a note, placed at an absolute position in the
+// track.
+type Control struct {
+	T      uint // Absolute tick of the event, from the start of the track.
+	Number byte // Controller number or pressed note, 0-127.
+	Value  byte // Controller value or pressure, 0-127.
+
+	Kind ControlKind // Kind of message, zero value is a control change.
+}
+
+// A ControlKind is a kind of channel message of a Control.
+type ControlKind int
+
+// Control kinds.
+const (
+	ControlChange   ControlKind = iota // Controller Number changes to Value.
+	KeyPressure                        // Aftertouch of note Number.
+	ChannelPressure                    // Aftertouch of the channel, Number is unused.
+	PitchBend                          // Pitch bend, Number is the low 7 bits and Value the high 7 bits.
+)
+
+// status returns the status byte of the kind's messages on the drum channel.
+func (k ControlKind) status() byte {
+	switch k {
+	case KeyPressure:
+		return 0xA9
+	case ChannelPressure:
+		return 0xD9
+	case PitchBend:
+		return 0xE9
+	}
+	return 0xB9
+}
+
+// sortedControls returns the track's control events ordered by tick. Events
+// on the same tick keep their original order. Returns nil if there are none.
+func (t *Track) sortedControls() []*Control {
+	if len(t.Controls) == 0 {
+		return nil
+	}
+	result := make([]*Control, len(t.Controls))
+	copy(result, t.Controls)
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].T < result[j].T
+	})
+	return result
 }
 
 // Velocity is a drum hit's volume.
@@ -0,0 +1,117 @@
+package beatnik
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEncode_annotations(t *testing.T) {
+	tr := &Track{
+		Hits: []*Hit{{Notes: map[byte]Velocity{38: F}, T: 96,
+			Annotations: map[string]string{"stick": "rim"}}},
+		BPM: 120,
+	}
+	event := []byte{0, 0xFF, MetaText, 9, 's', 't', 'i', 'c', 'k', '=', 'r', 'i', 'm'}
+
+	b, err := tr.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() failed: %v", err)
+	}
+	if bytes.Contains(b, event) {
+		t.Errorf("MarshalBinary()=%v, should not contain %v", b, event)
+	}
+
+	b, err = tr.Encode(&EncodeOptions{Annotations: true})
+	if err != nil {
+		t.Fatalf("Encode() failed: %v", err)
+	}
+	if !bytes.Contains(b, event) {
+		t.Errorf("Encode()=%v, should contain %v", b, event)
+	}
+}
+
+func TestWriteTo(t *testing.T) {
+	tr, err := ParseTrack(testTrack)
+	if err != nil {
+		t.Fatalf("ParseTrack(%v) failed: %v", testTrack, err)
+	}
+	want, err := tr.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() failed: %v", err)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	n, err := tr.WriteTo(buf)
+	if err != nil {
+		t.Fatalf("WriteTo() failed: %v", err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("WriteTo()=%v, want %v", n, buf.Len())
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("WriteTo() wrote %v, want %v", buf.Bytes(), want)
+	}
+}
+
+func TestWriteTo_badBPM(t *testing.T) {
+	tr := &Track{Hits: []*Hit{{Notes: map[byte]Velocity{38: F}, T: 96}}}
+	buf := bytes.NewBuffer(nil)
+	if n, err := tr.WriteTo(buf); err == nil {
+		t.Errorf("WriteTo()=%v, want failure", n)
+	}
+}
+
+func TestEncode_rests(t *testing.T) {
+	tr := &Track{
+		Hits: []*Hit{
+			{T: 96},
+			{Notes: map[byte]Velocity{38: F}, T: 48},
+			{T: 200},
+		},
+		BPM: 120,
+	}
+	b, err := tr.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() failed: %v", err)
+	}
+	want := []byte{96, 0x99, 38, F, 48, 0x89, 38, 64, 129, 72, 0xFF, 0x2F, 0}
+	if !bytes.HasSuffix(b, want) {
+		t.Errorf("MarshalBinary()=%v, want suffix %v", b, want)
+	}
+}
+
+func TestDuration(t *testing.T) {
+	tr, err := ParseTrack("bpm:120 K~~ S~~ K~")
+	if err != nil {
+		t.Fatalf("ParseTrack() failed: %v", err)
+	}
+	if got, want := tr.Duration(), 5*time.Second; got != want {
+		t.Errorf("Duration()=%v, want %v", got, want)
+	}
+	if got, want := tr.Bars(), 2.5; got != want {
+		t.Errorf("Bars()=%v, want %v", got, want)
+	}
+
+	tr.Meta = append(tr.Meta, tempoMeta(96*4, 60))
+	if got, want := tr.Duration(), 8*time.Second; got != want {
+		t.Errorf("Duration()=%v, want %v", got, want)
+	}
+
+	tr.TimeSig = TimeSig{5, 8}
+	if got, want := tr.Bars(), 4.0; got != want {
+		t.Errorf("Bars()=%v, want %v", got, want)
+	}
+}
+
+func TestNewHit(t *testing.T) {
+	got := NewHit(48, MF, 36, 42)
+	want := &Hit{Notes: map[byte]Velocity{36: MF, 42: MF}, T: 48}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("NewHit(48,MF,36,42)=%v, want %v", got, want)
+	}
+	if h := NewHit(96, F); !h.IsRest() {
+		t.Errorf("NewHit(96,F).IsRest()=false, want true")
+	}
+}
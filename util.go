@@ -5,23 +5,38 @@ package beatnik
 import (
 	"bytes"
 	"encoding/binary"
+	"io"
 )
 
 // uvarint returns a big-endian variable length int.
 func uvarint(x uint) []byte {
-	if x == 0 {
-		return []byte{0}
-	}
+	return appendUvarint(make([]byte, 0, uvarintLen(x)), x)
+}
 
-	b := make([]byte, binary.MaxVarintLen64)
-	i := len(b)
-	for x > 0 {
+// appendUvarint appends a big-endian variable length int to b.
+func appendUvarint(b []byte, x uint) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	i := len(buf) - 1
+	buf[i] = byte(x & 127)
+	for x >>= 7; x > 0; x >>= 7 {
 		i--
-		b[i] = byte(x&127) | 128
-		x >>= 7
+		buf[i] = byte(x&127) | 128
+	}
+	return append(b, buf[i:]...)
+}
+
+// uvarintLen returns the length of the variable length encoding of x.
+func uvarintLen(x uint) int {
+	n := 1
+	for x >>= 7; x > 0; x >>= 7 {
+		n++
 	}
-	b[len(b)-1] &= 127
-	return b[i:]
+	return n
+}
+
+// appendUint32 appends a big-endian 32-bit int to b.
+func appendUint32(b []byte, x uint32) []byte {
+	return append(b, byte(x>>24), byte(x>>16), byte(x>>8), byte(x))
 }
 
 // bin encodes a given value in big-endian binary. Returns a slice whose length
@@ -31,3 +46,21 @@ func bin(a interface{}) []byte {
 	binary.Write(buf, binary.BigEndian, a)
 	return buf.Bytes()
 }
+
+// countingWriter wraps a writer, counting the bytes written to it. After the
+// first error, subsequent writes are skipped and return that error.
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
@@ -16,6 +16,7 @@ func TestUvarint(t *testing.T) {
 		{128, []byte{129, 0}},
 		{129, []byte{129, 1}},
 		{130, []byte{129, 2}},
+		{1<<14 + 1, []byte{129, 128, 1}},
 	}
 
 	for _, test := range tests {
@@ -23,5 +24,8 @@ func TestUvarint(t *testing.T) {
 		if !reflect.DeepEqual(got, test.want) {
 			t.Errorf("uvarint(%v)=%v, want %v", test.in, got, test.want)
 		}
+		if got := uvarintLen(test.in); got != len(test.want) {
+			t.Errorf("uvarintLen(%v)=%v, want %v", test.in, got, len(test.want))
+		}
 	}
 }
@@ -0,0 +1,108 @@
+package beatnik
+
+// Validation of tracks before encoding.
+
+import (
+	"sort"
+	"strings"
+)
+
+// maxTicks is the largest delta time that midi can encode, which limits the
+// time between consecutive events in a midi track.
+const maxTicks = 0x0FFFFFFF
+
+// Validate checks that the track can be encoded as a valid midi file. Returns
+// all the problems found, or nil if there are none.
+func (t *Track) Validate() []error {
+	var errs []error
+	if len(t.TempoMap().changes) == 0 {
+		errs = append(errs, newError(CodeZeroBPM))
+	}
+	if t.TimeSig != (TimeSig{}) && !t.TimeSig.valid() {
+		errs = append(errs, newError(CodeBadTimeSig, t.TimeSig.String()))
+	}
+
+	return append(errs, t.validateHits()...)
+}
+
+// validateHits checks that the track's hits, meta and control events can be
+// encoded as valid midi events. Returns all the problems found, or nil if there
+// are none.
+func (t *Track) validateHits() []error {
+	var errs []error
+	var tick uint64
+	var hitTicks []uint64 // Of the events in the midi track of the hits.
+	for i, h := range t.Hits {
+		if h.T == 0 {
+			errs = append(errs, newError(CodeZeroDuration, i+1))
+		}
+		for n, v := range h.Notes {
+			if n == 0 || n > 127 {
+				errs = append(errs, newError(CodeBadNoteNumber, i+1, n))
+			}
+			if v == 0 || v > 127 {
+				errs = append(errs, newError(CodeBadVelocityValue, i+1, n, v))
+			}
+		}
+		if !h.IsRest() {
+			hitTicks = append(hitTicks, tick, tick+uint64(h.T))
+		}
+		tick += uint64(h.T)
+	}
+	hitTicks = append(hitTicks, tick)
+	metaTicks := []uint64{0}
+	for _, m := range t.Meta {
+		metaTicks = append(metaTicks, uint64(m.T))
+	}
+	for i, c := range t.Controls {
+		if c.Number > 127 || c.Value > 127 {
+			errs = append(errs, newError(CodeBadControl, i+1, c.Number, c.Value))
+		}
+		hitTicks = append(hitTicks, uint64(c.T))
+	}
+	for _, ticks := range [][]uint64{hitTicks, metaTicks} {
+		if gap := largestGap(ticks); gap > maxTicks {
+			errs = append(errs, newError(CodeTickOverflow, gap, maxTicks))
+		}
+	}
+	return errs
+}
+
+// largestGap returns the largest difference between consecutive ticks of the
+// given events, once they are sorted.
+func largestGap(ticks []uint64) uint64 {
+	sort.Slice(ticks, func(i, j int) bool {
+		return ticks[i] < ticks[j]
+	})
+	var result uint64
+	for i := 1; i < len(ticks); i++ {
+		if gap := ticks[i] - ticks[i-1]; gap > result {
+			result = gap
+		}
+	}
+	return result
+}
+
+// errorOf returns nil for no errors, the error itself for a single error, or
+// an ErrorList for several errors.
+func errorOf(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	return ErrorList(errs)
+}
+
+// An ErrorList is a list of errors that is itself an error.
+type ErrorList []error
+
+// Error returns the messages of all errors, separated by new lines.
+func (e ErrorList) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
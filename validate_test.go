@@ -0,0 +1,75 @@
+package beatnik
+
+import (
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tr, err := ParseTrack(testTrack)
+	if err != nil {
+		t.Fatalf("ParseTrack(%v) failed: %v", testTrack, err)
+	}
+	if errs := tr.Validate(); errs != nil {
+		t.Errorf("Validate()=%v, want nil", errs)
+	}
+}
+
+func TestValidate_tempoEvent(t *testing.T) {
+	tr := &Track{Meta: []*Meta{tempoMeta(0, 100)},
+		Hits: []*Hit{{Notes: map[byte]Velocity{36: F}, T: 96}}}
+	if errs := tr.Validate(); errs != nil {
+		t.Errorf("Validate()=%v, want nil", errs)
+	}
+}
+
+func TestValidate_bad(t *testing.T) {
+	tr := &Track{
+		Hits: []*Hit{
+			{Notes: map[byte]Velocity{36: F}, T: 0},
+			{Notes: map[byte]Velocity{0: F, 200: 0}, T: 96},
+			{Notes: map[byte]Velocity{38: F}, T: maxTicks + 1},
+		},
+		TimeSig: TimeSig{4, 3},
+	}
+	want := map[Code]int{
+		CodeZeroBPM:          1,
+		CodeBadTimeSig:       1,
+		CodeZeroDuration:     1,
+		CodeBadNoteNumber:    2,
+		CodeBadVelocityValue: 1,
+		CodeTickOverflow:     1,
+	}
+	got := map[Code]int{}
+	for _, err := range tr.Validate() {
+		got[err.(*Error).Code]++
+	}
+	for code, n := range want {
+		if got[code] != n {
+			t.Errorf("Validate() returned %v errors of %v, want %v",
+				got[code], code, n)
+		}
+	}
+
+	if b, err := tr.MarshalBinary(); err == nil {
+		t.Errorf("MarshalBinary()=%v, want failure", b)
+	}
+}
+
+func TestValidate_long(t *testing.T) {
+	k := map[byte]Velocity{36: F}
+	tr := &Track{BPM: 120, Hits: []*Hit{{Notes: k, T: maxTicks},
+		{Notes: k, T: maxTicks}, {Notes: k, T: 96}}}
+	if errs := tr.Validate(); errs != nil {
+		t.Errorf("Validate()=%v, want nil", errs)
+	}
+
+	tr.Hits = append(tr.Hits, &Hit{T: maxTicks}, &Hit{T: 1}, &Hit{Notes: k, T: 96})
+	if errs := tr.Validate(); len(errs) != 1 {
+		t.Errorf("Validate()=%v, want a gap of rests that is too long", errs)
+	}
+	tr.Hits = tr.Hits[:3]
+	tr.Meta = []*Meta{{maxTicks + 1, MetaMarker, []byte("x")}}
+	if errs := tr.Validate(); len(errs) != 1 {
+		t.Errorf("Validate()=%v, want a gap of meta events that is too long", errs)
+	}
+}
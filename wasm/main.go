@@ -0,0 +1,110 @@
+//go:build js && wasm
+// +build js,wasm
+
+// Command wasm compiles beatnik sources in the browser, for client-side
+// editors and playgrounds. It registers a global JavaScript function:
+//
+//	beatnikCompile(text, lang) -> {midi, diagnostics}
+//
+// midi is a Uint8Array with a standard midi file, or null if the source did
+// not compile, for playback with WebAudio or WebMIDI. diagnostics is an array
+// of {severity, code, line, col, message} objects, where severity is "error"
+// or "warning". lang is optional.
+//
+// Build it with:
+//
+//	GOOS=js GOARCH=wasm go build -o beatnik.wasm ./wasm
+//
+// and load it with the wasm_exec.js of the Go distribution.
+package main
+
+import (
+	"syscall/js"
+
+	"github.com/fluhus/beatnik"
+)
+
+// A Diagnostic is an error or a warning about the source.
+type Diagnostic struct {
+	Severity string // "error" or "warning".
+	Code     string // Kind of problem, empty if unknown.
+	Line     int    // 1-based line, 0 if unknown.
+	Col      int    // 1-based column in runes, 0 if unknown.
+	Message  string
+}
+
+func main() {
+	js.Global().Set("beatnikCompile", js.FuncOf(compileJS))
+	select {} // Keep serving calls.
+}
+
+// compileJS is the JavaScript binding of Compile.
+func compileJS(this js.Value, args []js.Value) interface{} {
+	text, lang := "", beatnik.DefaultLanguage
+	if len(args) > 0 && args[0].Type() == js.TypeString {
+		text = args[0].String()
+	}
+	if len(args) > 1 && args[1].Type() == js.TypeString {
+		lang = args[1].String()
+	}
+
+	midi, diags := compile(text, lang)
+	result := map[string]interface{}{"midi": nil}
+	if midi != nil {
+		arr := js.Global().Get("Uint8Array").New(len(midi))
+		js.CopyBytesToJS(arr, midi)
+		result["midi"] = arr
+	}
+	var jsDiags []interface{}
+	for _, d := range diags {
+		jsDiags = append(jsDiags, map[string]interface{}{
+			"severity": d.Severity, "code": d.Code, "line": d.Line,
+			"col": d.Col, "message": d.Message})
+	}
+	result["diagnostics"] = jsDiags
+	return result
+}
+
+// Compile returns the midi file of the given source, or nil if it does not
+// compile, and its diagnostics in English. Sources cannot include files, and
+// are parsed within the limits of a sandbox.
+func Compile(text string) ([]byte, []Diagnostic) {
+	return compile(text, beatnik.DefaultLanguage)
+}
+
+// compile is Compile with messages in the given language.
+func compile(text, lang string) ([]byte, []Diagnostic) {
+	var diags []Diagnostic
+	add := func(severity string, err error) {
+		d := Diagnostic{Severity: severity}
+		if e, ok := err.(*beatnik.Error); ok {
+			e2 := *e
+			e2.File, e2.Line = "", 0
+			d.Code, d.Line, d.Col = string(e.Code), e.Line, e.Col
+			d.Message = e2.Localize(lang)
+		} else {
+			d.Message = beatnik.Localize(err, lang)
+		}
+		diags = append(diags, d)
+	}
+
+	t, err := (&beatnik.Sandbox{}).ParseTrack(text)
+	var midi []byte
+	if err == nil {
+		midi, err = t.MarshalBinary()
+	}
+	if err != nil {
+		errs := []error{err}
+		if list, ok := err.(beatnik.ErrorList); ok {
+			errs = list
+		}
+		for _, err := range errs {
+			add("error", err)
+		}
+		return nil, diags
+	}
+	for _, d := range beatnik.Lint(t, text) {
+		add("warning", d.Error)
+	}
+	return midi, diags
+}